@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// The operations on pods that users are remembered for.
+const (
+	actorCreate = "create"
+	actorUpdate = "update"
+	actorDelete = "delete"
+)
+
+// actorTTLs are how long the user who created, updated or deleted a pod is kept for the pod's event, in case the watcher never sees the change.
+// Updates are kept for less time, as an update that changes nothing has no event.
+var actorTTLs = map[string]time.Duration{
+	actorCreate: time.Hour,
+	actorUpdate: time.Minute,
+	actorDelete: time.Hour,
+}
+
+// actorKey identifies a pod that a user created, updated or deleted. Pods created with generateName are identified by their generateName and a trailing "*".
+type actorKey struct {
+	cluster   string
+	operation string
+	namespace string
+	name      string
+}
+
+// actor is a user who changed a pod.
+type actor struct {
+	user string
+	time time.Time
+}
+
+// actorTracker remembers the users who changed pods, from the admission webhook and the audit log, so that the events of their pods say who changed them, which watch events never do.
+type actorTracker struct {
+	mu     sync.Mutex
+	actors map[actorKey][]actor
+}
+
+// actors is set by -admission-addr, -audit-addr and -audit-log.
+var actors *actorTracker
+
+// newActorTracker creates an actorTracker.
+func newActorTracker() *actorTracker {
+	return &actorTracker{actors: make(map[actorKey][]actor)}
+}
+
+// observe remembers the user who changed a pod, forgetting the users that have been kept for too long.
+// An empty cluster matches the pods of every cluster.
+func (t *actorTracker) observe(cluster, operation, namespace, name, user string) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, list := range t.actors {
+		for len(list) > 0 && now.Sub(list[0].time) > actorTTLs[key.operation] {
+			list = list[1:]
+		}
+		if len(list) == 0 {
+			delete(t.actors, key)
+		} else {
+			t.actors[key] = list
+		}
+	}
+	key := actorKey{cluster: cluster, operation: operation, namespace: namespace, name: name}
+	t.actors[key] = append(t.actors[key], actor{user: user, time: now})
+}
+
+// take returns the user who created, updated or deleted a pod, or an empty string if it is not known, and forgets them.
+// A created pod that was named by generateName is matched to the oldest request with its generateName.
+func (t *actorTracker) take(cluster, operation string, pod *v1.Pod) string {
+	names := []string{pod.Name}
+	if operation == actorCreate && pod.GenerateName != "" {
+		names = append(names, pod.GenerateName+"*")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range []string{cluster, ""} {
+		for _, name := range names {
+			key := actorKey{cluster: c, operation: operation, namespace: pod.Namespace, name: name}
+			list := t.actors[key]
+			if len(list) == 0 {
+				continue
+			}
+			if len(list) == 1 {
+				delete(t.actors, key)
+			} else {
+				t.actors[key] = list[1:]
+			}
+			return list[0].user
+		}
+	}
+	return ""
+}
+
+// byUser adds the user who changed a pod to an event's message, e.g. "by alice" or "evicted (by system:serviceaccount:kube-system:node-controller)".
+func byUser(message, user string) string {
+	switch {
+	case user == "":
+		return message
+	case message == "":
+		return "by " + user
+	}
+	return message + " (by " + user + ")"
+}
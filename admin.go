@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// eventStats counts the events published to the bus.
+type eventStats struct {
+	mu     sync.Mutex
+	counts map[eventType]int64
+	last   time.Time
+}
+
+// stats holds the counts for all events published to the bus.
+var stats = &eventStats{counts: make(map[eventType]int64)}
+
+// record counts an event.
+func (s *eventStats) record(e event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[e.Type]++
+	s.last = e.Time
+}
+
+// backlogger is implemented by sinks that queue events before delivering them.
+type backlogger interface {
+	backlog() int
+}
+
+// sinkStats is the backlog of a single sink, and the number of events it has dropped because its queue was full.
+type sinkStats struct {
+	Sink    string `json:"sink"`
+	Backlog int    `json:"backlog"`
+	Dropped int64  `json:"dropped"`
+}
+
+// adminStats is the response of the /stats admin endpoint.
+type adminStats struct {
+	PodsByNamespace map[string]int      `json:"podsByNamespace"`
+	Events          map[eventType]int64 `json:"events"`
+	LastEvent       *time.Time          `json:"lastEvent,omitempty"`
+	Queued          int                 `json:"queued"`
+	Sinks           []sinkStats         `json:"sinks"`
+	Namespaces      []shardStatus       `json:"namespaces"`
+	Clusters        []clusterStatus     `json:"clusters"`
+	Leader          *bool               `json:"leader,omitempty"`
+}
+
+// collectStats gathers the current statistics from the cache, the event counts and the bus.
+func collectStats(store cache.Store) adminStats {
+	a := adminStats{
+		PodsByNamespace: make(map[string]int),
+		Events:          make(map[eventType]int64),
+		Queued:          len(events.events),
+		Sinks:           []sinkStats{},
+		Namespaces:      []shardStatus{},
+		Clusters:        []clusterStatus{},
+	}
+	for _, s := range watchedClusters.shards() {
+		a.Namespaces = append(a.Namespaces, s.status())
+	}
+	for _, c := range watchedClusters.list() {
+		a.Clusters = append(a.Clusters, c.status())
+	}
+	if leadership != nil {
+		leading := leadership.leading()
+		a.Leader = &leading
+	}
+	for _, obj := range store.List() {
+		a.PodsByNamespace[obj.(*v1.Pod).Namespace]++
+	}
+
+	stats.mu.Lock()
+	for t, n := range stats.counts {
+		a.Events[t] = n
+	}
+	if !stats.last.IsZero() {
+		last := stats.last
+		a.LastEvent = &last
+	}
+	stats.mu.Unlock()
+
+	for _, r := range events.currentRoutes() {
+		s := sinkStats{Sink: r.name}
+		if b, ok := r.sink.(backlogger); ok {
+			s.Backlog = b.backlog()
+		}
+		if r.queue != nil {
+			s.Backlog += r.queue.backlog()
+			s.Dropped = r.queue.droppedCount()
+		}
+		a.Sinks = append(a.Sinks, s)
+	}
+	return a
+}
+
+// registerAdmin adds the admin endpoints to a mux.
+// GET /stats returns the current statistics as JSON.
+// GET /snapshot returns the pods in the cache as YAML, or as JSON with ?format=json.
+func registerAdmin(mux *http.ServeMux, store cache.Store) {
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, collectStats(store))
+	})
+	mux.HandleFunc("/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		format := snapshotFormat(r.URL.Query().Get("format"))
+		w.Header().Set("Content-Type", "application/"+format)
+		writeSnapshot(w, store, format)
+	})
+}
+
+// listen listens on a TCP address (host:port) or, if the address starts with "unix:", a Unix domain socket.
+// A stale socket file from a previous run is removed first.
+func listen(addr string) (net.Listener, error) {
+	if path := strings.TrimPrefix(addr, "unix:"); path != addr {
+		os.Remove(path)
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// admissionBodyLimit is the largest AdmissionReview that the admission webhook reads.
+const admissionBodyLimit = 4 << 20
+
+// admissionOperations are the admission operations on pods whose users are remembered.
+var admissionOperations = map[admissionv1.Operation]string{
+	admissionv1.Create: actorCreate,
+	admissionv1.Delete: actorDelete,
+}
+
+// admissionHandler handles an AdmissionReview from the API server, allowing the request and remembering who created or deleted the pod.
+// The webhook only observes: every request is allowed.
+// The cluster is given by the cluster query parameter of the webhook's URL, as the API server does not say which cluster it is in.
+func admissionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var review admissionv1.AdmissionReview
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, admissionBodyLimit)).Decode(&review); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(w, "AdmissionReview has no request", http.StatusBadRequest)
+		return
+	}
+	observeAdmission(r.URL.Query().Get("cluster"), review.Request)
+
+	review.Response = &admissionv1.AdmissionResponse{UID: review.Request.UID, Allowed: true}
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&review); err != nil {
+		log.Printf("Admission error: %v\n", err)
+	}
+}
+
+// observeAdmission logs and remembers the user in a request to create or delete a pod. Dry runs and other requests are ignored.
+func observeAdmission(cluster string, req *admissionv1.AdmissionRequest) {
+	operation, ok := admissionOperations[req.Operation]
+	if !ok || req.Kind.Kind != "Pod" || req.SubResource != "" || (req.DryRun != nil && *req.DryRun) {
+		return
+	}
+	name := req.Name
+	if name == "" && req.Operation == admissionv1.Create {
+		var pod v1.Pod
+		if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+			log.Printf("%sAdmission error: %v\n", clusterPrefix(cluster), err)
+			return
+		}
+		name = pod.Name
+		if name == "" && pod.GenerateName != "" {
+			name = pod.GenerateName + "*"
+		}
+	}
+	user := req.UserInfo.Username
+	log.Printf("%sAdmission: %s pod %s/%s by %s\n", clusterPrefix(cluster), strings.ToLower(string(req.Operation)), req.Namespace, name, user)
+	actors.observe(cluster, operation, req.Namespace, name, user)
+}
+
+// serveAdmission serves the admission webhook with TLS, as the API server only calls webhooks over HTTPS.
+// The audit webhook is served on the same server if its clients are authenticated, for API servers that are configured to send audit events over HTTPS.
+// The server asks for client certificates from -tls-client-ca-file without requiring them, so that the API server can still call the admission webhook without one.
+func serveAdmission(addr, certFile, keyFile string, auth *serverAuth) error {
+	if certFile == "" || keyFile == "" {
+		return fmt.Errorf("-admission-addr needs -admission-tls-cert and -admission-tls-key")
+	}
+	server := &http.Server{Addr: addr, Handler: admissionMux(auth)}
+	if auth != nil && auth.tls != nil && auth.tls.ClientCAs != nil {
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, ClientCAs: auth.tls.ClientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+	}
+	go func() {
+		log.Fatal(server.ListenAndServeTLS(certFile, keyFile))
+	}()
+	return nil
+}
+
+// admissionMux returns the handlers of the admission webhook's server.
+func admissionMux(auth *serverAuth) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/validate", admissionHandler)
+	if auth.authenticatesClients() {
+		mux.Handle("/audit", auditWebhook(auth))
+	}
+	return mux
+}
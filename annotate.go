@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// firstReadyAnnotation is the time that a pod first became ready.
+	firstReadyAnnotation = "pod-event-watcher/first-ready-at"
+	// restartCountAnnotation is the number of times that a pod's containers have restarted.
+	restartCountAnnotation = "pod-event-watcher/restart-count"
+	// annotateTimeout is how long each patch of a pod's annotations may take.
+	annotateTimeout = 10 * time.Second
+)
+
+// podAnnotator writes what the watcher has found out about each pod back to the pod as annotations, for other tools to read.
+// A pod is only patched when its annotations differ from these values, so the update caused by a patch does not cause another.
+type podAnnotator struct {
+	mu sync.Mutex
+	// sent is the annotations last sent for each pod, so that a pod is not patched again with the same values before the first patch has been seen.
+	sent     map[types.UID]map[string]string
+	clusters map[types.UID]string // UID -> cluster.
+}
+
+// annotationPaths are the paths of the annotations, which are left out of the differences.
+var annotationPaths, _ = watcher.ParsePaths(`metadata.annotations["` + firstReadyAnnotation + `"],metadata.annotations["` + restartCountAnnotation + `"]`)
+
+// annotations writes annotations to the pods if enabled with the -annotate-pods flag, and is otherwise nil.
+var annotations *podAnnotator
+
+// newPodAnnotator creates a podAnnotator.
+func newPodAnnotator() *podAnnotator {
+	return &podAnnotator{sent: make(map[types.UID]map[string]string), clusters: make(map[types.UID]string)}
+}
+
+// observe patches a pod in the background if its annotations are out of date.
+// The clientset of the pod's cluster is taken from the context of the pod handler.
+func (a *podAnnotator) observe(ctx context.Context, pod *v1.Pod) {
+	c, ok := ctx.Value(clusterKey{}).(*cluster)
+	if !ok || pod.DeletionTimestamp != nil {
+		return
+	}
+	changed := podAnnotations(pod)
+	a.mu.Lock()
+	sent := a.sent[pod.UID]
+	for k, v := range changed {
+		if pod.Annotations[k] == v || sent[k] == v {
+			delete(changed, k)
+		}
+	}
+	if len(changed) == 0 {
+		a.mu.Unlock()
+		return
+	}
+	if sent == nil {
+		sent = make(map[string]string)
+		a.sent[pod.UID] = sent
+		a.clusters[pod.UID] = c.name
+	}
+	for k, v := range changed {
+		sent[k] = v
+	}
+	a.mu.Unlock()
+
+	go func() {
+		patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": changed}})
+		if err != nil {
+			log.Printf("%sAnnotation error (%s/%s): %v\n", clusterPrefix(c.name), pod.Namespace, pod.Name, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), annotateTimeout)
+		defer cancel()
+		_, err = c.clientset.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: "pod-event-watcher"})
+		if err != nil {
+			log.Printf("%sAnnotation error (%s/%s): %v\n", clusterPrefix(c.name), pod.Namespace, pod.Name, err)
+			// The patch is sent again with the pod's next update.
+			a.mu.Lock()
+			for k := range changed {
+				delete(a.sent[pod.UID], k)
+			}
+			a.mu.Unlock()
+		}
+	}()
+}
+
+// forget removes a deleted pod.
+func (a *podAnnotator) forget(pod *v1.Pod) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sent, pod.UID)
+	delete(a.clusters, pod.UID)
+}
+
+// forgetCluster removes the pods of a cluster that is no longer watched.
+func (a *podAnnotator) forgetCluster(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for uid, cluster := range a.clusters {
+		if cluster == name {
+			delete(a.sent, uid)
+			delete(a.clusters, uid)
+		}
+	}
+}
+
+// podAnnotations returns the annotations that a pod should have.
+// The first ready time is kept once it has been written, as the Ready condition's transition time moves each time the pod becomes ready again.
+// Pods from -metadata-only have no status, so they are given no annotations.
+func podAnnotations(pod *v1.Pod) map[string]string {
+	values := make(map[string]string)
+	if pod.Status.Phase == "" {
+		return values
+	}
+	if c := podCondition(pod, v1.PodReady); c != nil && c.Status == v1.ConditionTrue && pod.Annotations[firstReadyAnnotation] == "" {
+		values[firstReadyAnnotation] = c.LastTransitionTime.UTC().Format(time.RFC3339)
+	}
+	values[restartCountAnnotation] = strconv.Itoa(int(restartCount(pod)))
+	return values
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// anomalyAlpha is the weight of each interval in the moving averages. Lower values make the baseline change more slowly.
+	anomalyAlpha = 0.1
+	// anomalyWarmUp is the number of intervals of history needed before anomalies are reported, so that there is a baseline.
+	anomalyWarmUp = 10
+	// anomalyMinimum is the smallest number of events in an interval that can be an anomaly, so that quiet workloads do not cause warnings about a handful of events.
+	anomalyMinimum = 5
+)
+
+// anomalyTypes are the event types whose rates are tracked.
+var anomalyTypes = []eventType{eventCreated, eventDeleted, eventContainerRestarted}
+
+// anomalyKey identifies a rate of events of one type for a workload.
+type anomalyKey struct {
+	cluster   string
+	namespace string
+	workload  string
+	eventType eventType
+}
+
+// ewma is an exponentially weighted moving average and variance of the number of events per interval.
+type ewma struct {
+	intervals int
+	mean      float64
+	variance  float64
+}
+
+// add updates the averages with the number of events in an interval.
+func (a *ewma) add(x float64) {
+	if a.intervals == 0 {
+		a.mean = x
+	} else {
+		diff := x - a.mean
+		incr := anomalyAlpha * diff
+		a.mean += incr
+		a.variance = (1 - anomalyAlpha) * (a.variance + diff*incr)
+	}
+	a.intervals++
+}
+
+// anomalyTracker keeps a baseline of the rate of each type of event for each workload, and warns when a rate is far above its baseline, such as a storm of deletions or a spike in restarts.
+// Unlike -rate-threshold, no threshold has to be chosen, as each workload is compared with its own history.
+type anomalyTracker struct {
+	interval    time.Duration
+	sensitivity float64
+	started     time.Time
+
+	mu        sync.Mutex
+	counts    map[anomalyKey]int
+	baselines map[anomalyKey]*ewma
+}
+
+// anomalies tracks the rates of events if enabled with the -anomaly-interval flag, and is otherwise nil.
+var anomalies *anomalyTracker
+
+// newAnomalyTracker creates an anomaly tracker and starts checking the rates every interval.
+func newAnomalyTracker(interval time.Duration, sensitivity float64) *anomalyTracker {
+	a := &anomalyTracker{
+		interval:    interval,
+		sensitivity: sensitivity,
+		started:     time.Now(),
+		counts:      make(map[anomalyKey]int),
+		baselines:   make(map[anomalyKey]*ewma),
+	}
+	go a.run()
+	return a
+}
+
+// observe counts an event.
+func (a *anomalyTracker) observe(e event) {
+	if e.Pod == nil || !containsEventType(anomalyTypes, e.Type) {
+		return
+	}
+	// Pods that existed before the watcher started are "created" when they are first added to the cache.
+	if e.Type == eventCreated && e.Pod.CreationTimestamp.Time.Before(a.started) {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.counts[anomalyKey{e.cluster(), e.Namespace, metricWorkload(e.Pod), e.Type}]++
+}
+
+// forgetCluster removes the counts and baselines of the workloads of a cluster that is no longer watched.
+func (a *anomalyTracker) forgetCluster(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key := range a.counts {
+		if key.cluster == name {
+			delete(a.counts, key)
+		}
+	}
+	for key := range a.baselines {
+		if key.cluster == name {
+			delete(a.baselines, key)
+		}
+	}
+}
+
+// run checks the rates at the end of each interval.
+func (a *anomalyTracker) run() {
+	for now := range time.Tick(a.interval) {
+		for _, e := range a.check(now) {
+			publish(e)
+		}
+	}
+}
+
+// check returns an event for each rate in the last interval that was far above its baseline, and adds the interval to the baselines.
+func (a *anomalyTracker) check(now time.Time) []event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var warnings []event
+	for key := range a.counts {
+		if _, ok := a.baselines[key]; !ok {
+			a.baselines[key] = &ewma{}
+		}
+	}
+	for key, baseline := range a.baselines {
+		n := a.counts[key]
+		stddev := math.Sqrt(baseline.variance)
+		if baseline.intervals >= anomalyWarmUp && n >= anomalyMinimum && float64(n) > baseline.mean+a.sensitivity*stddev {
+			subject := key.workload
+			if subject == "none" {
+				subject = "pods without a controller"
+			}
+			warnings = append(warnings, event{
+				Cluster:   key.cluster,
+				Type:      eventAnomaly,
+				Time:      now,
+				Namespace: key.namespace,
+				Message:   fmt.Sprintf("%s: %d %s events in the last %s, usually %.1f (±%.1f)", subject, n, key.eventType, a.interval, baseline.mean, stddev),
+				ctx:       clusterContext(key.cluster),
+			})
+		}
+		baseline.add(float64(n))
+		// Forget workloads that have been quiet for long enough, so that deleted workloads do not use memory forever.
+		if n == 0 && baseline.mean < 0.01 {
+			delete(a.baselines, key)
+		}
+	}
+	a.counts = make(map[anomalyKey]int)
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i].Message < warnings[j].Message })
+	return warnings
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAnomalyPerCluster(t *testing.T) {
+	a := &anomalyTracker{interval: time.Minute, sensitivity: 3, started: time.Now().Add(-time.Hour), counts: make(map[anomalyKey]int), baselines: make(map[anomalyKey]*ewma)}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", CreationTimestamp: metav1.Now()}}
+	now := time.Now()
+	// Both clusters have one deletion per interval, then prod has a storm of them.
+	for i := 0; i < anomalyWarmUp; i++ {
+		for _, cluster := range []string{"prod", "staging"} {
+			a.observe(clusterEvent(cluster, eventDeleted, pod))
+		}
+		if warnings := a.check(now); len(warnings) > 0 {
+			t.Fatalf("got %v while warming up", summaries(warnings))
+		}
+	}
+	for i := 0; i < 2*anomalyMinimum; i++ {
+		a.observe(clusterEvent("prod", eventDeleted, pod))
+	}
+	a.observe(clusterEvent("staging", eventDeleted, pod))
+	warnings := a.check(now)
+	if len(warnings) != 1 || warnings[0].Cluster != "prod" {
+		t.Fatalf("got %v, want one anomaly in prod", summaries(warnings))
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// apiDefaultLimit is the number of items in a page of results when the limit parameter is not given.
+	apiDefaultLimit = 100
+	// apiMaxLimit is the largest page of results that can be requested.
+	apiMaxLimit = 1000
+)
+
+// apiList is a page of results from the API. If there are more results, they are returned by repeating the request with the continue parameter.
+type apiList struct {
+	Items    interface{} `json:"items"`
+	Continue string      `json:"continue,omitempty"`
+}
+
+// registerAPI adds the query API to a mux.
+// GET /api/pods lists the pods in the cache, filtered by the namespace, selector, phase and node parameters.
+// GET /api/pods/{namespace}/{name} returns a single pod from the cache.
+// GET /api/events lists the events in the history store, filtered by the since, until, type, namespace and pod parameters.
+// GET /api/summary returns the number of pods and events of each workload in each namespace of each cluster.
+// GET /api/sinks/{name} returns the counts of the deliveries to a memory sink, and GET /api/sinks/{name}/events lists the events it has kept, filtered by the same parameters as /api/events.
+// The lists are paginated with the limit and continue parameters, in the same way as the Kubernetes API.
+func registerAPI(mux *http.ServeMux, store cache.Store, history historyStore) {
+	mux.HandleFunc("/api/pods", func(w http.ResponseWriter, r *http.Request) {
+		if !apiMethod(w, r) {
+			return
+		}
+		q, err := parsePodQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pods, next, err := listPods(store, q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, apiList{Items: pods, Continue: next})
+	})
+	mux.HandleFunc("/api/pods/", func(w http.ResponseWriter, r *http.Request) {
+		if !apiMethod(w, r) {
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/api/pods/")
+		if strings.Count(key, "/") != 1 {
+			http.NotFound(w, r)
+			return
+		}
+		obj, exists, err := store.GetByKey(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, fmt.Sprintf("pod %s not found", key), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, fullPod(obj.(*v1.Pod)))
+	})
+	mux.HandleFunc("/api/summary", func(w http.ResponseWriter, r *http.Request) {
+		if !apiMethod(w, r) {
+			return
+		}
+		writeJSON(w, fleet.summarize(watchedClusters.list(), false))
+	})
+	mux.HandleFunc("/api/sinks/", func(w http.ResponseWriter, r *http.Request) {
+		if !apiMethod(w, r) {
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/api/sinks/")
+		name, listEvents := strings.CutSuffix(name, "/events")
+		s := memorySinkNamed(name)
+		if s == nil {
+			http.Error(w, fmt.Sprintf("no memory sink named %q", name), http.StatusNotFound)
+			return
+		}
+		if !listEvents {
+			writeJSON(w, s.Stats())
+			return
+		}
+		q, err := parseEventQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		results, next, err := s.Query(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if results == nil {
+			results = []event{}
+		}
+		writeJSON(w, apiList{Items: results, Continue: next})
+	})
+	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		if !apiMethod(w, r) {
+			return
+		}
+		if history == nil {
+			http.Error(w, "no history store; start the watcher with -store", http.StatusNotFound)
+			return
+		}
+		q, err := parseEventQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		results, next, err := history.Query(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if results == nil {
+			results = []event{}
+		}
+		writeJSON(w, apiList{Items: results, Continue: next})
+	})
+}
+
+// apiMethod reports whether the request is a GET, responding with an error if it is not.
+func apiMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// writeJSON writes a response as indented JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// podQuery selects pods from the cache. Zero values match everything.
+type podQuery struct {
+	Namespace string
+	Selector  string
+	Phase     string
+	Node      string
+	// Limit is the maximum number of pods returned.
+	Limit int
+	// Continue is the token returned with the previous page of results, which is the key of the last pod.
+	Continue string
+}
+
+// parsePodQuery converts the query parameters of /api/pods to a query for the cache.
+func parsePodQuery(params url.Values) (podQuery, error) {
+	q := podQuery{
+		Namespace: params.Get("namespace"),
+		Selector:  params.Get("selector"),
+		Phase:     params.Get("phase"),
+		Node:      params.Get("node"),
+		Continue:  params.Get("continue"),
+	}
+	var err error
+	q.Limit, err = parseLimit(params.Get("limit"))
+	return q, err
+}
+
+// listPods returns a page of the pods in the cache matching the query, in order of namespace and name, and a token for fetching the next page, which is empty if there are no more pods.
+func listPods(store cache.Store, q podQuery) ([]*v1.Pod, string, error) {
+	selector, err := labels.Parse(q.Selector)
+	if err != nil {
+		return nil, "", err
+	}
+	pods := []*v1.Pod{}
+	for _, obj := range store.List() {
+		pod := obj.(*v1.Pod)
+		switch {
+		case q.Namespace != "" && pod.Namespace != q.Namespace,
+			q.Phase != "" && !strings.EqualFold(string(pod.Status.Phase), q.Phase),
+			q.Node != "" && pod.Spec.NodeName != q.Node,
+			!selector.Matches(labels.Set(pod.Labels)),
+			q.Continue != "" && pod.Namespace+"/"+pod.Name <= q.Continue:
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Namespace+"/"+pods[i].Name < pods[j].Namespace+"/"+pods[j].Name
+	})
+
+	if q.Limit > 0 && len(pods) > q.Limit {
+		last := pods[q.Limit-1]
+		return pods[:q.Limit], last.Namespace + "/" + last.Name, nil
+	}
+	return pods, "", nil
+}
+
+// parseEventQuery converts the query parameters of /api/events to a query for the history store.
+func parseEventQuery(params url.Values) (eventQuery, error) {
+	q := eventQuery{
+		Cluster:   params.Get("cluster"),
+		Namespace: params.Get("namespace"),
+		Pod:       params.Get("pod"),
+		Continue:  params.Get("continue"),
+	}
+	var err error
+	if q.Limit, err = parseLimit(params.Get("limit")); err != nil {
+		return q, err
+	}
+	if q.Since, err = parseTime(params.Get("since")); err != nil {
+		return q, err
+	}
+	if q.Until, err = parseTime(params.Get("until")); err != nil {
+		return q, err
+	}
+	for _, t := range splitList(params.Get("type")) {
+		if !validEventType(eventType(t)) {
+			return q, fmt.Errorf("unknown event type %q", t)
+		}
+		q.Types = append(q.Types, eventType(t))
+	}
+	return q, nil
+}
+
+// filterParams creates a filter for a subscription from the events, namespaces, selector and severity query parameters, e.g. ?events=created,deleted&namespaces=production or ?severity=critical.
+func filterParams(params url.Values) (filter, error) {
+	f, err := parseFilter(splitList(params.Get("events")), splitList(params.Get("namespaces")), params.Get("selector"))
+	if err != nil {
+		return filter{}, err
+	}
+	if f.Severity = severity(params.Get("severity")); f.Severity != "" && !validSeverity(f.Severity) {
+		return filter{}, fmt.Errorf("unknown severity %q", f.Severity)
+	}
+	return f, nil
+}
+
+// parseLimit parses the limit parameter.
+func parseLimit(s string) (int, error) {
+	if s == "" {
+		return apiLimit(0), nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid limit %q", s)
+	}
+	return apiLimit(n), nil
+}
+
+// apiLimit returns the number of results in a page for a requested limit, which defaults to apiDefaultLimit and cannot be more than apiMaxLimit.
+func apiLimit(n int) int {
+	switch {
+	case n <= 0:
+		return apiDefaultLimit
+	case n > apiMaxLimit:
+		return apiMaxLimit
+	}
+	return n
+}
+
+// parseTime parses a time parameter, which is either an RFC 3339 time such as "2024-01-31T12:00:00Z" or a duration before now such as "1h".
+// An empty parameter is the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use an RFC 3339 time or a duration", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// apiPage is a page of results from the API, with the items left to be decoded.
+type apiPage struct {
+	Items    []json.RawMessage `json:"items"`
+	Continue string            `json:"continue"`
+}
+
+// getAPI requests a path from the API, returning the status and decoding a successful response into v.
+func getAPI(t *testing.T, mux *http.ServeMux, path string, v interface{}) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code
+}
+
+// allPages follows the continue tokens from a path, returning the names of the items of each page, which are decoded into item.
+func allPages(t *testing.T, mux *http.ServeMux, path string, item interface{}, name func() string) [][]string {
+	t.Helper()
+	var pages [][]string
+	token := ""
+	for {
+		var page apiPage
+		if status := getAPI(t, mux, path+"&continue="+token, &page); status != http.StatusOK {
+			t.Fatalf("got status %d for %s", status, path)
+		}
+		var names []string
+		for _, data := range page.Items {
+			if err := json.Unmarshal(data, item); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, name())
+		}
+		pages = append(pages, names)
+		if token = page.Continue; token == "" || len(pages) > 10 {
+			return pages
+		}
+	}
+}
+
+func TestAPIPodsPagination(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, key := range [][2]string{{"web", "b"}, {"api", "x"}, {"web", "a"}, {"web", "c"}, {"api", "y"}} {
+		store.Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: key[0], Name: key[1]}})
+	}
+	mux := http.NewServeMux()
+	registerAPI(mux, store, nil)
+	var pod v1.Pod
+	name := func() string { return pod.Namespace + "/" + pod.Name }
+
+	tests := []struct {
+		path string
+		want [][]string
+	}{
+		{"/api/pods?limit=2", [][]string{{"api/x", "api/y"}, {"web/a", "web/b"}, {"web/c"}}},
+		{"/api/pods?limit=5", [][]string{{"api/x", "api/y", "web/a", "web/b", "web/c"}}},
+		{"/api/pods?namespace=web&limit=2", [][]string{{"web/a", "web/b"}, {"web/c"}}},
+		{"/api/pods?namespace=web&limit=3", [][]string{{"web/a", "web/b", "web/c"}}},
+		{"/api/pods?namespace=default", [][]string{nil}},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if got := allPages(t, mux, test.path, &pod, name); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got pages %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAPIEventsPagination(t *testing.T) {
+	s, err := openSQLiteStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	start := time.Now().Add(-time.Hour)
+	for i := 1; i <= 5; i++ {
+		e := event{Type: eventCreated, Time: start.Add(time.Duration(i) * time.Minute), Namespace: "default", Message: fmt.Sprintf("event %d", i)}
+		if i%2 == 0 {
+			e.Type = eventDeleted
+		}
+		if err := s.Send(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	registerAPI(mux, nil, s)
+	var e event
+	message := func() string { return e.Message }
+
+	tests := []struct {
+		path string
+		want [][]string
+	}{
+		{"/api/events?limit=2", [][]string{{"event 1", "event 2"}, {"event 3", "event 4"}, {"event 5"}}},
+		{"/api/events?limit=5", [][]string{{"event 1", "event 2", "event 3", "event 4", "event 5"}}},
+		{"/api/events?type=created&limit=2", [][]string{{"event 1", "event 3"}, {"event 5"}}},
+		{"/api/events?type=deleted&limit=1", [][]string{{"event 2"}, {"event 4"}}},
+		{"/api/events?namespace=production", [][]string{nil}},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if got := allPages(t, mux, test.path, &e, message); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got pages %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAPILimit(t *testing.T) {
+	tests := []struct {
+		limit string
+		want  int // The page size, or zero if the limit is invalid.
+	}{
+		{"", apiDefaultLimit},
+		{"1", 1},
+		{"250", 250},
+		{"5000", apiMaxLimit},
+		{"0", 0},
+		{"-1", 0},
+		{"ten", 0},
+	}
+	mux := http.NewServeMux()
+	registerAPI(mux, cache.NewStore(cache.MetaNamespaceKeyFunc), nil)
+	for _, test := range tests {
+		t.Run(test.limit, func(t *testing.T) {
+			got, err := parseLimit(test.limit)
+			if test.want == 0 {
+				if err == nil {
+					t.Errorf("got limit %d, want an error", got)
+				}
+				if status := getAPI(t, mux, "/api/pods?limit="+test.limit, nil); status != http.StatusBadRequest {
+					t.Errorf("got status %d, want 400", status)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("got %d, %v, want %d", got, err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// archiveMaxBatch is the compressed size of a batch that triggers an upload before the interval has passed.
+	archiveMaxBatch = 32 * 1024 * 1024
+	// archiveMaxFailed is the number of failed batches kept for retrying. When there are more, the oldest is dropped.
+	archiveMaxFailed = 24
+)
+
+// archiveBatch is a batch of events compressed as gzipped JSON lines.
+type archiveBatch struct {
+	start time.Time
+	buf   bytes.Buffer
+	gz    *gzip.Writer
+	count int
+}
+
+// newArchiveBatch starts a new batch.
+func newArchiveBatch() *archiveBatch {
+	b := &archiveBatch{start: time.Now().UTC()}
+	b.gz = gzip.NewWriter(&b.buf)
+	return b
+}
+
+// key returns the object key of the batch.
+func (b *archiveBatch) key(prefix string) string {
+	return partitionKey(prefix, b.start, "jsonl.gz")
+}
+
+// partitionKey returns the key of a batch of events started at a time, partitioned by date so that it can be queried by tools such as Athena, e.g. "prefix/date=2024-01-31/events-20240131T120000Z.jsonl.gz".
+func partitionKey(prefix string, start time.Time, ext string) string {
+	key := fmt.Sprintf("date=%s/events-%s.%s", start.Format("2006-01-02"), start.Format("20060102T150405Z"), ext)
+	if prefix != "" {
+		key = strings.TrimSuffix(prefix, "/") + "/" + key
+	}
+	return key
+}
+
+// archiveSink uploads batches of events to an S3-compatible bucket (AWS S3, Google Cloud Storage, MinIO...).
+// A batch is uploaded every interval, or sooner if it gets too big. Failed uploads are retried with the next batch.
+type archiveSink struct {
+	client *minio.Client
+	bucket string
+	prefix string
+
+	mu     sync.Mutex
+	batch  *archiveBatch
+	failed []*archiveBatch
+	flush  chan struct{}
+}
+
+// parseS3URL returns the bucket and key prefix of a URL such as s3://bucket/prefix.
+func parseS3URL(rawURL string) (string, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("URL must be s3://bucket/prefix, not %q", rawURL)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// newS3Client creates a client for an S3-compatible API.
+// The endpoint is the host of the S3 API, optionally prefixed with http:// to disable TLS.
+// Credentials are taken from the standard AWS or MinIO environment variables, the AWS credentials file, or the instance's IAM role.
+func newS3Client(endpoint string) (*minio.Client, error) {
+	secure := !strings.HasPrefix(endpoint, "http://")
+	endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://")
+	return minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		}),
+		Secure: secure,
+	})
+}
+
+// newArchiveSink creates an archive sink for a URL such as s3://bucket/prefix, and starts its background uploader.
+func newArchiveSink(rawURL string, endpoint string, interval time.Duration) (*archiveSink, error) {
+	bucket, prefix, err := parseS3URL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newS3Client(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	s := &archiveSink{
+		client: client,
+		bucket: bucket,
+		prefix: prefix,
+		batch:  newArchiveBatch(),
+		flush:  make(chan struct{}, 1),
+	}
+	go s.run(interval)
+	return s, nil
+}
+
+// Send adds an event to the current batch.
+func (s *archiveSink) Send(e event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batch.gz.Write(append(data, '\n'))
+	s.batch.count++
+	if s.batch.buf.Len() >= archiveMaxBatch {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// backlog returns the number of events waiting to be uploaded.
+func (s *archiveSink) backlog() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.batch.count
+	for _, b := range s.failed {
+		n += b.count
+	}
+	return n
+}
+
+// Close uploads the current batch straight away, e.g. when the watcher is shutting down.
+func (s *archiveSink) Close() error {
+	s.upload()
+	return nil
+}
+
+// run uploads the current batch every interval, or when it gets too big.
+func (s *archiveSink) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.flush:
+		}
+		s.upload()
+	}
+}
+
+// upload uploads the current batch and any that previously failed.
+func (s *archiveSink) upload() {
+	s.mu.Lock()
+	batches := s.failed
+	if s.batch.count > 0 {
+		batches = append(batches, s.batch)
+		s.batch = newArchiveBatch()
+	}
+	s.failed = nil
+	s.mu.Unlock()
+
+	var failed []*archiveBatch
+	for _, b := range batches {
+		if err := s.put(b); err != nil {
+			log.Printf("Archive error: %v\n", err)
+			failed = append(failed, b)
+		}
+	}
+	if len(failed) > archiveMaxFailed {
+		log.Printf("Archive error: dropping %d batches that could not be uploaded\n", len(failed)-archiveMaxFailed)
+		failed = failed[len(failed)-archiveMaxFailed:]
+	}
+
+	s.mu.Lock()
+	s.failed = append(failed, s.failed...)
+	s.mu.Unlock()
+}
+
+// put uploads a batch.
+func (s *archiveSink) put(b *archiveBatch) error {
+	if b.gz != nil {
+		if err := b.gz.Close(); err != nil {
+			return err
+		}
+		b.gz = nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	_, err := s.client.PutObject(ctx, s.bucket, b.key(s.prefix), bytes.NewReader(b.buf.Bytes()), int64(b.buf.Len()), minio.PutObjectOptions{
+		ContentType: "application/gzip",
+	})
+	return err
+}
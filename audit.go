@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// auditBodyLimit is the largest batch of audit events that the audit webhook reads.
+	auditBodyLimit = 32 << 20
+	// auditPollInterval is the time between reads of the audit log once the end has been reached.
+	auditPollInterval = time.Second
+)
+
+// auditEvent is the part of a Kubernetes audit event (audit.k8s.io/v1 Event) that says who did what to which object.
+// It is decoded from the audit webhook's EventList and each line of the JSON audit log, at any audit level.
+type auditEvent struct {
+	Stage string `json:"stage"`
+	Verb  string `json:"verb"`
+	User  struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	ImpersonatedUser *struct {
+		Username string `json:"username"`
+	} `json:"impersonatedUser,omitempty"`
+	ObjectRef *struct {
+		Resource    string `json:"resource"`
+		Namespace   string `json:"namespace"`
+		Name        string `json:"name"`
+		APIGroup    string `json:"apiGroup"`
+		Subresource string `json:"subresource"`
+	} `json:"objectRef,omitempty"`
+	ResponseStatus *struct {
+		Code int32 `json:"code"`
+	} `json:"responseStatus,omitempty"`
+}
+
+// auditOperations maps the verbs and subresources of the audited requests on pods to the operations whose users are remembered.
+// An eviction deletes the pod, so it is remembered as a delete by the user who asked for it.
+var auditOperations = map[[2]string]string{
+	{"create", ""}:         actorCreate,
+	{"update", ""}:         actorUpdate,
+	{"patch", ""}:          actorUpdate,
+	{"delete", ""}:         actorDelete,
+	{"create", "eviction"}: actorDelete,
+}
+
+// observeAudit remembers the user of an audit event for a pod that was created, updated, deleted or evicted.
+// Only the completed requests that succeeded are used, so that each request is only remembered once. Pods created with generateName are not named by their audit events, so they are not matched.
+func observeAudit(cluster string, e auditEvent) {
+	if e.Stage != "ResponseComplete" || e.ObjectRef == nil || e.ObjectRef.APIGroup != "" || e.ObjectRef.Resource != "pods" || e.ObjectRef.Name == "" {
+		return
+	}
+	if e.ResponseStatus != nil && (e.ResponseStatus.Code < 200 || e.ResponseStatus.Code > 299) {
+		return
+	}
+	operation, ok := auditOperations[[2]string{e.Verb, e.ObjectRef.Subresource}]
+	if !ok {
+		return
+	}
+	user := e.User.Username
+	if e.ImpersonatedUser != nil && e.ImpersonatedUser.Username != "" {
+		user = e.ImpersonatedUser.Username + " (impersonated by " + user + ")"
+	}
+	actors.observe(cluster, operation, e.ObjectRef.Namespace, e.ObjectRef.Name, user)
+}
+
+// auditHandler handles a batch of audit events from the API server's audit webhook backend.
+// The cluster is given by the cluster query parameter of the webhook's URL, as the audit events do not say which cluster they are from.
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var list struct {
+		Items []auditEvent `json:"items"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, auditBodyLimit)).Decode(&list); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cluster := r.URL.Query().Get("cluster")
+	for _, e := range list.Items {
+		observeAudit(cluster, e)
+	}
+}
+
+// auditWebhook returns the audit webhook's handler, which rejects the requests without a verified client certificate or bearer token, as anyone who could send audit events could say who changed each pod.
+func auditWebhook(auth *serverAuth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pod-event-watcher"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		auditHandler(w, r)
+	})
+}
+
+// serveAudit serves the audit webhook, with the TLS, client certificates and bearer tokens of the admin server.
+// It is not served unless the clients are authenticated with client certificates or bearer tokens.
+func serveAudit(addr string, auth *serverAuth) error {
+	if !auth.authenticatesClients() {
+		return fmt.Errorf("-audit-addr needs -tls-client-ca-file or -auth-token-file, so that only the API server can send audit events")
+	}
+	listener, err := auth.listen(addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/audit", auditWebhook(auth))
+	go func() {
+		log.Fatal(http.Serve(listener, mux))
+	}()
+	return nil
+}
+
+// followAuditLog reads the audit events appended to the API server's JSON audit log, like tail -F.
+// Reading starts at the end of the file, and at the start of the new file when it is rotated. The events apply to the pods of every cluster.
+func followAuditLog(path string) {
+	var (
+		f       *os.File
+		r       *bufio.Reader
+		offset  int64
+		partial []byte
+	)
+	fromStart := false
+	for {
+		if f == nil {
+			var err error
+			if f, err = os.Open(path); err != nil {
+				log.Printf("Audit log error: %v\n", err)
+				fromStart = true
+				time.Sleep(auditPollInterval)
+				continue
+			}
+			whence := io.SeekEnd
+			if fromStart {
+				whence = io.SeekStart
+			}
+			if offset, err = f.Seek(0, whence); err != nil {
+				log.Printf("Audit log error: %v\n", err)
+			}
+			r, partial = bufio.NewReader(f), nil
+		}
+
+		line, err := r.ReadBytes('\n')
+		offset += int64(len(line))
+		if err == nil {
+			line = append(partial, line...)
+			partial = nil
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				var e auditEvent
+				if err := json.Unmarshal(line, &e); err != nil {
+					log.Printf("Audit log error: %v\n", err)
+				} else {
+					observeAudit("", e)
+				}
+			}
+			continue
+		}
+		if err != io.EOF {
+			log.Printf("Audit log error: %v\n", err)
+		}
+		// Keep the start of a line that is still being written.
+		partial = append(partial, line...)
+		time.Sleep(auditPollInterval)
+
+		// Start again from the new file when the log is rotated or truncated.
+		info, statErr := os.Stat(path)
+		current, _ := f.Stat()
+		if statErr != nil || current == nil || !os.SameFile(info, current) || info.Size() < offset {
+			f.Close()
+			f, fromStart = nil, true
+		}
+	}
+}
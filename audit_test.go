@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuditWebhookAuth(t *testing.T) {
+	auth := &serverAuth{tokens: [][]byte{[]byte("secret")}}
+	tests := []struct {
+		name    string
+		handler http.Handler
+		header  string
+		want    int
+	}{
+		{"no token", auditWebhook(auth), "", http.StatusUnauthorized},
+		{"wrong token", auditWebhook(auth), "Bearer wrong", http.StatusUnauthorized},
+		{"token", auditWebhook(auth), "Bearer secret", http.StatusOK},
+		{"admission server without a token", admissionMux(auth), "", http.StatusUnauthorized},
+		{"admission server with a token", admissionMux(auth), "Bearer secret", http.StatusOK},
+		{"admission server without client authentication", admissionMux(nil), "Bearer secret", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/audit", strings.NewReader(`{"items":[]}`))
+			if test.header != "" {
+				r.Header.Set("Authorization", test.header)
+			}
+			w := httptest.NewRecorder()
+			test.handler.ServeHTTP(w, r)
+			if w.Code != test.want {
+				t.Errorf("got status %d, want %d", w.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestServeAuditNeedsClientAuth(t *testing.T) {
+	for _, auth := range []*serverAuth{nil, {tls: &tls.Config{}}} {
+		if err := serveAudit("127.0.0.1:0", auth); err == nil {
+			t.Errorf("got no error serving the audit webhook with %+v, want one without client certificates or tokens", auth)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+)
+
+const (
+	// benchCluster is the name of the cluster whose pods are generated with -bench.
+	benchCluster = "bench"
+	// benchPods is the number of pods whose lifecycles are interleaved with -bench, so that the handlers have other pods' state to keep as they would in a cluster.
+	benchPods = 1000
+	// benchSeed is the seed of the random choices made for the pods with -bench, so that each run generates the same changes.
+	benchSeed = 1
+)
+
+// benchmark pushes simulated pod changes through the pipeline as fast as it can, timing each stage: filtering, transforming and diffing the pods, the handlers (which include queueing the events for the sinks), and each sink's deliveries.
+type benchmark struct {
+	mu      sync.Mutex
+	stages  []string
+	timings map[string][]time.Duration
+
+	// capacity is the number of timings that each stage has room for.
+	capacity int
+	events   int
+	start    time.Time
+	before   runtime.MemStats
+
+	elapsed   time.Duration
+	mallocs   uint64
+	allocated uint64
+}
+
+// bench times the pipeline if enabled with the -bench flag, and is otherwise nil.
+var bench *benchmark
+
+// newBenchmark creates a benchmark.
+func newBenchmark() *benchmark {
+	return &benchmark{timings: make(map[string][]time.Duration)}
+}
+
+// observe records the time taken by one run of a stage.
+func (b *benchmark) observe(stage string, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.timings[stage]; !ok {
+		b.stages = append(b.stages, stage)
+		b.timings[stage] = make([]time.Duration, 0, b.capacity)
+	}
+	b.timings[stage] = append(b.timings[stage], d)
+}
+
+// time runs a stage and records the time it took.
+func (b *benchmark) time(stage string, f func()) {
+	start := time.Now()
+	f()
+	b.observe(stage, time.Since(start))
+}
+
+// run generates n pod changes and handles each in turn. The sinks may still be sending the events when it returns.
+func (b *benchmark) run(ctx context.Context, n int, opts watcher.Options) {
+	if opts.Transform == nil {
+		opts.Transform = watcher.TrimPod
+	}
+	if opts.Differ == nil {
+		opts.Differ = watcher.SemanticDiffer
+	}
+	clientset := fake.NewSimpleClientset()
+	c := newClusterForClientset(benchCluster, clientset)
+	watchedClusters.add(c)
+	ctx = withCluster(ctx, c)
+	sim := newSimulator(clientset, benchSeed)
+
+	type lifecycle struct {
+		pod   *v1.Pod
+		steps []func(*v1.Pod)
+	}
+	var pods [benchPods]lifecycle
+
+	b.mu.Lock()
+	b.capacity, b.events = n, n
+	// The pipeline's stages are reported in order, followed by the sinks.
+	for _, stage := range []string{"generate", "filter", "transform", "diff", "handle"} {
+		b.stages = append(b.stages, stage)
+		b.timings[stage] = make([]time.Duration, 0, n)
+	}
+	b.mu.Unlock()
+	runtime.GC()
+	runtime.ReadMemStats(&b.before)
+	b.start = time.Now()
+	for i := 0; i < n; i++ {
+		l := &pods[i%benchPods]
+		var oldPod, pod *v1.Pod
+		deleted := false
+		b.time("generate", func() {
+			switch {
+			case l.pod == nil:
+				l.pod, l.steps = sim.plan()
+				pod = l.pod
+			case len(l.steps) == 0:
+				pod, deleted = l.pod, true
+				l.pod = nil
+			default:
+				oldPod, pod = l.pod, l.pod.DeepCopy()
+				l.steps[0](pod)
+				l.steps = l.steps[1:]
+				pod.ResourceVersion = sim.nextResourceVersion()
+			}
+			if !deleted {
+				l.pod = pod
+			}
+		})
+		if opts.Filter != nil {
+			kept := true
+			b.time("filter", func() { kept = opts.Filter(pod) })
+			if !kept {
+				continue
+			}
+		}
+		if !deleted {
+			b.time("transform", func() { opts.Transform(pod) })
+		}
+		switch {
+		case deleted:
+			b.time("handle", func() { podDeleted(ctx, pod) })
+		case oldPod == nil:
+			b.time("handle", func() { podCreated(ctx, pod) })
+		default:
+			var diff []string
+			b.time("diff", func() { diff = opts.Differ.Diff(oldPod, pod) })
+			b.time("handle", func() { podUpdated(ctx, oldPod, pod, diff) })
+		}
+	}
+}
+
+// stop ends the benchmark once the sinks have been drained.
+func (b *benchmark) stop() {
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.elapsed = time.Since(b.start)
+	b.mallocs, b.allocated = after.Mallocs-b.before.Mallocs, after.TotalAlloc-b.before.TotalAlloc
+}
+
+// report writes the throughput, allocations and the latency of each stage.
+func (b *benchmark) report(w io.Writer) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	per := func(total uint64) uint64 { return total / uint64(b.events) }
+	fmt.Fprintf(w, "%d pod changes in %s, including draining the sinks: %.0f changes/sec, %d allocations and %d bytes allocated per change\n\n",
+		b.events, b.elapsed.Round(time.Millisecond), float64(b.events)/b.elapsed.Seconds(), per(b.mallocs), per(b.allocated))
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tCOUNT\tMEAN\tP50\tP99\tMAX")
+	for _, stage := range b.stages {
+		timings := append([]time.Duration(nil), b.timings[stage]...)
+		if len(timings) == 0 {
+			continue
+		}
+		sort.Slice(timings, func(i, j int) bool { return timings[i] < timings[j] })
+		var total time.Duration
+		for _, d := range timings {
+			total += d
+		}
+		percentile := func(p float64) time.Duration { return timings[int(p*float64(len(timings)-1))] }
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", stage, len(timings), total/time.Duration(len(timings)), percentile(0.5), percentile(0.99), timings[len(timings)-1])
+	}
+	return tw.Flush()
+}
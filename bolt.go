@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	v1 "k8s.io/api/core/v1"
+)
+
+var (
+	// boltPods holds the latest state of each pod, keyed by "namespace/name", or "cluster/namespace/name" for the pods of a named cluster.
+	boltPods = []byte("pods")
+	// boltCounts holds the total number of events of each type, keyed by event type.
+	boltCounts = []byte("counts")
+)
+
+// boltRecord is the latest state of a pod in a bolt store.
+type boltRecord struct {
+	Cluster string            `json:"cluster,omitempty"`
+	Type    eventType         `json:"type"`
+	Time    time.Time         `json:"time"`
+	Pod     *v1.Pod           `json:"pod"`
+	Counts  map[eventType]int `json:"counts"`
+}
+
+// boltStore records the latest state of each pod and event counts in an embedded bbolt database.
+// Unlike the SQL stores it does not keep every event, but it needs no cgo or database server, which suits single-binary deployments.
+type boltStore struct {
+	db *bolt.DB
+}
+
+// openBoltStore opens (or creates) a bbolt database at path.
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltPods, boltCounts} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+// Send records an event, updating the pod's latest state and the event counts.
+func (s *boltStore) Send(e event) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		counts := tx.Bucket(boltCounts)
+		var n uint64
+		if v := counts.Get([]byte(e.Type)); v != nil {
+			n = binary.BigEndian.Uint64(v)
+		}
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, n+1)
+		if err := counts.Put([]byte(e.Type), v); err != nil {
+			return err
+		}
+
+		if e.Pod == nil {
+			return nil
+		}
+		pods := tx.Bucket(boltPods)
+		key := []byte(e.Namespace + "/" + e.Pod.Name)
+		if e.Cluster != "" {
+			key = []byte(e.Cluster + "/" + string(key))
+		}
+		var record boltRecord
+		if v := pods.Get(key); v != nil {
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+		}
+		if record.Counts == nil {
+			record.Counts = make(map[eventType]int)
+		}
+		record.Cluster = e.Cluster
+		record.Type = e.Type
+		record.Time = e.Time
+		record.Pod = e.Pod
+		record.Counts[e.Type]++
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return pods.Put(key, data)
+	})
+}
+
+// Prune deletes the records of deleted pods older than the maximum age, and then the oldest records beyond the maximum number.
+// Pods that still exist are only removed by the maximum number, and are recorded again when they are next updated.
+func (s *boltStore) Prune(r retention) (int, error) {
+	n := 0
+	cutoff := r.cutoff()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		type key struct {
+			key  []byte
+			time time.Time
+		}
+		var keys []key
+		pods := tx.Bucket(boltPods)
+		err := pods.ForEach(func(k, v []byte) error {
+			var record boltRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if !cutoff.IsZero() && record.Type == eventDeleted && record.Time.Before(cutoff) {
+				// Keys must not be deleted while iterating, so they are deleted afterwards with the oldest.
+				keys = append(keys, key{append([]byte(nil), k...), time.Time{}})
+				return nil
+			}
+			keys = append(keys, key{append([]byte(nil), k...), record.Time})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(keys, func(i, j int) bool { return keys[i].time.Before(keys[j].time) })
+		for i, k := range keys {
+			tooOld := k.time.IsZero()
+			tooMany := r.MaxEvents > 0 && len(keys)-i > r.MaxEvents
+			if !tooOld && !tooMany {
+				break
+			}
+			if err := pods.Delete(k.key); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Query returns the latest event for each pod matching q, in order of cluster, namespace and name.
+func (s *boltStore) Query(q eventQuery) ([]event, string, error) {
+	var results []event
+	next := ""
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltPods).Cursor()
+		k, v := c.First()
+		if q.Continue != "" {
+			k, v = c.Seek([]byte(q.Continue))
+			if k != nil && string(k) == q.Continue {
+				k, v = c.Next()
+			}
+		}
+		var last []byte
+		for ; k != nil; k, v = c.Next() {
+			var record boltRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			e := event{Cluster: record.Cluster, Type: record.Type, Time: record.Time, Namespace: record.Pod.Namespace, Pod: record.Pod}
+			if !q.matches(e) {
+				continue
+			}
+			if q.Limit > 0 && len(results) == q.Limit {
+				next = string(last)
+				break
+			}
+			results = append(results, e)
+			last = append(last[:0], k...)
+		}
+		return nil
+	})
+	return results, next, err
+}
+
+// Close closes the database.
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBoltStoreClusters(t *testing.T) {
+	s, err := openBoltStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	for _, cluster := range []string{"prod", "staging"} {
+		if err := s.Send(event{Cluster: cluster, Type: eventCreated, Time: time.Now(), Namespace: "default", Pod: pod}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, _, err := s.Query(eventQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Cluster != "prod" || results[1].Cluster != "staging" {
+		t.Fatalf("got %v, want the pod in each cluster", summaries(results))
+	}
+}
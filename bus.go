@@ -0,0 +1,423 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// filter selects which events a sink receives.
+// Empty fields match everything.
+type filter struct {
+	Events     []eventType `json:"events,omitempty"`
+	Namespaces []string    `json:"namespaces,omitempty"`
+	Selector   string      `json:"selector,omitempty"`
+	// Severity is the least severity of the events, e.g. warning for the warning and critical events.
+	Severity severity `json:"severity,omitempty"`
+}
+
+// route connects a sink to the bus, along with the filter that decides which events it receives.
+type route struct {
+	name     string
+	sink     sink
+	filter   filter
+	selector labels.Selector
+	// queue, if not nil, holds the events for the sink so that they are sent in the background instead of by the bus.
+	queue *sinkQueue
+	// retries is the number of times a failed delivery is retried, with exponential backoff.
+	retries int
+	// configured is set for the sinks from the configuration file and the sink flags, which are replaced when the configuration is reloaded.
+	configured bool
+}
+
+// newRoute creates a route, parsing the filter's label selector.
+// The name identifies the sink in log messages and traces.
+func newRoute(name string, s sink, f filter) (route, error) {
+	selector, err := labels.Parse(f.Selector)
+	if err != nil {
+		return route{}, err
+	}
+	return route{name: name, sink: s, filter: f, selector: selector}, nil
+}
+
+// matches reports whether an event passes the route's filter.
+func (r route) matches(e event) bool {
+	if len(r.filter.Events) > 0 && !containsEventType(r.filter.Events, e.Type) {
+		return false
+	}
+	if len(r.filter.Namespaces) > 0 && !containsString(r.filter.Namespaces, e.Namespace) {
+		return false
+	}
+	if r.filter.Severity != "" && !e.severity().atLeast(r.filter.Severity) {
+		return false
+	}
+	var podLabels labels.Set
+	if e.Pod != nil {
+		podLabels = e.Pod.Labels
+	}
+	return r.selector.Matches(podLabels)
+}
+
+// bus distributes events from the handler functions to the configured sinks.
+// The handler functions only queue events, so they are not held up by sink delivery until the queue fills.
+type bus struct {
+	events     chan event
+	transforms []transformer
+	done       chan struct{}
+	lastID     int64 // Accessed atomically.
+
+	// routesMu is held for reading while an event is delivered and for writing while the routes are changed, so that each event goes to either the old or the new sinks when the configuration is reloaded.
+	routesMu sync.RWMutex
+	routes   []route
+
+	mu            sync.Mutex
+	subscriptions map[*subscription]bool
+
+	// closeMu is held for reading while publishing and for writing while closing events, so that events published while the bus drains are discarded rather than sent on a closed channel.
+	closeMu sync.RWMutex
+	closed  bool
+}
+
+// newBus creates an empty bus. Routes must be added, and lastID set to continue the numbering of events, before the bus is started.
+func newBus() *bus {
+	return &bus{events: make(chan event, 1000), done: make(chan struct{}), subscriptions: make(map[*subscription]bool)}
+}
+
+// transformer changes or drops events before they are delivered.
+type transformer interface {
+	apply(e event) (event, bool, error)
+}
+
+// addTransform adds a transformer that each event passes through, in the order they are added, before it is delivered.
+func (b *bus) addTransform(t transformer) {
+	b.transforms = append(b.transforms, t)
+}
+
+// add connects a sink to the bus, starting the sender for its queue if it has one.
+func (b *bus) add(r route) {
+	b.routesMu.Lock()
+	defer b.routesMu.Unlock()
+	b.routes = append(b.routes, r)
+	b.start(r)
+}
+
+// start starts the sender for a route's queue, if it has one.
+func (b *bus) start(r route) {
+	if r.queue != nil {
+		go r.queue.run(func(e event) { b.send(r, e) })
+	}
+}
+
+// replace swaps the configured routes for new ones, then sends the old sinks what is still queued for them and closes them, which stops their background senders.
+// The old sinks are closed at the same time, so that each has until the close deadline to deliver what it has queued.
+func (b *bus) replace(routes []route) {
+	b.routesMu.Lock()
+	var old []route
+	for _, r := range b.routes {
+		if r.configured {
+			old = append(old, r)
+		} else {
+			routes = append(routes, r)
+		}
+	}
+	b.routes = routes
+	for _, r := range routes {
+		if r.configured {
+			b.start(r)
+		}
+	}
+	b.routesMu.Unlock()
+	var wg sync.WaitGroup
+	for _, r := range old {
+		wg.Add(1)
+		go func(r route) {
+			defer wg.Done()
+			r.close()
+		}(r)
+	}
+	wg.Wait()
+}
+
+// currentRoutes returns the routes that events are being delivered to.
+func (b *bus) currentRoutes() []route {
+	b.routesMu.RLock()
+	defer b.routesMu.RUnlock()
+	return append([]route(nil), b.routes...)
+}
+
+// publish queues an event for delivery to all matching sinks.
+// With leader election, the events are only counted unless this replica is the leader.
+func (b *bus) publish(e event) {
+	e.Cluster = e.cluster()
+	if deterministic {
+		e.Time = deterministicTime
+	}
+	if timestamps != nil {
+		e.Time = e.Time.In(timestamps.location)
+	}
+	countEvent(e)
+	stats.record(e)
+	if leadership != nil && !leadership.leading() {
+		return
+	}
+	b.closeMu.RLock()
+	defer b.closeMu.RUnlock()
+	if b.closed {
+		return
+	}
+	b.events <- e
+}
+
+// run numbers the queued events and delivers them to each matching sink in turn.
+// Delivery errors are logged rather than returned so that one broken sink does not affect the others.
+func (b *bus) run() {
+	defer close(b.done)
+	for e := range b.events {
+		e, keep := b.transform(e)
+		if !keep {
+			continue
+		}
+		e.ID = atomic.AddInt64(&b.lastID, 1)
+		b.routesMu.RLock()
+		for _, r := range b.routes {
+			b.deliver(r, e)
+		}
+		b.routesMu.RUnlock()
+		b.notify(e)
+	}
+}
+
+// transform passes an event through each transformer, returning false if one of them dropped it.
+// An event is passed on unchanged by a transformer that fails, so that a broken transformer does not lose events.
+func (b *bus) transform(e event) (event, bool) {
+	for _, t := range b.transforms {
+		transformed, keep, err := t.apply(e)
+		if err != nil {
+			log.Printf("Transform error: %v\n", err)
+			continue
+		}
+		if !keep {
+			return e, false
+		}
+		e = transformed
+	}
+	return e, true
+}
+
+// drain stops the bus from accepting events and waits until the queued events have been delivered, including those in the sinks' queues.
+// Sinks that buffer events or hold files open implement io.Closer, and are closed once they have been sent everything.
+func (b *bus) drain() {
+	b.closeMu.Lock()
+	b.closed = true
+	close(b.events)
+	b.closeMu.Unlock()
+	<-b.done
+	for _, r := range b.currentRoutes() {
+		r.close()
+	}
+}
+
+// close waits until the events in the route's queue have been sent, then closes the sink if it implements io.Closer.
+func (r route) close() {
+	if r.queue != nil {
+		r.queue.close()
+	}
+	if c, ok := r.sink.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("Sink error (%s): %v\n", r.name, err)
+		}
+	}
+}
+
+// deliver sends an event to a route's sink, or adds it to the sink's queue, if it passes the route's filter.
+func (b *bus) deliver(r route, e event) {
+	attrs := trace.WithAttributes(attribute.String("sink", r.name))
+	_, filterSpan := tracer.Start(e.context(), "filter", attrs)
+	matched := r.matches(e)
+	filterSpan.SetAttributes(attribute.Bool("matched", matched))
+	filterSpan.End()
+	if !matched {
+		return
+	}
+	if r.queue == nil {
+		b.send(r, e)
+		return
+	}
+	if dropped, ok := r.queue.push(e); ok {
+		countDrop(dropped, r.name)
+		log.Printf("Sink error (%s): queue full, dropping event %q\n", r.name, dropped.summary())
+	}
+}
+
+// send sends an event to a route's sink, and records it in the dead-letter file if it cannot be delivered.
+func (b *bus) send(r route, e event) {
+	if err := r.send(e); err != nil {
+		log.Printf("Sink error (%s): %v\n", r.name, err)
+		if deadLetters != nil {
+			deadLetters.write(r.name, e, err)
+		}
+	}
+}
+
+// send sends an event to the route's sink, retrying with exponential backoff if it fails.
+// Retries hold up the sink's queue, or the bus if the sink has no queue.
+func (r route) send(e event) error {
+	_, sendSpan := tracer.Start(e.context(), "deliver", trace.WithAttributes(attribute.String("sink", r.name)))
+	defer sendSpan.End()
+	start := time.Now()
+	err := r.attempt(e, 1)
+	for retry := 0; err != nil && retry < r.retries; retry++ {
+		time.Sleep(retryDelay(retry))
+		err = r.attempt(e, retry+2)
+	}
+	countDelivery(e, r.name, start, err)
+	if bench != nil {
+		bench.observe("sink "+r.name, time.Since(start))
+	}
+	if err != nil {
+		sendSpan.RecordError(err)
+		sendSpan.SetStatus(codes.Error, err.Error())
+		if r.retries > 0 {
+			err = fmt.Errorf("%v (after %d retries)", err, r.retries)
+		}
+	}
+	return err
+}
+
+// attempt makes one attempt to send an event to the route's sink.
+func (r route) attempt(e event, n int) error {
+	start := time.Now()
+	err := r.sink.Send(e)
+	if err != nil {
+		debugf(1, debugSink, "attempt %d to send event %d to %s failed after %s: %v\n", n, e.ID, r.name, time.Since(start).Round(time.Millisecond), err)
+	} else {
+		debugf(2, debugSink, "attempt %d to send event %d to %s succeeded in %s\n", n, e.ID, r.name, time.Since(start).Round(time.Millisecond))
+	}
+	return err
+}
+
+// subscription receives the events matching a filter for as long as a client is connected, unlike a route which is fixed at startup.
+// If the client does not keep up and the buffer fills, the subscription is ended and overflowed is set, so that the bus is never held up by a client.
+type subscription struct {
+	route
+	events     chan event
+	overflowed bool
+}
+
+// subscribe creates a subscription for the events matching a filter, with room for buffer events.
+// The subscription's channel is closed when it is ended by unsubscribe or by overflowing.
+func (b *bus) subscribe(name string, f filter, buffer int) (*subscription, error) {
+	r, err := newRoute(name, nil, f)
+	if err != nil {
+		return nil, err
+	}
+	s := &subscription{route: r, events: make(chan event, buffer)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions[s] = true
+	return s, nil
+}
+
+// unsubscribe ends a subscription, if it has not already ended.
+func (b *bus) unsubscribe(s *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscriptions[s] {
+		delete(b.subscriptions, s)
+		close(s.events)
+	}
+}
+
+// notify sends an event to the matching subscriptions, ending those that are full.
+func (b *bus) notify(e event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subscriptions {
+		if !s.matches(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			log.Printf("Subscription error (%s): client is not keeping up, ending subscription\n", s.name)
+			s.overflowed = true
+			delete(b.subscriptions, s)
+			close(s.events)
+		}
+	}
+}
+
+// events is the bus that the handler functions publish to.
+var events = newBus()
+
+// publish queues an event on the bus, followed by any warning that it causes.
+func publish(e event) {
+	if !clusterAllows(e) {
+		return
+	}
+	events.publish(e)
+	fleet.observe(e)
+	if gate != nil {
+		gate.observe(e)
+	}
+	if anomalies != nil {
+		anomalies.observe(e)
+	}
+	if slos != nil {
+		slos.observe(e)
+	}
+	if churn != nil {
+		if warning, ok := churn.observe(e); ok {
+			events.publish(warning)
+		}
+	}
+}
+
+// parseEventTypes converts a comma-separated list of event types into a slice.
+func parseEventTypes(list string) []eventType {
+	var types []eventType
+	for _, t := range splitList(list) {
+		types = append(types, eventType(t))
+	}
+	return types
+}
+
+// parseFilter creates a filter for a subscription requested by a client, checking that the event types exist.
+func parseFilter(types []string, namespaces []string, selector string) (filter, error) {
+	f := filter{Namespaces: namespaces, Selector: selector}
+	for _, t := range types {
+		if !validEventType(eventType(t)) {
+			return filter{}, fmt.Errorf("unknown event type %q", t)
+		}
+		f.Events = append(f.Events, eventType(t))
+	}
+	return f, nil
+}
+
+// containsEventType reports whether an event type is in a list.
+func containsEventType(list []eventType, t eventType) bool {
+	for _, item := range list {
+		if item == t {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether a string is in a list.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// captureTimeout is how long writing the logs of a pod's containers to its capture file may take.
+const captureTimeout = time.Minute
+
+// logCapturer writes the logs of each pod's containers to a file when the pod fails or starts terminating, while the logs can still be read, so that evicted and deleted pods can be debugged afterwards.
+type logCapturer struct {
+	dir string
+
+	mu       sync.Mutex
+	captured map[types.UID]bool
+	clusters map[types.UID]string // UID -> cluster.
+}
+
+// captures writes the logs of failed and terminating pods to files if enabled with the -capture-logs flag, and is otherwise nil.
+var captures *logCapturer
+
+// newLogCapturer creates a logCapturer that writes the files to a directory, creating it if needed.
+func newLogCapturer(dir string) (*logCapturer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &logCapturer{dir: dir, captured: make(map[types.UID]bool), clusters: make(map[types.UID]string)}, nil
+}
+
+// observe captures the logs of a pod that has just failed or started terminating.
+func (l *logCapturer) observe(ctx context.Context, oldPod, newPod *v1.Pod) {
+	terminating := oldPod.DeletionTimestamp == nil && newPod.DeletionTimestamp != nil
+	failed := oldPod.Status.Phase != v1.PodFailed && newPod.Status.Phase == v1.PodFailed
+	if terminating || failed {
+		l.capture(ctx, newPod)
+	}
+}
+
+// forget captures the logs of a deleted pod if they were not captured before it was deleted, which only works if its containers have not been removed yet, and forgets the pod.
+func (l *logCapturer) forget(ctx context.Context, pod *v1.Pod) {
+	l.capture(ctx, pod)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.captured, pod.UID)
+	delete(l.clusters, pod.UID)
+}
+
+// forgetCluster removes the pods of a cluster that is no longer watched.
+func (l *logCapturer) forgetCluster(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for uid, cluster := range l.clusters {
+		if cluster == name {
+			delete(l.captured, uid)
+			delete(l.clusters, uid)
+		}
+	}
+}
+
+// capture writes the logs of a pod's containers to its file in the background, unless they have already been captured.
+// The clientset of the pod's cluster is taken from the context of the pod handler.
+func (l *logCapturer) capture(ctx context.Context, pod *v1.Pod) {
+	c, ok := ctx.Value(clusterKey{}).(*cluster)
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	if l.captured[pod.UID] {
+		l.mu.Unlock()
+		return
+	}
+	l.captured[pod.UID] = true
+	l.clusters[pod.UID] = c.name
+	l.mu.Unlock()
+
+	go func() {
+		path, err := l.write(c, pod)
+		if err != nil {
+			log.Printf("%sCapture error (%s/%s): %v\n", clusterPrefix(c.name), pod.Namespace, pod.Name, err)
+			return
+		}
+		log.Printf("%sCaptured the logs of %s/%s to %s\n", clusterPrefix(c.name), pod.Namespace, pod.Name, path)
+	}()
+}
+
+// write writes the logs of each of a pod's containers to a file named after the pod, with the previous logs of the containers that have restarted before their current logs.
+// The file is named after the cluster as well if it has a name, and the pod's UID, so that pods that reuse a name do not replace each other's files.
+func (l *logCapturer) write(c *cluster, pod *v1.Pod) (string, error) {
+	name := fmt.Sprintf("%s_%s_%s.log", pod.Namespace, pod.Name, pod.UID)
+	if c.name != "" {
+		name = c.name + "_" + name
+	}
+	path := filepath.Join(l.dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), captureTimeout)
+	defer cancel()
+	restarts := make(map[string]int32)
+	for _, s := range containerStatuses(pod) {
+		restarts[s.Name] = s.RestartCount
+	}
+	for _, container := range containers(pod) {
+		if restarts[container.Name] > 0 {
+			fmt.Fprintf(f, "==> %s (previous) <==\n", container.Name)
+			if err := copyLogs(ctx, f, c, pod, &v1.PodLogOptions{Container: container.Name, Previous: true, Timestamps: true}); err != nil {
+				fmt.Fprintf(f, "%v\n", err)
+			}
+		}
+		fmt.Fprintf(f, "==> %s <==\n", container.Name)
+		if err := copyLogs(ctx, f, c, pod, &v1.PodLogOptions{Container: container.Name, Timestamps: true}); err != nil {
+			fmt.Fprintf(f, "%v\n", err)
+		}
+	}
+	return path, f.Close()
+}
+
+// copyLogs streams a container's logs to w, masking the matches of the -redact patterns.
+func copyLogs(ctx context.Context, w io.Writer, c *cluster, pod *v1.Pod, opts *v1.PodLogOptions) error {
+	logs, err := c.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+	return redaction.copy(w, logs)
+}
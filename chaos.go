@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+)
+
+// The faults that -chaos injects into the lists and watches of the pods.
+const (
+	// chaosReset fails the request as if the connection had been reset.
+	chaosReset = "reset"
+	// chaosDrop cuts a watch off partway through, after up to chaosMaxDropAfter.
+	chaosDrop = "drop"
+	// chaosGone fails the request with 410 Gone, as if its resource version were too old, so that the pods are listed again.
+	chaosGone = "gone"
+)
+
+const (
+	// chaosMaxDropAfter is the longest time that a watch is kept open before it is cut off by chaosDrop.
+	chaosMaxDropAfter = 30 * time.Second
+	// chaosCheckTimeout is how long listing a shard's pods to check its cache may take.
+	chaosCheckTimeout = time.Minute
+)
+
+// chaosExemptKey is the context key that marks the requests that faults are not injected into, such as the lists that the caches are checked against.
+type chaosExemptKey struct{}
+
+// chaosMonkey injects faults into the watcher's requests to list and watch pods with -chaos, and checks that the caches still match the API server after the informers recover, so that watch reliability can be tested against a real cluster.
+type chaosMonkey struct {
+	probability float64
+	faults      []string
+
+	mu   sync.Mutex
+	rand *rand.Rand
+	// mismatches are the differences found between each shard's cache and the API server by the last check, so that only those that last for two checks in a row are reported.
+	mismatches map[string]map[string]bool
+}
+
+// chaos injects faults if enabled with the -chaos flag, and is otherwise nil.
+var chaos *chaosMonkey
+
+// newChaosMonkey creates a chaosMonkey that injects faults, chosen from a comma-separated list, into requests with a probability.
+func newChaosMonkey(probability float64, faults string) (*chaosMonkey, error) {
+	if probability <= 0 || probability > 1 {
+		return nil, fmt.Errorf("-chaos must be more than 0 and at most 1")
+	}
+	c := &chaosMonkey{probability: probability, rand: rand.New(rand.NewSource(time.Now().UnixNano())), mismatches: make(map[string]map[string]bool)}
+	for _, f := range splitList(faults) {
+		if f != chaosReset && f != chaosDrop && f != chaosGone {
+			return nil, fmt.Errorf("unknown -chaos-faults fault %q", f)
+		}
+		c.faults = append(c.faults, f)
+	}
+	if len(c.faults) == 0 {
+		return nil, fmt.Errorf("-chaos-faults is empty")
+	}
+	return c, nil
+}
+
+// wrap wraps a cluster's transport, for rest.Config.Wrap.
+func (c *chaosMonkey) wrap(rt http.RoundTripper) http.RoundTripper {
+	return &chaosTransport{next: rt, chaos: c}
+}
+
+// fault returns the fault to inject into a request, or "" for none. Only watches are dropped.
+func (c *chaosMonkey) fault(watching bool) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rand.Float64() >= c.probability {
+		return ""
+	}
+	f := c.faults[c.rand.Intn(len(c.faults))]
+	if f == chaosDrop && !watching {
+		return ""
+	}
+	return f
+}
+
+// dropAfter returns a random time to keep a watch open for before cutting it off.
+func (c *chaosMonkey) dropAfter() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Duration(c.rand.Int63n(int64(chaosMaxDropAfter)))
+}
+
+// chaosTransport injects faults into the requests to list and watch pods.
+type chaosTransport struct {
+	next  http.RoundTripper
+	chaos *chaosMonkey
+}
+
+// RoundTrip makes a request, injecting a fault into it if it is chosen.
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || !strings.HasSuffix(req.URL.Path, "/pods") || req.Context().Value(chaosExemptKey{}) != nil {
+		return t.next.RoundTrip(req)
+	}
+	watching := req.URL.Query().Get("watch") == "true" || req.URL.Query().Get("watch") == "1"
+	request := "list"
+	if watching {
+		request = "watch"
+	}
+	prefix := clusterPrefix(hostCluster(req.URL.Host))
+	switch t.chaos.fault(watching) {
+	case chaosReset:
+		log.Printf("%sChaos: resetting the connection of a %s of pods\n", prefix, request)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case chaosGone:
+		log.Printf("%sChaos: responding 410 Gone to a %s of pods\n", prefix, request)
+		body := `{"kind":"Status","apiVersion":"v1","metadata":{},"status":"Failure","message":"too old resource version (injected by -chaos)","reason":"Expired","code":410}`
+		return &http.Response{
+			Status:        "410 Gone",
+			StatusCode:    http.StatusGone,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"application/json"}},
+			Body:          io.NopCloser(bytes.NewBufferString(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	case chaosDrop:
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		after := t.chaos.dropAfter()
+		body := resp.Body
+		time.AfterFunc(after, func() {
+			log.Printf("%sChaos: dropping a watch of pods after %s\n", prefix, after.Round(time.Millisecond))
+			body.Close()
+		})
+		return resp, nil
+	}
+	return t.next.RoundTrip(req)
+}
+
+// checkPeriodically checks that the cache of each shard matches the API server every interval.
+func (c *chaosMonkey) checkPeriodically(opts watchOptions, interval time.Duration) {
+	for range time.Tick(interval) {
+		for _, cl := range watchedClusters.list() {
+			for _, s := range cl.shards {
+				c.check(cl, s, cl.scope(opts).pods)
+			}
+		}
+	}
+}
+
+// check compares the pods in a shard's cache with those listed from the API server, logging the differences that were also found by the previous check.
+// A difference is expected for a moment after each change to a pod, and while the informer is recovering from a fault, so only one that lasts is an error.
+func (c *chaosMonkey) check(cl *cluster, s *shard, opts watcher.Options) {
+	if s.watcher == nil || !s.watcher.HasSynced() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(chaosContext(context.Background()), chaosCheckTimeout)
+	defer cancel()
+	list, err := cl.clientset.CoreV1().Pods(s.namespace).List(ctx, metav1.ListOptions{LabelSelector: opts.Selector})
+	if err != nil {
+		log.Printf("%sChaos check error (%s): %v\n", clusterPrefix(cl.name), s.name(), err)
+		return
+	}
+	listed := list.Items[:0]
+	for i := range list.Items {
+		if opts.Filter == nil || opts.Filter(&list.Items[i]) {
+			listed = append(listed, list.Items[i])
+		}
+	}
+	differences := chaosDifferences(listed, s.watcher.Store().List())
+
+	c.mu.Lock()
+	previous := c.mismatches[s.name()]
+	current := make(map[string]bool)
+	var lasting []string
+	for _, d := range differences {
+		current[d] = true
+		if previous[d] {
+			lasting = append(lasting, d)
+		}
+	}
+	c.mismatches[s.name()] = current
+	c.mu.Unlock()
+
+	if len(differences) == 0 {
+		log.Printf("%sChaos check: the cache of %s matches the API server (%d pods)\n", clusterPrefix(cl.name), s.name(), len(listed))
+	}
+	for _, d := range lasting {
+		log.Printf("%sChaos check error (%s): %s\n", clusterPrefix(cl.name), s.name(), d)
+	}
+}
+
+// chaosDifferences returns the differences between the pods listed from the API server and the pods in a cache, by key.
+func chaosDifferences(listed []v1.Pod, cached []interface{}) []string {
+	versions := make(map[string]string)
+	for _, obj := range cached {
+		if pod, ok := obj.(*v1.Pod); ok {
+			versions[pod.Namespace+"/"+pod.Name] = pod.ResourceVersion
+		}
+	}
+	var differences []string
+	for _, pod := range listed {
+		key := pod.Namespace + "/" + pod.Name
+		version, ok := versions[key]
+		delete(versions, key)
+		switch {
+		case !ok:
+			differences = append(differences, fmt.Sprintf("pod %s is missing from the cache", key))
+		case version != pod.ResourceVersion:
+			differences = append(differences, fmt.Sprintf("pod %s is cached at resource version %s but is at %s", key, version, pod.ResourceVersion))
+		}
+	}
+	for key := range versions {
+		differences = append(differences, fmt.Sprintf("pod %s is cached but no longer exists", key))
+	}
+	sort.Strings(differences)
+	return differences
+}
+
+// chaosContext returns a context for requests that faults are not injected into.
+func chaosContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, chaosExemptKey{}, true)
+}
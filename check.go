@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// checkTimeout is how long each connection made by the check subcommand may take.
+const checkTimeout = 10 * time.Second
+
+// checkMain checks the configuration, that each cluster's API server can be reached and grants the permissions that the watcher needs, and that each sink can be reached, so that mistakes are found before the watcher is deployed rather than as a panic or an empty watch.
+// The results are printed as a table, and it exits with status 1 if any of the checks fail.
+func checkMain(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	conn := addConnectionFlags(flags)
+	namespace := flags.String("namespace", metav1.NamespaceAll, "namespace to be watched, or a comma-separated list of namespaces")
+	configPath := flags.String("config", "", "path to a YAML or JSON configuration file listing sinks and their filters")
+	storeURL := flags.String("store", "", "URL of the store to be used")
+	watchNodes := flags.Bool("watch-nodes", false, "check the permissions needed by -watch-nodes")
+	watchEvents := flags.Bool("watch-events", false, "check the permissions needed by -watch-probe-events and -watch-disruption-events")
+	recordEvents := flags.Bool("record-events", false, "check the permissions needed by -record-events")
+	annotatePods := flags.Bool("annotate-pods", false, "check the permissions needed by -annotate-pods")
+	watchBudgets := flags.Bool("watch-disruption-budgets", false, "check the permissions needed by -watch-disruption-budgets")
+	networkPolicies := flags.Bool("network-policies", false, "check the permissions needed by -network-policies")
+	describe := flags.Bool("describe", false, "check the permissions needed by -details=describe")
+	usageFlag := flags.Bool("usage", false, "check the permissions needed by -usage-interval")
+	crashLogs := flags.Bool("crash-logs", false, "check the permissions needed by -crash-logs and -capture-logs")
+	debugCrashLoops := flags.Bool("debug-crash-loops", false, "check the permissions needed by -debug-crash-loops")
+	leaderElect := flags.Bool("leader-elect", false, "check the permissions needed by -leader-elect")
+	leaderElectNamespace := flags.String("leader-elect-namespace", "", "namespace of the Lease for -leader-elect (default the namespace of the service account, or \"default\" outside a cluster)")
+	flags.Parse(args)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "RESULT\tCHECK\tDETAIL\n")
+	failed := false
+	report := func(check string, err error) {
+		if err != nil {
+			failed = true
+			fmt.Fprintf(w, "FAIL\t%s\t%v\n", check, err)
+		} else {
+			fmt.Fprintf(w, "ok\t%s\t\n", check)
+		}
+	}
+
+	var sinkConfigs []sinkConfig
+	if *configPath != "" {
+		c, err := loadConfig(*configPath)
+		report("load "+*configPath, err)
+		if c != nil {
+			sinkConfigs = c.Sinks
+		}
+	}
+	for _, c := range sinkConfigs {
+		name := c.Name
+		if name == "" {
+			name = c.Type
+		}
+		_, err := sinkRoute(c)
+		if err == nil {
+			err = probeSink(c)
+		}
+		report("reach the "+name+" sink", err)
+	}
+	if *storeURL != "" {
+		history, err := openStore(*storeURL)
+		if err == nil {
+			err = history.Close()
+		}
+		report("open the store", err)
+	}
+
+	clusters, err := conn.newClusters()
+	report("load the cluster configuration", err)
+	opts := watchOptions{namespace: *namespace, nodes: *watchNodes, probeEvents: *watchEvents, recordEvents: *recordEvents, annotatePods: *annotatePods, debugContainers: *debugCrashLoops, crashLogs: *crashLogs, networkPolicies: *networkPolicies, budgets: *watchBudgets, describe: *describe, usage: *usageFlag}
+	lease := ""
+	if *leaderElect {
+		lease = leaseNamespace(*leaderElectNamespace)
+	}
+	for i, c := range clusters {
+		name := c.name
+		if name == "" {
+			name = c.host()
+		}
+		err := c.ping(context.Background())
+		report("reach the API server of "+name, err)
+		if err != nil {
+			continue
+		}
+		// The Lease is only in the first cluster.
+		if i > 0 {
+			lease = ""
+		}
+		for _, a := range requiredAccess(c.scope(opts), lease) {
+			ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+			allowed, reason, err := c.reviewAccess(ctx, a)
+			cancel()
+			if err == nil && !allowed {
+				err = fmt.Errorf("forbidden")
+				if reason != "" {
+					err = fmt.Errorf("forbidden: %s", reason)
+				}
+			}
+			report(a.String()+" ("+name+")", err)
+		}
+	}
+
+	w.Flush()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// probeSink checks that a sink's destination can be reached, without sending it anything.
+// For the sinks that post to a URL, a TCP connection is made to its host, or to the proxy for it given by the environment.
+// For an exec sink, the command's program must be found.
+func probeSink(c sinkConfig) error {
+	switch c.Type {
+	case "stdout", "kubernetes", "memory":
+		return nil
+	case "exec":
+		fields := strings.Fields(c.Command)
+		if len(fields) == 0 {
+			return fmt.Errorf("command is empty")
+		}
+		_, err := exec.LookPath(fields[0])
+		return err
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return err
+	}
+	if proxy, err := http.ProxyFromEnvironment(&http.Request{URL: u}); err == nil && proxy != nil {
+		u = proxy
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", host, checkTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// windowBuckets is the number of buckets a sliding window is divided into.
+// More buckets make the window slide more smoothly, at the cost of memory per namespace.
+const windowBuckets = 12
+
+// slidingWindow counts events over a period of time by dividing it into buckets, discarding old buckets as time passes.
+type slidingWindow struct {
+	width  int64 // Bucket width in nanoseconds.
+	epochs [windowBuckets]int64
+	counts [windowBuckets]int
+}
+
+// newSlidingWindow creates a sliding window covering the given period.
+func newSlidingWindow(period time.Duration) *slidingWindow {
+	width := int64(period) / windowBuckets
+	if width < 1 {
+		width = 1
+	}
+	return &slidingWindow{width: width}
+}
+
+// add counts an event at the given time and returns the number of events in the window.
+func (w *slidingWindow) add(t time.Time) int {
+	epoch := t.UnixNano() / w.width
+	i := epoch % windowBuckets
+	if w.epochs[i] != epoch {
+		w.epochs[i] = epoch
+		w.counts[i] = 0
+	}
+	w.counts[i]++
+
+	total := 0
+	for i := range w.counts {
+		if epoch-w.epochs[i] < windowBuckets {
+			total += w.counts[i]
+		}
+	}
+	return total
+}
+
+// namespaceKey identifies a namespace in a cluster.
+type namespaceKey struct {
+	cluster   string
+	namespace string
+}
+
+// churnTracker counts pod creations and deletions per namespace of each cluster, and warns when there are more than a threshold within a window.
+// A high rate of churn usually means pods are crash looping or being autoscaled out of control.
+// Updates are not counted because every pod is updated at each resync.
+type churnTracker struct {
+	threshold int
+	window    time.Duration
+
+	mu       sync.Mutex
+	counts   map[namespaceKey]*slidingWindow
+	alerting map[namespaceKey]bool
+}
+
+// churn tracks the rate of pod events if enabled with the -rate-threshold flag, and is otherwise nil.
+var churn *churnTracker
+
+// newChurnTracker creates a churn tracker.
+func newChurnTracker(threshold int, window time.Duration) *churnTracker {
+	return &churnTracker{
+		threshold: threshold,
+		window:    window,
+		counts:    make(map[namespaceKey]*slidingWindow),
+		alerting:  make(map[namespaceKey]bool),
+	}
+}
+
+// observe counts an event, returning a warning event if it takes its namespace over the threshold.
+// Only one warning is returned until the rate drops below the threshold again.
+func (c *churnTracker) observe(e event) (event, bool) {
+	switch e.Type {
+	case eventCreated:
+		// Pods that existed before the watcher started are "created" when they are first added to the cache.
+		if e.Pod.CreationTimestamp.Time.Before(e.Time.Add(-c.window)) {
+			return event{}, false
+		}
+	case eventDeleted:
+	default:
+		return event{}, false
+	}
+
+	key := namespaceKey{cluster: e.cluster(), namespace: e.Namespace}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w, ok := c.counts[key]
+	if !ok {
+		w = newSlidingWindow(c.window)
+		c.counts[key] = w
+	}
+	n := w.add(e.Time)
+	if n <= c.threshold {
+		c.alerting[key] = false
+		return event{}, false
+	}
+	if c.alerting[key] {
+		return event{}, false
+	}
+	c.alerting[key] = true
+
+	return event{
+		Cluster:   key.cluster,
+		Type:      eventRateExceeded,
+		Time:      e.Time,
+		Namespace: e.Namespace,
+		Message:   fmt.Sprintf("%d pods created or deleted in the last %s (threshold %d)", n, c.window, c.threshold),
+		ctx:       e.ctx,
+	}, true
+}
+
+// forgetCluster removes the namespaces of a cluster that is no longer watched.
+func (c *churnTracker) forgetCluster(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.counts {
+		if key.cluster == name {
+			delete(c.counts, key)
+			delete(c.alerting, key)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// clusterEvent returns a pod event from the pod handlers of a cluster.
+func clusterEvent(cluster string, t eventType, pod *v1.Pod) event {
+	ctx := withCluster(context.Background(), newClusterForClientset(cluster, fake.NewSimpleClientset()))
+	return newPodEvent(ctx, t, pod)
+}
+
+func TestChurnPerCluster(t *testing.T) {
+	c := newChurnTracker(2, time.Minute)
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", CreationTimestamp: metav1.Now()}}
+	for i := 0; i < 2; i++ {
+		for _, cluster := range []string{"prod", "staging"} {
+			if e, ok := c.observe(clusterEvent(cluster, eventCreated, pod)); ok {
+				t.Fatalf("got %s in %s, want the clusters counted separately", e.summary(), e.Cluster)
+			}
+		}
+	}
+	e, ok := c.observe(clusterEvent("prod", eventCreated, pod))
+	if !ok || e.Cluster != "prod" || e.cluster() != "prod" {
+		t.Fatalf("got %v in %q, want a rate-exceeded event in prod", ok, e.Cluster)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// clusterCheckTimeout is how long a check of a cluster's API server may take before it counts as a failure.
+const clusterCheckTimeout = 10 * time.Second
+
+// clusterHealth tracks whether a cluster's API server can be reached.
+type clusterHealth struct {
+	mu sync.Mutex
+	// since is the time of the last successful check, or when checking started if there has not been one.
+	since       time.Time
+	lastContact time.Time
+	lastErr     error
+	checked     bool
+	unreachable bool
+}
+
+// clusterStatus is the connection state of a cluster, as reported by the /stats admin endpoint.
+type clusterStatus struct {
+	Name             string     `json:"name"`
+	Reachable        bool       `json:"reachable"`
+	LastContact      *time.Time `json:"lastContact,omitempty"`
+	LastError        string     `json:"lastError,omitempty"`
+	UnreachableSince *time.Time `json:"unreachableSince,omitempty"`
+}
+
+// The cluster metric instruments.
+var (
+	_, _ = meter.Int64ObservableGauge("pod_event_watcher.cluster.reachable",
+		metric.WithDescription("Whether the last check of each cluster's API server succeeded (1) or failed (0)."),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			for _, c := range watchedClusters.list() {
+				status := c.status()
+				if !status.Reachable && status.LastError == "" {
+					continue // Not checked yet.
+				}
+				reachable := int64(0)
+				if status.Reachable {
+					reachable = 1
+				}
+				o.Observe(reachable, metric.WithAttributes(attribute.String("cluster", c.name)))
+			}
+			return nil
+		}))
+)
+
+// checkHealth checks that the cluster's API server can be reached every interval until the context is cancelled.
+// Once it has not been reached for unreachableAfter, a cluster-unreachable event is sent, and a cluster-recovered event follows when it is reached again.
+func (c *cluster) checkHealth(ctx context.Context, interval time.Duration, unreachableAfter time.Duration) {
+	c.health.mu.Lock()
+	c.health.since = time.Now()
+	c.health.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := c.ping(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if e, ok := c.health.observe(c.name, time.Now(), err, unreachableAfter); ok {
+			publish(e)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ping checks that the cluster's API server is ready.
+func (c *cluster) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, clusterCheckTimeout)
+	defer cancel()
+	return c.clientset.Discovery().RESTClient().Get().AbsPath("/readyz").Do(ctx).Error()
+}
+
+// status returns the connection state of the cluster.
+func (c *cluster) status() clusterStatus {
+	h := &c.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status := clusterStatus{Name: c.name, Reachable: h.checked && h.lastErr == nil}
+	if !h.lastContact.IsZero() {
+		t := h.lastContact
+		status.LastContact = &t
+	}
+	if h.lastErr != nil {
+		status.LastError = h.lastErr.Error()
+	}
+	if h.unreachable {
+		t := h.since
+		status.UnreachableSince = &t
+	}
+	return status
+}
+
+// observe records the result of a check of a cluster, returning a cluster-unreachable event if the cluster has now not been reached for unreachableAfter (unless that is 0), or a cluster-recovered event if it was unreachable and has been reached again.
+func (h *clusterHealth) observe(cluster string, now time.Time, err error, unreachableAfter time.Duration) (event, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checked, h.lastErr = true, err
+	if err == nil {
+		outage := now.Sub(h.since)
+		h.since, h.lastContact = now, now
+		if !h.unreachable {
+			return event{}, false
+		}
+		h.unreachable = false
+		return event{
+			Cluster: cluster,
+			Type:    eventClusterRecovered,
+			Time:    now,
+			Message: fmt.Sprintf("unreachable for %s", outage.Round(time.Second)),
+		}, true
+	}
+
+	if h.unreachable || unreachableAfter <= 0 || now.Sub(h.since) < unreachableAfter {
+		return event{}, false
+	}
+	h.unreachable = true
+	return event{
+		Cluster: cluster,
+		Type:    eventClusterUnreachable,
+		Time:    now,
+		Message: fmt.Sprintf("API server not reached for %s: %v", now.Sub(h.since).Round(time.Second), err),
+	}, true
+}
@@ -0,0 +1,715 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// clustersConfig is the contents of the clusters file given by the -clusters flag.
+//
+// Example:
+//
+//	clusters:
+//	- context: prod-eu
+//	- name: prod-us
+//	  context: arn:aws:eks:us-east-1:123456789012:cluster/prod
+//	  kubeconfig: /etc/pod-event-watcher/prod-us.kubeconfig
+//	  namespaces: [payments, checkout]
+//	  selector: tier=frontend
+//	  filter:
+//	    events: [deleted, crash-loop, oom-killed]
+type clustersConfig struct {
+	Clusters []clusterConfig `json:"clusters"`
+}
+
+// clusterConfig configures one cluster to watch.
+type clusterConfig struct {
+	// Name identifies the cluster in messages. It defaults to the context.
+	Name string `json:"name,omitempty"`
+	// Context is the kubeconfig context for the cluster. It defaults to the current context.
+	Context string `json:"context,omitempty"`
+	// Kubeconfig is the path of the kubeconfig file with the context. It defaults to the -kubeconfig flag.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// Namespaces are the namespaces to watch in the cluster, each separately. They default to the -namespace flag.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Selector is the label selector of the pods to watch in the cluster. It defaults to the -selector flag.
+	Selector string `json:"selector,omitempty"`
+	// Filter selects the events from the cluster that are sent to the sinks, in addition to the sinks' own filters.
+	Filter filter `json:"filter,omitempty"`
+}
+
+// loadClustersConfig reads a clusters file.
+func loadClustersConfig(path string) ([]clusterConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c clustersConfig
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(c.Clusters) == 0 {
+		return nil, fmt.Errorf("%s: no clusters", path)
+	}
+	return c.Clusters, nil
+}
+
+// listFlag is a list of values such as kubeconfig contexts, given either as a comma-separated list or by repeating the flag.
+type listFlag []string
+
+// String returns the values as a list.
+func (f *listFlag) String() string {
+	return fmt.Sprint([]string(*f))
+}
+
+// Set adds the values in a comma-separated list.
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, splitList(value)...)
+	return nil
+}
+
+// kubeconfigRESTConfig returns the client configuration for a context in a kubeconfig file, or for the file's current context if context is empty.
+func kubeconfigRESTConfig(kubeconfig string, context string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		rules.ExplicitPath = kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+}
+
+// clusterName is the name of the cluster when only one is watched, for the events that do not come from a particular cluster's pod handlers, such as reports.
+// It is empty when several clusters are watched.
+var clusterName string
+
+// clusterKey is the context key for the cluster that a pod handler was called for.
+type clusterKey struct{}
+
+// withCluster returns a context for the pod handlers of a cluster.
+func withCluster(ctx context.Context, c *cluster) context.Context {
+	return context.WithValue(ctx, clusterKey{}, c)
+}
+
+// contextCluster returns the name of the cluster that a pod handler was called for, or clusterName if the context is not from a pod handler.
+func contextCluster(ctx context.Context) string {
+	if ctx != nil {
+		if c, ok := ctx.Value(clusterKey{}).(*cluster); ok {
+			return c.name
+		}
+	}
+	return clusterName
+}
+
+// detachedContext returns a context with only the cluster of a pod handler's context, for the events about a pod that are published after the handler has returned.
+func detachedContext(ctx context.Context) context.Context {
+	detached := context.Background()
+	if ctx != nil {
+		if c, ok := ctx.Value(clusterKey{}).(*cluster); ok {
+			detached = withCluster(detached, c)
+		}
+	}
+	return detached
+}
+
+// clusterContext returns a context for the events about a cluster that are not published by its pod handlers, such as anomalies found from the counts of its events, so that they pass through the cluster's filter.
+func clusterContext(name string) context.Context {
+	ctx := context.Background()
+	if c := watchedClusters.named(name); c != nil && c.name == name {
+		ctx = withCluster(ctx, c)
+	}
+	return ctx
+}
+
+// clusterAllows reports whether an event passes the filter of the cluster whose pod handler it came from.
+// Events that were not detected by a cluster's pod handlers, such as reports, always pass.
+func clusterAllows(e event) bool {
+	if e.ctx == nil {
+		return true
+	}
+	c, ok := e.ctx.Value(clusterKey{}).(*cluster)
+	return !ok || c.filter == nil || c.filter.matches(e)
+}
+
+// clusterPrefix returns the prefix for log lines about a cluster, e.g. "[prod] ", or an empty string if it has no name.
+func clusterPrefix(name string) string {
+	if name == "" {
+		return ""
+	}
+	return "[" + name + "] "
+}
+
+// clusterHosts maps the host and port of each cluster's API server to the cluster's name, for the client-go metrics, which only know the URL of each request.
+var clusterHosts sync.Map
+
+// hostCluster returns the name of the cluster with an API server, or clusterName if it is not known.
+func hostCluster(host string) string {
+	if name, ok := clusterHosts.Load(host); ok {
+		return name.(string)
+	}
+	return clusterName
+}
+
+// currentContext returns the context that a kubeconfig loader uses, or an empty string if it cannot be loaded.
+func currentContext(loader clientcmd.ClientConfig, override string) string {
+	if override != "" {
+		return override
+	}
+	raw, err := loader.RawConfig()
+	if err != nil {
+		return ""
+	}
+	return raw.CurrentContext
+}
+
+// detectClusterName returns a name for a cluster that was not given one: its kubeconfig context if there is one, or else (e.g. when running in the cluster) the UID of the kube-system namespace, which stays the same for the life of the cluster.
+func detectClusterName(ctx context.Context, clientset kubernetes.Interface, context string) (string, error) {
+	if context != "" {
+		return context, nil
+	}
+	ns, err := clientset.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("detecting the cluster name (use -cluster-name to set it): %v", err)
+	}
+	return string(ns.UID), nil
+}
+
+// cluster watches the pods in one Kubernetes cluster, with its own clients and shards.
+type cluster struct {
+	name      string
+	source    clusterConfig
+	config    *rest.Config
+	client    *http.Client
+	clientset kubernetes.Interface
+	shards    []*shard
+	health    clusterHealth
+	// credentials tracks whether the API server is rejecting the cluster's credentials.
+	credentials credentialState
+	// filter, if not nil, selects the events from the cluster that are sent to the sinks.
+	filter *route
+	// stop stops the cluster's informers and watchers.
+	stop context.CancelFunc
+	// removed is set when the cluster is no longer watched, so that the events its watchers handle while draining their queues are ignored.
+	removed atomic.Bool
+}
+
+// newCluster creates the clients for a cluster, which share an HTTP client that retries the requests rejected as unauthorized up to credentialRetries times.
+// Protobuf is requested for the built-in types unless contentType is "json", falling back to JSON for anything that can only be sent as JSON.
+func newCluster(name string, config *rest.Config, contentType string, credentialRetries int) (*cluster, error) {
+	if contentType != "json" {
+		config.ContentType = runtime.ContentTypeProtobuf
+		config.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	}
+	if chaos != nil {
+		config.Wrap(chaos.wrap)
+	}
+	c := &cluster{config: config}
+	var err error
+	if c.client, err = newCredentialClient(c, config, credentialRetries); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if c.clientset, err = kubernetes.NewForConfigAndClient(config, c.client); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	c.setName(name)
+	return c, nil
+}
+
+// newClusterForClientset creates a cluster that uses a clientset, such as the fake clientset from k8s.io/client-go/kubernetes/fake, so that the watch and the pod handlers can be run without an API server.
+// The cluster has no configuration, so it cannot use -metadata-only.
+func newClusterForClientset(name string, clientset kubernetes.Interface) *cluster {
+	c := &cluster{clientset: clientset}
+	c.setName(name)
+	return c
+}
+
+// setName names the cluster, and records the name for its API server requests.
+func (c *cluster) setName(name string) {
+	c.name = name
+	if host := c.host(); host != "" {
+		clusterHosts.Store(host, name)
+	}
+}
+
+// host returns the host and port of the cluster's API server, or an empty string for a cluster without a configuration.
+func (c *cluster) host() string {
+	if c.config == nil {
+		return ""
+	}
+	if u, err := url.Parse(c.config.Host); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return c.config.Host
+}
+
+// clusterSource is where the clusters to watch are listed: the clusters file and the -context flags.
+type clusterSource struct {
+	path        string
+	contexts    []string
+	kubeconfig  string
+	contentType string
+	// credentialRetries is the number of times a request rejected as unauthorized is retried.
+	credentialRetries int
+	// configure, if not nil, adjusts each cluster's configuration, e.g. with the -server and -token flags.
+	configure func(*rest.Config)
+}
+
+// configs returns the clusters in the clusters file followed by the contexts, with their names filled in.
+func (s clusterSource) configs() ([]clusterConfig, error) {
+	var configs []clusterConfig
+	if s.path != "" {
+		var err error
+		if configs, err = loadClustersConfig(s.path); err != nil {
+			return nil, err
+		}
+	}
+	for _, context := range s.contexts {
+		configs = append(configs, clusterConfig{Context: context})
+	}
+	names := make(map[string]bool)
+	for i := range configs {
+		if configs[i].Name == "" {
+			configs[i].Name = configs[i].Context
+		}
+		if names[configs[i].Name] {
+			return nil, fmt.Errorf("cluster %q is given more than once", configs[i].Name)
+		}
+		names[configs[i].Name] = true
+	}
+	return configs, nil
+}
+
+// newCluster creates the clients for a cluster in the source.
+func (s clusterSource) newCluster(cc clusterConfig) (*cluster, error) {
+	path := cc.Kubeconfig
+	if path == "" {
+		path = s.kubeconfig
+	}
+	restConfig, err := kubeconfigRESTConfig(path, cc.Context)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", cc.Name, err)
+	}
+	if s.configure != nil {
+		s.configure(restConfig)
+	}
+	c, err := newCluster(cc.Name, restConfig, s.contentType, s.credentialRetries)
+	if err != nil {
+		return nil, err
+	}
+	c.source = cc
+	if _, err := labels.Parse(cc.Selector); err != nil {
+		return nil, fmt.Errorf("%s: %v", cc.Name, err)
+	}
+	for _, t := range cc.Filter.Events {
+		if !validEventType(t) {
+			return nil, fmt.Errorf("%s: unknown event type %q", cc.Name, t)
+		}
+	}
+	r, err := newRoute(cc.Name, nil, cc.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", cc.Name, err)
+	}
+	c.filter = &r
+	return c, nil
+}
+
+// newClusters creates a cluster for each entry in the clusters file and each context, or else a single cluster with the given configuration.
+func newClusters(source clusterSource, config func() (*rest.Config, error)) ([]*cluster, error) {
+	configs, err := source.configs()
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		restConfig, err := config()
+		if err != nil {
+			return nil, err
+		}
+		if source.configure != nil {
+			source.configure(restConfig)
+		}
+		c, err := newCluster("", restConfig, source.contentType, source.credentialRetries)
+		if err != nil {
+			return nil, err
+		}
+		return []*cluster{c}, nil
+	}
+
+	var clusters []*cluster
+	for _, cc := range configs {
+		c, err := source.newCluster(cc)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
+
+// watchOptions are the settings for watching the pods in every cluster, unless the clusters file sets the namespaces or selector for a cluster.
+type watchOptions struct {
+	namespace    string
+	nodes        bool
+	probeEvents  bool
+	disruptions  bool
+	metadataOnly bool
+	// recordEvents is set if events are recorded as Kubernetes Events on their pods, which needs permission to create and patch events.
+	recordEvents bool
+	// crashLogs is set if the logs of crashed containers are fetched or captured, which needs permission to get pods/log.
+	crashLogs bool
+	// budgets is set if the PodDisruptionBudgets of evicted pods are reported, which needs permission to list and watch poddisruptionbudgets.policy.
+	budgets bool
+	// networkPolicies is set if new pods are checked against the NetworkPolicies, which needs permission to list and watch networkpolicies.networking.k8s.io.
+	networkPolicies bool
+	// describe is set if pods are described with their Kubernetes Events by -details=describe, which needs permission to list events.
+	describe bool
+	// usage is set if the usage of the pods is listed from the metrics API, which needs permission to list pods.metrics.k8s.io.
+	usage bool
+	// debugContainers is set if debug containers are added to crash looping pods, which needs permission to patch pods/ephemeralcontainers.
+	debugContainers bool
+	// annotatePods is set if the pods are patched with annotations, which needs permission to patch pods.
+	annotatePods bool
+	// preflight is the -rbac-preflight mode, for clusters with a configuration; the fake clusters of -simulate and -replay-fixture are not checked.
+	preflight string
+	// checkInterval is the time between checks that the cluster's API server can be reached (0 to disable), and unreachableAfter is the time without reaching it after which a cluster-unreachable event is sent.
+	checkInterval    time.Duration
+	unreachableAfter time.Duration
+	// store is the cache of pods in every cluster, for looking up the pods that Kubernetes events are about.
+	store cache.Store
+	// pods are the options for the watchers, with the Namespace, Factory and Metadata of each shard filled in by watch.
+	pods watcher.Options
+}
+
+// scope returns the options with the namespaces and selector set for the cluster in the clusters file, if there are any.
+func (c *cluster) scope(opts watchOptions) watchOptions {
+	if len(c.source.Namespaces) > 0 {
+		opts.namespace = strings.Join(c.source.Namespaces, ",")
+	}
+	if c.source.Selector != "" {
+		opts.pods.Selector = c.source.Selector
+	}
+	return opts
+}
+
+// listOnce lists the cluster's pods and calls podCreated for each of them in order of namespace and name, as happens for the existing pods when they are watched, but without watching them.
+func (c *cluster) listOnce(ctx context.Context, opts watchOptions) error {
+	opts = c.scope(opts)
+	store, err := listClusterPods(ctx, c.clientset, splitList(opts.namespace), opts.pods.Selector)
+	if err != nil {
+		return fmt.Errorf("%s: %v", c.name, err)
+	}
+	ctx = withCluster(ctx, c)
+	pods := snapshot(store).Items
+	for i := range pods {
+		if opts.pods.Filter == nil || opts.pods.Filter(&pods[i]) {
+			if opts.pods.Transform != nil {
+				opts.pods.Transform(&pods[i])
+			}
+			podCreated(ctx, &pods[i])
+		}
+	}
+	return nil
+}
+
+// watch creates the cluster's shards, and watches for the nodes and events that explain failures and deletions, waiting until they are known before watching the pods.
+// The informers share a factory, so that each type of object is only listed and watched once.
+// When several namespaces are watched, each has its own factory for its events, and the nodes are in a factory of their own.
+// Everything runs until the context is cancelled or the cluster is stopped.
+func (c *cluster) watch(ctx context.Context, opts watchOptions) error {
+	ctx, c.stop = context.WithCancel(ctx)
+	if opts.checkInterval > 0 {
+		go c.checkHealth(ctx, opts.checkInterval, opts.unreachableAfter)
+	}
+	opts = c.scope(opts)
+	if opts.preflight != preflightOff && c.config != nil {
+		var err error
+		if opts, err = c.preflight(ctx, opts, opts.preflight); err != nil {
+			c.stop()
+			return err
+		}
+	}
+	newFactory := func(namespace string) informers.SharedInformerFactory {
+		return informers.NewSharedInformerFactoryWithOptions(c.clientset, 0, informers.WithNamespace(namespace))
+	}
+	c.shards = newShards(c.name, newFactory(opts.namespace), opts.namespace, newFactory)
+	factory := c.shards[0].factory
+	if len(c.shards) > 1 {
+		factory = newFactory(metav1.NamespaceAll)
+	}
+	if opts.nodes {
+		watchNodes(factory)
+	}
+	for _, s := range c.shards {
+		if opts.probeEvents {
+			// The handler is added once the pods are cached, but the informer is added now so that it is started with the others.
+			podEventsInformer(s.factory, s.namespace)
+		}
+		if opts.disruptions {
+			watchDisruptionEvents(s.factory, s.namespace)
+		}
+		if opts.networkPolicies {
+			s.watchNetworkPolicies()
+		}
+		if opts.budgets {
+			s.watchDisruptionBudgets()
+		}
+	}
+	if len(c.shards) > 1 {
+		startInformers(factory, ctx.Done())
+	}
+	startShardInformers(c.shards, ctx.Done())
+
+	var metadataClient metadata.Interface
+	if opts.metadataOnly {
+		if c.config == nil {
+			c.stop()
+			return fmt.Errorf("%s: -metadata-only needs the cluster's configuration", c.name)
+		}
+		var err error
+		if metadataClient, err = metadata.NewForConfigAndClient(c.config, c.client); err != nil {
+			c.stop()
+			return fmt.Errorf("%s: %v", c.name, err)
+		}
+	}
+	for _, s := range c.shards {
+		podOpts := opts.pods
+		podOpts.Namespace, podOpts.Factory, podOpts.Metadata = s.namespace, s.factory, metadataClient
+		podOpts.ListWatch = watcher.ClientsetListWatch(c.clientset, s.namespace, podOpts.Selector)
+		if fixture != nil {
+			podOpts.ListWatch = &fixtureListWatch{ListerWatcher: podOpts.ListWatch, cluster: c.name, namespace: s.namespace}
+		}
+		podOpts.WatchErrorHandler = s.watchError
+		s.watcher, s.lw = watchPods(ctx, c, podOpts)
+		go s.logSync(ctx)
+		if opts.probeEvents {
+			probes.watch(c, podEventsInformer(s.factory, s.namespace), opts.store)
+		}
+	}
+	return nil
+}
+
+// watchClusters starts watching each cluster concurrently, so that a cluster whose nodes or events are slow to list does not hold up the others, and returns the error (if any) for each.
+func watchClusters(ctx context.Context, clusters []*cluster, opts watchOptions) []error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(clusters))
+	for i, c := range clusters {
+		wg.Add(1)
+		go func(i int, c *cluster) {
+			defer wg.Done()
+			errs[i] = c.watch(ctx, opts)
+		}(i, c)
+	}
+	wg.Wait()
+	return errs
+}
+
+// clusterSet is the clusters being watched, which change as the clusters file is edited.
+type clusterSet struct {
+	mu       sync.RWMutex
+	clusters []*cluster
+}
+
+// watchedClusters are the clusters whose pods are being watched.
+var watchedClusters = &clusterSet{}
+
+// list returns the clusters being watched.
+func (s *clusterSet) list() []*cluster {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*cluster(nil), s.clusters...)
+}
+
+// shards returns the shards of every cluster being watched.
+func (s *clusterSet) shards() []*shard {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var shards []*shard
+	for _, c := range s.clusters {
+		shards = append(shards, c.shards...)
+	}
+	return shards
+}
+
+// named returns the cluster with a name, or the only cluster being watched if none has the name, as the events from a single cluster may be named by -cluster-name instead. It returns nil if there is no such cluster.
+func (s *clusterSet) named(name string) *cluster {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.clusters {
+		if c.name == name {
+			return c
+		}
+	}
+	if len(s.clusters) == 1 {
+		return s.clusters[0]
+	}
+	return nil
+}
+
+// add adds clusters that are being watched.
+func (s *clusterSet) add(clusters ...*cluster) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clusters = append(s.clusters, clusters...)
+}
+
+// remove stops watching a cluster and removes it. Its pods are forgotten without deleted events being sent.
+func (s *clusterSet) remove(c *cluster) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, other := range s.clusters {
+		if other == c {
+			s.clusters = append(s.clusters[:i:i], s.clusters[i+1:]...)
+			break
+		}
+	}
+	c.removed.Store(true)
+	c.stop()
+	clusterHosts.Delete(c.host())
+	forgetCluster(c.name)
+}
+
+// forgetCluster removes the pods and workloads of a cluster that is no longer watched from the trackers, so that they send no more events about them.
+func forgetCluster(name string) {
+	if pending != nil {
+		pending.forgetCluster(name)
+	}
+	crashLoops.forgetCluster(name)
+	readiness.forgetCluster(name)
+	if firstSeen != nil {
+		firstSeen.forgetCluster(name)
+	}
+	if slos != nil {
+		slos.forgetCluster(name)
+	}
+	fleet.forgetCluster(name)
+	restarts.forgetCluster(name)
+	rollouts.forgetCluster(name)
+	if debounce != nil {
+		debounce.forgetCluster(name)
+	}
+	if flapping != nil {
+		flapping.forgetCluster(name)
+	}
+	if probes != nil {
+		probes.forgetCluster(name)
+	}
+	if deletions != nil {
+		deletions.forgetCluster(name)
+	}
+	if annotations != nil {
+		annotations.forgetCluster(name)
+	}
+	if captures != nil {
+		captures.forgetCluster(name)
+	}
+	if debugContainers != nil {
+		debugContainers.forgetCluster(name)
+	}
+	if churn != nil {
+		churn.forgetCluster(name)
+	}
+	if anomalies != nil {
+		anomalies.forgetCluster(name)
+	}
+}
+
+// clusterReloadInterval is the time between checks for changes to the clusters file.
+const clusterReloadInterval = 5 * time.Second
+
+// reloadClustersPeriodically checks the clusters file for changes until the context is cancelled, and reloads it whenever it is modified.
+// If single is true, as with -watch-nodes, a file listing more than one cluster is not loaded.
+func reloadClustersPeriodically(ctx context.Context, source clusterSource, opts watchOptions, single bool) {
+	info, err := os.Stat(source.path)
+	if err != nil {
+		log.Printf("Clusters error: %v\n", err)
+		return
+	}
+	modTime := info.ModTime()
+	ticker := time.NewTicker(clusterReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(source.path)
+		if err != nil {
+			log.Printf("Clusters error: %v\n", err)
+			continue
+		}
+		if info.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+		if err := reloadClusters(ctx, source, opts, single); err != nil {
+			log.Printf("Clusters error: %v\n", err)
+		}
+	}
+}
+
+// reloadClusters stops watching the clusters that have been removed from the source, and starts watching the clusters that have been added to it.
+// A cluster whose settings have changed is stopped and started again. The other clusters carry on undisturbed.
+func reloadClusters(ctx context.Context, source clusterSource, opts watchOptions, single bool) error {
+	configs, err := source.configs()
+	if err != nil {
+		return err
+	}
+	if single && len(configs) > 1 {
+		return fmt.Errorf("%s: only one cluster can be watched with -watch-nodes or -state-file", source.path)
+	}
+	wanted := make(map[string]clusterConfig)
+	for _, cc := range configs {
+		wanted[cc.Name] = cc
+	}
+	running := make(map[string]bool)
+	for _, c := range watchedClusters.list() {
+		if cc, ok := wanted[c.name]; ok && reflect.DeepEqual(cc, c.source) {
+			running[c.name] = true
+			continue
+		}
+		watchedClusters.remove(c)
+		log.Printf("Stopped watching cluster %s\n", c.name)
+	}
+
+	var added []*cluster
+	for _, cc := range configs {
+		if running[cc.Name] {
+			continue
+		}
+		c, err := source.newCluster(cc)
+		if err != nil {
+			log.Printf("Clusters error: %v\n", err)
+			continue
+		}
+		added = append(added, c)
+	}
+	for i, err := range watchClusters(ctx, added, opts) {
+		if err != nil {
+			log.Printf("Clusters error: %v\n", err)
+			continue
+		}
+		watchedClusters.add(added[i])
+		log.Printf("Watching cluster %s\n", added[i].name)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRemoveClusterSendsNoMoreEvents(t *testing.T) {
+	debounce = newDebouncer(50 * time.Millisecond)
+	flapping = newFlapTracker(1, time.Minute)
+	t.Cleanup(func() { debounce, flapping = nil, nil })
+	testSink.Reset()
+
+	staging := newClusterForClientset("staging", fake.NewSimpleClientset())
+	staging.stop = func() {}
+	set := &clusterSet{clusters: []*cluster{staging}}
+	for _, name := range []string{"staging", "prod"} {
+		ctx := withCluster(context.Background(), newClusterForClientset(name, fake.NewSimpleClientset()))
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-" + name, Namespace: "default", UID: "web-" + types.UID(name)}}
+		debounce.hold(newPodEvent(ctx, eventCreated, pod))
+		ready := pod.DeepCopy()
+		ready.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+		flapping.observe(newPodEvent(ctx, eventUpdated, ready), pod)
+	}
+	set.remove(staging)
+
+	if n := len(set.list()); n != 0 {
+		t.Errorf("got %d clusters, want none", n)
+	}
+	// The held back created event for prod is still delivered, but not the one for staging.
+	waitForEvent(t, eventCreated, "web-prod")
+	time.Sleep(100 * time.Millisecond)
+	for _, e := range testSink.Events() {
+		if e.cluster() == "staging" {
+			t.Errorf("got %s from a removed cluster", e.summary())
+		}
+	}
+	if _, ok := flapping.changes["web-staging"]; ok {
+		t.Error("got readiness changes for a pod of a removed cluster")
+	}
+	if _, ok := flapping.changes["web-prod"]; !ok {
+		t.Error("got no readiness changes for a pod of a watched cluster")
+	}
+}
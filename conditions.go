@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// logConditions enables a log line for each change to a pod's conditions.
+var logConditions bool
+
+// observeConditions logs the conditions of a pod that have changed status since the old pod, each with the pod's lifecycle so far.
+func observeConditions(e event, oldPod *v1.Pod) {
+	if !logConditions || e.Type != eventUpdated {
+		return
+	}
+	for _, c := range e.Pod.Status.Conditions {
+		if old := podCondition(oldPod, c.Type); old != nil && old.Status == c.Status {
+			continue
+		}
+		status := string(c.Type) + "=" + string(c.Status)
+		if c.Reason != "" {
+			status += " (" + c.Reason + ")"
+		}
+		log.Printf("%sPod condition changed: %s %s at %s: %s\n", clusterPrefix(e.cluster()), e.Pod.Name, status, c.LastTransitionTime.UTC().Format(time.RFC3339), conditionNarrative(e.Pod))
+	}
+}
+
+// conditionNarrative describes a pod's lifecycle from its conditions, in the order of their last transitions with the time between them, e.g. "created, PodScheduled +1s, Initialized +3s, ContainersReady +8s, Ready +0s".
+// The conditions that are not true are given with their status.
+func conditionNarrative(pod *v1.Pod) string {
+	conditions := append([]v1.PodCondition(nil), pod.Status.Conditions...)
+	sort.SliceStable(conditions, func(i, j int) bool {
+		return conditions[i].LastTransitionTime.Before(&conditions[j].LastTransitionTime)
+	})
+	steps := []string{"created"}
+	previous := pod.CreationTimestamp.Time
+	for _, c := range conditions {
+		step := string(c.Type)
+		if c.Status != v1.ConditionTrue {
+			step += "=" + string(c.Status)
+		}
+		if !c.LastTransitionTime.IsZero() {
+			step += fmt.Sprintf(" +%s", c.LastTransitionTime.Sub(previous).Round(time.Second))
+			previous = c.LastTransitionTime.Time
+		}
+		steps = append(steps, step)
+	}
+	return strings.Join(steps, ", ")
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// config is the contents of the configuration file given by the -config flag.
+//
+// Example:
+//
+//	sinks:
+//	- type: stdout
+//	  details: true
+//	- type: slack
+//	  url: https://hooks.slack.com/services/...
+//	  filter:
+//	    events: [created, deleted]
+//	    namespaces: [production]
+//	    selector: tier=frontend
+//	    severity: critical
+type config struct {
+	Sinks []sinkConfig `json:"sinks"`
+}
+
+// sinkConfig configures one sink. Fields that do not apply to the sink type are ignored.
+type sinkConfig struct {
+	// Type is one of stdout, webhook, slack, teams, discord, exec, kubernetes, which records the events as Kubernetes Events on their pods, or memory, which keeps them for tests.
+	Type string `json:"type"`
+	// Name identifies the sink in log messages, metrics and the dead-letter file. It defaults to the type.
+	Name string `json:"name,omitempty"`
+	// URL is the webhook URL for all types except stdout, exec, kubernetes and memory.
+	URL string `json:"url,omitempty"`
+	// SecretFile is the path of a file with a shared secret that each request is signed with, in the X-Signature and X-Signature-Timestamp headers (webhook only). It is read again when the configuration is reloaded.
+	SecretFile string `json:"secretFile,omitempty"`
+	// Command is the shell command to run for each event (exec only).
+	Command string `json:"command,omitempty"`
+	// Concurrency is the maximum number of commands running at once (exec only, default 4).
+	Concurrency int `json:"concurrency,omitempty"`
+	// Timeout is the time after which a command is killed (exec only, default 30s).
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+	// Details prints pod object details (stdout only): true or dump for a dump of the pod object, or describe for a description as by kubectl describe.
+	Details detailsMode `json:"details,omitempty"`
+	// Interval is the minimum time between messages (teams only).
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// Rate is the maximum number of deliveries per minute. Zero means unlimited, except for discord which defaults to 30.
+	Rate int `json:"rate,omitempty"`
+	// Buffer is the number of events queued for the sink, so that it is sent events in the background. Zero means the events are sent by the bus, holding up the other sinks while they are sent.
+	Buffer int `json:"buffer,omitempty"`
+	// Overflow is what happens to events when the buffer is full: block (wait for room), drop-oldest or drop-newest (the default).
+	Overflow string `json:"overflow,omitempty"`
+	// Limit is the number of most recent events kept (memory only, default 10000).
+	Limit int `json:"limit,omitempty"`
+	// Failures is the number of attempts to deliver each event that fail on purpose, for testing retries (memory only).
+	Failures int `json:"failures,omitempty"`
+	// Path is the file that the events kept are written to as JSON lines when the sink is closed, e.g. when -replay-fixture ends (memory only).
+	Path string `json:"path,omitempty"`
+	// Group is the interval for which the events about pods are batched per owning workload, so that the sink is sent a workload-summary event for each workload instead of an event for each pod (all types except teams, which always groups its messages by workload).
+	Group metav1.Duration `json:"group,omitempty"`
+	// Retries is the number of times a delivery that fails is retried, with exponential backoff, before the event is written to the dead-letter file.
+	Retries int `json:"retries,omitempty"`
+	// Filter selects the events that the sink receives.
+	Filter filter `json:"filter,omitempty"`
+}
+
+// loadConfig reads a YAML or JSON configuration file.
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &c, nil
+}
+
+// loadSinkConfigs returns the sinks from the configuration file if there is one, otherwise a stdout sink that just logs the events.
+func loadSinkConfigs(configPath string, details detailsMode) ([]sinkConfig, error) {
+	if configPath == "" {
+		return []sinkConfig{{Type: "stdout", Details: details}}, nil
+	}
+	c, err := loadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return c.Sinks, nil
+}
+
+// addSinks creates the sinks described by sink configurations and adds them to the bus.
+func addSinks(configs []sinkConfig) error {
+	routes, err := sinkRoutes(configs)
+	if err != nil {
+		return err
+	}
+	for _, r := range routes {
+		events.add(r)
+	}
+	return nil
+}
+
+// reloadSinks creates the sinks described by sink configurations and replaces the configured sinks on the bus with them.
+func reloadSinks(configs []sinkConfig) error {
+	routes, err := sinkRoutes(configs)
+	if err != nil {
+		return err
+	}
+	events.replace(routes)
+	return nil
+}
+
+// sinkRoutes creates the sinks described by sink configurations and their routes.
+// If one of them cannot be created, the sinks that were created are closed.
+func sinkRoutes(configs []sinkConfig) ([]route, error) {
+	var routes []route
+	for _, c := range configs {
+		r, err := sinkRoute(c)
+		if err != nil {
+			for _, r := range routes {
+				if c, ok := r.sink.(io.Closer); ok {
+					c.Close()
+				}
+			}
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+// sinkRoute creates the sink described by a sink configuration and its route.
+func sinkRoute(c sinkConfig) (route, error) {
+	name := c.Name
+	if name == "" {
+		name = c.Type
+	}
+	r, err := newRoute(name, nil, c.Filter)
+	if err != nil {
+		return route{}, err
+	}
+	if c.Buffer > 0 && c.Overflow == "" {
+		c.Overflow = overflowDropNewest
+	}
+	if c.Buffer > 0 && !validOverflow(c.Overflow) {
+		return route{}, fmt.Errorf("%s sink: unknown overflow policy %q", c.Type, c.Overflow)
+	}
+	if r.sink, err = newSink(c); err != nil {
+		return route{}, err
+	}
+	r.retries, r.configured = c.Retries, true
+	if c.Buffer > 0 {
+		r.queue = newSinkQueue(c.Buffer, c.Overflow)
+	}
+	return r, nil
+}
+
+// newSink creates the sink described by a sink configuration.
+func newSink(c sinkConfig) (sink, error) {
+	switch {
+	case c.Type == "exec" && c.Command == "":
+		return nil, fmt.Errorf("exec sink: command is required")
+	case c.Type != "stdout" && c.Type != "exec" && c.Type != "kubernetes" && c.Type != "memory" && c.URL == "":
+		return nil, fmt.Errorf("%s sink: url is required", c.Type)
+	}
+	for _, t := range c.Filter.Events {
+		if !validEventType(t) {
+			return nil, fmt.Errorf("%s sink: unknown event type %q", c.Type, t)
+		}
+	}
+	if c.Filter.Severity != "" && !validSeverity(c.Filter.Severity) {
+		return nil, fmt.Errorf("%s sink: severity must be info, warning or critical", c.Type)
+	}
+
+	name := c.Name
+	if name == "" {
+		name = c.Type
+	}
+	policy := retryPolicy{sink: name, retries: c.Retries}
+
+	var s sink
+	switch c.Type {
+	case "stdout":
+		s = &stdoutSink{details: c.Details}
+	case "webhook":
+		var err error
+		if s, err = newWebhookSink(c.URL, c.SecretFile); err != nil {
+			return nil, err
+		}
+	case "slack":
+		s = &slackSink{url: c.URL}
+	case "teams":
+		interval := c.Interval.Duration
+		if interval == 0 {
+			interval = 30 * time.Second
+		}
+		s = newTeamsSink(c.URL, interval)
+	case "discord":
+		s = &discordSink{url: c.URL}
+		if c.Rate == 0 {
+			c.Rate = 30
+		}
+	case "exec":
+		concurrency := c.Concurrency
+		if concurrency == 0 {
+			concurrency = 4
+		}
+		timeout := c.Timeout.Duration
+		if timeout == 0 {
+			timeout = 30 * time.Second
+		}
+		s = newExecSink(c.Command, concurrency, timeout, policy)
+	case "kubernetes":
+		s = newRecorderSink()
+	case "memory":
+		name := c.Name
+		if name == "" {
+			name = c.Type
+		}
+		s = newMemorySink(name, c.Limit, c.Failures, c.Path)
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", c.Type)
+	}
+
+	if c.Rate > 0 {
+		s = newRateLimitedSink(s, c.Rate, policy)
+	}
+	if c.Group.Duration > 0 && c.Type != "teams" {
+		s = newGroupingSink(s, c.Group.Duration, policy)
+	}
+	return s, nil
+}
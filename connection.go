@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// connectionFlags are the flags for connecting to the clusters, which are shared by the subcommands that connect to them.
+type connectionFlags struct {
+	kubeconfig  *string
+	contexts    listFlag
+	clusters    *string
+	contentType *string
+	server      *string
+	token       *string
+	as          *string
+	asUID       *string
+	asGroups    listFlag
+	qps         *float64
+	burst       *int
+	proxy       *string
+	caFile      *string
+	certFile    *string
+	keyFile     *string
+	insecure    *bool
+	retries     *int
+
+	// kubectl is set to kubectl's own flags when running as a kubectl plugin, which take the place of -kubeconfig and -context.
+	kubectl *genericclioptions.ConfigFlags
+	// name is the default name of a single cluster once its configuration has been loaded: its kubeconfig context, or the host given by -server.
+	name string
+}
+
+// addConnectionFlags adds the flags for connecting to the clusters to a flag set.
+func addConnectionFlags(flags *flag.FlagSet) *connectionFlags {
+	f := &connectionFlags{}
+
+	// Optional path to .kube/config for authentication details.
+	// Logging in first may be required to authenticate (and thereby populate .kube/config) if running outside a cluster.
+	if home := homeDir(); home != "" {
+		f.kubeconfig = flags.String("kubeconfig", filepath.Join(home, ".kube", "config"), "absolute path to the kubeconfig file")
+	} else {
+		f.kubeconfig = flags.String("kubeconfig", "", "absolute path to the kubeconfig file")
+	}
+
+	// Optional kubeconfig contexts or clusters file, for watching several clusters at once.
+	flags.Var(&f.contexts, "context", "kubeconfig context of a cluster to watch, which can be repeated or given as a comma-separated list to watch several clusters (default the current context)")
+	f.clusters = flags.String("clusters", "", "path to a YAML or JSON file listing the clusters to watch, by kubeconfig context")
+
+	// Optional API server and bearer token, in place of those in the kubeconfig file or the in-cluster config.
+	f.server = flags.String("server", "", "address of the API server (e.g. \"https://10.0.0.1:6443\"), in place of the cluster's address in the kubeconfig file")
+	f.token = flags.String("token", "", "bearer token for authenticating to the API server, in place of the credentials in the kubeconfig file")
+
+	// Optional impersonation, for seeing what another user or service account would see.
+	f.as = flags.String("as", "", "user or service account (e.g. \"system:serviceaccount:monitoring:pod-event-watcher\") to impersonate in every request to the API server")
+	f.asUID = flags.String("as-uid", "", "UID of the user to impersonate with -as")
+	flags.Var(&f.asGroups, "as-group", "group to impersonate with -as, which can be repeated or given as a comma-separated list")
+
+	// Optional proxy and TLS settings, for clusters that are only reachable through a proxy or have a private certificate authority.
+	f.proxy = flags.String("proxy-url", "", "URL of the HTTP or SOCKS5 proxy to connect to the API server through (default the proxy in the kubeconfig file, or $HTTPS_PROXY)")
+	f.caFile = flags.String("certificate-authority", "", "path to a PEM file of the certificate authorities to trust for the API server's certificate")
+	f.certFile = flags.String("client-certificate", "", "path to a PEM client certificate for authenticating to the API server")
+	f.keyFile = flags.String("client-key", "", "path to the PEM private key of -client-certificate")
+	f.insecure = flags.Bool("insecure-skip-tls-verify", false, "do not check the API server's certificate, which makes the connection open to interception")
+
+	// Retries of the requests rejected as unauthorized, so that expired credentials can be refreshed.
+	f.retries = flags.Int("credential-retries", 4, "number of times a request that the API server rejects as unauthorized is retried, with exponential backoff, so that an exec credential plugin or OIDC can refresh the credentials, before a credentials-expired event is sent")
+
+	// Client-side rate limit of the requests to the API server.
+	f.qps = flags.Float64("kube-api-qps", float64(rest.DefaultQPS), "maximum average number of requests per second to each API server (-1 for no limit)")
+	f.burst = flags.Int("kube-api-burst", rest.DefaultBurst, "maximum number of requests to each API server in a burst above -kube-api-qps")
+
+	// Encoding of the objects received from the API server.
+	f.contentType = flags.String("api-content-type", "protobuf", "encoding of the objects listed and watched from the API server (protobuf or json); protobuf is much smaller and faster to decode in large clusters")
+	return f
+}
+
+// config returns the configuration for a single cluster when no contexts or clusters file are given.
+// Try to use the in-cluster config first, which will succeed if running in a cluster.
+// If that fails, try to use the local .kube/config, which will succeed if running on a user's machine and they have logged in recently.
+// A kubectl plugin uses the same config as kubectl instead.
+// With -server, the cluster is named after the server's host, as the kubeconfig context may be for a different cluster.
+func (f *connectionFlags) config() (*rest.Config, error) {
+	if f.kubectl != nil {
+		f.name = currentContext(f.kubectl.ToRawKubeConfigLoader(), *f.kubectl.Context)
+		return f.kubectl.ToRESTConfig()
+	}
+	if *f.server != "" {
+		if u, err := url.Parse(*f.server); err == nil && u.Host != "" {
+			f.name = u.Host
+		} else {
+			f.name = *f.server
+		}
+	}
+	if config, err := rest.InClusterConfig(); err == nil {
+		return config, nil
+	}
+	if *f.server != "" {
+		// Without a kubeconfig file, the server and token flags are all that is needed.
+		if _, err := os.Stat(*f.kubeconfig); err != nil {
+			return &rest.Config{}, nil
+		}
+	}
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(&clientcmd.ClientConfigLoadingRules{ExplicitPath: *f.kubeconfig}, &clientcmd.ConfigOverrides{})
+	if f.name == "" {
+		f.name = currentContext(loader, "")
+	}
+	return clientcmd.BuildConfigFromFlags("", *f.kubeconfig)
+}
+
+// configure applies the server, token, impersonation, proxy, TLS and rate limit flags to a cluster's configuration.
+// The token replaces any other credentials, so that the server is not sent two identities.
+func (f *connectionFlags) configure(config *rest.Config) {
+	if *f.server != "" {
+		config.Host = *f.server
+	}
+	if *f.token != "" {
+		config.BearerToken, config.BearerTokenFile = *f.token, ""
+		config.Username, config.Password = "", ""
+		config.AuthProvider, config.ExecProvider = nil, nil
+		config.CertFile, config.KeyFile, config.CertData, config.KeyData = "", "", nil, nil
+	}
+	if *f.as != "" {
+		config.Impersonate = rest.ImpersonationConfig{UserName: *f.as, UID: *f.asUID, Groups: f.asGroups}
+	}
+	if *f.proxy != "" {
+		// The URL is checked by newClusters.
+		u, _ := url.Parse(*f.proxy)
+		config.Proxy = http.ProxyURL(u)
+	}
+	if *f.caFile != "" {
+		config.CAFile, config.CAData = *f.caFile, nil
+	}
+	if *f.certFile != "" {
+		config.CertFile, config.CertData = *f.certFile, nil
+	}
+	if *f.keyFile != "" {
+		config.KeyFile, config.KeyData = *f.keyFile, nil
+	}
+	if *f.insecure {
+		// The API server's certificate is not checked, so a certificate authority cannot be given as well.
+		config.Insecure, config.CAFile, config.CAData = true, "", nil
+	}
+	config.QPS, config.Burst = float32(*f.qps), *f.burst
+}
+
+// source returns where the clusters are listed.
+func (f *connectionFlags) source() clusterSource {
+	kubeconfig := *f.kubeconfig
+	if f.kubectl != nil && f.kubectl.KubeConfig != nil {
+		kubeconfig = *f.kubectl.KubeConfig
+	}
+	return clusterSource{path: *f.clusters, contexts: f.contexts, kubeconfig: kubeconfig, contentType: *f.contentType, credentialRetries: *f.retries, configure: f.configure}
+}
+
+// newClusters creates the clusters given by the flags: each context given by -context and cluster in the clusters file, or else the single cluster from config.
+func (f *connectionFlags) newClusters() ([]*cluster, error) {
+	if *f.as == "" && (*f.asUID != "" || len(f.asGroups) > 0) {
+		return nil, fmt.Errorf("-as-uid and -as-group can only be used with -as")
+	}
+	if (*f.certFile == "") != (*f.keyFile == "") {
+		return nil, fmt.Errorf("-client-certificate and -client-key must be given together")
+	}
+	if *f.proxy != "" {
+		if u, err := url.Parse(*f.proxy); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("-proxy-url %q is not a URL with a host", *f.proxy)
+		}
+	}
+	return newClusters(f.source(), f.config)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// priceSheetRefresh is how often a price sheet given by a URL is fetched again.
+const priceSheetRefresh = time.Hour
+
+// churnedCost is the estimated cost of the pods deleted, by cluster, namespace and currency.
+var churnedCost, _ = meter.Float64Counter("pod_event_watcher.cost.churned",
+	metric.WithDescription("Estimated cost of the requests of the pods deleted, from when each started until it was deleted, by namespace and currency."))
+
+// priceSheet is the contents of the -price-sheet file or URL.
+//
+// Example:
+//
+//	currency: USD
+//	prices:
+//	  cpu: 0.0316           # per core per hour
+//	  memory: 0.0042        # per GiB per hour
+//	  nvidia.com/gpu: 2.48  # per GPU per hour
+type priceSheet struct {
+	// Currency is the currency of the prices, which defaults to USD.
+	Currency string `json:"currency,omitempty"`
+	// Prices are the prices per hour of each resource that pods request: per core of cpu, per GiB of memory, ephemeral-storage and hugepages, and per unit of anything else, such as GPUs.
+	Prices map[v1.ResourceName]float64 `json:"prices"`
+}
+
+// podCost is the estimated cost of a pod's requests.
+type podCost struct {
+	Currency string `json:"currency"`
+	// Hourly is the cost per hour of the resources that the pod requests.
+	Hourly float64 `json:"hourly"`
+	// Lifetime is the cost of the pod from when it started until it was deleted, for eventDeleted.
+	Lifetime float64 `json:"lifetime,omitempty"`
+}
+
+// costEstimator adds the estimated cost of their pods' requests to the events, and adds up the cost of the pods deleted in each namespace, so that churn can be given in money rather than counts.
+type costEstimator struct {
+	mu    sync.Mutex
+	sheet priceSheet
+	// churned is the cost of the pods deleted since the last cluster report, by cluster and namespace.
+	churned map[string]map[string]float64
+}
+
+// costs estimates the cost of pods if enabled with the -price-sheet flag, and is otherwise nil.
+var costs *costEstimator
+
+// newCostEstimator creates a cost estimator with the price sheet in a file, or at an http or https URL, which is then fetched again every priceSheetRefresh.
+func newCostEstimator(source string) (*costEstimator, error) {
+	sheet, err := loadPriceSheet(source)
+	if err != nil {
+		return nil, err
+	}
+	c := &costEstimator{sheet: sheet, churned: make(map[string]map[string]float64)}
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		go c.refresh(source)
+	}
+	return c, nil
+}
+
+// loadPriceSheet reads a YAML or JSON price sheet from a file or URL.
+func loadPriceSheet(source string) (priceSheet, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		data, err = fetchPriceSheet(source)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return priceSheet{}, err
+	}
+	var sheet priceSheet
+	if err := yaml.UnmarshalStrict(data, &sheet); err != nil {
+		return priceSheet{}, fmt.Errorf("%s: %v", source, err)
+	}
+	if len(sheet.Prices) == 0 {
+		return priceSheet{}, fmt.Errorf("%s: no prices", source)
+	}
+	if sheet.Currency == "" {
+		sheet.Currency = "USD"
+	}
+	return sheet, nil
+}
+
+// fetchPriceSheet gets a price sheet from a pricing service.
+func fetchPriceSheet(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// refresh fetches the price sheet again every priceSheetRefresh, keeping the previous prices if it cannot be fetched.
+func (c *costEstimator) refresh(url string) {
+	for range time.Tick(priceSheetRefresh) {
+		sheet, err := loadPriceSheet(url)
+		if err != nil {
+			log.Printf("Price sheet error: %v\n", err)
+			continue
+		}
+		c.mu.Lock()
+		c.sheet = sheet
+		c.mu.Unlock()
+	}
+}
+
+// podRequests returns the resources that a pod requests as the scheduler counts them: the larger of the sum of its containers' requests and the largest of its init containers' requests, plus its overhead.
+func podRequests(pod *v1.Pod) v1.ResourceList {
+	requests := v1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		for name, q := range c.Resources.Requests {
+			total := requests[name]
+			total.Add(q)
+			requests[name] = total
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		for name, q := range c.Resources.Requests {
+			if total, ok := requests[name]; !ok || q.Cmp(total) > 0 {
+				requests[name] = q.DeepCopy()
+			}
+		}
+	}
+	for name, q := range pod.Spec.Overhead {
+		total := requests[name]
+		total.Add(q)
+		requests[name] = total
+	}
+	return requests
+}
+
+// resourceUnits returns a quantity of a resource in the units that it is priced in: cores of cpu, GiB of memory, ephemeral-storage and hugepages, and otherwise units.
+func resourceUnits(name v1.ResourceName, q resource.Quantity) float64 {
+	switch {
+	case name == v1.ResourceCPU:
+		return float64(q.MilliValue()) / 1000
+	case name == v1.ResourceMemory, name == v1.ResourceEphemeralStorage, strings.HasPrefix(string(name), v1.ResourceHugePagesPrefix):
+		return q.AsApproximateFloat64() / (1 << 30)
+	}
+	return q.AsApproximateFloat64()
+}
+
+// hourly returns the cost per hour of a pod's requests.
+func (s priceSheet) hourly(pod *v1.Pod) float64 {
+	cost := 0.0
+	for name, q := range podRequests(pod) {
+		cost += resourceUnits(name, q) * s.Prices[name]
+	}
+	return cost
+}
+
+// apply adds the estimated cost of its pod's requests to an event for the bus, and for a deleted pod, the cost of its lifetime, which is added to its namespace's churn.
+func (c *costEstimator) apply(e event) (event, bool, error) {
+	if e.Pod == nil {
+		return e, true, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cost := &podCost{Currency: c.sheet.Currency, Hourly: c.sheet.hourly(e.Pod)}
+	if e.Type == eventDeleted {
+		started := e.Pod.CreationTimestamp.Time
+		if e.Pod.Status.StartTime != nil {
+			started = e.Pod.Status.StartTime.Time
+		}
+		if lifetime := e.Time.Sub(started); lifetime > 0 && !started.IsZero() {
+			cost.Lifetime = cost.Hourly * lifetime.Hours()
+		}
+		if c.churned[e.Cluster] == nil {
+			c.churned[e.Cluster] = make(map[string]float64)
+		}
+		c.churned[e.Cluster][e.Namespace] += cost.Lifetime
+		churnedCost.Add(context.Background(), cost.Lifetime, metric.WithAttributes(attribute.String("cluster", e.Cluster), attribute.String("namespace", e.Namespace), attribute.String("currency", cost.Currency)))
+	}
+	e.Cost = cost
+	return e, true, nil
+}
+
+// churnReport returns a description of the cost of the pods deleted in a cluster since the last report, with the namespaces that cost the most first, and starts adding up again.
+// It is empty if no pods were deleted.
+func (c *costEstimator) churnReport(cluster string, top int) string {
+	c.mu.Lock()
+	churned := c.churned[cluster]
+	delete(c.churned, cluster)
+	currency := c.sheet.Currency
+	c.mu.Unlock()
+	if len(churned) == 0 {
+		return ""
+	}
+	namespaces := make([]string, 0, len(churned))
+	total := 0.0
+	for namespace, cost := range churned {
+		namespaces = append(namespaces, namespace)
+		total += cost
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		if churned[namespaces[i]] != churned[namespaces[j]] {
+			return churned[namespaces[i]] > churned[namespaces[j]]
+		}
+		return namespaces[i] < namespaces[j]
+	})
+	if len(namespaces) > top {
+		namespaces = namespaces[:top]
+	}
+	items := make([]string, len(namespaces))
+	for i, namespace := range namespaces {
+		items[i] = fmt.Sprintf("%s %.2f", namespace, churned[namespace])
+	}
+	return fmt.Sprintf("deleted pods cost %.2f %s (%s)", total, currency, strings.Join(items, ", "))
+}
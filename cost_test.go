@@ -0,0 +1,182 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// requesting returns a container that requests resources, given as name and quantity pairs.
+func requesting(pairs ...string) v1.Container {
+	requests := v1.ResourceList{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		requests[v1.ResourceName(pairs[i])] = resource.MustParse(pairs[i+1])
+	}
+	return v1.Container{Resources: v1.ResourceRequirements{Requests: requests}}
+}
+
+// costsAbout reports whether two costs are the same to a millionth.
+func costsAbout(got, want float64) bool {
+	return math.Abs(got-want) < 1e-6
+}
+
+func TestPodRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1.PodSpec
+		want map[v1.ResourceName]string
+	}{
+		{
+			"containers add up",
+			v1.PodSpec{Containers: []v1.Container{requesting("cpu", "500m", "memory", "1Gi"), requesting("cpu", "250m")}},
+			map[v1.ResourceName]string{"cpu": "750m", "memory": "1Gi"},
+		},
+		{
+			"larger init container",
+			v1.PodSpec{InitContainers: []v1.Container{requesting("cpu", "2"), requesting("cpu", "1")}, Containers: []v1.Container{requesting("cpu", "500m", "memory", "1Gi")}},
+			map[v1.ResourceName]string{"cpu": "2", "memory": "1Gi"},
+		},
+		{
+			"smaller init container",
+			v1.PodSpec{InitContainers: []v1.Container{requesting("memory", "512Mi")}, Containers: []v1.Container{requesting("memory", "1Gi")}},
+			map[v1.ResourceName]string{"memory": "1Gi"},
+		},
+		{
+			"overhead",
+			v1.PodSpec{Containers: []v1.Container{requesting("cpu", "1")}, Overhead: v1.ResourceList{"cpu": resource.MustParse("250m")}},
+			map[v1.ResourceName]string{"cpu": "1250m"},
+		},
+		{"no requests", v1.PodSpec{Containers: []v1.Container{{}}}, map[v1.ResourceName]string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := podRequests(&v1.Pod{Spec: test.spec})
+			if len(got) != len(test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			for name, want := range test.want {
+				if q := got[name]; q.Cmp(resource.MustParse(want)) != 0 {
+					t.Errorf("got %s %s, want %s", name, q.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestCostEstimator(t *testing.T) {
+	c := &costEstimator{
+		sheet:   priceSheet{Currency: "EUR", Prices: map[v1.ResourceName]float64{"cpu": 0.04, "memory": 0.01, "nvidia.com/gpu": 2}},
+		churned: make(map[string]map[string]float64),
+	}
+	started := time.Unix(1700000000, 0)
+	pod := func(namespace string, containers ...v1.Container) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace, CreationTimestamp: metav1.NewTime(started.Add(-time.Hour))},
+			Spec:       v1.PodSpec{Containers: containers},
+			Status:     v1.PodStatus{StartTime: &metav1.Time{Time: started}},
+		}
+	}
+	gpu := pod("training", requesting("cpu", "2", "memory", "4Gi", "nvidia.com/gpu", "1"))
+	tests := []struct {
+		name             string
+		e                event
+		hourly, lifetime float64
+	}{
+		{"created", event{Type: eventCreated, Namespace: "training", Pod: gpu, Time: started}, 2.12, 0},
+		{"deleted after 10 hours", event{Type: eventDeleted, Namespace: "training", Pod: gpu, Time: started.Add(10 * time.Hour)}, 2.12, 21.2},
+		{"unpriced resource", event{Type: eventDeleted, Namespace: "web", Pod: pod("web", requesting("cpu", "500m", "example.com/widget", "3")), Time: started.Add(2 * time.Hour)}, 0.02, 0.04},
+		{"deleted before starting", event{Type: eventDeleted, Namespace: "web", Pod: pod("web", requesting("cpu", "1")), Time: started.Add(-2 * time.Hour)}, 0.04, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, keep, err := c.apply(test.e)
+			if err != nil || !keep || e.Cost == nil {
+				t.Fatalf("got %+v, %v, %v, want the event kept with its cost", e.Cost, keep, err)
+			}
+			if e.Cost.Currency != "EUR" || !costsAbout(e.Cost.Hourly, test.hourly) || !costsAbout(e.Cost.Lifetime, test.lifetime) {
+				t.Errorf("got %+v, want %v an hour and %v for the lifetime", *e.Cost, test.hourly, test.lifetime)
+			}
+		})
+	}
+	if e, _, _ := c.apply(event{Type: eventClusterReport}); e.Cost != nil {
+		t.Errorf("got %+v for an event without a pod, want no cost", *e.Cost)
+	}
+
+	if got, want := c.churnReport("", 5), "deleted pods cost 21.24 EUR (training 21.20, web 0.04)"; got != want {
+		t.Errorf("got report %q, want %q", got, want)
+	}
+	if got := c.churnReport("", 5); got != "" {
+		t.Errorf("got report %q after reporting, want none", got)
+	}
+}
+
+func TestChurnReportTop(t *testing.T) {
+	c := &costEstimator{sheet: priceSheet{Currency: "USD"}, churned: map[string]map[string]float64{
+		"prod":    {"a": 1, "b": 3, "c": 2, "d": 2},
+		"staging": {"e": 5},
+	}}
+	if got, want := c.churnReport("prod", 3), "deleted pods cost 8.00 USD (b 3.00, c 2.00, d 2.00)"; got != want {
+		t.Errorf("got report %q, want %q", got, want)
+	}
+	if got, want := c.churnReport("staging", 3), "deleted pods cost 5.00 USD (e 5.00)"; got != want {
+		t.Errorf("got report %q, want %q", got, want)
+	}
+}
+
+func TestLoadPriceSheet(t *testing.T) {
+	tests := []struct {
+		name, sheet string
+		currency    string
+		err         string // Part of the error, or empty if the sheet is valid.
+	}{
+		{"default currency", "prices:\n  cpu: 0.03\n", "USD", ""},
+		{"currency", "currency: EUR\nprices:\n  cpu: 0.03\n", "EUR", ""},
+		{"JSON", `{"currency": "GBP", "prices": {"memory": 0.004}}`, "GBP", ""},
+		{"no prices", "currency: EUR\n", "", "no prices"},
+		{"unknown field", "prices:\n  cpu: 0.03\ndiscount: 0.1\n", "", "discount"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "prices.yaml")
+			if err := os.WriteFile(path, []byte(test.sheet), 0600); err != nil {
+				t.Fatal(err)
+			}
+			sheet, err := loadPriceSheet(path)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got %v, want an error with %q", err, test.err)
+				}
+				return
+			}
+			if err != nil || sheet.Currency != test.currency {
+				t.Errorf("got %+v, %v, want the prices in %s", sheet, err, test.currency)
+			}
+		})
+	}
+}
+
+func TestLoadPriceSheetURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prices" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("prices:\n  cpu: 0.03\n"))
+	}))
+	defer server.Close()
+	if sheet, err := loadPriceSheet(server.URL + "/prices"); err != nil || sheet.Prices["cpu"] != 0.03 {
+		t.Errorf("got %+v, %v, want the fetched prices", sheet, err)
+	}
+	if _, err := loadPriceSheet(server.URL + "/missing"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got %v, want the status", err)
+	}
+}
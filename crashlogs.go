@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// crashLogTimeout is how long fetching a crashed container's logs may take.
+	crashLogTimeout = 10 * time.Second
+	// crashLogLimit is the most bytes of logs fetched for a crashed container, in case its lines are very long.
+	crashLogLimit = 64 * 1024
+)
+
+// crashLogLines is the number of lines of a crashed container's logs added to its container-restarted or oom-killed event, set by -crash-logs. Logs are not fetched if it is zero.
+var crashLogLines int64
+
+// publishWithLogs publishes a container-restarted or oom-killed event, first adding the end of the container's logs from before it ended if it ended abnormally.
+// The logs are fetched in the background so that the pod handler is not held up, so the event may be delivered after later events for the pod.
+func publishWithLogs(e event) {
+	c, ok := e.context().Value(clusterKey{}).(*cluster)
+	previous, abnormal := crashed(e.Pod, e.Container)
+	if crashLogLines == 0 || !ok || !abnormal {
+		publish(e)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), crashLogTimeout)
+		defer cancel()
+		opts := &v1.PodLogOptions{Container: e.Container, Previous: previous, TailLines: &crashLogLines, LimitBytes: int64Ptr(crashLogLimit)}
+		logs, err := c.clientset.CoreV1().Pods(e.Namespace).GetLogs(e.Pod.Name, opts).DoRaw(ctx)
+		if err != nil {
+			log.Printf("%sLogs error (%s/%s %s): %v\n", clusterPrefix(e.cluster()), e.Namespace, e.Pod.Name, e.Container, err)
+		} else {
+			e.Logs = string(logs)
+		}
+		publish(e)
+	}()
+}
+
+// crashed reports whether a container of a pod last ended abnormally, i.e. with a non-zero exit code or a reason other than Completed, and whether those logs are the previous logs because the container has been started again since.
+func crashed(pod *v1.Pod, container string) (previous bool, abnormal bool) {
+	for _, s := range containerStatuses(pod) {
+		if s.Name != container {
+			continue
+		}
+		t, previous := s.State.Terminated, false
+		if t == nil {
+			t, previous = s.LastTerminationState.Terminated, true
+		}
+		return previous, t != nil && (t.ExitCode != 0 || (t.Reason != "" && t.Reason != "Completed"))
+	}
+	return false, false
+}
+
+// int64Ptr returns a pointer to n.
+func int64Ptr(n int64) *int64 {
+	return &n
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// crashLoopBackOff is the waiting reason of a container that the kubelet is not restarting until its backoff expires.
+	crashLoopBackOff = "CrashLoopBackOff"
+	// crashLoopRecovery is how long a container must run after a crash loop to have recovered. The kubelet resets a container's backoff after it has run for this long.
+	crashLoopRecovery = 10 * time.Minute
+	// crashLoopCheckInterval is the time between checks for containers that have recovered.
+	crashLoopCheckInterval = 30 * time.Second
+)
+
+// crashLoopKey identifies a container in a pod.
+type crashLoopKey struct {
+	uid       types.UID
+	container string
+}
+
+// crashLoopTracker sends one event when a container enters CrashLoopBackOff, and one when it recovers, however many times the container restarts in between.
+// A container in a crash loop runs briefly between backoffs, so it has only recovered once it has run for crashLoopRecovery.
+type crashLoopTracker struct {
+	mu      sync.Mutex
+	looping map[crashLoopKey]crashLoop
+}
+
+// crashLoop is the latest version of a pod with a container in a crash loop, and the context of the cluster it is in.
+type crashLoop struct {
+	pod *v1.Pod
+	ctx context.Context
+}
+
+// crashLoops tracks the containers in a crash loop.
+var crashLoops = &crashLoopTracker{looping: make(map[crashLoopKey]crashLoop)}
+
+// observe returns an event for each container in a created or updated pod that has entered a crash loop.
+func (c *crashLoopTracker) observe(e event) []event {
+	if e.Type != eventCreated && e.Type != eventUpdated {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var entered []event
+	for _, s := range containerStatuses(e.Pod) {
+		key := crashLoopKey{e.Pod.UID, s.Name}
+		if _, ok := c.looping[key]; ok {
+			c.looping[key] = crashLoop{pod: e.Pod, ctx: detachedContext(e.ctx)}
+			continue
+		}
+		if s.State.Waiting == nil || s.State.Waiting.Reason != crashLoopBackOff {
+			continue
+		}
+		c.looping[key] = crashLoop{pod: e.Pod, ctx: detachedContext(e.ctx)}
+		entered = append(entered, event{
+			Cluster:   e.Cluster,
+			Type:      eventCrashLoop,
+			Time:      e.Time,
+			Namespace: e.Namespace,
+			Pod:       e.Pod,
+			Container: s.Name,
+			Message:   fmt.Sprintf("container %s is in CrashLoopBackOff after %d restarts: %s", s.Name, s.RestartCount, s.State.Waiting.Message),
+			ctx:       e.ctx,
+		})
+	}
+	return entered
+}
+
+// recovered returns an event for each container in a crash loop that has now been running for crashLoopRecovery, and stops tracking it.
+func (c *crashLoopTracker) recovered(now time.Time) []event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var recoveries []event
+	for key, loop := range c.looping {
+		pod := loop.pod
+		for _, s := range containerStatuses(pod) {
+			if s.Name != key.container || s.State.Running == nil || now.Sub(s.State.Running.StartedAt.Time) < crashLoopRecovery {
+				continue
+			}
+			delete(c.looping, key)
+			recoveries = append(recoveries, event{
+				Cluster:   contextCluster(loop.ctx),
+				Type:      eventCrashLoopRecovered,
+				Time:      now,
+				Namespace: pod.Namespace,
+				Pod:       pod,
+				Message:   fmt.Sprintf("container %s has been running for %s after %d restarts", s.Name, now.Sub(s.State.Running.StartedAt.Time).Round(time.Second), s.RestartCount),
+				ctx:       loop.ctx,
+			})
+		}
+	}
+	return recoveries
+}
+
+// forget stops tracking the containers of a deleted pod.
+func (c *crashLoopTracker) forget(pod *v1.Pod) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.looping {
+		if key.uid == pod.UID {
+			delete(c.looping, key)
+		}
+	}
+}
+
+// forgetCluster stops tracking the containers of the pods of a cluster that is no longer watched.
+func (c *crashLoopTracker) forgetCluster(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, loop := range c.looping {
+		if contextCluster(loop.ctx) == name {
+			delete(c.looping, key)
+		}
+	}
+}
+
+// checkCrashLoops periodically sends an event for each container that has recovered from a crash loop.
+func checkCrashLoops() {
+	for now := range time.Tick(crashLoopCheckInterval) {
+		for _, e := range crashLoops.recovered(now) {
+			publish(e)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCrashLoopCluster(t *testing.T) {
+	ctx := withCluster(context.Background(), newClusterForClientset("prod", fake.NewSimpleClientset()))
+	tracker := &crashLoopTracker{looping: make(map[crashLoopKey]crashLoop)}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "web"},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+			Name:  "app",
+			State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: crashLoopBackOff}},
+		}}},
+	}
+	entered := tracker.observe(newPodEvent(ctx, eventUpdated, pod))
+	if len(entered) != 1 || entered[0].Cluster != "prod" {
+		t.Fatalf("got %v, want a crash loop in prod", summaries(entered))
+	}
+
+	now := time.Now()
+	running := pod.DeepCopy()
+	running.Status.ContainerStatuses[0].State = v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: metav1.NewTime(now.Add(-crashLoopRecovery))}}
+	tracker.observe(newPodEvent(ctx, eventUpdated, running))
+	recovered := tracker.recovered(now)
+	if len(recovered) != 1 || recovered[0].Cluster != "prod" || recovered[0].cluster() != "prod" {
+		t.Fatalf("got %v, want a recovery in prod", summaries(recovered))
+	}
+}
+
+func TestCrashLoopForgetCluster(t *testing.T) {
+	tracker := &crashLoopTracker{looping: make(map[crashLoopKey]crashLoop)}
+	for _, name := range []string{"prod", "staging"} {
+		ctx := withCluster(context.Background(), newClusterForClientset(name, fake.NewSimpleClientset()))
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "web-" + types.UID(name)},
+			Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+				Name:  "app",
+				State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: crashLoopBackOff}},
+			}}},
+		}
+		tracker.observe(newPodEvent(ctx, eventUpdated, pod))
+	}
+	tracker.forgetCluster("staging")
+	if n := len(tracker.looping); n != 1 {
+		t.Fatalf("got %d containers in a crash loop, want only the one in prod", n)
+	}
+	for _, loop := range tracker.looping {
+		if got := contextCluster(loop.ctx); got != "prod" {
+			t.Errorf("got a crash loop in %s, want prod", got)
+		}
+	}
+}
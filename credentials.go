@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// The backoff between the retries of a request that the API server rejected as unauthorized.
+const (
+	credentialRetryDelay    = time.Second
+	credentialMaxRetryDelay = 30 * time.Second
+)
+
+// credentialTransport retries the requests to a cluster's API server that are rejected as unauthorized, with an exponential backoff, and tells the sinks when the cluster's credentials have expired and when they are accepted again.
+// It wraps client-go's authentication, which runs an exec credential plugin again when a request is rejected, refreshes an OIDC token with its refresh token once it has expired, and reads a token file again every minute, so that the retries are made with the new credentials. Without it, the informers only log the rejections while they back off, and the watch dies silently once a token expires during a long run.
+type credentialTransport struct {
+	next    http.RoundTripper
+	cluster *cluster
+	retries int
+	// source describes where the credentials come from, for the credentials-expired event.
+	source string
+}
+
+// credentialState tracks whether a cluster's credentials are being rejected.
+type credentialState struct {
+	mu      sync.Mutex
+	expired bool
+	since   time.Time
+}
+
+// newCredentialClient returns an HTTP client for a cluster's API server whose requests are retried, up to retries times, when they are rejected as unauthorized.
+func newCredentialClient(c *cluster, config *rest.Config, retries int) (*http.Client, error) {
+	client, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, err
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	// The client may be http.DefaultClient, so it is copied rather than changed.
+	transport := &credentialTransport{next: next, cluster: c, retries: retries, source: credentialSource(config)}
+	return &http.Client{Transport: transport, Timeout: client.Timeout}, nil
+}
+
+// credentialSource describes where a cluster's credentials come from.
+func credentialSource(config *rest.Config) string {
+	switch {
+	case config.ExecProvider != nil:
+		return fmt.Sprintf("the exec credential plugin %q", config.ExecProvider.Command)
+	case config.AuthProvider != nil:
+		return fmt.Sprintf("the %s auth provider", config.AuthProvider.Name)
+	case config.BearerTokenFile != "":
+		return "the token file " + config.BearerTokenFile
+	case config.BearerToken != "":
+		return "the bearer token"
+	case config.CertFile != "" || len(config.CertData) > 0:
+		return "the client certificate"
+	case config.Username != "":
+		return "the username and password"
+	}
+	return "no credentials"
+}
+
+// RoundTrip sends a request, retrying it while it is rejected as unauthorized.
+// A request with a body that cannot be read again is not retried.
+func (t *credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	delay := credentialRetryDelay
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.accepted()
+			return resp, nil
+		}
+		if attempt == t.retries || (req.Body != nil && req.GetBody == nil) {
+			t.rejected(attempt)
+			return resp, nil
+		}
+		debugf(1, debugInformer, "%s %s in %s was unauthorized, retrying in %s\n", req.Method, req.URL.Path, t.cluster.name, delay)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > credentialMaxRetryDelay {
+			delay = credentialMaxRetryDelay
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// rejected records that a request was still rejected after its retries, sending a credentials-expired event if the credentials were being accepted.
+func (t *credentialTransport) rejected(retries int) {
+	s := &t.cluster.credentials
+	s.mu.Lock()
+	if s.expired {
+		s.mu.Unlock()
+		return
+	}
+	s.expired, s.since = true, time.Now()
+	s.mu.Unlock()
+	message := fmt.Sprintf("the API server rejected the credentials from %s after %d retries; the watch is stalled until they are renewed", t.source, retries)
+	log.Printf("%sCredentials expired: %s\n", clusterPrefix(t.cluster.name), message)
+	publish(event{Cluster: t.cluster.name, Type: eventCredentialsExpired, Time: time.Now(), Message: message})
+}
+
+// accepted records that a request was not rejected, sending a credentials-renewed event if the credentials had expired.
+func (t *credentialTransport) accepted() {
+	s := &t.cluster.credentials
+	s.mu.Lock()
+	if !s.expired {
+		s.mu.Unlock()
+		return
+	}
+	s.expired = false
+	rejected := time.Since(s.since)
+	s.mu.Unlock()
+	message := fmt.Sprintf("the credentials from %s were accepted again after %s", t.source, rejected.Round(time.Second))
+	log.Printf("%sCredentials renewed: %s\n", clusterPrefix(t.cluster.name), message)
+	publish(event{Cluster: t.cluster.name, Type: eventCredentialsRenewed, Time: time.Now(), Message: message})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// firstSeenPods remembers the state of each pod when the watcher first observed it, so that its updates can also be compared with where it started.
+// The first state of each pod is kept for as long as the pod exists, which can double the memory used by the cache.
+type firstSeenPods struct {
+	mu   sync.Mutex
+	pods map[types.UID]firstSeenPod
+}
+
+// firstSeenPod is the first observed state of a pod, and the cluster it is in.
+type firstSeenPod struct {
+	pod     *v1.Pod
+	cluster string
+}
+
+// firstSeen remembers the first state of each pod if enabled with the -diff-cumulative flag, and is otherwise nil.
+var firstSeen *firstSeenPods
+
+// newFirstSeenPods creates an empty firstSeenPods.
+func newFirstSeenPods() *firstSeenPods {
+	return &firstSeenPods{pods: make(map[types.UID]firstSeenPod)}
+}
+
+// observe records a pod from the cluster of a pod handler's context if it has not been observed before, and returns its first observed state.
+// The pods from the informer are not changed once cached, so they are kept without copying them.
+func (f *firstSeenPods) observe(ctx context.Context, pod *v1.Pod) *v1.Pod {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if first, ok := f.pods[pod.UID]; ok {
+		return first.pod
+	}
+	f.pods[pod.UID] = firstSeenPod{pod: pod, cluster: contextCluster(ctx)}
+	return pod
+}
+
+// forget removes a deleted pod.
+func (f *firstSeenPods) forget(pod *v1.Pod) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.pods, pod.UID)
+}
+
+// forgetCluster removes the pods of a cluster that is no longer watched.
+func (f *firstSeenPods) forgetCluster(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for uid, first := range f.pods {
+		if first.cluster == name {
+			delete(f.pods, uid)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// dashboardFiles holds the web dashboard, which is built into the binary.
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// registerDashboard adds the web dashboard to a mux at /dashboard/, redirecting / to it.
+// The dashboard shows the live events from /events, the counts from /stats, and the current state of pods from /api/pods.
+func registerDashboard(mux *http.ServeMux) {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err.Error())
+	}
+	mux.Handle("/dashboard/", http.StripPrefix("/dashboard/", http.FileServer(http.FS(files))))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, "/dashboard/", http.StatusFound)
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// sinkRetryDelay is the time before the first retry of a failed delivery to a sink. It doubles with each retry.
+	sinkRetryDelay = time.Second
+	// sinkMaxRetryDelay is the longest time between retries.
+	sinkMaxRetryDelay = 30 * time.Second
+)
+
+// retryDelay returns the time to wait before a retry, starting from 0 for the first.
+func retryDelay(retry int) time.Duration {
+	delay := sinkRetryDelay << uint(retry)
+	if delay <= 0 || delay > sinkMaxRetryDelay {
+		return sinkMaxRetryDelay
+	}
+	return delay
+}
+
+// retryPolicy is the retries and dead-lettering of the route of a sink that delivers events in the background, such as a rate-limited, grouping or exec sink, whose failures cannot be returned from Send.
+type retryPolicy struct {
+	sink    string
+	retries int
+}
+
+// deliver calls send for an event, retrying with exponential backoff if it fails, and logs the error and writes the event to the dead-letter file if it still fails.
+func (p retryPolicy) deliver(e event, send func(e event) error) {
+	err := send(e)
+	for retry := 0; err != nil && retry < p.retries; retry++ {
+		time.Sleep(retryDelay(retry))
+		err = send(e)
+	}
+	if err == nil {
+		return
+	}
+	if p.retries > 0 {
+		err = fmt.Errorf("%v (after %d retries)", err, p.retries)
+	}
+	p.fail(e, err)
+}
+
+// fail logs the error of an event that could not be delivered and writes it to the dead-letter file.
+func (p retryPolicy) fail(e event, err error) {
+	log.Printf("Sink error (%s): %v\n", p.sink, err)
+	if deadLetters != nil {
+		deadLetters.write(p.sink, e, err)
+	}
+}
+
+// deadLetter is an event that could not be delivered to a sink, even after retrying, as recorded in the dead-letter file.
+type deadLetter struct {
+	Sink  string    `json:"sink"`
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+	Event event     `json:"event"`
+}
+
+// deadLetterFile appends the events that could not be delivered to a file as JSON lines, so that they can be delivered later with the redrive subcommand.
+type deadLetterFile struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// deadLetters records undeliverable events if enabled with the -dead-letter flag, and is otherwise nil.
+var deadLetters *deadLetterFile
+
+// openDeadLetterFile opens (or creates) a dead-letter file for appending.
+func openDeadLetterFile(path string) (*deadLetterFile, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &deadLetterFile{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// write records an event that could not be delivered to a sink.
+func (d *deadLetterFile) write(sink string, e event, sendErr error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	letter := deadLetter{Sink: sink, Error: sendErr.Error(), Time: time.Now(), Event: e}
+	if err := d.encoder.Encode(letter); err != nil {
+		log.Printf("Dead-letter error: %v\n", err)
+	}
+}
+
+// Close closes the dead-letter file.
+func (d *deadLetterFile) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.file.Close()
+}
+
+// redriveMain runs the redrive subcommand, which delivers the events in a dead-letter file to the sinks that they could not be delivered to.
+// The file is moved aside first, so that a running watcher can keep adding to it. Events that still cannot be delivered are added back.
+func redriveMain(args []string) {
+	flags := flag.NewFlagSet("redrive", flag.ExitOnError)
+	path := flags.String("dead-letter", "", "path of the dead-letter file to redrive")
+	configPath := flags.String("config", "", "path to the YAML or JSON configuration file listing the sinks, as given to the watcher")
+	retries := flags.Int("sink-retries", 3, "number of times a delivery that fails is retried, with exponential backoff, before the event is put back in the dead-letter file")
+	flags.Parse(args)
+
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "redrive: -dead-letter is required")
+		flags.Usage()
+		os.Exit(2)
+	}
+	sinkConfigs, err := loadSinkConfigs(*configPath, detailsNone)
+	if err != nil {
+		panic(err.Error())
+	}
+	for i := range sinkConfigs {
+		if sinkConfigs[i].Retries == 0 {
+			sinkConfigs[i].Retries = *retries
+		}
+	}
+	if err := addSinks(sinkConfigs); err != nil {
+		panic(err.Error())
+	}
+
+	redriving := *path + ".redrive"
+	if err := os.Rename(*path, redriving); err != nil {
+		panic(err.Error())
+	}
+	if deadLetters, err = openDeadLetterFile(*path); err != nil {
+		panic(err.Error())
+	}
+	defer deadLetters.Close()
+
+	delivered, failed, err := redrive(redriving)
+	if err != nil {
+		panic(err.Error())
+	}
+	if err := os.Remove(redriving); err != nil {
+		panic(err.Error())
+	}
+	log.Printf("Redrove %d events, %d could not be delivered\n", delivered, failed)
+}
+
+// redrive delivers each event in a dead-letter file to the routes with the name of its sink, writing those that fail again to deadLetters.
+func redrive(path string) (int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	delivered, failed := 0, 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var letter deadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			return delivered, failed, fmt.Errorf("%s: line %d: %v", path, line, err)
+		}
+		found := false
+		for _, r := range events.currentRoutes() {
+			if r.name != letter.Sink {
+				continue
+			}
+			found = true
+			if err := r.send(letter.Event); err != nil {
+				log.Printf("Sink error (%s): %v\n", r.name, err)
+				deadLetters.write(r.name, letter.Event, err)
+				failed++
+			} else {
+				delivered++
+			}
+		}
+		if !found {
+			log.Printf("Redrive error: no sink named %q, keeping event %q\n", letter.Sink, letter.Event.summary())
+			deadLetters.write(letter.Sink, letter.Event, fmt.Errorf("%s", letter.Error))
+			failed++
+		}
+	}
+	return delivered, failed, scanner.Err()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// debounceMaxDelays is the number of debounce delays that a created event can be held for while a pod keeps being updated.
+const debounceMaxDelays = 10
+
+// debouncer holds back the created event for each new pod until its updates have stopped for a delay, and folds the updates into it.
+// Pods are updated many times as they are scheduled and their containers start, which would otherwise be reported as a burst of near-identical updated events.
+type debouncer struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	pending map[types.UID]*debounced
+}
+
+// debounced is a created event being held back.
+type debounced struct {
+	event    event
+	timer    *time.Timer
+	deadline time.Time
+}
+
+// debounce holds back created events if enabled with the -debounce flag, and is otherwise nil.
+var debounce *debouncer
+
+// newDebouncer creates a debouncer that holds back each created event until there has been no update to the pod for the delay.
+func newDebouncer(delay time.Duration) *debouncer {
+	return &debouncer{delay: delay, pending: make(map[types.UID]*debounced)}
+}
+
+// hold holds back a created event.
+func (d *debouncer) hold(e event) {
+	uid := e.Pod.UID
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending[uid] = &debounced{
+		event:    e,
+		timer:    time.AfterFunc(d.delay, func() { d.flush(uid) }),
+		deadline: time.Now().Add(debounceMaxDelays * d.delay),
+	}
+}
+
+// absorb folds an updated event into the held back created event for the pod, returning false if there is none.
+// The created event is then delivered with the pod as it is after the update, and the differences of all of the updates.
+func (d *debouncer) absorb(e event) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.pending[e.Pod.UID]
+	if !ok {
+		return false
+	}
+	p.event.Pod = e.Pod
+	p.event.Diff = append(p.event.Diff, e.Diff...)
+	p.event.Containers = append(p.event.Containers, e.Containers...)
+	p.event.Cumulative = e.Cumulative
+	if remaining := time.Until(p.deadline); remaining > 0 {
+		p.timer.Reset(min(d.delay, remaining))
+	}
+	return true
+}
+
+// forget delivers the held back created event for a pod that has been deleted, so that it comes before the deleted event.
+func (d *debouncer) forget(pod *v1.Pod) {
+	d.flush(pod.UID)
+}
+
+// forgetCluster drops the held back created events for the pods of a cluster that is no longer watched, without delivering them.
+func (d *debouncer) forgetCluster(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for uid, p := range d.pending {
+		if p.event.cluster() == name {
+			p.timer.Stop()
+			delete(d.pending, uid)
+		}
+	}
+}
+
+// flush delivers the held back created event for a pod, if there is one.
+func (d *debouncer) flush(uid types.UID) {
+	d.mu.Lock()
+	p, ok := d.pending[uid]
+	if ok {
+		p.timer.Stop()
+		delete(d.pending, uid)
+	}
+	d.mu.Unlock()
+	if ok {
+		publish(p.event)
+	}
+}
+
+// flushAll delivers all of the held back created events, e.g. when the watcher is shutting down.
+func (d *debouncer) flushAll() {
+	d.mu.Lock()
+	uids := make([]types.UID, 0, len(d.pending))
+	for uid := range d.pending {
+		uids = append(uids, uid)
+	}
+	d.mu.Unlock()
+	for _, uid := range uids {
+		d.flush(uid)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+
+	"k8s.io/klog/v2"
+)
+
+// Components of the debug messages, which can be chosen with -v-components.
+const (
+	// debugInformer is for listing and watching the pods: each list, sync and watch (re)connection.
+	debugInformer = "informer"
+	// debugSink is for delivering events: each attempt to send an event to a sink.
+	debugSink = "sink"
+)
+
+var (
+	// verbosity is the level of the debug messages that are logged, set by -v. The events themselves are sent to the sinks whatever the level.
+	verbosity int
+	// debugComponents, if not empty, are the only components that debug messages are logged for.
+	debugComponents map[string]bool
+)
+
+// setVerbosity sets the level and components of the debug messages.
+// From level 4, client-go's own debug messages are logged too, at the same level, e.g. each request to the API server from level 6.
+func setVerbosity(level int, components []string) error {
+	verbosity = level
+	debugComponents = nil
+	for _, c := range components {
+		if c != debugInformer && c != debugSink {
+			return fmt.Errorf("unknown debug component %q", c)
+		}
+		if debugComponents == nil {
+			debugComponents = make(map[string]bool)
+		}
+		debugComponents[c] = true
+	}
+	if level < 4 {
+		return nil
+	}
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(flags)
+	return flags.Set("v", strconv.Itoa(level))
+}
+
+// debugf logs a debug message for a component if the verbosity is at least level and the component has not been left out.
+func debugf(level int, component string, format string, args ...interface{}) {
+	if verbosity < level || (debugComponents != nil && !debugComponents[component]) {
+		return
+	}
+	log.Printf("Debug (%s): "+format, append([]interface{}{component}, args...)...)
+}
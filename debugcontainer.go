@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// debugContainerTimeout is how long adding a debug container to a pod may take.
+const debugContainerTimeout = 10 * time.Second
+
+// debugContainerAdder adds an ephemeral debug container to each pod with a container that enters a crash loop, if the pod matches its selector, so that the crashing container's processes and files can be looked at as soon as it is found.
+// The debug container targets the crashing container, sharing its process namespace, and keeps a terminal open for kubectl attach.
+type debugContainerAdder struct {
+	selector labels.Selector
+	image    string
+
+	mu sync.Mutex
+	// added is the debug containers added to each pod, so that a pod whose update has not been seen yet is not patched twice.
+	added    map[types.UID]map[string]bool
+	clusters map[types.UID]string // UID -> cluster.
+}
+
+// debugContainers adds debug containers to crash looping pods if enabled with the -debug-crash-loops flag, and is otherwise nil.
+var debugContainers *debugContainerAdder
+
+// newDebugContainerAdder creates a debugContainerAdder for the pods that match a label selector.
+func newDebugContainerAdder(selector, image string) (*debugContainerAdder, error) {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("-debug-crash-loops: %v", err)
+	}
+	return &debugContainerAdder{selector: s, image: image, added: make(map[types.UID]map[string]bool), clusters: make(map[types.UID]string)}, nil
+}
+
+// observe adds a debug container in the background to the pod of a crash-loop event if it matches the selector and does not have one for the container already, and publishes a debug-container event that says how to attach to it.
+func (d *debugContainerAdder) observe(e event) {
+	c, ok := e.context().Value(clusterKey{}).(*cluster)
+	if !ok || e.Pod == nil || e.Container == "" || !d.selector.Matches(labels.Set(e.Pod.Labels)) {
+		return
+	}
+	pod := e.Pod
+	name := debugContainerName(e.Container)
+	for _, ec := range pod.Spec.EphemeralContainers {
+		if ec.Name == name {
+			return
+		}
+	}
+	d.mu.Lock()
+	if d.added[pod.UID][name] {
+		d.mu.Unlock()
+		return
+	}
+	if d.added[pod.UID] == nil {
+		d.added[pod.UID] = make(map[string]bool)
+		d.clusters[pod.UID] = c.name
+	}
+	d.added[pod.UID][name] = true
+	d.mu.Unlock()
+
+	go func() {
+		if err := d.add(c, pod, e.Container, name); err != nil {
+			log.Printf("%sDebug container error (%s/%s): %v\n", clusterPrefix(c.name), pod.Namespace, pod.Name, err)
+			return
+		}
+		added := newPodEvent(e.context(), eventDebugContainer, pod)
+		added.Container = name
+		added.Message = fmt.Sprintf("container %s (%s) targets %s; attach with: %s", name, d.image, e.Container, attachCommand(c.name, pod, name))
+		publish(added)
+	}()
+}
+
+// add patches a pod's ephemeral containers with a debug container.
+func (d *debugContainerAdder) add(c *cluster, pod *v1.Pod, target, name string) error {
+	container := v1.EphemeralContainer{
+		EphemeralContainerCommon: v1.EphemeralContainerCommon{
+			Name:                     name,
+			Image:                    d.image,
+			Stdin:                    true,
+			TTY:                      true,
+			TerminationMessagePolicy: v1.TerminationMessageReadFile,
+		},
+		TargetContainerName: target,
+	}
+	patch, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"ephemeralContainers": []v1.EphemeralContainer{container}}})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), debugContainerTimeout)
+	defer cancel()
+	_, err = c.clientset.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: "pod-event-watcher"}, "ephemeralcontainers")
+	return err
+}
+
+// forget removes a deleted pod.
+func (d *debugContainerAdder) forget(pod *v1.Pod) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.added, pod.UID)
+	delete(d.clusters, pod.UID)
+}
+
+// forgetCluster removes the pods of a cluster that is no longer watched.
+func (d *debugContainerAdder) forgetCluster(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for uid, cluster := range d.clusters {
+		if cluster == name {
+			delete(d.added, uid)
+			delete(d.clusters, uid)
+		}
+	}
+}
+
+// debugContainerName returns the name of the debug container for a container, e.g. "debug-app", which is at most 63 characters long.
+func debugContainerName(container string) string {
+	name := "debug-" + container
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return name
+}
+
+// attachCommand returns the kubectl command for attaching to a container, e.g. "kubectl attach -it -n production web-5d8f7 -c debug-app".
+func attachCommand(clusterName string, pod *v1.Pod, container string) string {
+	command := "kubectl attach -it"
+	if clusterName != "" {
+		command += " --context " + clusterName
+	}
+	return command + fmt.Sprintf(" -n %s %s -c %s", pod.Namespace, pod.Name, container)
+}
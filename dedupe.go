@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// suppressedCounter counts the events dropped by -dedupe-window.
+var suppressedCounter, _ = meter.Int64Counter("pod_event_watcher.events.suppressed",
+	metric.WithDescription("Number of events not delivered because an identical event for the same pod was delivered within -dedupe-window, by event type."))
+
+// deduplicator drops the events that repeat an event for the same pod within a window, before they are delivered to any sink.
+// Two events are the same if they have the same type, container, message and differences, so that the repeats that a relist or resync storm sends for pods that have not changed are delivered once, while each real change is still delivered.
+type deduplicator struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[[sha256.Size]byte]time.Time
+	// swept is when the fingerprints older than the window were last forgotten.
+	swept time.Time
+}
+
+// dedupe drops repeated events if enabled with the -dedupe-window flag, and is otherwise nil.
+var dedupe *deduplicator
+
+// newDeduplicator creates a deduplicator that drops the repeats of each event within the window.
+func newDeduplicator(window time.Duration) *deduplicator {
+	return &deduplicator{window: window, seen: make(map[[sha256.Size]byte]time.Time), swept: time.Now()}
+}
+
+// fingerprint identifies an event by its cluster, pod, type, container, message and differences, including the cumulative differences and the changes to each container.
+// Each list is ended by a byte that cannot be in a string, so that the same strings in different lists give different fingerprints.
+func fingerprint(e event) [sha256.Size]byte {
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	for _, s := range []string{e.Cluster, e.Namespace, e.podName(), string(e.Pod.UID), string(e.Type), e.Container, e.Message} {
+		write(s)
+	}
+	for _, lines := range [][]string{e.Diff, e.Cumulative} {
+		for _, line := range lines {
+			write(line)
+		}
+		h.Write([]byte{0xff})
+	}
+	for _, c := range e.Containers {
+		write(c.Container)
+		for _, change := range c.Changes {
+			write(change.Field)
+			write(change.Old)
+			write(change.New)
+		}
+		h.Write([]byte{0xff})
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// apply drops an event for the bus if the same event for the same pod was delivered within the window. Events that are not about a pod, such as reports, are always delivered.
+func (d *deduplicator) apply(e event) (event, bool, error) {
+	if e.Pod == nil {
+		return e, true, nil
+	}
+	key := fingerprint(e)
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.swept) >= d.window {
+		for k, t := range d.seen {
+			if now.Sub(t) >= d.window {
+				delete(d.seen, k)
+			}
+		}
+		d.swept = now
+	}
+	if t, ok := d.seen[key]; ok && now.Sub(t) < d.window {
+		debugf(2, debugSink, "suppressed %s event for %s/%s, which repeats one from %s ago\n", e.Type, e.Namespace, e.podName(), now.Sub(t).Round(time.Millisecond))
+		suppressedCounter.Add(context.Background(), 1, metric.WithAttributes(attribute.String("type", string(e.Type))))
+		return e, false, nil
+	}
+	d.seen[key] = now
+	return e, true, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFingerprint(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "web"}}
+	base := event{Type: eventUpdated, Namespace: "default", Pod: pod, Diff: []string{"image: web:1 != web:2"}}
+	cumulative := base
+	cumulative.Cumulative = []string{"image: web:0 != web:2"}
+	moved := event{Type: eventUpdated, Namespace: "default", Pod: pod, Cumulative: base.Diff}
+	containers := base
+	containers.Containers = []containerDiff{{Container: "app", Changes: []fieldChange{{Field: "image", Old: "web:1", New: "web:2"}}}}
+	otherContainer := base
+	otherContainer.Containers = []containerDiff{{Container: "sidecar", Changes: []fieldChange{{Field: "image", Old: "web:1", New: "web:2"}}}}
+
+	seen := map[[sha256.Size]byte]string{}
+	for name, e := range map[string]event{"base": base, "cumulative": cumulative, "moved": moved, "containers": containers, "other container": otherContainer} {
+		key := fingerprint(e)
+		if other, ok := seen[key]; ok {
+			t.Errorf("%s and %s events have the same fingerprint", name, other)
+		}
+		seen[key] = name
+	}
+	if fingerprint(containers) != fingerprint(containers) {
+		t.Error("the same event has different fingerprints")
+	}
+}
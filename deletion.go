@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// deletionLifecycle is how far a pod has got through being deleted, for the terminating, finalizer-removed and deleted events with -deletion-stages.
+type deletionLifecycle struct {
+	// RequestedAt is when the deletion of the pod was requested.
+	RequestedAt time.Time `json:"requestedAt"`
+	// GracePeriodSeconds is the time that the pod's containers were given to stop.
+	GracePeriodSeconds *int64 `json:"gracePeriodSeconds,omitempty"`
+	// Finalizers are the finalizers that the pod is still waiting for.
+	Finalizers []string `json:"finalizers,omitempty"`
+	// ElapsedSeconds is the time since the deletion was requested.
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+}
+
+// deletionTracker follows each pod through its deletion: its deletion being requested (terminating), each of its finalizers being removed (finalizer-removed), and it being gone (deleted), with the time taken to reach each stage.
+// A pod with finalizers stays in the API after its containers have stopped until the controllers that own the finalizers remove them, which is often why a deletion is slow.
+type deletionTracker struct {
+	mu        sync.Mutex
+	requested map[types.UID]time.Time
+	clusters  map[types.UID]string // UID -> cluster.
+}
+
+// deletions follows the deletions of pods if enabled with the -deletion-stages flag, and is otherwise nil.
+var deletions *deletionTracker
+
+// newDeletionTracker creates a deletionTracker.
+func newDeletionTracker() *deletionTracker {
+	return &deletionTracker{requested: make(map[types.UID]time.Time), clusters: make(map[types.UID]string)}
+}
+
+// observe returns a terminating event when a pod's deletion is requested, and a finalizer-removed event when one of the finalizers of a terminating pod is removed.
+// oldPod is nil for a pod that has just been created (or listed), which can already be terminating if the watcher started during its deletion.
+func (d *deletionTracker) observe(e event, oldPod *v1.Pod) []event {
+	pod := e.Pod
+	if pod.DeletionTimestamp == nil {
+		return nil
+	}
+	requested := d.requestedAt(e)
+	if oldPod == nil {
+		return nil
+	}
+	var found []event
+	if oldPod.DeletionTimestamp == nil {
+		t := newPodEvent(e.context(), eventTerminating, pod)
+		t.Deletion = lifecycle(pod, requested)
+		t.Message = "grace period " + gracePeriod(pod)
+		if len(pod.Finalizers) > 0 {
+			t.Message += ", waiting for finalizers " + strings.Join(pod.Finalizers, ", ")
+		}
+		if cause := disruptionCause(pod); cause != "" {
+			t.Message = cause + "; " + t.Message
+			withDisruptionBudgets(&t)
+		}
+		found = append(found, t)
+	}
+	remaining := make(map[string]bool)
+	for _, f := range pod.Finalizers {
+		remaining[f] = true
+	}
+	for _, f := range oldPod.Finalizers {
+		if remaining[f] {
+			continue
+		}
+		r := newPodEvent(e.context(), eventFinalizerRemoved, pod)
+		r.Deletion = lifecycle(pod, requested)
+		r.Message = fmt.Sprintf("%s removed %s after deletion was requested", f, elapsed(requested))
+		if len(pod.Finalizers) > 0 {
+			r.Message += "; waiting for " + strings.Join(pod.Finalizers, ", ")
+		} else {
+			r.Message += "; no finalizers left"
+		}
+		found = append(found, r)
+	}
+	return found
+}
+
+// forget removes a deleted pod, and adds the time since its deletion was requested to its deleted event.
+func (d *deletionTracker) forget(e *event) {
+	requested := d.requestedAt(*e)
+	d.mu.Lock()
+	delete(d.requested, e.Pod.UID)
+	delete(d.clusters, e.Pod.UID)
+	d.mu.Unlock()
+	if requested.IsZero() {
+		return
+	}
+	e.Deletion = lifecycle(e.Pod, requested)
+	gone := "gone " + elapsed(requested) + " after deletion was requested"
+	if e.Message == "" {
+		e.Message = gone
+	} else {
+		e.Message += "; " + gone
+	}
+}
+
+// requestedAt returns when the deletion of an event's pod was requested, which is remembered from the first time that the pod is seen terminating, or the zero time if it is not terminating.
+func (d *deletionTracker) requestedAt(e event) time.Time {
+	pod := e.Pod
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t, ok := d.requested[pod.UID]; ok {
+		return t
+	}
+	if pod.DeletionTimestamp == nil {
+		return time.Time{}
+	}
+	// The deletion timestamp is when the grace period ends. It is moved earlier if the deletion is requested again with a shorter grace period, so it is only used the first time that the pod is seen terminating.
+	t := pod.DeletionTimestamp.Time
+	if pod.DeletionGracePeriodSeconds != nil {
+		t = t.Add(-time.Duration(*pod.DeletionGracePeriodSeconds) * time.Second)
+	}
+	d.requested[pod.UID] = t
+	d.clusters[pod.UID] = e.cluster()
+	return t
+}
+
+// forgetCluster removes the pods of a cluster that is no longer watched.
+func (d *deletionTracker) forgetCluster(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for uid, cluster := range d.clusters {
+		if cluster == name {
+			delete(d.requested, uid)
+			delete(d.clusters, uid)
+		}
+	}
+}
+
+// lifecycle returns the deletion stage of a pod whose deletion was requested at a given time.
+func lifecycle(pod *v1.Pod, requested time.Time) *deletionLifecycle {
+	return &deletionLifecycle{
+		RequestedAt:        requested,
+		GracePeriodSeconds: pod.DeletionGracePeriodSeconds,
+		Finalizers:         pod.Finalizers,
+		ElapsedSeconds:     time.Since(requested).Seconds(),
+	}
+}
+
+// gracePeriod describes a terminating pod's grace period, e.g. "30s".
+func gracePeriod(pod *v1.Pod) string {
+	if pod.DeletionGracePeriodSeconds == nil {
+		return "unknown"
+	}
+	return (time.Duration(*pod.DeletionGracePeriodSeconds) * time.Second).String()
+}
+
+// elapsed describes the time since t, rounded to the second.
+func elapsed(t time.Time) string {
+	return time.Since(t).Round(time.Second).String()
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// describeTimeout is how long listing the Kubernetes Events of a pod for its description may take.
+const describeTimeout = 5 * time.Second
+
+// detailsMode is how the stdout sink prints the pod details: not at all, as a dump of the pod object, or described as by kubectl describe.
+// It is given by -details, which on its own means a dump, or -details=describe.
+type detailsMode string
+
+const (
+	detailsNone     detailsMode = ""
+	detailsDump     detailsMode = "dump"
+	detailsDescribe detailsMode = "describe"
+)
+
+// String returns the mode as given to -details.
+func (m *detailsMode) String() string {
+	if m == nil || *m == detailsNone {
+		return "false"
+	}
+	return string(*m)
+}
+
+// Set parses the value of -details.
+func (m *detailsMode) Set(value string) error {
+	switch value {
+	case "false", "":
+		*m = detailsNone
+	case "true", string(detailsDump):
+		*m = detailsDump
+	case string(detailsDescribe):
+		*m = detailsDescribe
+	default:
+		return fmt.Errorf("unknown details mode %q (must be true, false, dump or describe)", value)
+	}
+	return nil
+}
+
+// IsBoolFlag allows -details to be given without a value.
+func (m *detailsMode) IsBoolFlag() bool {
+	return true
+}
+
+// UnmarshalJSON accepts true, false or a mode name, so that details: true in a configuration file still means a dump.
+func (m *detailsMode) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		return m.Set(fmt.Sprint(b))
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("details must be true, false, dump or describe")
+	}
+	return m.Set(s)
+}
+
+// describesPods returns whether any of the sinks describes pods, and so lists their Kubernetes Events.
+func describesPods(sinkConfigs []sinkConfig) bool {
+	for _, c := range sinkConfigs {
+		if c.Type == "stdout" && c.Details == detailsDescribe {
+			return true
+		}
+	}
+	return false
+}
+
+// describePod writes a description of a pod in the layout of kubectl describe pod, followed by its recent Kubernetes Events if its cluster is being watched.
+func describePod(out io.Writer, clusterName string, pod *v1.Pod) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	line := func(level int, format string, args ...interface{}) {
+		fmt.Fprintf(w, strings.Repeat("  ", level)+format+"\n", args...)
+	}
+
+	line(0, "Name:\t%s", pod.Name)
+	line(0, "Namespace:\t%s", pod.Namespace)
+	if pod.Spec.Priority != nil {
+		line(0, "Priority:\t%d", *pod.Spec.Priority)
+	}
+	if pod.Spec.PriorityClassName != "" {
+		line(0, "Priority Class Name:\t%s", pod.Spec.PriorityClassName)
+	}
+	line(0, "Service Account:\t%s", orNone(pod.Spec.ServiceAccountName))
+	node := pod.Spec.NodeName
+	if node != "" && pod.Status.HostIP != "" {
+		node += "/" + pod.Status.HostIP
+	}
+	line(0, "Node:\t%s", orNone(node))
+	if pod.Status.StartTime != nil {
+		line(0, "Start Time:\t%s", pod.Status.StartTime.Format(time.RFC1123Z))
+	}
+	describeMap(line, "Labels", pod.Labels)
+	describeMap(line, "Annotations", pod.Annotations)
+	if pod.DeletionTimestamp != nil {
+		line(0, "Status:\tTerminating (lasts %s)", duration.HumanDuration(time.Since(pod.DeletionTimestamp.Time)))
+		if pod.DeletionGracePeriodSeconds != nil {
+			line(0, "Termination Grace Period:\t%ds", *pod.DeletionGracePeriodSeconds)
+		}
+	} else {
+		line(0, "Status:\t%s", pod.Status.Phase)
+	}
+	if pod.Status.Reason != "" {
+		line(0, "Reason:\t%s", pod.Status.Reason)
+	}
+	if pod.Status.Message != "" {
+		line(0, "Message:\t%s", pod.Status.Message)
+	}
+	line(0, "IP:\t%s", pod.Status.PodIP)
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		line(0, "Controlled By:\t%s/%s", owner.Kind, owner.Name)
+	}
+
+	statuses := make(map[string]v1.ContainerStatus)
+	for _, list := range [][]v1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses, pod.Status.EphemeralContainerStatuses} {
+		for _, s := range list {
+			statuses[s.Name] = s
+		}
+	}
+	if len(pod.Spec.InitContainers) > 0 {
+		line(0, "Init Containers:")
+		for _, c := range pod.Spec.InitContainers {
+			describeContainer(line, c, statuses[c.Name])
+		}
+	}
+	line(0, "Containers:")
+	for _, c := range pod.Spec.Containers {
+		describeContainer(line, c, statuses[c.Name])
+	}
+	if len(pod.Spec.EphemeralContainers) > 0 {
+		line(0, "Ephemeral Containers:")
+		for _, c := range pod.Spec.EphemeralContainers {
+			describeContainer(line, v1.Container(c.EphemeralContainerCommon), statuses[c.Name])
+		}
+	}
+
+	if len(pod.Status.Conditions) > 0 {
+		line(0, "Conditions:")
+		line(1, "Type\tStatus")
+		for _, c := range pod.Status.Conditions {
+			line(1, "%s\t%s", c.Type, c.Status)
+		}
+	}
+	if pod.Status.QOSClass != "" {
+		line(0, "QoS Class:\t%s", pod.Status.QOSClass)
+	}
+	describeMap(line, "Node-Selectors", pod.Spec.NodeSelector)
+	if len(pod.Spec.Tolerations) == 0 {
+		line(0, "Tolerations:\t<none>")
+	}
+	for i, t := range pod.Spec.Tolerations {
+		label := ""
+		if i == 0 {
+			label = "Tolerations:"
+		}
+		line(0, "%s\t%s", label, describeToleration(t))
+	}
+	w.Flush()
+
+	if c := watchedClusters.named(clusterName); c != nil {
+		describeEvents(out, c, pod)
+	}
+}
+
+// describeContainer writes the description of a container and its status.
+func describeContainer(line func(int, string, ...interface{}), c v1.Container, s v1.ContainerStatus) {
+	line(1, "%s:", c.Name)
+	if s.ContainerID != "" {
+		line(2, "Container ID:\t%s", s.ContainerID)
+	}
+	line(2, "Image:\t%s", c.Image)
+	if s.ImageID != "" {
+		line(2, "Image ID:\t%s", s.ImageID)
+	}
+	var ports []string
+	for _, p := range c.Ports {
+		ports = append(ports, fmt.Sprintf("%d/%s", p.ContainerPort, p.Protocol))
+	}
+	line(2, "Port:\t%s", orNone(strings.Join(ports, ", ")))
+	if len(c.Command) > 0 {
+		line(2, "Command:\t%s", strings.Join(c.Command, " "))
+	}
+	if len(c.Args) > 0 {
+		line(2, "Args:\t%s", strings.Join(c.Args, " "))
+	}
+	describeState(line, "State", s.State)
+	if s.LastTerminationState.Terminated != nil {
+		describeState(line, "Last State", s.LastTerminationState)
+	}
+	ready := "False"
+	if s.Ready {
+		ready = "True"
+	}
+	line(2, "Ready:\t%s", ready)
+	line(2, "Restart Count:\t%d", s.RestartCount)
+	describeResources(line, "Limits", c.Resources.Limits)
+	describeResources(line, "Requests", c.Resources.Requests)
+	if len(c.VolumeMounts) == 0 {
+		line(2, "Mounts:\t<none>")
+	} else {
+		line(2, "Mounts:")
+	}
+	for _, m := range c.VolumeMounts {
+		mode := "rw"
+		if m.ReadOnly {
+			mode = "ro"
+		}
+		line(3, "%s from %s (%s)", m.MountPath, m.Name, mode)
+	}
+}
+
+// describeState writes a container state, e.g. Waiting with its reason.
+func describeState(line func(int, string, ...interface{}), label string, s v1.ContainerState) {
+	switch {
+	case s.Running != nil:
+		line(2, "%s:\tRunning", label)
+		line(3, "Started:\t%s", s.Running.StartedAt.Format(time.RFC1123Z))
+	case s.Waiting != nil:
+		line(2, "%s:\tWaiting", label)
+		if s.Waiting.Reason != "" {
+			line(3, "Reason:\t%s", s.Waiting.Reason)
+		}
+		if s.Waiting.Message != "" {
+			line(3, "Message:\t%s", s.Waiting.Message)
+		}
+	case s.Terminated != nil:
+		line(2, "%s:\tTerminated", label)
+		if s.Terminated.Reason != "" {
+			line(3, "Reason:\t%s", s.Terminated.Reason)
+		}
+		if s.Terminated.Message != "" {
+			line(3, "Message:\t%s", s.Terminated.Message)
+		}
+		line(3, "Exit Code:\t%d", s.Terminated.ExitCode)
+		if s.Terminated.Signal != 0 {
+			line(3, "Signal:\t%d", s.Terminated.Signal)
+		}
+		line(3, "Started:\t%s", s.Terminated.StartedAt.Format(time.RFC1123Z))
+		line(3, "Finished:\t%s", s.Terminated.FinishedAt.Format(time.RFC1123Z))
+	default:
+		line(2, "%s:\tWaiting", label)
+	}
+}
+
+// describeResources writes a container's limits or requests, sorted by resource name.
+func describeResources(line func(int, string, ...interface{}), label string, resources v1.ResourceList) {
+	if len(resources) == 0 {
+		return
+	}
+	line(2, "%s:", label)
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		q := resources[v1.ResourceName(name)]
+		line(3, "%s:\t%s", name, q.String())
+	}
+}
+
+// describeMap writes labels, annotations or node selectors one per line, sorted by key.
+func describeMap(line func(int, string, ...interface{}), label string, m map[string]string) {
+	if len(m) == 0 {
+		line(0, "%s:\t<none>", label)
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		if i == 0 {
+			line(0, "%s:\t%s=%s", label, k, m[k])
+		} else {
+			line(0, "\t%s=%s", k, m[k])
+		}
+	}
+}
+
+// describeToleration formats a toleration as kubectl describe does, e.g. "node.kubernetes.io/not-ready:NoExecute op=Exists for 300s".
+func describeToleration(t v1.Toleration) string {
+	s := t.Key
+	if t.Value != "" {
+		s += "=" + t.Value
+	}
+	if t.Effect != "" {
+		s += ":" + string(t.Effect)
+	}
+	if t.Operator == v1.TolerationOpExists && t.Value == "" {
+		if t.Key != "" || t.Effect != "" {
+			s += " "
+		}
+		s += "op=Exists"
+	}
+	if t.TolerationSeconds != nil {
+		s += fmt.Sprintf(" for %ds", *t.TolerationSeconds)
+	}
+	return s
+}
+
+// describeEvents lists the Kubernetes Events of a pod from its cluster and writes them oldest first, as kubectl describe does.
+func describeEvents(out io.Writer, c *cluster, pod *v1.Pod) {
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+	selector := fields.Set{"involvedObject.name": pod.Name, "involvedObject.namespace": pod.Namespace}
+	if pod.UID != "" {
+		selector["involvedObject.uid"] = string(pod.UID)
+	}
+	list, err := c.clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{FieldSelector: selector.AsSelector().String()})
+	if err != nil {
+		log.Printf("%sDescribe error: %v\n", clusterPrefix(c.name), err)
+		return
+	}
+	if len(list.Items) == 0 {
+		fmt.Fprintln(out, "Events:  <none>")
+		return
+	}
+	events := list.Items
+	sort.SliceStable(events, func(i, j int) bool { return eventTime(events[i]).Before(eventTime(events[j])) })
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Events:")
+	fmt.Fprintln(w, "  Type\tReason\tAge\tFrom\tMessage")
+	fmt.Fprintln(w, "  ----\t------\t----\t----\t-------")
+	for _, e := range events {
+		age := duration.HumanDuration(time.Since(eventTime(e)))
+		if e.Count > 1 && !e.FirstTimestamp.IsZero() {
+			age = fmt.Sprintf("%s (x%d over %s)", age, e.Count, duration.HumanDuration(time.Since(e.FirstTimestamp.Time)))
+		}
+		from := e.Source.Component
+		if from == "" {
+			from = e.ReportingController
+		}
+		// The pod was masked when it was cached, but its Kubernetes Events are listed as it is described, so their messages are masked here.
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", e.Type, e.Reason, age, from, redaction.redactString(strings.TrimSpace(e.Message)))
+	}
+	w.Flush()
+}
+
+// eventTime returns the last time that a Kubernetes Event was seen, which is in a different field for the events.k8s.io API.
+func eventTime(e v1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case e.Series != nil:
+		return e.Series.LastObservedTime.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+// orNone returns s, or "<none>" if it is empty.
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
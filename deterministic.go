@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/k0kubun/pp"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+)
+
+// deterministicTime is the time of every event with -deterministic.
+var deterministicTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// deterministic is set by the -deterministic flag, for output that is the same every time the same pods are watched or replayed.
+var deterministic bool
+
+// setDeterministic makes the output reproducible, so that it can be compared with golden files: every event is sent to the sinks with the same time, log lines have no timestamps, the differences are sorted without pointer addresses, and the pods in the stdout details are written as YAML without colours, as pp writes maps in a random order.
+// The events keep their real times until they are published, so that the warnings that count events within a time window still work.
+func setDeterministic() {
+	deterministic = true
+	log.SetFlags(0)
+	pp.ColoringEnabled = false
+}
+
+// deterministicPointer matches the addresses that the differences show for pointers inside values that were added or removed, such as a container status's Started.
+var deterministicPointer = regexp.MustCompile(`\b0x[0-9a-f]{6,}\b`)
+
+// deterministicDiffer returns a Differ like d whose differences are sorted and show no pointer addresses, as the differences in maps such as the labels, annotations and resources are otherwise found in a random order.
+func deterministicDiffer(d watcher.Differ) watcher.Differ {
+	return watcher.DifferFunc(func(oldPod, newPod *v1.Pod) []string {
+		diff := d.Diff(oldPod, newPod)
+		for i := range diff {
+			diff[i] = deterministicPointer.ReplaceAllString(diff[i], "0x0")
+		}
+		sort.Strings(diff)
+		return diff
+	})
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Values of -diff-scope.
+const (
+	diffScopeAll    = "all"
+	diffScopeSpec   = "spec"
+	diffScopeStatus = "status"
+)
+
+// diffStrategies are the Differs that can be chosen with -diff-strategy.
+var diffStrategies = map[string]watcher.Differ{
+	"semantic":   watcher.SemanticDiffer,
+	"deep-equal": watcher.DeepEqualDiffer,
+	"json-patch": watcher.JSONPatchDiffer,
+	"none":       watcher.NoDiffer,
+}
+
+// podDiff finds the differences between the old and new pod of each update with the -diff-strategy, leaving out the fields given by -diff-ignore and -diff-scope.
+var podDiff = watcher.SemanticDiffer
+
+// diffScope is the part of the pod that the differences are reported for, set by -diff-scope.
+var diffScope = diffScopeAll
+
+// diffScopePaths returns the paths left out of the differences by a -diff-scope.
+// The spec scope includes the metadata, as labels and annotations are changed by the same people and controllers as the spec.
+func diffScopePaths(scope string) ([]watcher.Path, error) {
+	switch scope {
+	case diffScopeAll:
+		return nil, nil
+	case diffScopeSpec:
+		return watcher.ParsePaths("status")
+	case diffScopeStatus:
+		return watcher.ParsePaths("metadata,spec")
+	}
+	return nil, fmt.Errorf("-diff-scope must be spec, status or all, not %q", scope)
+}
+
+// Values of -diff-format.
+const (
+	diffFormatFields     = "fields"
+	diffFormatContainers = "containers"
+	diffFormatPaths      = "paths"
+)
+
+// diffFormat is how the differences are reported, set by -diff-format.
+var diffFormat = diffFormatFields
+
+// formatDiff formats the differences between two pods for -diff-format, returning the summaries of the containers as well for the containers format.
+func formatDiff(oldPod, newPod *v1.Pod, diff []string) ([]containerDiff, []string) {
+	switch diffFormat {
+	case diffFormatContainers:
+		return containerDiffs(oldPod, newPod, diff)
+	case diffFormatPaths:
+		return nil, changedPaths(diff)
+	}
+	return nil, diff
+}
+
+// changedPaths returns a single line listing the dotted paths of the fields that changed, e.g. "status.phase, status.podIP, metadata.labels.version", or nothing if none did.
+func changedPaths(diff []string) []string {
+	if len(diff) == 0 {
+		return diff
+	}
+	seen := make(map[string]bool)
+	var paths []string
+	for _, line := range diff {
+		if p := diffPath(line); !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	return []string{strings.Join(paths, ", ")}
+}
+
+// diffPath returns the dotted path of the field changed by a line of differences, which is either from go-test/deep, e.g. "Status.ContainerStatuses.slice[0].Ready: false != true", or a JSON Patch operation.
+// The Go names of the fields in lines from go-test/deep are changed to their JSON names.
+func diffPath(line string) string {
+	var b strings.Builder
+	if strings.HasPrefix(line, "{") {
+		var op struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(line), &op); err != nil {
+			return line
+		}
+		for _, token := range strings.Split(strings.TrimPrefix(op.Path, "/"), "/") {
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+			if _, err := strconv.Atoi(token); err == nil {
+				b.WriteString("[" + token + "]")
+			} else {
+				writeKey(&b, token)
+			}
+		}
+		return b.String()
+	}
+	path, _, _ := strings.Cut(line, ": ")
+	for path != "" {
+		var step string
+		switch {
+		case strings.HasPrefix(path, "map["):
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return line
+			}
+			writeKey(&b, path[4:end])
+			path = path[end+1:]
+		case strings.HasPrefix(path, "slice["):
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return line
+			}
+			b.WriteString(path[5 : end+1])
+			path = path[end+1:]
+		default:
+			step, path, _ = strings.Cut(path, ".")
+			// The embedded structs are not in the JSON paths.
+			if step == "TypeMeta" || step == "EphemeralContainerCommon" {
+				continue
+			}
+			writeKey(&b, jsonName(step))
+			continue
+		}
+		path = strings.TrimPrefix(path, ".")
+	}
+	return b.String()
+}
+
+// writeKey appends a key to a dotted path, in quoted brackets if it is not a plain name.
+func writeKey(b *strings.Builder, key string) {
+	if key == "" || strings.ContainsAny(key, ".,[]*\"' /") {
+		fmt.Fprintf(b, "[%q]", key)
+		return
+	}
+	if b.Len() > 0 {
+		b.WriteByte('.')
+	}
+	b.WriteString(key)
+}
+
+// jsonNames are the JSON names of the fields of pods that are not their Go names in camel case.
+var jsonNames = map[string]string{
+	"ObjectMeta":           "metadata",
+	"LastTerminationState": "lastState",
+}
+
+// jsonName returns the JSON name of a field of a pod from its Go name, e.g. "podIP" for PodIP and "qosClass" for QOSClass.
+func jsonName(name string) string {
+	if n, ok := jsonNames[name]; ok {
+		return n
+	}
+	// The leading capitals are lower case, except for the start of the next word.
+	upper := 0
+	for upper < len(name) && name[upper] >= 'A' && name[upper] <= 'Z' {
+		upper++
+	}
+	if upper > 1 && upper < len(name) {
+		upper--
+	}
+	return strings.ToLower(name[:upper]) + name[upper:]
+}
+
+// containerDiff is the changes to one container in an update.
+type containerDiff struct {
+	Container string        `json:"container"`
+	Changes   []fieldChange `json:"changes"`
+}
+
+// fieldChange is a change to one field of a container. Old and New are empty for the fields that are not summarized, such as env.
+type fieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// String describes the changes to a container, e.g. "container app: image web:1.2 -> web:1.3, restartCount 0 -> 1".
+func (d containerDiff) String() string {
+	changes := make([]string, len(d.Changes))
+	for i, c := range d.Changes {
+		if c.Old == "" && c.New == "" {
+			changes[i] = c.Field + " changed"
+		} else {
+			changes[i] = fmt.Sprintf("%s %s -> %s", c.Field, orDash(c.Old), orDash(c.New))
+		}
+	}
+	return fmt.Sprintf("container %s: %s", d.Container, strings.Join(changes, ", "))
+}
+
+// containerLists are the lists of containers and their statuses in a pod, by the paths that go-test/deep reports their differences with.
+var containerLists = map[string]func(*v1.Pod) interface{}{
+	"Spec.Containers":                   func(p *v1.Pod) interface{} { return p.Spec.Containers },
+	"Spec.InitContainers":               func(p *v1.Pod) interface{} { return p.Spec.InitContainers },
+	"Spec.EphemeralContainers":          func(p *v1.Pod) interface{} { return p.Spec.EphemeralContainers },
+	"Status.ContainerStatuses":          func(p *v1.Pod) interface{} { return p.Status.ContainerStatuses },
+	"Status.InitContainerStatuses":      func(p *v1.Pod) interface{} { return p.Status.InitContainerStatuses },
+	"Status.EphemeralContainerStatuses": func(p *v1.Pod) interface{} { return p.Status.EphemeralContainerStatuses },
+}
+
+// containerValues returns the names of a list of containers or container statuses, and the elements to read their fields from.
+func containerValues(list interface{}) ([]string, []reflect.Value) {
+	v := reflect.ValueOf(list)
+	names, values := make([]string, v.Len()), make([]reflect.Value, v.Len())
+	for i := range values {
+		values[i] = v.Index(i)
+		// Containers, ephemeral containers and container statuses all have a Name, although an ephemeral container's is embedded.
+		names[i] = values[i].FieldByName("Name").String()
+	}
+	return names, values
+}
+
+// containerFields are the names used for the fields of containers and their statuses, where they differ from their Go names with the first letter in lower case.
+var containerFields = map[string]string{
+	"LastTerminationState": "lastState",
+	"ImageID":              "imageID",
+}
+
+// containerDiffs summarizes the differences of an update by container, from the lines found by podDiff.
+// The lines for the fields of containers and their statuses are replaced by one line for each container that changed, and the other lines are kept.
+// Only the fields that podDiff found changes in are summarized, so -diff-ignore and -diff-scope apply to the summaries too.
+func containerDiffs(oldPod, newPod *v1.Pod, diff []string) ([]containerDiff, []string) {
+	var diffs []containerDiff
+	byName := make(map[string]int)
+	var other []string
+	for _, line := range diff {
+		list, index, field, ok := containerPath(line)
+		if !ok {
+			other = append(other, line)
+			continue
+		}
+		oldNames, oldValues := containerValues(containerLists[list](oldPod))
+		newNames, newValues := containerValues(containerLists[list](newPod))
+		var name string
+		var oldValue, newValue reflect.Value
+		if index < len(oldNames) {
+			name, oldValue = oldNames[index], oldValues[index].FieldByName(field)
+		}
+		if index < len(newNames) {
+			name, newValue = newNames[index], newValues[index].FieldByName(field)
+		}
+		if name == "" {
+			other = append(other, line)
+			continue
+		}
+		change := fieldChange{Field: containerFields[field], Old: fieldString(oldValue), New: fieldString(newValue)}
+		if change.Field == "" {
+			change.Field = strings.ToLower(field[:1]) + field[1:]
+		}
+		// A field with several differences or in both the spec and status (e.g. image) is only summarized once, and the fields whose summaries are the same (e.g. a running container's start time) are left out.
+		i, ok := byName[name]
+		if !ok {
+			i = len(diffs)
+			byName[name] = i
+			diffs = append(diffs, containerDiff{Container: name})
+		}
+		if hasField(diffs[i].Changes, change.Field) || (change.Old == change.New && change.Old != "") {
+			continue
+		}
+		diffs[i].Changes = append(diffs[i].Changes, change)
+	}
+	changed := diffs[:0]
+	lines := make([]string, 0, len(diffs)+len(other))
+	for _, d := range diffs {
+		if len(d.Changes) > 0 {
+			changed = append(changed, d)
+			lines = append(lines, d.String())
+		}
+	}
+	return changed, append(lines, other...)
+}
+
+// containerPath parses a line found by podDiff for a field of a container or container status, e.g. "Spec.Containers.slice[0].Image: web:1.2 != web:1.3".
+func containerPath(line string) (list string, index int, field string, ok bool) {
+	for l := range containerLists {
+		rest, found := strings.CutPrefix(line, l+".slice[")
+		if !found {
+			continue
+		}
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return "", 0, "", false
+		}
+		index, err := strconv.Atoi(rest[:end])
+		if err != nil {
+			return "", 0, "", false
+		}
+		// The field is missing if a whole container was added or removed. The fields of an ephemeral container are embedded in EphemeralContainerCommon.
+		field := strings.TrimPrefix(strings.TrimPrefix(rest[end+1:], "."), "EphemeralContainerCommon.")
+		if i := strings.IndexAny(field, ".:"); i >= 0 {
+			field = field[:i]
+		}
+		if field == "" {
+			return "", 0, "", false
+		}
+		return l, index, field, true
+	}
+	return "", 0, "", false
+}
+
+// fieldString summarizes the value of a field of a container or container status, or returns an empty string for the fields that are not summarized.
+func fieldString(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	switch value := v.Interface().(type) {
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case *bool:
+		if value == nil {
+			return ""
+		}
+		return strconv.FormatBool(*value)
+	case int32:
+		return strconv.Itoa(int(value))
+	case v1.ContainerState:
+		return containerState(value)
+	}
+	return ""
+}
+
+// hasField reports whether a field is in a list of changes.
+func hasField(changes []fieldChange, field string) bool {
+	for _, c := range changes {
+		if c.Field == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// discordColors maps event types to embed colours.
+var discordColors = map[eventType]int{
+	eventCreated: 0x2ecc71, // green
+	eventUpdated: 0x3498db, // blue
+	eventDeleted: 0xe74c3c, // red
+
+	eventContainerRestarted: 0xe67e22, // orange
+	eventOOMKilled:          0x992d22, // dark red
+	eventCrashLoop:          0xe74c3c, // red
+	eventCrashLoopRecovered: 0x2ecc71, // green
+	eventPendingTooLong:     0xe67e22, // orange
+	eventReadinessFlapping:  0xe67e22, // orange
+	eventImageChanged:       0x9b59b6, // purple
+	eventProbeFailed:        0xe67e22, // orange
+	eventSchedulingFailed:   0xe67e22, // orange
+	eventOrphaned:           0xe74c3c, // red
+	eventTerminating:        0x95a5a6, // grey
+	eventFinalizerRemoved:   0x95a5a6, // grey
+	eventDebugContainer:     0x9b59b6, // purple
+	eventUnrestricted:       0xe67e22, // orange
+	eventRateExceeded:       0xe67e22, // orange
+	eventAnomaly:            0xe67e22, // orange
+	eventRestartReport:      0xf1c40f, // yellow
+	eventClusterReport:      0xf1c40f, // yellow
+	eventSLOReport:          0xf1c40f, // yellow
+	eventClusterUnreachable: 0xe74c3c, // red
+	eventClusterRecovered:   0x2ecc71, // green
+	eventCredentialsExpired: 0xe74c3c, // red
+	eventCredentialsRenewed: 0x2ecc71, // green
+}
+
+// discordSeverityColors maps severities to embed colours, for events whose severity was changed by the severity rules.
+var discordSeverityColors = map[severity]int{
+	severityInfo:     0x3498db, // blue
+	severityWarning:  0xe67e22, // orange
+	severityCritical: 0xe74c3c, // red
+}
+
+// discordSink posts embeds to a Discord webhook.
+// It should be wrapped in a rateLimitedSink, as Discord rejects webhooks that post too often.
+type discordSink struct {
+	url string
+}
+
+// Send posts an event as a single embed.
+// See https://discord.com/developers/docs/resources/webhook#execute-webhook
+func (s *discordSink) Send(e event) error {
+	title := e.title()
+	fields := []interface{}{}
+	if e.Cluster != "" {
+		fields = append(fields, map[string]interface{}{"name": "Cluster", "value": e.Cluster, "inline": true})
+	}
+	if e.Namespace != "" {
+		title += ": " + e.Namespace
+		fields = append(fields, map[string]interface{}{"name": "Namespace", "value": e.Namespace, "inline": true})
+	}
+	if e.Pod != nil {
+		title = e.title() + ": " + e.Pod.Name
+		fields = append(fields,
+			map[string]interface{}{"name": "Phase", "value": orDash(string(e.Pod.Status.Phase)), "inline": true},
+			map[string]interface{}{"name": "Reason", "value": orDash(podReason(e.Pod)), "inline": true},
+		)
+	}
+	color := discordColors[e.Type]
+	if e.severity() != defaultSeverity(e) {
+		color = discordSeverityColors[e.severity()]
+	}
+	embed := map[string]interface{}{
+		"title":     title,
+		"color":     color,
+		"timestamp": e.Time.Format(time.RFC3339),
+		"fields":    fields,
+	}
+	if e.Message != "" {
+		embed["description"] = truncate(e.Message, 4096)
+	} else if len(e.Diff) > 0 {
+		embed["description"] = truncate(strings.Join(e.Diff, "\n"), 4096)
+	}
+	return postJSON(s.url, map[string]interface{}{"embeds": []interface{}{embed}})
+}
+
+// orDash returns s, or "-" if it is empty, as Discord rejects empty field values.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// truncate shortens a string to at most n bytes, cutting it at the start of a character so that it is still valid UTF-8.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	end := n - 3
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end] + "..."
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"abcdefghij", 8, "abcde..."},
+		// "é" is 2 bytes, so cutting at 5 bytes would split the third.
+		{"ééééé", 8, "éé..."},
+		{"日本語のテキスト", 10, "日本..."},
+	} {
+		got := truncate(test.s, test.n)
+		if got != test.want || len(got) > test.n || !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q, want %q", test.s, test.n, got, test.want)
+		}
+	}
+}
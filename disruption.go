@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// disruptionTarget is the condition added to a pod that is about to be deleted because of a disruption, in Kubernetes 1.26 and later.
+const disruptionTarget v1.PodConditionType = "DisruptionTarget"
+
+// disruptionReasons describes the reasons of the DisruptionTarget condition.
+var disruptionReasons = map[string]string{
+	"PreemptionByScheduler":  "preempted by the scheduler",
+	"EvictionByEvictionAPI":  "evicted by the eviction API",
+	"DeletionByTaintManager": "evicted by the taint manager",
+	"DeletionByPodGC":        "deleted by the pod garbage collector",
+	"TerminationByKubelet":   "terminated by the kubelet",
+}
+
+// disruptionEventReasons describes the reasons of the Kubernetes events that are recorded for a pod before it is evicted or preempted.
+var disruptionEventReasons = map[string]string{
+	"Preempted":            "preempted by the scheduler",
+	"Evicted":              "evicted by the kubelet",
+	"TaintManagerEviction": "evicted by the taint manager",
+}
+
+// disruptionEvents holds the Kubernetes events about pods for each watched namespace, indexed by the UID of their pod, if enabled with the -watch-disruption-events flag.
+// The events with the reasons in disruptionEventReasons explain the deletions of pods in older clusters without the DisruptionTarget condition.
+var disruptionEvents []cache.Indexer
+
+// watchDisruptionEvents adds the informer for the Kubernetes events that explain why pods were deleted to a factory.
+func watchDisruptionEvents(factory informers.SharedInformerFactory, namespace string) {
+	disruptionEvents = append(disruptionEvents, podEventsInformer(factory, namespace).GetIndexer())
+}
+
+// deletionCause explains why a pod was deleted if it was evicted or preempted, including any problems with its node, or returns an empty string if it was not.
+func deletionCause(pod *v1.Pod) string {
+	cause := disruptionCause(pod)
+	if cause == "" {
+		return ""
+	}
+	if problems := nodeProblems(pod); problems != "" {
+		cause += "; " + problems
+	}
+	return cause
+}
+
+// disruptionCause explains why a pod was evicted or preempted, or returns an empty string if it was not.
+func disruptionCause(pod *v1.Pod) string {
+	if c := podCondition(pod, disruptionTarget); c != nil && c.Status == v1.ConditionTrue {
+		cause, ok := disruptionReasons[c.Reason]
+		if !ok {
+			cause = c.Reason
+		}
+		return withMessage(cause, c.Message)
+	}
+	if pod.Status.Reason == "Evicted" {
+		return withMessage("evicted by the kubelet", pod.Status.Message)
+	}
+	for _, indexer := range disruptionEvents {
+		objs, err := indexer.ByIndex(podUIDIndex, string(pod.UID))
+		if err != nil {
+			continue
+		}
+		for _, obj := range objs {
+			e := obj.(*v1.Event)
+			if cause, ok := disruptionEventReasons[e.Reason]; ok {
+				return withMessage(cause, e.Message)
+			}
+		}
+	}
+	return ""
+}
+
+// withMessage appends a message to a description if there is one.
+func withMessage(description, message string) string {
+	if message = strings.TrimSpace(message); message != "" {
+		return description + ": " + message
+	}
+	return description
+}
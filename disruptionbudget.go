@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// disruptionBudget is the state of a PodDisruptionBudget that covers an evicted pod, as it was when the pod was deleted.
+type disruptionBudget struct {
+	Name               string `json:"name"`
+	DisruptionsAllowed int32  `json:"disruptionsAllowed"`
+	CurrentHealthy     int32  `json:"currentHealthy"`
+	DesiredHealthy     int32  `json:"desiredHealthy"`
+	ExpectedPods       int32  `json:"expectedPods"`
+}
+
+// String describes the budget, e.g. "PodDisruptionBudget web is at its limit: 0 disruptions allowed, 2 of 3 pods healthy (2 desired)".
+func (b disruptionBudget) String() string {
+	limit := ""
+	switch b.DisruptionsAllowed {
+	case 0:
+		limit = " is at its limit"
+	case 1:
+		limit = " is near its limit"
+	}
+	return fmt.Sprintf("PodDisruptionBudget %s%s: %d disruptions allowed, %d of %d pods healthy (%d desired)", b.Name, limit, b.DisruptionsAllowed, b.CurrentHealthy, b.ExpectedPods, b.DesiredHealthy)
+}
+
+// watchDisruptionBudgets adds the informer for the PodDisruptionBudgets in a shard's namespace to its factory.
+func (s *shard) watchDisruptionBudgets() {
+	s.disruptionBudgets = s.factory.Policy().V1().PodDisruptionBudgets().Informer().GetIndexer()
+}
+
+// disruptionBudgets returns the PodDisruptionBudgets whose selectors match a pod, from the caches of the cluster that the pod handler was called for.
+// It returns nil if the budgets are not being watched.
+func disruptionBudgets(ctx context.Context, pod *v1.Pod) []disruptionBudget {
+	c, ok := ctx.Value(clusterKey{}).(*cluster)
+	if !ok {
+		return nil
+	}
+	var budgets []disruptionBudget
+	for _, obj := range c.namespaced(pod.Namespace, func(s *shard) cache.Indexer { return s.disruptionBudgets }) {
+		pdb := obj.(*policyv1.PodDisruptionBudget)
+		// A budget with an empty selector matches every pod in policy/v1, but a nil one matches none.
+		if pdb.Spec.Selector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		budgets = append(budgets, disruptionBudget{
+			Name:               pdb.Name,
+			DisruptionsAllowed: pdb.Status.DisruptionsAllowed,
+			CurrentHealthy:     pdb.Status.CurrentHealthy,
+			DesiredHealthy:     pdb.Status.DesiredHealthy,
+			ExpectedPods:       pdb.Status.ExpectedPods,
+		})
+	}
+	return budgets
+}
+
+// withDisruptionBudgets adds the PodDisruptionBudgets of an evicted pod to its deleted event, so that it says whether the workload can lose any more pods, which is why drains stall.
+func withDisruptionBudgets(e *event) {
+	e.DisruptionBudgets = disruptionBudgets(e.context(), e.Pod)
+	if len(e.DisruptionBudgets) == 0 {
+		return
+	}
+	descriptions := make([]string, len(e.DisruptionBudgets))
+	for i, b := range e.DisruptionBudgets {
+		descriptions[i] = b.String()
+	}
+	e.Message += "; " + strings.Join(descriptions, "; ")
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// eventType identifies what happened to a pod, or what was detected about pods.
+type eventType string
+
+const (
+	eventCreated         eventType = "created"
+	eventUpdated         eventType = "updated"
+	eventDeleted         eventType = "deleted"
+	eventRateExceeded    eventType = "rate-exceeded"
+	eventRestartReport   eventType = "restart-report"
+	eventAnomaly         eventType = "anomaly"
+	eventClusterReport   eventType = "cluster-report"
+	eventWorkloadSummary eventType = "workload-summary"
+	eventSLOReport       eventType = "slo-report"
+
+	eventContainerRestarted eventType = "container-restarted"
+	eventOOMKilled          eventType = "oom-killed"
+	eventCrashLoop          eventType = "crash-loop"
+	eventCrashLoopRecovered eventType = "crash-loop-recovered"
+	eventPendingTooLong     eventType = "pending-too-long"
+	eventReadinessFlapping  eventType = "readiness-flapping"
+	eventImageChanged       eventType = "image-changed"
+	eventProbeFailed        eventType = "probe-failed"
+	eventSchedulingFailed   eventType = "scheduling-failed"
+	eventOrphaned           eventType = "orphaned"
+	eventTerminating        eventType = "terminating"
+	eventFinalizerRemoved   eventType = "finalizer-removed"
+	eventDebugContainer     eventType = "debug-container"
+	eventUnrestricted       eventType = "network-unrestricted"
+
+	eventClusterUnreachable eventType = "cluster-unreachable"
+	eventClusterRecovered   eventType = "cluster-recovered"
+	eventCredentialsExpired eventType = "credentials-expired"
+	eventCredentialsRenewed eventType = "credentials-renewed"
+)
+
+// eventTitles describes each event type in log lines and notifications.
+// The order of eventTypes is the order that event types are listed in notifications.
+var (
+	eventTitles = map[eventType]string{
+		eventCreated:         "Pod created",
+		eventUpdated:         "Pod updated",
+		eventDeleted:         "Pod deleted",
+		eventRateExceeded:    "Event rate exceeded",
+		eventRestartReport:   "Top restarting pods",
+		eventAnomaly:         "Unusual event rate",
+		eventClusterReport:   "Cluster summary",
+		eventWorkloadSummary: "Workload summary",
+		eventSLOReport:       "Workload availability",
+
+		eventContainerRestarted: "Container restarted",
+		eventOOMKilled:          "Container OOM killed",
+		eventCrashLoop:          "Container crash looping",
+		eventCrashLoopRecovered: "Container recovered from crash loop",
+		eventPendingTooLong:     "Pod pending too long",
+		eventReadinessFlapping:  "Pod readiness flapping",
+		eventImageChanged:       "Workload image changed",
+		eventProbeFailed:        "Container probe failed",
+		eventSchedulingFailed:   "Pod cannot be scheduled",
+		eventOrphaned:           "Pod orphaned",
+		eventTerminating:        "Pod terminating",
+		eventFinalizerRemoved:   "Pod finalizer removed",
+		eventDebugContainer:     "Debug container added",
+		eventUnrestricted:       "Pod not restricted by a NetworkPolicy",
+
+		eventClusterUnreachable: "Cluster unreachable",
+		eventClusterRecovered:   "Cluster recovered",
+		eventCredentialsExpired: "Cluster credentials expired",
+		eventCredentialsRenewed: "Cluster credentials renewed",
+	}
+	eventTypes = []eventType{eventCreated, eventUpdated, eventDeleted, eventContainerRestarted, eventOOMKilled, eventCrashLoop, eventCrashLoopRecovered, eventPendingTooLong, eventReadinessFlapping, eventImageChanged, eventProbeFailed, eventSchedulingFailed, eventOrphaned, eventUnrestricted, eventTerminating, eventFinalizerRemoved, eventDebugContainer, eventRateExceeded, eventAnomaly, eventRestartReport, eventClusterReport, eventWorkloadSummary, eventSLOReport, eventClusterUnreachable, eventClusterRecovered, eventCredentialsExpired, eventCredentialsRenewed}
+)
+
+// event is a single pod event as seen by the handler functions, or a condition detected from those events.
+// Events that are not about a single pod (such as eventRateExceeded) have a nil Pod, and reports about all namespaces (such as eventClusterUnreachable) have no Namespace.
+type event struct {
+	// ID is the position of the event on the bus, which increases by one with each event and continues from the journal after a restart.
+	ID int64 `json:"id,omitempty"`
+	// Cluster is the name of the cluster that the event came from.
+	Cluster   string    `json:"cluster,omitempty"`
+	Type      eventType `json:"type"`
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Pod       *v1.Pod   `json:"pod,omitempty"`
+	Diff      []string  `json:"diff,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	// Severity is how urgent the event is, as set by the severity rules.
+	Severity severity `json:"severity,omitempty"`
+	// Cumulative is the differences between the pod as it was first observed and its current state, for eventUpdated with -diff-cumulative.
+	Cumulative []string `json:"cumulative,omitempty"`
+	// Containers is the changes to each container, for eventUpdated with -diff-format=containers.
+	Containers []containerDiff `json:"containers,omitempty"`
+	// Container is the name of the container that an eventContainerRestarted, eventOOMKilled or eventCrashLoop event is about, or of the debug container added by an eventDebugContainer event.
+	Container string `json:"container,omitempty"`
+	// Logs is the end of the container's logs from before it ended, for eventContainerRestarted and eventOOMKilled with -crash-logs.
+	Logs string `json:"logs,omitempty"`
+	// Usage is the CPU and memory that the pod's containers were using at the last check, for eventUpdated, eventContainerRestarted and eventOOMKilled with -usage-interval.
+	Usage []containerUsage `json:"usage,omitempty"`
+	// User is the user who created, updated or deleted the pod, for eventCreated and eventDeleted with -admission-addr, and also eventUpdated with -audit-addr or -audit-log.
+	User string `json:"user,omitempty"`
+	// Deletion is how far the pod has got through being deleted, for eventTerminating, eventFinalizerRemoved and eventDeleted with -deletion-stages.
+	Deletion *deletionLifecycle `json:"deletion,omitempty"`
+	// DisruptionBudgets are the PodDisruptionBudgets that cover an evicted or preempted pod, for eventDeleted and eventTerminating with -watch-disruption-budgets.
+	DisruptionBudgets []disruptionBudget `json:"disruptionBudgets,omitempty"`
+	// Cost is the estimated cost of the pod's requests, for events about a pod with -price-sheet.
+	Cost *podCost `json:"cost,omitempty"`
+	// Group is the pods of a workload with events in the interval, for eventWorkloadSummary.
+	Group *workloadGroup `json:"group,omitempty"`
+	// SLOs is the workloads below -slo-objective or burning their error budget, for eventSLOReport.
+	SLOs []sloStatus `json:"slos,omitempty"`
+	// Scheduling is the parsed reason that a pod cannot be scheduled, for eventSchedulingFailed and eventPendingTooLong.
+	Scheduling *schedulingFailure `json:"scheduling,omitempty"`
+
+	// ctx carries the trace span of the handler function that created the event.
+	ctx context.Context
+}
+
+// newPodEvent creates an event for a pod at the current time.
+func newPodEvent(ctx context.Context, t eventType, pod *v1.Pod) event {
+	return event{Cluster: contextCluster(ctx), Type: t, Time: time.Now(), Namespace: pod.Namespace, Pod: pod, ctx: ctx}
+}
+
+// cluster returns the name of the cluster that the event came from.
+// Events detected from other events do not all copy the cluster, but do keep the context of the handler function that it was called for.
+func (e event) cluster() string {
+	if e.Cluster != "" {
+		return e.Cluster
+	}
+	return contextCluster(e.ctx)
+}
+
+// context returns the event's context for starting child spans.
+func (e event) context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+// podName returns the name of the event's pod, or an empty string if it has none.
+func (e event) podName() string {
+	if e.Pod == nil {
+		return ""
+	}
+	return e.Pod.Name
+}
+
+// title returns the description of the event's type.
+func (e event) title() string {
+	if title, ok := eventTitles[e.Type]; ok {
+		return title
+	}
+	return string(e.Type)
+}
+
+// summary returns a one-line description of the event, e.g. "[prod] Pod created: nginx" or "Event rate exceeded: default: 120 events in 1m0s".
+func (e event) summary() string {
+	subject := e.podName()
+	if subject == "" {
+		subject = e.Namespace
+	}
+	s := clusterPrefix(e.cluster()) + e.title()
+	if subject != "" {
+		s += ": " + subject
+	}
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	return s
+}
+
+// validEventType reports whether t is a known event type.
+func validEventType(t eventType) bool {
+	_, ok := eventTitles[t]
+	return ok
+}
@@ -0,0 +1,4 @@
+// Package eventspb contains the gRPC API for streaming pod events, generated from events.proto, and the gRPC API for plugins, generated from plugin.proto.
+package eventspb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative events.proto plugin.proto
@@ -0,0 +1,112 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: plugin.proto
+
+package eventspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	SinkPlugin_Send_FullMethodName = "/podeventwatcher.v1.SinkPlugin/Send"
+)
+
+// SinkPluginClient is the client API for SinkPlugin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SinkPluginClient interface {
+	// Send handles an event. An error is logged by the watcher, and the event is not sent again.
+	Send(ctx context.Context, in *Event, opts ...grpc.CallOption) (*emptypb.Empty, error)
+}
+
+type sinkPluginClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSinkPluginClient(cc grpc.ClientConnInterface) SinkPluginClient {
+	return &sinkPluginClient{cc}
+}
+
+func (c *sinkPluginClient) Send(ctx context.Context, in *Event, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, SinkPlugin_Send_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SinkPluginServer is the server API for SinkPlugin service.
+// All implementations must embed UnimplementedSinkPluginServer
+// for forward compatibility
+type SinkPluginServer interface {
+	// Send handles an event. An error is logged by the watcher, and the event is not sent again.
+	Send(context.Context, *Event) (*emptypb.Empty, error)
+	mustEmbedUnimplementedSinkPluginServer()
+}
+
+// UnimplementedSinkPluginServer must be embedded to have forward compatible implementations.
+type UnimplementedSinkPluginServer struct {
+}
+
+func (UnimplementedSinkPluginServer) Send(context.Context, *Event) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Send not implemented")
+}
+func (UnimplementedSinkPluginServer) mustEmbedUnimplementedSinkPluginServer() {}
+
+// UnsafeSinkPluginServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SinkPluginServer will
+// result in compilation errors.
+type UnsafeSinkPluginServer interface {
+	mustEmbedUnimplementedSinkPluginServer()
+}
+
+func RegisterSinkPluginServer(s grpc.ServiceRegistrar, srv SinkPluginServer) {
+	s.RegisterService(&SinkPlugin_ServiceDesc, srv)
+}
+
+func _SinkPlugin_Send_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Event)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SinkPluginServer).Send(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SinkPlugin_Send_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SinkPluginServer).Send(ctx, req.(*Event))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SinkPlugin_ServiceDesc is the grpc.ServiceDesc for SinkPlugin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SinkPlugin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "podeventwatcher.v1.SinkPlugin",
+	HandlerType: (*SinkPluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Send",
+			Handler:    _SinkPlugin_Send_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "plugin.proto",
+}
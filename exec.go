@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// execSink runs a shell command for each event.
+// The event is written to the command's stdin as JSON, and the cluster, pod name, namespace, event type and severity are set in its environment as $CLUSTER, $POD_NAME, $NAMESPACE, $EVENT_TYPE and $SEVERITY.
+// At most concurrency commands run at once; Send blocks until one finishes if the limit has been reached.
+type execSink struct {
+	command string
+	policy  retryPolicy
+	timeout time.Duration
+	slots   chan struct{}
+	// ctx is cancelled to kill the commands still running at the close deadline.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	closed  bool
+	running sync.WaitGroup
+}
+
+// newExecSink creates an exec sink, which retries and dead-letters the commands that fail with the policy of the sink's route.
+func newExecSink(command string, concurrency int, timeout time.Duration, policy retryPolicy) *execSink {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	s := &execSink{
+		command: command,
+		policy:  policy,
+		timeout: timeout,
+		slots:   make(chan struct{}, concurrency),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// Send starts the command for an event.
+func (s *execSink) Send(e event) error {
+	input, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return fmt.Errorf("exec sink closed, not running command for event %q", e.summary())
+	}
+	s.running.Add(1)
+	s.mu.Unlock()
+
+	s.slots <- struct{}{}
+	go func() {
+		defer s.running.Done()
+		defer func() { <-s.slots }()
+		s.policy.deliver(e, func(e event) error {
+			if err := s.run(e, input); err != nil {
+				return fmt.Errorf("exec error for event %q: %v", e.summary(), err)
+			}
+			return nil
+		})
+	}()
+	return nil
+}
+
+// backlog returns the number of commands running.
+func (s *execSink) backlog() int {
+	return len(s.slots)
+}
+
+// Close waits for the running commands to finish, and kills those still running at the close deadline.
+func (s *execSink) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(time.Until(closeDeadline()))
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		running := len(s.slots)
+		s.cancel()
+		return fmt.Errorf("killed %d commands still running when the exec sink was closed", running)
+	}
+}
+
+// run runs the command to completion, killing it if the timeout is reached.
+func (s *execSink) run(e event, input []byte) error {
+	ctx := s.ctx
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", s.command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"CLUSTER="+e.Cluster,
+		"POD_NAME="+e.podName(),
+		"NAMESPACE="+e.Namespace,
+		"EVENT_TYPE="+string(e.Type),
+		"SEVERITY="+string(e.severity()),
+	)
+	return cmd.Run()
+}
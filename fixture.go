@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+)
+
+// fixtureList is the type of the fixture records of the pods listed when a watch starts or restarts.
+const fixtureList = "LIST"
+
+// fixtureRecord is one line of a fixture file: the pods listed by one of a cluster's shards, or one of the events from its watch, as they were received from the API server.
+type fixtureRecord struct {
+	Time      time.Time `json:"time"`
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace,omitempty"`
+	// Type is LIST, or the type of the watch event (ADDED, MODIFIED, DELETED or ERROR).
+	Type string `json:"type"`
+	// Object is the PodList for LIST, the Status for ERROR, and otherwise the Pod.
+	Object json.RawMessage `json:"object"`
+}
+
+// fixtureWriter appends the pods listed and watched to a fixture file with -record-fixture, so that a watch session can be replayed with -replay-fixture, e.g. to check that changes to the filters, diffs and warnings still give the same events for a real cluster's pods.
+type fixtureWriter struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// fixture records the watch sessions if enabled with the -record-fixture flag, and is otherwise nil.
+var fixture *fixtureWriter
+
+// openFixtureWriter opens a fixture file for appending.
+func openFixtureWriter(path string) (*fixtureWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fixtureWriter{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// write appends a record of an object listed or watched in a cluster's shard, with its pods masked.
+func (w *fixtureWriter) write(cluster, namespace, recordType string, obj runtime.Object) {
+	data, err := json.Marshal(redaction.redactObject(obj))
+	if err != nil {
+		log.Printf("%sFixture error: %v\n", clusterPrefix(cluster), err)
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	r := fixtureRecord{Time: time.Now(), Cluster: cluster, Namespace: namespace, Type: recordType, Object: data}
+	if err := w.enc.Encode(r); err != nil {
+		log.Printf("%sFixture error: %v\n", clusterPrefix(cluster), err)
+	}
+}
+
+// fixtureListWatch records the pods that a shard lists and watches before they are filtered or transformed.
+type fixtureListWatch struct {
+	cache.ListerWatcher
+	cluster, namespace string
+}
+
+// List lists the pods and records them.
+func (f *fixtureListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	obj, err := f.ListerWatcher.List(options)
+	if err == nil {
+		fixture.write(f.cluster, f.namespace, fixtureList, obj)
+	}
+	return obj, err
+}
+
+// Watch starts a watch that records each of its events. Bookmarks are not recorded, as they only carry the resource version.
+func (f *fixtureListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := f.ListerWatcher.Watch(options)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		if e.Type != watch.Bookmark {
+			fixture.write(f.cluster, f.namespace, string(e.Type), e.Object)
+		}
+		return e, true
+	}), nil
+}
+
+// fixtureReplay handles the records of a fixture file as the informers would have handled them, calling the pod handlers for each change in turn.
+// The handlers are called one at a time in the order of the records, rather than as the informers call them, so that a fixture always gives the same events.
+type fixtureReplay struct {
+	opts watcher.Options
+	// clusters are the clusters named by the records, which have fake clientsets for the handlers that look things up.
+	clusters map[string]*cluster
+	// pods are the pods that each cluster's shard has, by their keys.
+	pods map[[2]string]map[string]*v1.Pod
+}
+
+// replayFixture replays the watch sessions recorded in a fixture file.
+func replayFixture(ctx context.Context, path string, opts watcher.Options) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if opts.Transform == nil {
+		opts.Transform = watcher.TrimPod
+	}
+	if opts.Differ == nil {
+		opts.Differ = watcher.SemanticDiffer
+	}
+	r := &fixtureReplay{opts: opts, clusters: make(map[string]*cluster), pods: make(map[[2]string]map[string]*v1.Pod)}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 256<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record fixtureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		if err := r.handle(ctx, record); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// handle handles one record.
+func (r *fixtureReplay) handle(ctx context.Context, record fixtureRecord) error {
+	c, ok := r.clusters[record.Cluster]
+	if !ok {
+		c = newClusterForClientset(record.Cluster, fake.NewSimpleClientset())
+		r.clusters[record.Cluster] = c
+		watchedClusters.add(c)
+	}
+	ctx = withCluster(ctx, c)
+	shard := [2]string{record.Cluster, record.Namespace}
+	if r.pods[shard] == nil {
+		r.pods[shard] = make(map[string]*v1.Pod)
+	}
+	pods := r.pods[shard]
+
+	switch record.Type {
+	case fixtureList:
+		// Listing again replaces the shard's pods, as the informer does: the pods that are no longer listed are deleted, and the others are updated whether or not they changed.
+		var list v1.PodList
+		if err := json.Unmarshal(record.Object, &list); err != nil {
+			return err
+		}
+		listed := make(map[string]bool)
+		for i := range list.Items {
+			if pod := r.keep(&list.Items[i]); pod != nil {
+				listed[pod.Namespace+"/"+pod.Name] = true
+				r.apply(ctx, pods, pod)
+			}
+		}
+		var gone []string
+		for key := range pods {
+			if !listed[key] {
+				gone = append(gone, key)
+			}
+		}
+		sort.Strings(gone)
+		for _, key := range gone {
+			pod := pods[key]
+			delete(pods, key)
+			podDeleted(ctx, pod)
+		}
+	case string(watch.Added), string(watch.Modified):
+		var pod v1.Pod
+		if err := json.Unmarshal(record.Object, &pod); err != nil {
+			return err
+		}
+		if p := r.keep(&pod); p != nil {
+			r.apply(ctx, pods, p)
+		}
+	case string(watch.Deleted):
+		var pod v1.Pod
+		if err := json.Unmarshal(record.Object, &pod); err != nil {
+			return err
+		}
+		if p := r.keep(&pod); p != nil {
+			delete(pods, p.Namespace+"/"+p.Name)
+			podDeleted(ctx, p)
+		}
+	case string(watch.Error):
+		var status metav1.Status
+		if err := json.Unmarshal(record.Object, &status); err != nil {
+			return err
+		}
+		log.Printf("%sFixture watch error: %s\n", clusterPrefix(record.Cluster), status.Message)
+	default:
+		return fmt.Errorf("unknown record type %q", record.Type)
+	}
+	return nil
+}
+
+// keep returns a recorded pod after transforming it, or nil if the filter leaves it out.
+func (r *fixtureReplay) keep(pod *v1.Pod) *v1.Pod {
+	if r.opts.Filter != nil && !r.opts.Filter(pod) {
+		return nil
+	}
+	r.opts.Transform(pod)
+	return pod
+}
+
+// apply adds a pod to a shard's pods, calling podCreated for a new pod and podUpdated for one that the shard already has.
+func (r *fixtureReplay) apply(ctx context.Context, pods map[string]*v1.Pod, pod *v1.Pod) {
+	key := pod.Namespace + "/" + pod.Name
+	oldPod, ok := pods[key]
+	pods[key] = pod
+	if !ok {
+		podCreated(ctx, pod)
+		return
+	}
+	podUpdated(ctx, oldPod, pod, r.opts.Differ.Diff(oldPod, pod))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// flapTracker counts the changes to each pod's readiness, and warns when there are more than a threshold within a window.
+// A pod whose readiness keeps changing usually has a readiness probe that is too strict, or is too overloaded to answer it in time.
+type flapTracker struct {
+	threshold int
+	window    time.Duration
+
+	mu       sync.Mutex
+	changes  map[types.UID]*slidingWindow
+	alerting map[types.UID]bool
+	clusters map[types.UID]string // UID -> cluster.
+}
+
+// flapping tracks readiness changes if enabled with the -flap-threshold flag, and is otherwise nil.
+var flapping *flapTracker
+
+// newFlapTracker creates a flap tracker.
+func newFlapTracker(threshold int, window time.Duration) *flapTracker {
+	return &flapTracker{
+		threshold: threshold,
+		window:    window,
+		changes:   make(map[types.UID]*slidingWindow),
+		alerting:  make(map[types.UID]bool),
+		clusters:  make(map[types.UID]string),
+	}
+}
+
+// observe counts a change to a pod's readiness in an update, returning a warning event if it takes the pod over the threshold.
+// Only one warning is returned until the pod's readiness settles down again.
+func (f *flapTracker) observe(e event, oldPod *v1.Pod) (event, bool) {
+	if e.Type != eventUpdated || podReady(oldPod) == podReady(e.Pod) {
+		return event{}, false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w, ok := f.changes[e.Pod.UID]
+	if !ok {
+		w = newSlidingWindow(f.window)
+		f.changes[e.Pod.UID] = w
+		f.clusters[e.Pod.UID] = e.cluster()
+	}
+	n := w.add(e.Time)
+	if n <= f.threshold {
+		f.alerting[e.Pod.UID] = false
+		return event{}, false
+	}
+	if f.alerting[e.Pod.UID] {
+		return event{}, false
+	}
+	f.alerting[e.Pod.UID] = true
+
+	return event{
+		Type:      eventReadinessFlapping,
+		Time:      e.Time,
+		Namespace: e.Namespace,
+		Pod:       e.Pod,
+		Message:   fmt.Sprintf("readiness changed %d times in the last %s (threshold %d)", n, f.window, f.threshold),
+		ctx:       e.ctx,
+	}, true
+}
+
+// forget removes a deleted pod.
+func (f *flapTracker) forget(pod *v1.Pod) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.changes, pod.UID)
+	delete(f.alerting, pod.UID)
+	delete(f.clusters, pod.UID)
+}
+
+// forgetCluster removes the pods of a cluster that is no longer watched.
+func (f *flapTracker) forgetCluster(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for uid, cluster := range f.clusters {
+		if cluster == name {
+			delete(f.changes, uid)
+			delete(f.alerting, uid)
+			delete(f.clusters, uid)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// workloadKey identifies a workload in a namespace of a cluster.
+type workloadKey struct {
+	cluster   string
+	namespace string
+	workload  string
+}
+
+// workloadSummary is the number of pods and events of a workload, as returned by /api/summary and shown by the terminal UI.
+type workloadSummary struct {
+	Cluster   string            `json:"cluster"`
+	Namespace string            `json:"namespace"`
+	Workload  string            `json:"workload"`
+	Pods      int               `json:"pods"`
+	Events    map[eventType]int `json:"events"`
+}
+
+// eventCount returns the total number of events of every type.
+func (w workloadSummary) eventCount() int {
+	n := 0
+	for _, count := range w.Events {
+		n += count
+	}
+	return n
+}
+
+// fleetTracker counts the pod events for each workload in each cluster, both since the watcher started and since the last cluster report.
+type fleetTracker struct {
+	mu       sync.Mutex
+	total    map[workloadKey]map[eventType]int
+	interval map[workloadKey]map[eventType]int
+}
+
+// fleet counts the pod events published to the bus.
+var fleet = newFleetTracker()
+
+// newFleetTracker creates an empty fleetTracker.
+func newFleetTracker() *fleetTracker {
+	return &fleetTracker{
+		total:    make(map[workloadKey]map[eventType]int),
+		interval: make(map[workloadKey]map[eventType]int),
+	}
+}
+
+// observe counts a pod event. Events that are not about a single pod are not counted.
+func (f *fleetTracker) observe(e event) {
+	if e.Pod == nil {
+		return
+	}
+	key := workloadKey{cluster: e.cluster(), namespace: e.Namespace, workload: workload(e.Pod)}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, counts := range []map[workloadKey]map[eventType]int{f.total, f.interval} {
+		if counts[key] == nil {
+			counts[key] = make(map[eventType]int)
+		}
+		counts[key][e.Type]++
+	}
+}
+
+// forgetCluster forgets the events of the workloads of a cluster that is no longer watched.
+func (f *fleetTracker) forgetCluster(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, counts := range []map[workloadKey]map[eventType]int{f.total, f.interval} {
+		for key := range counts {
+			if key.cluster == name {
+				delete(counts, key)
+			}
+		}
+	}
+}
+
+// summarize returns the pods of each workload in the clusters being watched, with the events since the watcher started or, if reset is true, since the last call with reset, which starts counting again.
+// Workloads that had events but no longer have pods are included. The summaries are sorted by cluster, namespace and workload.
+func (f *fleetTracker) summarize(clusters []*cluster, reset bool) []workloadSummary {
+	summaries := make(map[workloadKey]*workloadSummary)
+	get := func(key workloadKey) *workloadSummary {
+		s, ok := summaries[key]
+		if !ok {
+			s = &workloadSummary{Cluster: key.cluster, Namespace: key.namespace, Workload: key.workload, Events: make(map[eventType]int)}
+			summaries[key] = s
+		}
+		return s
+	}
+	for _, c := range clusters {
+		for _, s := range c.shards {
+			for _, obj := range s.watcher.Store().List() {
+				pod := obj.(*v1.Pod)
+				get(workloadKey{cluster: c.name, namespace: pod.Namespace, workload: workload(pod)}).Pods++
+			}
+		}
+	}
+
+	f.mu.Lock()
+	counts := f.total
+	if reset {
+		counts = f.interval
+		f.interval = make(map[workloadKey]map[eventType]int)
+	}
+	for key, types := range counts {
+		s := get(key)
+		for t, n := range types {
+			s.Events[t] = n
+		}
+	}
+	f.mu.Unlock()
+
+	list := make([]workloadSummary, 0, len(summaries))
+	for _, s := range summaries {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Workload < b.Workload
+	})
+	return list
+}
+
+// clusterReports returns a report for each cluster of its pods and namespaces and the events since the last report, naming the top workloads by events.
+func clusterReports(summaries []workloadSummary, top int, interval time.Duration) []event {
+	var reports []event
+	for len(summaries) > 0 {
+		cluster := summaries[0].Cluster
+		n := 1
+		for n < len(summaries) && summaries[n].Cluster == cluster {
+			n++
+		}
+		reports = append(reports, clusterReport(cluster, summaries[:n], top, interval))
+		summaries = summaries[n:]
+	}
+	return reports
+}
+
+// clusterReport summarizes the workloads of a cluster in a single event.
+func clusterReport(cluster string, workloads []workloadSummary, top int, interval time.Duration) event {
+	pods, events := 0, 0
+	namespaces := make(map[string]bool)
+	var busy []workloadSummary
+	for _, w := range workloads {
+		pods += w.Pods
+		events += w.eventCount()
+		if w.Pods > 0 {
+			namespaces[w.Namespace] = true
+		}
+		if w.eventCount() > 0 {
+			busy = append(busy, w)
+		}
+	}
+	sort.SliceStable(busy, func(i, j int) bool { return busy[i].eventCount() > busy[j].eventCount() })
+	if len(busy) > top {
+		busy = busy[:top]
+	}
+
+	message := fmt.Sprintf("%d pods in %d namespaces, %d events in the last %s", pods, len(namespaces), events, interval)
+	if len(busy) > 0 {
+		items := make([]string, len(busy))
+		for i, w := range busy {
+			items[i] = fmt.Sprintf("%s/%s (%d)", w.Namespace, w.Workload, w.eventCount())
+		}
+		message += ": " + strings.Join(items, ", ")
+	}
+	if costs != nil {
+		if churn := costs.churnReport(cluster, top); churn != "" {
+			message += "; " + churn
+		}
+	}
+	return event{Cluster: cluster, Type: eventClusterReport, Time: time.Now(), Message: message}
+}
+
+// reportClusters publishes a report for each cluster every interval.
+func reportClusters(top int, interval time.Duration) {
+	for range time.Tick(interval) {
+		for _, e := range clusterReports(fleet.summarize(watchedClusters.list(), true), top, interval) {
+			publish(e)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// failureGate stops the watcher as soon as a pod hits one of a list of conditions, so that the watcher can be used to verify a deployment in a pipeline.
+// A condition is an event type (e.g. crash-loop) or the reason that a pod or container is waiting or terminated (e.g. CrashLoopBackOff or OOMKilled), compared without regard to case.
+type failureGate struct {
+	conditions []string
+	start      time.Time
+	stop       context.CancelFunc
+
+	mu     sync.Mutex
+	failed bool
+}
+
+// newFailureGate creates a gate for the conditions that calls stop when one of them is hit.
+func newFailureGate(conditions []string, stop context.CancelFunc) *failureGate {
+	return &failureGate{conditions: conditions, start: time.Now(), stop: stop}
+}
+
+// gate is the failure gate given by -fail-on, or nil if there is none.
+var gate *failureGate
+
+// observe checks whether an event shows that a pod has hit one of the conditions.
+func (g *failureGate) observe(e event) {
+	condition, ok := g.match(e)
+	if !ok {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.failed {
+		return
+	}
+	g.failed = true
+	name := ""
+	if e.Pod != nil {
+		name = " " + e.Pod.Namespace + "/" + e.Pod.Name
+	}
+	log.Printf("%sPod%s hit %s, failing\n", clusterPrefix(e.cluster()), name, condition)
+	g.stop()
+}
+
+// match returns the condition that an event matches, if any.
+// The last termination of a container only counts if it happened after the gate was created, so that old failures of existing pods are ignored.
+func (g *failureGate) match(e event) (string, bool) {
+	reasons := []string{string(e.Type)}
+	if pod := e.Pod; pod != nil {
+		reasons = append(reasons, pod.Status.Reason)
+		statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, s := range statuses {
+			if s.State.Waiting != nil {
+				reasons = append(reasons, s.State.Waiting.Reason)
+			}
+			if s.State.Terminated != nil {
+				reasons = append(reasons, s.State.Terminated.Reason)
+			}
+			if t := s.LastTerminationState.Terminated; t != nil && t.FinishedAt.After(g.start) {
+				reasons = append(reasons, t.Reason)
+			}
+		}
+	}
+	for _, reason := range reasons {
+		for _, c := range g.conditions {
+			if reason != "" && strings.EqualFold(reason, c) {
+				return c, true
+			}
+		}
+	}
+	return "", false
+}
+
+// hasFailed reports whether a pod has hit one of the conditions.
+func (g *failureGate) hasFailed() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.failed
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podWithStatus returns a pod with a status.
+func podWithStatus(status v1.PodStatus) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}, Status: status}
+}
+
+// lastTerminated returns a container status that was last terminated for a reason at a time.
+func lastTerminated(reason string, at time.Time) v1.ContainerStatus {
+	return v1.ContainerStatus{Name: "app", LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: reason, FinishedAt: metav1.NewTime(at)}}}
+}
+
+func TestFailureGateMatch(t *testing.T) {
+	g := newFailureGate([]string{"crash-loop", "CrashLoopBackOff", "oomkilled", "Evicted", "ImagePullBackOff"}, func() {})
+	waiting := func(reason string) v1.ContainerStatus {
+		return v1.ContainerStatus{Name: "app", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason}}}
+	}
+	tests := []struct {
+		name string
+		e    event
+		want string // The condition matched, or empty if none is.
+	}{
+		{"event type", event{Type: eventCrashLoop}, "crash-loop"},
+		{"other event type", event{Type: eventCreated, Pod: podWithStatus(v1.PodStatus{})}, ""},
+		{"pod reason", event{Type: eventUpdated, Pod: podWithStatus(v1.PodStatus{Reason: "Evicted"})}, "Evicted"},
+		{"waiting container", event{Type: eventUpdated, Pod: podWithStatus(v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{waiting("CrashLoopBackOff")}})}, "CrashLoopBackOff"},
+		{"waiting init container", event{Type: eventUpdated, Pod: podWithStatus(v1.PodStatus{InitContainerStatuses: []v1.ContainerStatus{waiting("ImagePullBackOff")}})}, "ImagePullBackOff"},
+		{"waiting for another reason", event{Type: eventUpdated, Pod: podWithStatus(v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{waiting("ContainerCreating")}})}, ""},
+		{"terminated container, without regard to case", event{Type: eventUpdated, Pod: podWithStatus(v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+			{Name: "app", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled"}}},
+		}})}, "oomkilled"},
+		{"terminated since the gate was created", event{Type: eventUpdated, Pod: podWithStatus(v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{lastTerminated("OOMKilled", g.start.Add(time.Second))}})}, "oomkilled"},
+		{"terminated before the gate was created", event{Type: eventUpdated, Pod: podWithStatus(v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{lastTerminated("OOMKilled", g.start.Add(-time.Hour))}})}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := g.match(test.e)
+			if ok != (test.want != "") || got != test.want {
+				t.Errorf("got %q, %v, want %q", got, ok, test.want)
+			}
+		})
+	}
+}
+
+func TestFailureGateStopsOnce(t *testing.T) {
+	stops := 0
+	g := newFailureGate([]string{"crash-loop"}, func() { stops++ })
+	g.observe(event{Type: eventCreated})
+	if g.hasFailed() || stops != 0 {
+		t.Fatalf("got failed %v after %d stops, want the gate open", g.hasFailed(), stops)
+	}
+	g.observe(event{Type: eventCrashLoop, Pod: podWithStatus(v1.PodStatus{})})
+	g.observe(event{Type: eventCrashLoop})
+	if !g.hasFailed() || stops != 1 {
+		t.Errorf("got failed %v after %d stops, want it failed after 1", g.hasFailed(), stops)
+	}
+}
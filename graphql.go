@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// graphqlSchema describes the GraphQL API. The subscription is served as Server-Sent Events, following the GraphQL over SSE protocol.
+const graphqlSchema = `
+schema {
+	query: Query
+	subscription: Subscription
+}
+
+scalar Time
+
+type Query {
+	# Pods in the cache, in order of namespace and name.
+	pods(namespace: String, selector: String, phase: String, node: String, first: Int, after: String): PodConnection!
+	# A single pod from the cache.
+	pod(namespace: String!, name: String!): Pod
+	# Events in the history store, in the order they were recorded. Times are RFC 3339 times or durations before now.
+	events(since: String, until: String, types: [String!], cluster: String, namespace: String, pod: String, first: Int, after: String): EventConnection!
+}
+
+type Subscription {
+	# Events as they happen.
+	podEvents(types: [String!], namespaces: [String!], selector: String): Event!
+}
+
+type PodConnection {
+	items: [Pod!]!
+	# Pass as "after" to get the next page. Null if there are no more pods.
+	continue: String
+}
+
+type EventConnection {
+	items: [Event!]!
+	# Pass as "after" to get the next page. Null if there are no more events.
+	continue: String
+}
+
+type Pod {
+	namespace: String!
+	name: String!
+	uid: String!
+	phase: String!
+	node: String!
+	reason: String!
+	ready: Boolean!
+	restarts: Int!
+	created: Time!
+	labels: [Label!]!
+	# The owning workload, e.g. "Deployment/web".
+	workload: String!
+	owners: [Owner!]!
+	containers: [Container!]!
+	# The pod's events in the history store, oldest first.
+	events(first: Int): [Event!]!
+}
+
+type Label {
+	key: String!
+	value: String!
+}
+
+type Owner {
+	kind: String!
+	name: String!
+	controller: Boolean!
+}
+
+type Container {
+	name: String!
+	image: String!
+	ready: Boolean!
+	restarts: Int!
+	# e.g. "running", "waiting: CrashLoopBackOff" or "terminated: Completed".
+	state: String!
+}
+
+type Event {
+	id: ID!
+	# Empty when only one cluster is watched and it is not named.
+	cluster: String!
+	type: String!
+	time: Time!
+	namespace: String!
+	# Null for events that are not about a single pod.
+	pod: Pod
+	diff: [String!]!
+	message: String!
+}
+`
+
+// graphqlResolver resolves the Query and Subscription types from the cache, the history store and the bus.
+type graphqlResolver struct {
+	store   cache.Store
+	history historyStore
+}
+
+// podConnection is a page of pods.
+type podConnection struct {
+	Items    []*podResolver
+	Continue *string
+}
+
+// eventConnection is a page of events.
+type eventConnection struct {
+	Items    []*eventResolver
+	Continue *string
+}
+
+// Pods resolves Query.pods.
+func (r *graphqlResolver) Pods(args struct {
+	Namespace, Selector, Phase, Node, After *string
+	First                                   *int32
+}) (*podConnection, error) {
+	pods, next, err := listPods(r.store, podQuery{
+		Namespace: deref(args.Namespace),
+		Selector:  deref(args.Selector),
+		Phase:     deref(args.Phase),
+		Node:      deref(args.Node),
+		Limit:     apiLimit(int(derefInt(args.First))),
+		Continue:  deref(args.After),
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := &podConnection{Items: []*podResolver{}, Continue: nullable(next)}
+	for _, pod := range pods {
+		c.Items = append(c.Items, &podResolver{pod: pod, root: r})
+	}
+	return c, nil
+}
+
+// Pod resolves Query.pod.
+func (r *graphqlResolver) Pod(args struct{ Namespace, Name string }) (*podResolver, error) {
+	obj, exists, err := r.store.GetByKey(args.Namespace + "/" + args.Name)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return &podResolver{pod: obj.(*v1.Pod), root: r}, nil
+}
+
+// Events resolves Query.events.
+func (r *graphqlResolver) Events(args struct {
+	Since, Until, Cluster, Namespace, Pod, After *string
+	Types                                        *[]string
+	First                                        *int32
+}) (*eventConnection, error) {
+	if r.history == nil {
+		return nil, fmt.Errorf("no history store; start the watcher with -store")
+	}
+	q := eventQuery{
+		Cluster:   deref(args.Cluster),
+		Namespace: deref(args.Namespace),
+		Pod:       deref(args.Pod),
+		Limit:     apiLimit(int(derefInt(args.First))),
+		Continue:  deref(args.After),
+	}
+	var err error
+	if q.Since, err = parseTime(deref(args.Since)); err != nil {
+		return nil, err
+	}
+	if q.Until, err = parseTime(deref(args.Until)); err != nil {
+		return nil, err
+	}
+	if args.Types != nil {
+		f, err := parseFilter(*args.Types, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		q.Types = f.Events
+	}
+	results, next, err := r.history.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	c := &eventConnection{Items: []*eventResolver{}, Continue: nullable(next)}
+	for _, e := range results {
+		c.Items = append(c.Items, &eventResolver{e: e, root: r})
+	}
+	return c, nil
+}
+
+// PodEvents resolves Subscription.podEvents by subscribing to the bus until the client disconnects.
+func (r *graphqlResolver) PodEvents(ctx context.Context, args struct {
+	Types, Namespaces *[]string
+	Selector          *string
+}) (<-chan *eventResolver, error) {
+	var types, namespaces []string
+	if args.Types != nil {
+		types = *args.Types
+	}
+	if args.Namespaces != nil {
+		namespaces = *args.Namespaces
+	}
+	f, err := parseFilter(types, namespaces, deref(args.Selector))
+	if err != nil {
+		return nil, err
+	}
+	sub, err := events.subscribe("graphql", f, sseBuffer)
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan *eventResolver)
+	go func() {
+		defer close(c)
+		defer events.unsubscribe(sub)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-sub.events:
+				if !ok {
+					return
+				}
+				select {
+				case c <- &eventResolver{e: e, root: r}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return c, nil
+}
+
+// podResolver resolves the Pod type.
+type podResolver struct {
+	pod  *v1.Pod
+	root *graphqlResolver
+}
+
+// The fields of Pod that come straight from the pod.
+func (p *podResolver) Namespace() string { return p.pod.Namespace }
+func (p *podResolver) Name() string      { return p.pod.Name }
+func (p *podResolver) UID() string       { return string(p.pod.UID) }
+func (p *podResolver) Phase() string     { return string(p.pod.Status.Phase) }
+func (p *podResolver) Node() string      { return p.pod.Spec.NodeName }
+func (p *podResolver) Reason() string    { return podReason(p.pod) }
+func (p *podResolver) Ready() bool       { return podReady(p.pod) }
+func (p *podResolver) Restarts() int32   { return restartCount(p.pod) }
+func (p *podResolver) Workload() string  { return workload(p.pod) }
+
+// Created returns the pod's creation time.
+func (p *podResolver) Created() graphql.Time {
+	return graphql.Time{Time: p.pod.CreationTimestamp.Time}
+}
+
+// Labels returns the pod's labels in order of key.
+func (p *podResolver) Labels() []graphqlLabel {
+	labels := []graphqlLabel{}
+	for k, v := range p.pod.Labels {
+		labels = append(labels, graphqlLabel{Key: k, Value: v})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Key < labels[j].Key })
+	return labels
+}
+
+// Owners returns the pod's owner references.
+func (p *podResolver) Owners() []graphqlOwner {
+	owners := []graphqlOwner{}
+	for _, ref := range p.pod.OwnerReferences {
+		owners = append(owners, graphqlOwner{Kind: ref.Kind, Name: ref.Name, Controller: ref.Controller != nil && *ref.Controller})
+	}
+	return owners
+}
+
+// Containers returns the status of the pod's containers, in the order of the pod spec.
+func (p *podResolver) Containers() []graphqlContainer {
+	statuses := make(map[string]v1.ContainerStatus)
+	for _, s := range p.pod.Status.ContainerStatuses {
+		statuses[s.Name] = s
+	}
+	containers := []graphqlContainer{}
+	for _, c := range p.pod.Spec.Containers {
+		s := statuses[c.Name]
+		containers = append(containers, graphqlContainer{
+			Name:     c.Name,
+			Image:    c.Image,
+			Ready:    s.Ready,
+			Restarts: s.RestartCount,
+			State:    containerState(s.State),
+		})
+	}
+	return containers
+}
+
+// Events returns the pod's events in the history store, or none if there is no store.
+func (p *podResolver) Events(args struct{ First *int32 }) ([]*eventResolver, error) {
+	results := []*eventResolver{}
+	if p.root.history == nil {
+		return results, nil
+	}
+	found, _, err := p.root.history.Query(eventQuery{Namespace: p.pod.Namespace, Pod: p.pod.Name, Limit: apiLimit(int(derefInt(args.First)))})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range found {
+		results = append(results, &eventResolver{e: e, root: p.root})
+	}
+	return results, nil
+}
+
+// graphqlLabel is a pod label.
+type graphqlLabel struct {
+	Key   string
+	Value string
+}
+
+// graphqlOwner is an owner reference of a pod.
+type graphqlOwner struct {
+	Kind       string
+	Name       string
+	Controller bool
+}
+
+// graphqlContainer is the status of a container.
+type graphqlContainer struct {
+	Name     string
+	Image    string
+	Ready    bool
+	Restarts int32
+	State    string
+}
+
+// containerState describes the state of a container, e.g. "waiting: CrashLoopBackOff".
+func containerState(s v1.ContainerState) string {
+	switch {
+	case s.Running != nil:
+		return "running"
+	case s.Waiting != nil && s.Waiting.Reason != "":
+		return "waiting: " + s.Waiting.Reason
+	case s.Waiting != nil:
+		return "waiting"
+	case s.Terminated != nil && s.Terminated.Reason != "":
+		return "terminated: " + s.Terminated.Reason
+	case s.Terminated != nil:
+		return "terminated"
+	}
+	return "unknown"
+}
+
+// eventResolver resolves the Event type.
+type eventResolver struct {
+	e    event
+	root *graphqlResolver
+}
+
+// The fields of Event that come straight from the event.
+func (r *eventResolver) ID() graphql.ID     { return graphql.ID(strconv.FormatInt(r.e.ID, 10)) }
+func (r *eventResolver) Cluster() string    { return r.e.Cluster }
+func (r *eventResolver) Type() string       { return string(r.e.Type) }
+func (r *eventResolver) Time() graphql.Time { return graphql.Time{Time: r.e.Time} }
+func (r *eventResolver) Namespace() string  { return r.e.Namespace }
+func (r *eventResolver) Message() string    { return r.e.Message }
+
+// Pod returns the event's pod as it was at the time of the event.
+func (r *eventResolver) Pod() *podResolver {
+	if r.e.Pod == nil {
+		return nil
+	}
+	return &podResolver{pod: r.e.Pod, root: r.root}
+}
+
+// Diff returns the differences from the previous state of the pod.
+func (r *eventResolver) Diff() []string {
+	if r.e.Diff == nil {
+		return []string{}
+	}
+	return r.e.Diff
+}
+
+// graphqlRequest is a GraphQL request, sent as JSON in a POST body or as query parameters of a GET.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// registerGraphQL adds the /graphql endpoint to a mux.
+// Queries are answered with a JSON response. Subscriptions (and queries) with an Accept: text/event-stream header are answered with a stream of Server-Sent Events, each a "next" event with a JSON response, followed by a "complete" event.
+func registerGraphQL(mux *http.ServeMux, store cache.Store, history historyStore) {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{store: store, history: history}, graphql.UseFieldResolvers(), graphql.MaxDepth(10))
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var req graphqlRequest
+		switch r.Method {
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodGet:
+			req.Query = r.URL.Query().Get("query")
+			req.OperationName = r.URL.Query().Get("operationName")
+			if v := r.URL.Query().Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			writeJSON(w, schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables))
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		responses, err := schema.Subscribe(r.Context(), req.Query, req.OperationName, req.Variables)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		for response := range responses {
+			data, err := json.Marshal(response)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+		fmt.Fprint(w, "event: complete\ndata:\n\n")
+		flusher.Flush()
+	})
+}
+
+// deref returns the value of an optional string argument, or an empty string if it was not given.
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// derefInt returns the value of an optional Int argument, or 0 if it was not given.
+func derefInt(n *int32) int32 {
+	if n == nil {
+		return 0
+	}
+	return *n
+}
+
+// nullable converts an empty string to null.
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
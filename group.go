@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// workloadGroup is the pods of a workload that had events within a grouping interval, for eventWorkloadSummary.
+type workloadGroup struct {
+	// Workload is the controller that owns the pods, as "Kind/name".
+	Workload string `json:"workload"`
+	// Pods are the names of the pods with each type of event, each listed once.
+	Pods map[eventType][]string `json:"pods"`
+}
+
+// groupingSink batches the events about pods per owning workload for an interval, and delivers a workload-summary event for each workload instead, e.g. "Deployment payments-api: 3 pods created, 1 deleted in the last 10s", which is how rollouts are thought of.
+// A workload with only one event in the interval has that event delivered as it is, and the events of pods without a controller, or not about a pod, are delivered straight away.
+type groupingSink struct {
+	sink     sink
+	policy   retryPolicy
+	interval time.Duration
+
+	mu     sync.Mutex
+	groups map[workloadKey]*pendingGroup
+}
+
+// pendingGroup is the events of a workload waiting for the end of its interval.
+type pendingGroup struct {
+	events []event
+	timer  *time.Timer
+}
+
+// newGroupingSink wraps a sink so that it is sent a summary of each workload's events every interval, retrying and dead-lettering the summaries that fail with the policy of the sink's route.
+func newGroupingSink(s sink, interval time.Duration, policy retryPolicy) *groupingSink {
+	return &groupingSink{sink: s, policy: policy, interval: interval, groups: make(map[workloadKey]*pendingGroup)}
+}
+
+// Send adds an event to its workload's group, starting the group's interval if it is the first.
+func (g *groupingSink) Send(e event) error {
+	if e.Pod == nil || metav1.GetControllerOf(e.Pod) == nil {
+		return g.sink.Send(e)
+	}
+	key := workloadKey{cluster: e.cluster(), namespace: e.Namespace, workload: workload(e.Pod)}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.groups[key]
+	if !ok {
+		p = &pendingGroup{timer: time.AfterFunc(g.interval, func() { g.flush(key) })}
+		g.groups[key] = p
+	}
+	p.events = append(p.events, e)
+	return nil
+}
+
+// backlog returns the number of events waiting to be grouped.
+func (g *groupingSink) backlog() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n := 0
+	for _, p := range g.groups {
+		n += len(p.events)
+	}
+	return n
+}
+
+// flush delivers the summary of a workload's events.
+func (g *groupingSink) flush(key workloadKey) {
+	g.mu.Lock()
+	p, ok := g.groups[key]
+	delete(g.groups, key)
+	g.mu.Unlock()
+	if !ok {
+		return
+	}
+	p.timer.Stop()
+	e := p.events[0]
+	if len(p.events) > 1 {
+		e = groupSummary(p.events, g.interval)
+	}
+	g.policy.deliver(e, g.sink.Send)
+}
+
+// Close delivers the summaries of the events waiting to be grouped straight away, e.g. when the watcher is shutting down, then closes the sink.
+func (g *groupingSink) Close() error {
+	g.mu.Lock()
+	keys := make([]workloadKey, 0, len(g.groups))
+	for key := range g.groups {
+		keys = append(keys, key)
+	}
+	g.mu.Unlock()
+	for _, key := range keys {
+		g.flush(key)
+	}
+	if c, ok := g.sink.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// groupSummary returns the workload-summary event for the events of a workload's pods within an interval.
+func groupSummary(events []event, interval time.Duration) event {
+	first := events[0]
+	group := &workloadGroup{Workload: workload(first.Pod), Pods: make(map[eventType][]string)}
+	seen := make(map[eventType]map[string]bool)
+	for _, e := range events {
+		if seen[e.Type] == nil {
+			seen[e.Type] = make(map[string]bool)
+		}
+		if !seen[e.Type][e.Pod.Name] {
+			seen[e.Type][e.Pod.Name] = true
+			group.Pods[e.Type] = append(group.Pods[e.Type], e.Pod.Name)
+		}
+	}
+	var counts []string
+	for _, t := range eventTypes {
+		if n := len(group.Pods[t]); n > 0 {
+			if len(counts) == 0 {
+				counts = append(counts, fmt.Sprintf("%d %s %s", n, plural(n, "pod", "pods"), t))
+			} else {
+				counts = append(counts, fmt.Sprintf("%d %s", n, t))
+			}
+		}
+	}
+	kind, name, _ := strings.Cut(group.Workload, "/")
+	return event{
+		Cluster:   first.cluster(),
+		Type:      eventWorkloadSummary,
+		Time:      events[len(events)-1].Time,
+		Namespace: first.Namespace,
+		Message:   fmt.Sprintf("%s %s: %s in the last %s", kind, name, strings.Join(counts, ", "), interval),
+		Group:     group,
+		ctx:       first.ctx,
+	}
+}
+
+// plural returns singular if n is 1, and otherwise plural.
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/mhale/pod-event-watcher/eventspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcBuffer is the number of events queued for each gRPC stream. A client that falls further behind is disconnected.
+const grpcBuffer = 1000
+
+// eventServer implements the gRPC EventService by subscribing to the bus for each call.
+type eventServer struct {
+	eventspb.UnimplementedEventServiceServer
+}
+
+// WatchEvents streams the events matching the filter until the client cancels the call.
+// gRPC flow control stops the sends when the client is slow, and the events queue in the subscription until it overflows.
+func (eventServer) WatchEvents(f *eventspb.Filter, stream eventspb.EventService_WatchEventsServer) error {
+	name := "grpc"
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		name = "grpc " + p.Addr.String()
+	}
+	subFilter, err := parseFilter(f.Events, f.Namespaces, f.Selector)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	sub, err := events.subscribe(name, subFilter, grpcBuffer)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer events.unsubscribe(sub)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-sub.events:
+			if !ok {
+				if sub.overflowed {
+					return status.Errorf(codes.ResourceExhausted, "more than %d events behind", grpcBuffer)
+				}
+				return nil
+			}
+			msg, err := protoEvent(e)
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// protoEvent converts an event to its protobuf form.
+func protoEvent(e event) (*eventspb.Event, error) {
+	msg := &eventspb.Event{
+		Type:      string(e.Type),
+		Time:      timestamppb.New(e.Time),
+		Namespace: e.Namespace,
+		Cluster:   e.Cluster,
+		Diff:      e.Diff,
+		Message:   e.Message,
+	}
+	if pod := e.Pod; pod != nil {
+		data, err := json.Marshal(pod)
+		if err != nil {
+			return nil, err
+		}
+		msg.PodJson = data
+		msg.Pod = &eventspb.Pod{
+			Name:     pod.Name,
+			Uid:      string(pod.UID),
+			Workload: workload(pod),
+			Node:     pod.Spec.NodeName,
+			Phase:    string(pod.Status.Phase),
+			Reason:   podReason(pod),
+			Ready:    podReady(pod),
+			Restarts: restartCount(pod),
+			Labels:   pod.Labels,
+			Created:  timestamppb.New(pod.CreationTimestamp.Time),
+		}
+	}
+	return msg, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// activityListWatch wraps a ListerWatcher to record the time of the last list, watch or watch event, and the informer metrics.
+// The reflector restarts its watch every few minutes even when nothing changes, so a long period without activity means the informer has stalled.
+type activityListWatch struct {
+	cache.ListerWatcher
+	cluster string
+	// name describes the pods being watched, for debug messages.
+	name    string
+	last    int64 // Unix nanoseconds, accessed atomically.
+	watches int64 // Accessed atomically.
+}
+
+// newActivityListWatch wraps a ListerWatcher for a namespace of a cluster. The creation time counts as activity.
+func newActivityListWatch(cluster, namespace string, lw cache.ListerWatcher) *activityListWatch {
+	a := &activityListWatch{ListerWatcher: lw, cluster: cluster, name: shardName(cluster, namespace)}
+	a.touch()
+	return a
+}
+
+// touch records activity now.
+func (a *activityListWatch) touch() {
+	atomic.StoreInt64(&a.last, time.Now().UnixNano())
+}
+
+// idle returns the time since the last activity.
+func (a *activityListWatch) idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&a.last)))
+}
+
+// List lists the pods.
+func (a *activityListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	a.touch()
+	start := time.Now()
+	obj, err := a.ListerWatcher.List(options)
+	recordList(a.cluster, start, obj, err)
+	if err == nil {
+		page := ""
+		if options.Continue != "" {
+			page = " (next page)"
+		}
+		debugf(1, debugInformer, "listed %d pods in %s%s in %s\n", meta.LenList(obj), a.name, page, time.Since(start).Round(time.Millisecond))
+	}
+	return obj, err
+}
+
+// Watch starts a watch, recording activity for every event received.
+func (a *activityListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	a.touch()
+	w, err := a.ListerWatcher.Watch(options)
+	recordWatch(a.cluster, err)
+	if err != nil {
+		return nil, err
+	}
+	if atomic.AddInt64(&a.watches, 1) == 1 {
+		debugf(1, debugInformer, "watching the pods in %s from resource version %s\n", a.name, options.ResourceVersion)
+	} else {
+		debugf(1, debugInformer, "reconnected the watch of the pods in %s from resource version %s\n", a.name, options.ResourceVersion)
+	}
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		a.touch()
+		recordWatchEvent(a.cluster, e)
+		debugf(3, debugInformer, "watch event %s in %s\n", e.Type, a.name)
+		return e, true
+	}), nil
+}
+
+// registerHealth adds the liveness (/healthz) and readiness (/readyz) endpoints to a mux.
+// The pod watcher is live if the informer for each namespace has been active within the threshold, and ready once the initial list of pods in each namespace has been added to the cache.
+func registerHealth(mux *http.ServeMux, shards func() []*shard, threshold time.Duration) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		for _, s := range shards() {
+			if idle := s.lw.idle(); idle > threshold {
+				http.Error(w, fmt.Sprintf("no informer activity for %s in %s", idle.Round(time.Second), s.name()), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		var unsynced []string
+		for _, s := range shards() {
+			if !s.watcher.HasSynced() {
+				unsynced = append(unsynced, s.name())
+			}
+		}
+		if len(unsynced) > 0 {
+			http.Error(w, "informer has not synced for "+strings.Join(unsynced, ", "), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
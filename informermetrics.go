@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+)
+
+// The informer metric instruments.
+// The reflector in client-go does not report its own metrics (cache.SetReflectorMetricsProvider is not used), so lists and watches are measured by activityListWatch instead.
+var (
+	listCounter, _ = meter.Int64Counter("pod_event_watcher.informer.lists",
+		metric.WithDescription("Number of pod lists made by the informer, by result."))
+	listDuration, _ = meter.Float64Histogram("pod_event_watcher.informer.list.duration",
+		metric.WithDescription("Time taken to list pods."),
+		metric.WithUnit("s"))
+	listItems, _ = meter.Int64Histogram("pod_event_watcher.informer.list.items",
+		metric.WithDescription("Number of pods returned by each list."),
+		metric.WithExplicitBucketBoundaries(10, 100, 1000, 10000, 50000, 100000))
+	watchCounter, _ = meter.Int64Counter("pod_event_watcher.informer.watches",
+		metric.WithDescription("Number of watches started by the informer, by result. Every watch after the first is a reconnect."))
+	watchEventCounter, _ = meter.Int64Counter("pod_event_watcher.informer.watch.events",
+		metric.WithDescription("Number of watch events received, by type."))
+	resyncCounter, _ = meter.Int64Counter("pod_event_watcher.informer.resyncs",
+		metric.WithDescription("Number of updates caused by a resync rather than a change to the pod."))
+	requestLatency, _ = meter.Float64Histogram("pod_event_watcher.client.request.duration",
+		metric.WithDescription("Time taken by requests to the API server, by verb."),
+		metric.WithUnit("s"))
+	requestResults, _ = meter.Int64Counter("pod_event_watcher.client.requests",
+		metric.WithDescription("Number of requests to the API server, by status code and method."))
+)
+
+// resultAttributes returns the cluster and result attributes for a list or watch.
+func resultAttributes(cluster string, err error) metric.MeasurementOption {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	return metric.WithAttributes(attribute.String("cluster", cluster), attribute.String("result", result))
+}
+
+// recordList records the duration, result and size of a list in a cluster.
+func recordList(cluster string, start time.Time, obj runtime.Object, err error) {
+	ctx := context.Background()
+	listCounter.Add(ctx, 1, resultAttributes(cluster, err))
+	if err != nil {
+		return
+	}
+	attrs := metric.WithAttributes(attribute.String("cluster", cluster))
+	listDuration.Record(ctx, time.Since(start).Seconds(), attrs)
+	listItems.Record(ctx, int64(meta.LenList(obj)), attrs)
+}
+
+// recordWatch records the start of a watch in a cluster.
+func recordWatch(cluster string, err error) {
+	watchCounter.Add(context.Background(), 1, resultAttributes(cluster, err))
+}
+
+// recordWatchEvent records an event received on a watch in a cluster.
+func recordWatchEvent(cluster string, e watch.Event) {
+	watchEventCounter.Add(context.Background(), 1, metric.WithAttributes(attribute.String("cluster", cluster), attribute.String("type", string(e.Type))))
+}
+
+// registerStoreMetrics reports the number of pods in the caches of each cluster's shards.
+func registerStoreMetrics(shards func() []*shard) {
+	meter.Int64ObservableGauge("pod_event_watcher.informer.store.objects",
+		metric.WithDescription("Number of pods in the informer's cache."),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			counts := make(map[string]int)
+			for _, s := range shards() {
+				counts[s.cluster] += len(s.watcher.Store().ListKeys())
+			}
+			for cluster, n := range counts {
+				o.Observe(int64(n), metric.WithAttributes(attribute.String("cluster", cluster)))
+			}
+			return nil
+		}))
+}
+
+// clientLatency reports the latency of API server requests made by client-go.
+type clientLatency struct{}
+
+// Observe records the latency of a request.
+func (clientLatency) Observe(ctx context.Context, verb string, u url.URL, latency time.Duration) {
+	requestLatency.Record(ctx, latency.Seconds(), metric.WithAttributes(attribute.String("cluster", hostCluster(u.Host)), attribute.String("verb", verb)))
+}
+
+// clientResult reports the results of API server requests made by client-go.
+type clientResult struct{}
+
+// Increment counts a request.
+func (clientResult) Increment(ctx context.Context, code string, method string, host string) {
+	requestResults.Add(ctx, 1, metric.WithAttributes(attribute.String("cluster", hostCluster(host)), attribute.String("code", code), attribute.String("method", method)))
+}
+
+func init() {
+	clientmetrics.Register(clientmetrics.RegisterOpts{
+		RequestLatency: clientLatency{},
+		RequestResult:  clientResult{},
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// cacheSyncTimeout is how long to wait for the caches of nodes and events to be filled before watching the pods anyway, e.g. if the watcher does not have permission to list them.
+const cacheSyncTimeout = time.Minute
+
+// podUIDIndex indexes Kubernetes events by the UID of the pod they are about.
+const podUIDIndex = "uid"
+
+// podEventsInformer returns the factory's informer for the Kubernetes events about pods in a namespace (or all namespaces), indexed by the UID of the pod.
+// It is shared by everything that looks up the events for a pod, so that they are only listed and watched once.
+func podEventsInformer(factory informers.SharedInformerFactory, namespace string) cache.SharedIndexInformer {
+	return factory.InformerFor(&v1.Event{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		lw := cache.NewFilteredListWatchFromClient(client.CoreV1().RESTClient(), "events", namespace, func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("involvedObject.kind", "Pod").String()
+		})
+		return cache.NewSharedIndexInformer(lw, &v1.Event{}, resync, cache.Indexers{podUIDIndex: func(obj interface{}) ([]string, error) {
+			return []string{string(obj.(*v1.Event).InvolvedObject.UID)}, nil
+		}})
+	})
+}
+
+// startInformers starts the factory's informers, which run until stop is closed, and waits for their caches to be filled, so that the pod handlers can use them from the first event.
+func startInformers(factory informers.SharedInformerFactory, stop <-chan struct{}) {
+	factory.Start(stop)
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(cacheSyncTimeout, func() { close(timeout) })
+	defer timer.Stop()
+	for t, synced := range factory.WaitForCacheSync(timeout) {
+		if !synced {
+			log.Printf("Cache sync error: timed out waiting for %s after %s\n", t, cacheSyncTimeout)
+		}
+	}
+}
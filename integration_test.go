@@ -0,0 +1,104 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+)
+
+// TestIntegration watches the pods of the API server started by envtest, which has no scheduler, controller manager or kubelet, so the pods are only changed by the test.
+// Run it with make integration, or with go test -tags integration and KUBEBUILDER_ASSETS set to the directory of the kube-apiserver and etcd binaries.
+func TestIntegration(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set")
+	}
+	env := &envtest.Environment{}
+	config, err := env.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Stop()
+
+	c, err := newCluster("envtest", config, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testSink.Reset()
+	w, _ := watchPods(ctx, c, watcher.Options{ListWatch: watcher.ClientsetListWatch(c.clientset, "default", ""), Namespace: "default"})
+	deadline := time.Now().Add(30 * time.Second)
+	for !w.HasSynced() {
+		if time.Now().After(deadline) {
+			t.Fatal("pods not synced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Without a controller manager, the default service account that pods use is not created.
+	sa := &v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}}
+	if _, err := c.clientset.CoreV1().ServiceAccounts("default").Create(ctx, sa, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		t.Fatal(err)
+	}
+
+	pods := c.clientset.CoreV1().Pods("default")
+	automount := false
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec: v1.PodSpec{
+			AutomountServiceAccountToken: &automount,
+			Containers:                   []v1.Container{{Name: "app", Image: "nginx"}},
+		},
+	}
+	if pod, err = pods.Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if e := waitForEvent(t, eventCreated, "web"); e.Cluster != "envtest" || e.Pod.UID != pod.UID {
+		t.Errorf("got cluster %q and UID %s, want envtest and %s", e.Cluster, e.Pod.UID, pod.UID)
+	}
+
+	pod.Labels["version"] = "2"
+	if pod, err = pods.Update(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if e := waitForEvent(t, eventUpdated, "web"); len(e.Diff) == 0 {
+		t.Error("got an update without differences, want the label added")
+	}
+
+	// The container restarts after being OOM killed, as the kubelet would report it.
+	pod.Status = v1.PodStatus{
+		Phase: v1.PodRunning,
+		ContainerStatuses: []v1.ContainerStatus{{
+			Name:         "app",
+			Image:        "nginx",
+			RestartCount: 1,
+			State:        v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: metav1.Now()}},
+			LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+				ExitCode: 137,
+				Reason:   "OOMKilled",
+			}},
+		}},
+	}
+	if _, err = pods.UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, eventOOMKilled, "web")
+
+	// Without a kubelet, a pod that is not on a node is deleted straight away.
+	if err := pods.Delete(ctx, "web", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if e := waitForEvent(t, eventDeleted, "web"); e.Pod.Labels["version"] != "2" {
+		t.Errorf("got deleted pod with labels %v, want its last state", e.Pod.Labels)
+	}
+}
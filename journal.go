@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journal appends every event to a file as a line of JSON.
+// The file is rotated when it reaches a maximum size or age, and rotated files are compressed with gzip in the background.
+type journal struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	opened  time.Time
+	encoder *json.Encoder
+	// compressing has the rotated files that are being compressed in the background, which are not pruned until they are done.
+	compressing map[string]bool
+
+	// chained is set if each line has the hash of the line before it and its own hash, made with key if it is not empty, and lastHash is the hash of the last line written.
+	chained  bool
+	key      []byte
+	lastHash string
+}
+
+// openJournal opens (or creates) a journal file for appending.
+// A maxSize or maxAge of zero disables rotation by size or age.
+func openJournal(path string, maxSize int64, maxAge time.Duration) (*journal, error) {
+	j := &journal{path: path, maxSize: maxSize, maxAge: maxAge}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// chain makes the journal hash-chained from its next line, continuing the chain of its last line if it has one, so that the verify subcommand can tell whether it has been changed.
+func (j *journal) chain(key []byte) error {
+	hash, err := j.lastChainHash()
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.chained, j.key, j.lastHash = true, key, hash
+	return nil
+}
+
+// open opens the journal file, continuing an existing file if there is one.
+func (j *journal) open() error {
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	j.file = file
+	j.size = info.Size()
+	j.opened = time.Now()
+	j.encoder = json.NewEncoder(&countingWriter{w: file, n: &j.size})
+	return nil
+}
+
+// Send appends an event to the journal, rotating the file first if necessary.
+func (j *journal) Send(e event) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.due() {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+	if !j.chained {
+		return j.encoder.Encode(e)
+	}
+	line, hash, err := encodeChained(e, j.lastHash, j.key)
+	if err != nil {
+		return err
+	}
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	if err != nil {
+		return err
+	}
+	j.lastHash = hash
+	return nil
+}
+
+// due reports whether the journal file should be rotated before the next write.
+func (j *journal) due() bool {
+	if j.size == 0 {
+		return false
+	}
+	return (j.maxSize > 0 && j.size >= j.maxSize) || (j.maxAge > 0 && time.Since(j.opened) >= j.maxAge)
+}
+
+// rotate renames the journal file with a timestamp suffix, starts a new file, and compresses the old one in the background.
+func (j *journal) rotate() error {
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+	rotated := j.path + "." + time.Now().UTC().Format("20060102T150405.000")
+	if err := os.Rename(j.path, rotated); err != nil {
+		return err
+	}
+	if j.compressing == nil {
+		j.compressing = make(map[string]bool)
+	}
+	j.compressing[rotated] = true
+	go func() {
+		if err := compressFile(rotated); err != nil {
+			log.Printf("Journal error: %v\n", err)
+		}
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		delete(j.compressing, rotated)
+	}()
+	return j.open()
+}
+
+// files returns the paths of the rotated journal files, oldest first, followed by the current file.
+// A rotated file that is being compressed is returned once: the file itself until its .gz file is complete, then the .gz file.
+func (j *journal) files() ([]string, error) {
+	matches, err := filepath.Glob(j.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(matches))
+	for _, path := range matches {
+		found[path] = true
+	}
+	var paths []string
+	for _, path := range matches {
+		if strings.HasSuffix(path, compressingSuffix) || found[path+".gz"] || strings.HasPrefix(path, j.checkpointPath()) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	// The timestamp suffix of rotated files sorts chronologically.
+	sort.Strings(paths)
+	return append(paths, j.path), nil
+}
+
+// lastID returns the ID of the last event in the journal, or 0 if it is empty.
+func (j *journal) lastID() (int64, error) {
+	paths, err := j.files()
+	if err != nil {
+		return 0, err
+	}
+	// The newest file may be empty just after rotating, so look back until an event is found.
+	for i := len(paths) - 1; i >= 0; i-- {
+		var id int64
+		err := readJournalFile(paths[i], func(e event) error {
+			id = e.ID
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		if id > 0 {
+			return id, nil
+		}
+	}
+	return 0, nil
+}
+
+// since calls fn for each event in the journal with an ID after id, in order.
+func (j *journal) since(id int64, fn func(e event) error) error {
+	paths, err := j.files()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		err := readJournalFile(path, func(e event) error {
+			if e.ID <= id {
+				return nil
+			}
+			return fn(e)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readJournalFile calls fn for each event in a journal file, which may be compressed.
+// A rotated file that has been compressed since it was listed is read from its .gz file, and a file that has disappeared, e.g. because it was pruned while reading the journal, is skipped.
+// A line that cannot be decoded is logged and skipped, except for an incomplete last line, which is still being written and is ignored.
+func readJournalFile(path string, fn func(e event) error) error {
+	file, err := openJournalFile(path)
+	if os.IsNotExist(err) && !strings.HasSuffix(path, ".gz") {
+		// The rotated file may have been compressed since it was listed.
+		file, err = openJournalFile(path + ".gz")
+	}
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	// A line that cannot be decoded is only logged once another line follows it, as otherwise it may be the incomplete last line.
+	var bad error
+	for n := 1; scanner.Scan(); n++ {
+		if bad != nil {
+			log.Printf("Journal error (%s:%d): %v\n", path, n-1, bad)
+			bad = nil
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			bad = err
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Close closes the journal file.
+func (j *journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// compressingSuffix is the suffix of a rotated file's .gz file while it is being written.
+const compressingSuffix = ".gz.tmp"
+
+// compressFile compresses a file with gzip, replacing it with a file with a .gz suffix.
+// The compressed file is written under a temporary name and renamed once complete, so that it is never read while partly written.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := path + compressingSuffix
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+// Write writes to the underlying writer, adding the number of bytes written to the count.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
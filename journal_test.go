@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJournalFilesWhileCompressing(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+	// The first rotated file has been compressed but not yet removed, and the second is still being compressed.
+	for _, name := range []string{"events.jsonl", "events.jsonl.1", "events.jsonl.1.gz", "events.jsonl.2", "events.jsonl.2.gz.tmp"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := (&journal{path: path}).files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{path + ".1.gz", path + ".2", path}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got files %v, want %v", files, want)
+	}
+}
+
+func TestReadJournalFileSkipsCorruptLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	var lines []string
+	for _, id := range []int64{1, 2, 3} {
+		data, err := json.Marshal(event{ID: id, Type: eventCreated, Namespace: "default"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(data))
+	}
+	// The second line is corrupt, and the last line is still being written.
+	lines[1] = lines[1][:len(lines[1])/2] + "\x00"
+	content := strings.Join(lines, "\n") + "\n" + `{"id":4,"type":"cre`
+	if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	err := readJournalFile(path, func(e event) error {
+		ids = append(ids, e.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 3}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got events %v, want %v", ids, want)
+	}
+}
+
+func TestPruneSkipsCompressingFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(j *journal)
+	}{
+		{"rotated by this journal", func(j *journal) { j.compressing = map[string]bool{j.path + ".2": true} }},
+		{"rotated by another process", func(j *journal) { writeJournalFile(t, j.path+".2"+compressingSuffix, nil) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "events.jsonl")
+			lines := chainedLines(t, 6, nil)
+			writeJournalFile(t, path+".1", lines[:2])
+			writeJournalFile(t, path+".2", lines[2:4])
+			writeJournalFile(t, path+".3", lines[4:5])
+			writeJournalFile(t, path, lines[5:])
+			j := &journal{path: path}
+			test.setup(j)
+			if n, err := j.Prune(retention{MaxJournalBytes: 1}); err != nil || n != 1 {
+				t.Fatalf("got %d files pruned, %v, want only the file before the one being compressed", n, err)
+			}
+			for _, name := range []string{".2", ".3"} {
+				if _, err := os.Stat(path + name); err != nil {
+					t.Errorf("got %v, want %s kept", err, path+name)
+				}
+			}
+		})
+	}
+}
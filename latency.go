@@ -0,0 +1,76 @@
+package main
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	v1 "k8s.io/api/core/v1"
+)
+
+// startTime is when the watcher started. Pods created before then are added to the cache by the initial list rather than by a watch event.
+var startTime = time.Now()
+
+// watchLatencyHistogram records the time between a change to a pod and the handler function being called for it.
+// If it is consistently high, the bottleneck is the API server (or the network to it) rather than the sinks.
+// Timestamps are set by the API server and kubelets, which only have one second precision and may have clock skew.
+var watchLatencyHistogram, _ = meter.Float64Histogram("pod_event_watcher.watch.latency",
+	metric.WithDescription("Time between a pod changing and the watcher being notified."),
+	metric.WithUnit("s"),
+	metric.WithExplicitBucketBoundaries(0.5, 1, 2, 5, 10, 30, 60, 120, 300))
+
+// latestTransition returns the most recent time recorded in a pod's status, from its conditions and container states.
+func latestTransition(pod *v1.Pod) time.Time {
+	var latest time.Time
+	later := func(t time.Time) {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	for _, c := range pod.Status.Conditions {
+		later(c.LastTransitionTime.Time)
+	}
+	for _, statuses := range [][]v1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, s := range statuses {
+			if s.State.Running != nil {
+				later(s.State.Running.StartedAt.Time)
+			}
+			if s.State.Terminated != nil {
+				later(s.State.Terminated.FinishedAt.Time)
+			}
+		}
+	}
+	return latest
+}
+
+// watchLatency returns the time between the change that caused an event and the current time.
+// It returns false if the event cannot be attributed to a change with a timestamp, such as pods from the initial list, resyncs or metadata changes.
+func watchLatency(t eventType, oldPod, newPod *v1.Pod) (time.Duration, bool) {
+	var changed time.Time
+	switch t {
+	case eventCreated:
+		changed = newPod.CreationTimestamp.Time
+		if changed.Before(startTime) {
+			return 0, false
+		}
+	case eventUpdated:
+		changed = latestTransition(newPod)
+		if !changed.After(latestTransition(oldPod)) {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	latency := time.Since(changed)
+	if latency < 0 {
+		latency = 0
+	}
+	return latency, true
+}
+
+// recordWatchLatency records the watch latency of an event, if it has one.
+func recordWatchLatency(e event, oldPod *v1.Pod) {
+	if latency, ok := watchLatency(e.Type, oldPod, e.Pod); ok {
+		watchLatencyHistogram.Record(e.context(), latency.Seconds(), metric.WithAttributes(attribute.String("cluster", e.cluster()), attribute.String("type", string(e.Type))))
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	// leaseRenewDeadline is how long the leader keeps trying to renew its lease before giving up leadership.
+	leaseRenewDeadline = 10 * time.Second
+	// leaseRetryPeriod is the time between attempts to acquire or renew the lease.
+	leaseRetryPeriod = 2 * time.Second
+	// serviceAccountNamespace is the file that holds the namespace of a pod's service account.
+	serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// leaderElector takes part in the election of a leader among the replicas of the watcher, using a Lease.
+// Every replica watches the pods, so that a new leader can take over straight away, but only the leader publishes events.
+type leaderElector struct {
+	identity string
+	leader   int32 // Accessed atomically.
+}
+
+// leadership is the election that the watcher takes part in if it was started with the -leader-elect flag, and is otherwise nil.
+var leadership *leaderElector
+
+// leading reports whether this replica is the leader.
+func (l *leaderElector) leading() bool {
+	return atomic.LoadInt32(&l.leader) == 1
+}
+
+// leaseNamespace returns the namespace for the Lease: the given namespace, or if it is empty, the namespace of the watcher's service account, or "default" outside a cluster.
+func leaseNamespace(namespace string) string {
+	if namespace != "" {
+		return namespace
+	}
+	if data, err := os.ReadFile(serviceAccountNamespace); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	return metav1.NamespaceDefault
+}
+
+// electLeader takes part in the election for the Lease with the given name, in the given namespace (or the namespace of the watcher's service account if it is empty).
+// Another replica takes over if the lease is not renewed within leaseDuration. After losing the lease, the replica tries to acquire it again until the context is cancelled, when the lease is released so that another replica can take over straight away.
+func electLeader(ctx context.Context, clientset kubernetes.Interface, namespace string, name string, leaseDuration time.Duration) *leaderElector {
+	identity, err := os.Hostname()
+	if err != nil {
+		panic(err.Error())
+	}
+	l := &leaderElector{identity: identity}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: leaseNamespace(namespace), Name: name},
+		Client:     clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+	config := leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   leaseRenewDeadline,
+		RetryPeriod:     leaseRetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				atomic.StoreInt32(&l.leader, 1)
+				log.Printf("Became the leader (%s)\n", identity)
+			},
+			OnStoppedLeading: func() {
+				atomic.StoreInt32(&l.leader, 0)
+				log.Printf("Lost leadership (%s)\n", identity)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Printf("The leader is %s\n", leader)
+				}
+			},
+		},
+	}
+	elector, err := leaderelection.NewLeaderElector(config)
+	if err != nil {
+		panic(err.Error())
+	}
+	go func() {
+		for ctx.Err() == nil {
+			elector.Run(ctx)
+		}
+	}()
+	return l
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+)
+
+// testSink receives the events from the bus, which is started once for all of the tests.
+var testSink = func() *memorySink {
+	s := newMemorySink("test", 0, 0, "")
+	events.add(route{name: "test", sink: s, selector: labels.Everything()})
+	go events.run()
+	return s
+}()
+
+// watchFake watches the pods of a fake clientset with the handler functions, as a cluster named test, and waits until the watch has started, after which the fake clientset sends it every change.
+func watchFake(t *testing.T, clientset *fake.Clientset) {
+	t.Helper()
+	started := make(chan struct{})
+	var once sync.Once
+	clientset.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w, err := clientset.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		if err == nil {
+			once.Do(func() { close(started) })
+		}
+		return true, w, err
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c := newClusterForClientset("test", clientset)
+	watchPods(ctx, c, watcher.Options{ListWatch: watcher.ClientsetListWatch(clientset, "", ""), ResyncPeriod: time.Hour})
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch not started")
+	}
+}
+
+// waitForEvent returns the first event delivered to the test sink since it was reset that has a type and is about a pod.
+func waitForEvent(t *testing.T, want eventType, pod string) event {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, e := range testSink.Events() {
+			if e.Type == want && e.podName() == pod {
+				return e
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no %s event for %s in %v", want, pod, summaries(testSink.Events()))
+	return event{}
+}
+
+// summaries returns the summaries of events, for test failures.
+func summaries(list []event) []string {
+	var s []string
+	for _, e := range list {
+		s = append(s, e.summary())
+	}
+	return s
+}
+
+func TestPodEvents(t *testing.T) {
+	testSink.Reset()
+	existing := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"}}
+	clientset := fake.NewSimpleClientset(existing)
+	watchFake(t, clientset)
+	ctx := context.Background()
+
+	if e := waitForEvent(t, eventCreated, "existing"); e.Cluster != "test" || e.Namespace != "default" {
+		t.Errorf("got cluster %q and namespace %q, want test and default", e.Cluster, e.Namespace)
+	}
+
+	pods := clientset.CoreV1().Pods("default")
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "web:1"}}},
+	}
+	pod, err := pods.Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, eventCreated, "web")
+
+	pod.Spec.Containers[0].Image = "web:2"
+	if _, err := pods.Update(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	e := waitForEvent(t, eventUpdated, "web")
+	if len(e.Diff) != 1 || !strings.Contains(e.Diff[0], "web:1 != web:2") {
+		t.Errorf("got diff %q, want the image change", e.Diff)
+	}
+
+	if err := pods.Delete(ctx, "web", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if e := waitForEvent(t, eventDeleted, "web"); e.Pod.Spec.Containers[0].Image != "web:2" {
+		t.Errorf("got deleted pod with image %s, want its last state", e.Pod.Spec.Containers[0].Image)
+	}
+
+	var ids []int64
+	for _, e := range testSink.Events() {
+		ids = append(ids, e.ID)
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Errorf("got event IDs %v, want them increasing", ids)
+			break
+		}
+	}
+}
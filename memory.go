@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+	bolt "go.etcd.io/bbolt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// memoryCheckInterval is the time between checks of the memory in use against the budget.
+	memoryCheckInterval = 10 * time.Second
+	// summaryAnnotation marks the pods in the cache that have been reduced to summaries.
+	summaryAnnotation = "pod-event-watcher/summary"
+)
+
+// spillPods holds the full state of the pods whose summaries are cached, keyed by "namespace/name".
+var spillPods = []byte("pods")
+
+// memoryBudget limits the memory used by the cache. While the heap is over the budget, pods are cached as summaries with only the fields that the warnings need, and their full state is written to a spill file instead.
+// The cache goes back to full pods once the heap is under half of the budget, so that it does not switch back and forth.
+// Pods are only summarized as they are listed or updated, so the cache shrinks gradually.
+type memoryBudget struct {
+	limit uint64
+	spill *bolt.DB
+	over  int32 // Accessed atomically.
+}
+
+// budget limits the memory used by the cache if enabled with the -memory-budget flag, and is otherwise nil.
+var budget *memoryBudget
+
+// newMemoryBudget creates a memory budget from a quantity such as "64Mi", with an optional spill file, and starts checking the heap against it.
+func newMemoryBudget(quantity string, spillPath string) (*memoryBudget, error) {
+	limit, err := resource.ParseQuantity(quantity)
+	if err != nil {
+		return nil, err
+	}
+	b := &memoryBudget{limit: uint64(limit.Value())}
+	if spillPath != "" {
+		if b.spill, err = bolt.Open(spillPath, 0600, &bolt.Options{Timeout: 5 * time.Second}); err != nil {
+			return nil, err
+		}
+		err = b.spill.Update(func(tx *bolt.Tx) error {
+			// Pods spilled by a previous run are out of date.
+			if tx.Bucket(spillPods) != nil {
+				if err := tx.DeleteBucket(spillPods); err != nil {
+					return err
+				}
+			}
+			_, err := tx.CreateBucket(spillPods)
+			return err
+		})
+		if err != nil {
+			b.spill.Close()
+			return nil, err
+		}
+	}
+	go b.checkPeriodically()
+	return b, nil
+}
+
+// summarizing reports whether pods are being cached as summaries.
+func (b *memoryBudget) summarizing() bool {
+	return atomic.LoadInt32(&b.over) == 1
+}
+
+// checkPeriodically compares the heap with the budget every memoryCheckInterval.
+func (b *memoryBudget) checkPeriodically() {
+	for range time.Tick(memoryCheckInterval) {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		switch {
+		case !b.summarizing() && m.HeapAlloc > b.limit:
+			atomic.StoreInt32(&b.over, 1)
+			log.Printf("Memory budget exceeded (%s of %s): caching pod summaries\n", formatBytes(m.HeapAlloc), formatBytes(b.limit))
+		case b.summarizing() && m.HeapAlloc < b.limit/2:
+			atomic.StoreInt32(&b.over, 0)
+			log.Printf("Memory back under budget (%s of %s): caching full pods\n", formatBytes(m.HeapAlloc), formatBytes(b.limit))
+		}
+	}
+}
+
+// transform is the watcher's Options.Transform. It trims every pod, and reduces it to a summary while over the budget, spilling its full state first.
+func (b *memoryBudget) transform(pod *v1.Pod) {
+	watcher.TrimPod(pod)
+	if !b.summarizing() {
+		return
+	}
+	if b.spill != nil {
+		if err := b.save(pod); err != nil {
+			log.Printf("Spill error: %v\n", err)
+		}
+	}
+	summarizePod(pod)
+}
+
+// save writes the full state of a pod to the spill file.
+func (b *memoryBudget) save(pod *v1.Pod) error {
+	data, err := json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+	return b.spill.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(spillPods).Put([]byte(pod.Namespace+"/"+pod.Name), data)
+	})
+}
+
+// forget removes a deleted pod from the spill file.
+func (b *memoryBudget) forget(pod *v1.Pod) {
+	if b.spill == nil {
+		return
+	}
+	err := b.spill.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(spillPods).Delete([]byte(pod.Namespace + "/" + pod.Name))
+	})
+	if err != nil {
+		log.Printf("Spill error: %v\n", err)
+	}
+}
+
+// fullPod returns the full state of a pod from the spill file if the cache only has its summary, or the pod itself otherwise.
+func fullPod(pod *v1.Pod) *v1.Pod {
+	if budget == nil || budget.spill == nil || !isSummary(pod) {
+		return pod
+	}
+	var full *v1.Pod
+	err := budget.spill.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(spillPods).Get([]byte(pod.Namespace + "/" + pod.Name))
+		if data == nil {
+			return nil
+		}
+		full = &v1.Pod{}
+		return json.Unmarshal(data, full)
+	})
+	if err != nil || full == nil {
+		return pod
+	}
+	return full
+}
+
+// summarizePod reduces a pod to the fields that the warnings and the terminal UI use: its metadata (without annotations), node and containers' images and resources, and its status.
+func summarizePod(pod *v1.Pod) {
+	pod.Annotations = map[string]string{summaryAnnotation: "true"}
+	pod.Spec = v1.PodSpec{
+		NodeName:       pod.Spec.NodeName,
+		InitContainers: summarizeContainers(pod.Spec.InitContainers),
+		Containers:     summarizeContainers(pod.Spec.Containers),
+	}
+}
+
+// summarizeContainers returns the names, images and resources of containers.
+func summarizeContainers(containers []v1.Container) []v1.Container {
+	var summaries []v1.Container
+	for _, c := range containers {
+		summaries = append(summaries, v1.Container{Name: c.Name, Image: c.Image, Resources: c.Resources})
+	}
+	return summaries
+}
+
+// isSummary reports whether a pod has been reduced to a summary.
+func isSummary(pod *v1.Pod) bool {
+	return pod.Annotations[summaryAnnotation] == "true"
+}
+
+// summaryDiff returns the differences between two pods when only one of them is a summary, so that the fields left out of the summary are not reported as changes.
+// Otherwise it returns diff, the differences found by the watcher.
+func summaryDiff(oldPod, newPod *v1.Pod, diff []string) []string {
+	if isSummary(oldPod) == isSummary(newPod) {
+		return diff
+	}
+	oldPod, newPod = oldPod.DeepCopy(), newPod.DeepCopy()
+	summarizePod(oldPod)
+	summarizePod(newPod)
+	return podDiff.Diff(oldPod, newPod)
+}
+
+// formatBytes formats a number of bytes as a quantity, e.g. "64Mi".
+func formatBytes(n uint64) string {
+	return resource.NewQuantity(int64(n), resource.BinarySI).String()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// memorySinkDefaultLimit is the number of events kept by a memory sink when its limit is not given.
+const memorySinkDefaultLimit = 10000
+
+// memorySink keeps the events delivered to it in memory, so that what the sink framework sends (after filtering, queueing and retries) can be checked by tests, or through /api/sinks/{name}/events while the watcher runs, e.g. with -simulate or -replay-fixture.
+// It can fail each event's first deliveries on purpose, so that retries and the dead-letter file can be checked too.
+type memorySink struct {
+	name     string
+	limit    int
+	failures int
+	path     string
+
+	mu     sync.Mutex
+	events []event
+	stats  memorySinkStats
+	// current is the ID of the event being delivered, and attempts the number of times it has been sent, which counts the retries of each event as they are made one after another.
+	current  int64
+	attempts int
+}
+
+// memorySinkStats counts the deliveries to a memory sink.
+type memorySinkStats struct {
+	Name string `json:"name"`
+	// Delivered is the number of events delivered, including those no longer kept.
+	Delivered int `json:"delivered"`
+	// Attempts is the number of times Send was called, including the failures.
+	Attempts int `json:"attempts"`
+	// Failed is the number of attempts that were failed on purpose.
+	Failed int `json:"failed"`
+	// Retried is the number of events that were delivered after failing at least once.
+	Retried int `json:"retried"`
+	// Discarded is the number of delivered events that are no longer kept, as the sink was over its limit.
+	Discarded int `json:"discarded"`
+}
+
+var (
+	memorySinksMu sync.Mutex
+	// memorySinks are the memory sinks by name. A sink replaces the one with the same name when the configuration is reloaded.
+	memorySinks = make(map[string]*memorySink)
+)
+
+// newMemorySink creates a memory sink that keeps the last limit events and fails the first failures attempts to deliver each event, and registers it by name.
+// If path is not empty, the events are written to it as JSON lines when the sink is closed.
+func newMemorySink(name string, limit, failures int, path string) *memorySink {
+	if limit <= 0 {
+		limit = memorySinkDefaultLimit
+	}
+	s := &memorySink{name: name, limit: limit, failures: failures, path: path}
+	s.stats.Name = name
+	memorySinksMu.Lock()
+	defer memorySinksMu.Unlock()
+	memorySinks[name] = s
+	return s
+}
+
+// memorySinkNamed returns the memory sink with a name, or nil if there is none.
+func memorySinkNamed(name string) *memorySink {
+	memorySinksMu.Lock()
+	defer memorySinksMu.Unlock()
+	return memorySinks[name]
+}
+
+// Send keeps an event, unless this attempt to deliver it is one of those to fail.
+func (s *memorySink) Send(e event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.ID != s.current || s.attempts == 0 {
+		s.current, s.attempts = e.ID, 0
+	}
+	s.attempts++
+	s.stats.Attempts++
+	if s.attempts <= s.failures {
+		s.stats.Failed++
+		return fmt.Errorf("memory sink: failing attempt %d of %d to deliver event %d", s.attempts, s.failures, e.ID)
+	}
+	if s.attempts > 1 {
+		s.stats.Retried++
+	}
+	s.attempts = 0
+	s.stats.Delivered++
+	s.events = append(s.events, e)
+	if over := len(s.events) - s.limit; over > 0 {
+		s.events = append(s.events[:0], s.events[over:]...)
+		s.stats.Discarded += over
+	}
+	return nil
+}
+
+// Events returns the events kept, in the order they were delivered.
+func (s *memorySink) Events() []event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]event(nil), s.events...)
+}
+
+// Stats returns the counts of the deliveries to the sink.
+func (s *memorySink) Stats() memorySinkStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Query returns the events kept that match q in the order they were delivered, and a token for fetching the next page, which is the ID of the last event returned.
+func (s *memorySink) Query(q eventQuery) ([]event, string, error) {
+	var after int64
+	if q.Continue != "" {
+		var err error
+		if after, err = strconv.ParseInt(q.Continue, 10, 64); err != nil {
+			return nil, "", fmt.Errorf("invalid continue token %q", q.Continue)
+		}
+	}
+	var results []event
+	for _, e := range s.Events() {
+		if e.ID <= after || !q.matches(e) {
+			continue
+		}
+		if q.Limit > 0 && len(results) == q.Limit {
+			return results, strconv.FormatInt(results[len(results)-1].ID, 10), nil
+		}
+		results = append(results, e)
+	}
+	return results, "", nil
+}
+
+// Reset forgets the events kept and the counts, e.g. between the cases of a test.
+func (s *memorySink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = nil
+	s.stats = memorySinkStats{Name: s.name}
+	s.current, s.attempts = 0, 0
+}
+
+// Close writes the events kept to the sink's file, if it has one.
+func (s *memorySink) Close() error {
+	if s.path == "" {
+		return nil
+	}
+	f, err := os.Create(s.path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range s.Events() {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
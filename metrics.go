@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// meter creates the metric instruments.
+// Until setupMetrics is called it is a no-op meter.
+var meter = otel.Meter("github.com/mhale/pod-event-watcher")
+
+// The metric instruments. Creating an instrument only fails if its name is invalid, so the errors are ignored.
+var (
+	eventCounter, _ = meter.Int64Counter("pod_event_watcher.events",
+		metric.WithDescription("Number of pod events received from the API server."))
+	diffSize, _ = meter.Int64Histogram("pod_event_watcher.diff.size",
+		metric.WithDescription("Number of differences found per pod update."),
+		metric.WithExplicitBucketBoundaries(0, 1, 2, 5, 10, 20, 50, 100))
+	deliveryCounter, _ = meter.Int64Counter("pod_event_watcher.sink.deliveries",
+		metric.WithDescription("Number of events delivered to sinks, by sink and result."))
+	deliveryDuration, _ = meter.Float64Histogram("pod_event_watcher.sink.delivery.duration",
+		metric.WithDescription("Time taken to deliver an event to a sink."),
+		metric.WithUnit("s"))
+	dropCounter, _ = meter.Int64Counter("pod_event_watcher.sink.dropped",
+		metric.WithDescription("Number of events dropped because a sink's queue was full, by sink."))
+	_, _ = meter.Int64ObservableGauge("pod_event_watcher.bus.queued",
+		metric.WithDescription("Number of events waiting to be delivered to sinks."),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(len(events.events)))
+			return nil
+		}))
+)
+
+// setupMetrics pushes metrics to an OTLP/HTTP collector at endpoint (host:port) every interval.
+// The standard OTEL_EXPORTER_OTLP_* environment variables are also honoured, e.g. for headers.
+func setupMetrics(endpoint string, insecure bool, interval time.Duration) error {
+	opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+	exporter, err := otlpmetrichttp.New(context.Background(), opts...)
+	if err != nil {
+		return err
+	}
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval))),
+		sdkmetric.WithResource(telemetryResource),
+	)
+	otel.SetMeterProvider(provider)
+	return nil
+}
+
+// countEvent records an event received from the API server.
+func countEvent(e event) {
+	eventCounter.Add(e.context(), 1, metric.WithAttributes(attribute.String("cluster", e.cluster()), attribute.String("type", string(e.Type))))
+	if e.Type == eventUpdated {
+		diffSize.Record(e.context(), int64(len(e.Diff)))
+	}
+}
+
+// countDelivery records the result and duration of delivering an event to a sink.
+func countDelivery(e event, sink string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	attrs := metric.WithAttributes(attribute.String("cluster", e.cluster()), attribute.String("sink", sink), attribute.String("result", result))
+	deliveryCounter.Add(e.context(), 1, attrs)
+	deliveryDuration.Record(e.context(), time.Since(start).Seconds(), attrs)
+}
+
+// countDrop records an event dropped from a sink's queue.
+func countDrop(e event, sink string) {
+	dropCounter.Add(e.context(), 1, metric.WithAttributes(attribute.String("cluster", e.cluster()), attribute.String("sink", sink)))
+}
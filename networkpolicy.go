@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// checkNetworkPolicies is set by -network-policies.
+var checkNetworkPolicies bool
+
+// watchNetworkPolicies adds the informer for the NetworkPolicies in a shard's namespace to its factory.
+func (s *shard) watchNetworkPolicies() {
+	s.networkPolicies = s.factory.Networking().V1().NetworkPolicies().Informer().GetIndexer()
+}
+
+// observeNetworkPolicies returns a network-unrestricted event for a new pod that no NetworkPolicy selects, so that all of its traffic is allowed.
+// Pods on the host network are reported as well, as NetworkPolicies do not apply to them. Pods that have finished are not reported.
+func observeNetworkPolicies(ctx context.Context, pod *v1.Pod) (event, bool) {
+	if !checkNetworkPolicies || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return event{}, false
+	}
+	c, ok := ctx.Value(clusterKey{}).(*cluster)
+	if !ok {
+		return event{}, false
+	}
+	e := newPodEvent(ctx, eventUnrestricted, pod)
+	if pod.Spec.HostNetwork {
+		e.Message = "uses the host network, which NetworkPolicies do not apply to"
+		return e, true
+	}
+	if selectedByPolicy(c, pod) {
+		return event{}, false
+	}
+	e.Message = "no NetworkPolicy selects the pod, so all of its traffic is allowed"
+	return e, true
+}
+
+// selectedByPolicy reports whether any of the NetworkPolicies in a pod's namespace has a pod selector that matches its labels.
+func selectedByPolicy(c *cluster, pod *v1.Pod) bool {
+	for _, obj := range c.namespaced(pod.Namespace, func(s *shard) cache.Indexer { return s.networkPolicies }) {
+		policy := obj.(*networkingv1.NetworkPolicy)
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+		if err == nil && selector.Matches(labels.Set(pod.Labels)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// nodePressureConditions are the node conditions that cause pods to fail or be evicted when they are true.
+var nodePressureConditions = []v1.NodeConditionType{v1.NodeMemoryPressure, v1.NodeDiskPressure, v1.NodePIDPressure, v1.NodeNetworkUnavailable}
+
+// nodes is a cache of the cluster's nodes if enabled with the -watch-nodes flag, and is otherwise nil.
+// nodesSynced reports whether the cache has been filled.
+var (
+	nodes       cache.Store
+	nodesSynced func() bool
+)
+
+// watchNodes adds the informer for the cluster's nodes to a factory.
+func watchNodes(factory informers.SharedInformerFactory) {
+	informer := factory.Core().V1().Nodes().Informer()
+	nodes, nodesSynced = informer.GetStore(), informer.HasSynced
+}
+
+// nodeProblems describes the conditions of a pod's node that could explain it failing, e.g. "node worker-1 has MemoryPressure, DiskPressure".
+// It returns an empty string if the node has no problems, or the nodes are not being watched.
+func nodeProblems(pod *v1.Pod) string {
+	if nodes == nil || pod.Spec.NodeName == "" {
+		return ""
+	}
+	obj, ok, err := nodes.GetByKey(pod.Spec.NodeName)
+	if err != nil || !ok {
+		return ""
+	}
+	node := obj.(*v1.Node)
+	notReady := false
+	var pressures []string
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady && c.Status != v1.ConditionTrue {
+			notReady = true
+		}
+	}
+	for _, t := range nodePressureConditions {
+		for _, c := range node.Status.Conditions {
+			if c.Type == t && c.Status == v1.ConditionTrue {
+				pressures = append(pressures, string(t))
+			}
+		}
+	}
+	var problems []string
+	if notReady {
+		problems = append(problems, "is NotReady")
+	}
+	if len(pressures) > 0 {
+		problems = append(problems, "has "+strings.Join(pressures, ", "))
+	}
+	if len(problems) == 0 {
+		return ""
+	}
+	return "node " + node.Name + " " + strings.Join(problems, " and ")
+}
+
+// failure explains why a pod has just failed, with any problems with its node, or returns an empty string if it has not failed.
+func failure(e event, oldPod *v1.Pod) string {
+	if e.Type != eventUpdated || oldPod.Status.Phase == v1.PodFailed || e.Pod.Status.Phase != v1.PodFailed {
+		return ""
+	}
+	msg := "pod failed"
+	if e.Pod.Status.Reason != "" {
+		msg += ": " + withMessage(e.Pod.Status.Reason, e.Pod.Status.Message)
+	}
+	if problems := nodeProblems(e.Pod); problems != "" {
+		msg += "; " + problems
+	}
+	return msg
+}
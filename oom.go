@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// oomKilled is the reason given for a container that was killed for using more memory than its limit.
+const oomKilled = "OOMKilled"
+
+// terminationKey identifies a container termination, which moves from the state to the last state when the container restarts.
+type terminationKey struct {
+	containerID string
+	finishedAt  int64
+}
+
+// containerStatuses returns the statuses of a pod's init containers and containers.
+func containerStatuses(pod *v1.Pod) []v1.ContainerStatus {
+	statuses := make([]v1.ContainerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	return append(statuses, pod.Status.ContainerStatuses...)
+}
+
+// containers returns a pod's init containers and containers.
+func containers(pod *v1.Pod) []v1.Container {
+	c := make([]v1.Container, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	c = append(c, pod.Spec.InitContainers...)
+	return append(c, pod.Spec.Containers...)
+}
+
+// terminations returns the terminations recorded in a container status.
+func terminations(s v1.ContainerStatus) []*v1.ContainerStateTerminated {
+	var t []*v1.ContainerStateTerminated
+	if s.State.Terminated != nil {
+		t = append(t, s.State.Terminated)
+	}
+	if s.LastTerminationState.Terminated != nil {
+		t = append(t, s.LastTerminationState.Terminated)
+	}
+	return t
+}
+
+// oomKills returns an event for each container in an updated pod that has been OOM killed since the old pod, as these are otherwise hidden in the diff.
+func oomKills(e event, oldPod *v1.Pod) []event {
+	seen := make(map[string]map[terminationKey]bool)
+	for _, s := range containerStatuses(oldPod) {
+		seen[s.Name] = make(map[terminationKey]bool)
+		for _, t := range terminations(s) {
+			seen[s.Name][terminationKey{t.ContainerID, t.FinishedAt.Unix()}] = true
+		}
+	}
+
+	var kills []event
+	for _, s := range containerStatuses(e.Pod) {
+		for _, t := range terminations(s) {
+			if t.Reason != oomKilled || seen[s.Name][terminationKey{t.ContainerID, t.FinishedAt.Unix()}] {
+				continue
+			}
+			kills = append(kills, event{
+				Type:      eventOOMKilled,
+				Time:      e.Time,
+				Namespace: e.Namespace,
+				Pod:       e.Pod,
+				Message:   fmt.Sprintf("container %s was killed for running out of memory (exit code %d, %s)", s.Name, t.ExitCode, memoryResources(e.Pod, s.Name)),
+				Container: s.Name,
+				ctx:       e.ctx,
+			})
+		}
+	}
+	return kills
+}
+
+// memoryResources describes the memory limit and request of a container, e.g. "memory limit 256Mi, request 128Mi".
+func memoryResources(pod *v1.Pod, name string) string {
+	for _, c := range containers(pod) {
+		if c.Name != name {
+			continue
+		}
+		limit, ok := c.Resources.Limits[v1.ResourceMemory]
+		if !ok {
+			return "no memory limit"
+		}
+		s := "memory limit " + limit.String()
+		if request, ok := c.Resources.Requests[v1.ResourceMemory]; ok {
+			s += ", request " + request.String()
+		}
+		return s
+	}
+	return "no memory limit"
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// orphanCheckInterval is the time between checks for orphaned pods.
+const orphanCheckInterval = time.Minute
+
+// orphanReason explains why a pod is orphaned, because its node no longer exists or has been NotReady for longer than a timeout, or returns an empty string if it is not.
+func orphanReason(pod *v1.Pod, timeout time.Duration, now time.Time) string {
+	if pod.Spec.NodeName == "" || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return ""
+	}
+	obj, ok, err := nodes.GetByKey(pod.Spec.NodeName)
+	if err != nil {
+		return ""
+	}
+	if !ok {
+		return "node " + pod.Spec.NodeName + " no longer exists"
+	}
+	for _, c := range obj.(*v1.Node).Status.Conditions {
+		if c.Type == v1.NodeReady && c.Status != v1.ConditionTrue && now.Sub(c.LastTransitionTime.Time) >= timeout {
+			return fmt.Sprintf("node %s has been NotReady for %s", pod.Spec.NodeName, now.Sub(c.LastTransitionTime.Time).Round(time.Second))
+		}
+	}
+	return ""
+}
+
+// checkOrphans periodically sends an event for each pod that is assigned to a node that no longer exists or has been NotReady for longer than a timeout.
+// These pods still appear in service endpoints and workload counts until they are cleaned up, which is confusing unless they are called out.
+// Each pod is reported once until it is no longer orphaned.
+func checkOrphans(pods cache.Store, timeout time.Duration) {
+	reported := make(map[types.UID]bool)
+	for now := range time.Tick(orphanCheckInterval) {
+		if !nodesSynced() {
+			continue
+		}
+		orphans := make(map[types.UID]bool)
+		for _, obj := range pods.List() {
+			pod := obj.(*v1.Pod)
+			reason := orphanReason(pod, timeout, now)
+			if reason == "" {
+				continue
+			}
+			orphans[pod.UID] = true
+			if reported[pod.UID] {
+				continue
+			}
+			publish(event{
+				Type:      eventOrphaned,
+				Time:      now,
+				Namespace: pod.Namespace,
+				Pod:       pod,
+				Message:   reason,
+			})
+		}
+		reported = orphans
+	}
+}
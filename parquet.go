@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetMaxRows is the number of rows in a batch that triggers a write before the interval has passed.
+const parquetMaxRows = 100000
+
+// parquetRow is the flattened form of an event written to Parquet files, with the interesting parts of the pod as top level columns.
+// The columns are named so that the files can be queried directly, e.g. with DuckDB:
+//
+//	SELECT namespace, workload, count(*) FROM 'events/date=*/*.parquet' WHERE type = 'deleted' GROUP BY ALL
+type parquetRow struct {
+	Time      time.Time         `parquet:"time,timestamp(millisecond)"`
+	Type      string            `parquet:"type,dict"`
+	Cluster   string            `parquet:"cluster,dict"`
+	Namespace string            `parquet:"namespace,dict"`
+	Pod       string            `parquet:"pod"`
+	UID       string            `parquet:"uid"`
+	Workload  string            `parquet:"workload,dict"`
+	Node      string            `parquet:"node,dict"`
+	Phase     string            `parquet:"phase,dict"`
+	Reason    string            `parquet:"reason,dict"`
+	Ready     bool              `parquet:"ready"`
+	Restarts  int32             `parquet:"restarts"`
+	QOSClass  string            `parquet:"qos_class,dict"`
+	PodIP     string            `parquet:"pod_ip"`
+	Created   time.Time         `parquet:"created,timestamp(millisecond),optional"`
+	Labels    map[string]string `parquet:"labels"`
+	Diff      []string          `parquet:"diff,list"`
+	Message   string            `parquet:"message"`
+}
+
+// newParquetRow flattens an event into a row.
+func newParquetRow(e event) parquetRow {
+	row := parquetRow{
+		Time:      e.Time.UTC(),
+		Type:      string(e.Type),
+		Cluster:   e.Cluster,
+		Namespace: e.Namespace,
+		Diff:      e.Diff,
+		Message:   e.Message,
+	}
+	if pod := e.Pod; pod != nil {
+		row.Pod = pod.Name
+		row.UID = string(pod.UID)
+		row.Workload = workload(pod)
+		row.Node = pod.Spec.NodeName
+		row.Phase = string(pod.Status.Phase)
+		row.Reason = podReason(pod)
+		row.Ready = podReady(pod)
+		row.Restarts = restartCount(pod)
+		row.QOSClass = string(pod.Status.QOSClass)
+		row.PodIP = pod.Status.PodIP
+		row.Created = pod.CreationTimestamp.UTC()
+		row.Labels = pod.Labels
+	}
+	return row
+}
+
+// parquetBatch is a batch of rows written to one Parquet file.
+type parquetBatch struct {
+	start time.Time
+	rows  []parquetRow
+	data  []byte
+}
+
+// parquetSink writes batches of events to Parquet files partitioned by date, in a local directory or an S3-compatible bucket.
+// A file is written every interval, or sooner if the batch gets too big. Failed writes are retried with the next batch.
+type parquetSink struct {
+	dir    string
+	client *minio.Client
+	bucket string
+	prefix string
+
+	mu     sync.Mutex
+	batch  *parquetBatch
+	failed []*parquetBatch
+	flush  chan struct{}
+}
+
+// newParquetSink creates a Parquet sink for a local directory or a URL such as s3://bucket/prefix, and starts its background writer.
+// The endpoint is only used for URLs, as described by newS3Client.
+func newParquetSink(dest string, endpoint string, interval time.Duration) (*parquetSink, error) {
+	s := &parquetSink{
+		batch: &parquetBatch{start: time.Now().UTC()},
+		flush: make(chan struct{}, 1),
+	}
+	if strings.HasPrefix(dest, "s3://") {
+		bucket, prefix, err := parseS3URL(dest)
+		if err != nil {
+			return nil, err
+		}
+		client, err := newS3Client(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		s.client, s.bucket, s.prefix = client, bucket, prefix
+	} else {
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return nil, err
+		}
+		s.dir = dest
+	}
+	go s.run(interval)
+	return s, nil
+}
+
+// Send adds an event to the current batch.
+func (s *parquetSink) Send(e event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batch.rows = append(s.batch.rows, newParquetRow(e))
+	if len(s.batch.rows) >= parquetMaxRows {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// backlog returns the number of events waiting to be written.
+func (s *parquetSink) backlog() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.batch.rows)
+	for _, b := range s.failed {
+		n += len(b.rows)
+	}
+	return n
+}
+
+// run writes the current batch every interval, or when it gets too big.
+func (s *parquetSink) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.flush:
+		}
+		s.write()
+	}
+}
+
+// Close writes the current batch straight away, e.g. when the watcher is shutting down.
+func (s *parquetSink) Close() error {
+	s.write()
+	return nil
+}
+
+// write writes the current batch and any that previously failed.
+func (s *parquetSink) write() {
+	s.mu.Lock()
+	batches := s.failed
+	if len(s.batch.rows) > 0 {
+		batches = append(batches, s.batch)
+		s.batch = &parquetBatch{start: time.Now().UTC()}
+	}
+	s.failed = nil
+	s.mu.Unlock()
+
+	var failed []*parquetBatch
+	for _, b := range batches {
+		if err := s.put(b); err != nil {
+			log.Printf("Parquet error: %v\n", err)
+			failed = append(failed, b)
+		}
+	}
+	if len(failed) > archiveMaxFailed {
+		log.Printf("Parquet error: dropping %d batches that could not be written\n", len(failed)-archiveMaxFailed)
+		failed = failed[len(failed)-archiveMaxFailed:]
+	}
+
+	s.mu.Lock()
+	s.failed = append(failed, s.failed...)
+	s.mu.Unlock()
+}
+
+// put encodes a batch and writes it to the directory or bucket.
+func (s *parquetSink) put(b *parquetBatch) error {
+	if b.data == nil {
+		var buf bytes.Buffer
+		if err := parquet.Write(&buf, b.rows, parquet.Compression(&parquet.Snappy)); err != nil {
+			return err
+		}
+		b.data = buf.Bytes()
+	}
+	key := partitionKey(s.prefix, b.start, "parquet")
+	if s.client != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(b.data), int64(len(b.data)), minio.PutObjectOptions{
+			ContentType: "application/vnd.apache.parquet",
+		})
+		return err
+	}
+
+	// Write to a temporary file first so that queries never see a partial file.
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, b.data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"hash/fnv"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// partition is the filter for the pods in this replica's partition if the pods are split with the -shard-total flag, and is otherwise nil.
+var partition func(*v1.Pod) bool
+
+// inPartition reports whether the pod with a namespace and name is in this replica's partition, e.g. for Kubernetes events about pods that may not be in the cache.
+func inPartition(namespace, name string) bool {
+	return partition == nil || partition(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}})
+}
+
+// partitionFilter returns a filter for the pods in one of total partitions, so that several replicas of the watcher can split the pods between them.
+// A pod's partition is chosen by a hash of its namespace and name, so each pod is watched by exactly one replica, and stays with it for its whole life.
+func partitionFilter(index, total int) func(*v1.Pod) bool {
+	return func(pod *v1.Pod) bool {
+		return podPartition(pod, total) == index
+	}
+}
+
+// podPartition returns the partition that a pod belongs to.
+func podPartition(pod *v1.Pod, total int) int {
+	h := fnv.New32a()
+	h.Write([]byte(pod.Namespace + "/" + pod.Name))
+	return int(h.Sum32() % uint32(total))
+}
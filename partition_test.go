@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestPartitionFilter(t *testing.T) {
+	for _, total := range []int{1, 2, 3, 7} {
+		t.Run(fmt.Sprint(total), func(t *testing.T) {
+			filters := make([]func(*v1.Pod) bool, total)
+			for i := range filters {
+				filters[i] = partitionFilter(i, total)
+			}
+			counts := make([]int, total)
+			for n := 0; n < 1000; n++ {
+				pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: fmt.Sprintf("team-%d", n%10), Name: fmt.Sprintf("web-%d", n)}}
+				var in []int
+				for i, filter := range filters {
+					if filter(pod) {
+						in = append(in, i)
+					}
+				}
+				if len(in) != 1 {
+					t.Fatalf("got %s/%s in partitions %v, want exactly one", pod.Namespace, pod.Name, in)
+				}
+				counts[in[0]]++
+			}
+			for i, n := range counts {
+				if n < 1000/total/2 {
+					t.Errorf("got %d of 1000 pods in partition %d, want them split about evenly: %v", n, i, counts)
+				}
+			}
+		})
+	}
+}
+
+func TestPodPartition(t *testing.T) {
+	tests := []struct {
+		namespace, name string
+		want            int
+	}{
+		// Replicas of different versions must agree, so the partitions are fixed by the FNV-1a hash of the namespace and name.
+		{"default", "web", 3},
+		{"default", "api", 1},
+		{"kube-system", "coredns", 3},
+	}
+	for _, test := range tests {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: test.namespace, Name: test.name, UID: "1"}}
+		if got := podPartition(pod, 4); got != test.want {
+			t.Errorf("got partition %d of 4 for %s/%s, want %d", got, test.namespace, test.name, test.want)
+		}
+		// The partition only depends on the namespace and name, so a pod stays in it as it changes.
+		changed := pod.DeepCopy()
+		changed.UID, changed.Labels, changed.Status.Phase = types.UID("2"), map[string]string{"app": "web"}, v1.PodRunning
+		if got := podPartition(changed, 4); got != test.want {
+			t.Errorf("got partition %d for %s/%s after it changed, want %d", got, test.namespace, test.name, test.want)
+		}
+	}
+}
+
+func TestInPartition(t *testing.T) {
+	saved := partition
+	t.Cleanup(func() { partition = saved })
+	partition = nil
+	if !inPartition("default", "web") {
+		t.Error("got a pod outside the partition without -shard-total, want every pod in it")
+	}
+	want := podPartition(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}, 2)
+	for i := 0; i < 2; i++ {
+		partition = partitionFilter(i, 2)
+		if got := inPartition("default", "web"); got != (i == want) {
+			t.Errorf("got %v for partition %d, want only partition %d", got, i, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// pendingTracker sends an event for each pod that is still pending a timeout after it was created.
+// Pods that stay pending send no updates, so each pod is queued until its deadline rather than being checked in the handler functions.
+type pendingTracker struct {
+	timeout time.Duration
+	queue   workqueue.DelayingInterface
+
+	mu      sync.Mutex
+	pods    map[types.UID]pendingPod
+	alerted map[types.UID]bool
+}
+
+// pendingPod is the latest version of a pending pod, and the context of the cluster it is in.
+type pendingPod struct {
+	pod *v1.Pod
+	ctx context.Context
+}
+
+// pending tracks pending pods if enabled with the -pending-timeout flag, and is otherwise nil.
+var pending *pendingTracker
+
+// newPendingTracker creates a pending tracker and starts checking pods as they reach the timeout.
+func newPendingTracker(timeout time.Duration) *pendingTracker {
+	p := &pendingTracker{
+		timeout: timeout,
+		queue:   workqueue.NewNamedDelayingQueue("pending"),
+		pods:    make(map[types.UID]pendingPod),
+		alerted: make(map[types.UID]bool),
+	}
+	go p.run()
+	return p
+}
+
+// observe queues a pod that has been created or updated if it is pending, or stops tracking it if it is not.
+// ctx is the pod handler's context, whose cluster the event is published for.
+func (p *pendingTracker) observe(ctx context.Context, pod *v1.Pod) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pod.Status.Phase != v1.PodPending || pod.DeletionTimestamp != nil {
+		delete(p.pods, pod.UID)
+		delete(p.alerted, pod.UID)
+		return
+	}
+	_, queued := p.pods[pod.UID]
+	p.pods[pod.UID] = pendingPod{pod: pod, ctx: detachedContext(ctx)}
+	if !queued && !p.alerted[pod.UID] {
+		p.queue.AddAfter(pod.UID, time.Until(pod.CreationTimestamp.Add(p.timeout)))
+	}
+}
+
+// forget stops tracking a deleted pod.
+func (p *pendingTracker) forget(pod *v1.Pod) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pods, pod.UID)
+	delete(p.alerted, pod.UID)
+}
+
+// forgetCluster stops tracking the pods of a cluster that is no longer watched.
+func (p *pendingTracker) forgetCluster(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for uid, tracked := range p.pods {
+		if contextCluster(tracked.ctx) == name {
+			delete(p.pods, uid)
+			delete(p.alerted, uid)
+		}
+	}
+}
+
+// run sends an event for each queued pod that is still pending when its deadline is reached.
+func (p *pendingTracker) run() {
+	for {
+		item, shutdown := p.queue.Get()
+		if shutdown {
+			return
+		}
+		uid := item.(types.UID)
+		p.mu.Lock()
+		tracked, ok := p.pods[uid]
+		if ok {
+			p.alerted[uid] = true
+		}
+		p.mu.Unlock()
+		p.queue.Done(item)
+		if ok {
+			pod := tracked.pod
+			publish(event{
+				Cluster:    contextCluster(tracked.ctx),
+				Type:       eventPendingTooLong,
+				Time:       time.Now(),
+				Namespace:  pod.Namespace,
+				Pod:        pod,
+				Message:    fmt.Sprintf("pending for %s: %s", time.Since(pod.CreationTimestamp.Time).Round(time.Second), pendingReason(pod)),
+				Scheduling: parseSchedulingFailure(pod),
+				ctx:        tracked.ctx,
+			})
+		}
+	}
+}
+
+// pendingReason explains why a pod is pending, from the PodScheduled condition if it has not been scheduled, or from its waiting containers if it has.
+func pendingReason(pod *v1.Pod) string {
+	if c := podCondition(pod, v1.PodScheduled); c != nil && c.Status != v1.ConditionTrue {
+		if c.Message != "" {
+			return c.Reason + ": " + c.Message
+		}
+		return c.Reason
+	}
+	if !podScheduled(pod) {
+		return "not scheduled"
+	}
+	var waiting []string
+	for _, s := range containerStatuses(pod) {
+		if w := s.State.Waiting; w != nil && w.Reason != "" {
+			reason := fmt.Sprintf("container %s is %s", s.Name, w.Reason)
+			if w.Message != "" {
+				reason += " (" + w.Message + ")"
+			}
+			waiting = append(waiting, reason)
+		}
+	}
+	if len(waiting) == 0 {
+		return "scheduled to " + pod.Spec.NodeName + " but not started"
+	}
+	return strings.Join(waiting, ", ")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// pluginName is the name of the binary when it is installed as a kubectl plugin, so that it can be run as "kubectl pod-events".
+const pluginName = "kubectl-pod_events"
+
+// isKubectlPlugin returns whether the watcher is running as a kubectl plugin.
+func isKubectlPlugin() bool {
+	return strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe") == pluginName
+}
+
+// parsePluginFlags parses the command line in the style of kubectl, with the standard kubectl flags (e.g. --context, --namespace and --as) as well as the watcher's own flags from the watch flag set.
+// As with kubectl, the namespace of the current context is watched unless --namespace or --all-namespaces is given.
+func parsePluginFlags(watchFlags *flag.FlagSet, args []string, namespace *string) *genericclioptions.ConfigFlags {
+	kubectl := genericclioptions.NewConfigFlags(true)
+	flags := pflag.NewFlagSet("kubectl pod-events", pflag.ExitOnError)
+	kubectl.AddFlags(flags)
+	allNamespaces := flags.BoolP("all-namespaces", "A", false, "watch pods in all namespaces")
+	selector := pflag.PFlagFromGoFlag(watchFlags.Lookup("selector"))
+	selector.Shorthand = "l"
+	flags.AddFlag(selector)
+	// The kubectl flags take the place of the watcher's -kubeconfig and -namespace flags.
+	flags.AddGoFlagSet(watchFlags)
+	flags.Parse(args)
+
+	if *allNamespaces {
+		*namespace = metav1.NamespaceAll
+		return kubectl
+	}
+	ns, _, err := kubectl.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		panic(err.Error())
+	}
+	*namespace = ns
+	return kubectl
+}
@@ -0,0 +1,91 @@
+// Package plugin lets other programs handle the watcher's events, so that integrations can be added without changing the watcher.
+//
+// A plugin is an executable that calls Serve from its main function, and is placed in the watcher's -plugin-dir directory.
+// The watcher starts each plugin when it starts, and calls its Send method over gRPC for each event:
+//
+//	type logger struct{}
+//
+//	func (logger) Send(ctx context.Context, e *eventspb.Event) error {
+//		log.Printf("%s %s/%s\n", e.Type, e.Namespace, e.Pod.GetName())
+//		return nil
+//	}
+//
+//	func main() {
+//		plugin.Serve(logger{})
+//	}
+package plugin
+
+import (
+	"context"
+
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/mhale/pod-event-watcher/eventspb"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Handshake is used by the watcher and its plugins to check that an executable is a plugin, and that they speak the same protocol.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "POD_EVENT_WATCHER_PLUGIN",
+	MagicCookieValue: "sink",
+}
+
+// Plugins is the set of plugin types, for use in the go-plugin client and server configuration.
+var Plugins = goplugin.PluginSet{
+	"sink": &SinkPlugin{},
+}
+
+// Sink is implemented by plugins to handle events.
+type Sink interface {
+	Send(ctx context.Context, e *eventspb.Event) error
+}
+
+// Serve serves a sink to the watcher that started the plugin. It does not return.
+func Serve(s Sink) {
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         goplugin.PluginSet{"sink": &SinkPlugin{Impl: s}},
+		GRPCServer:      goplugin.DefaultGRPCServer,
+	})
+}
+
+// SinkPlugin connects a Sink in a plugin to the watcher over gRPC.
+type SinkPlugin struct {
+	goplugin.NetRPCUnsupportedPlugin
+	// Impl is the sink served by a plugin. It is not used by the watcher.
+	Impl Sink
+}
+
+// GRPCServer registers the plugin's sink with the gRPC server.
+func (p *SinkPlugin) GRPCServer(broker *goplugin.GRPCBroker, s *grpc.Server) error {
+	eventspb.RegisterSinkPluginServer(s, sinkServer{impl: p.Impl})
+	return nil
+}
+
+// GRPCClient returns a Sink that calls the plugin.
+func (p *SinkPlugin) GRPCClient(ctx context.Context, broker *goplugin.GRPCBroker, conn *grpc.ClientConn) (interface{}, error) {
+	return sinkClient{client: eventspb.NewSinkPluginClient(conn)}, nil
+}
+
+// sinkServer implements the SinkPlugin gRPC service in a plugin.
+type sinkServer struct {
+	eventspb.UnimplementedSinkPluginServer
+	impl Sink
+}
+
+// Send passes an event to the plugin's sink.
+func (s sinkServer) Send(ctx context.Context, e *eventspb.Event) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, s.impl.Send(ctx, e)
+}
+
+// sinkClient is a Sink that calls a plugin's SinkPlugin service.
+type sinkClient struct {
+	client eventspb.SinkPluginClient
+}
+
+// Send sends an event to the plugin.
+func (c sinkClient) Send(ctx context.Context, e *eventspb.Event) error {
+	_, err := c.client.Send(ctx, e)
+	return err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/mhale/pod-event-watcher/plugin"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// pluginTimeout is how long a plugin may take to handle an event.
+const pluginTimeout = 10 * time.Second
+
+// pluginSink sends events to a plugin started from the -plugin-dir directory.
+type pluginSink struct {
+	sink plugin.Sink
+}
+
+// Send sends an event to the plugin.
+func (s pluginSink) Send(e event) error {
+	msg, err := protoEvent(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pluginTimeout)
+	defer cancel()
+	return s.sink.Send(ctx, msg)
+}
+
+// loadPlugins starts each executable in a directory as a plugin, and sends every event to it.
+func loadPlugins(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	logger := hclog.New(&hclog.LoggerOptions{Name: "plugin", Level: hclog.Info, Output: log.Writer()})
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || !isExecutable(info) {
+			continue
+		}
+		client := goplugin.NewClient(&goplugin.ClientConfig{
+			HandshakeConfig:  plugin.Handshake,
+			Plugins:          plugin.Plugins,
+			Cmd:              exec.Command(filepath.Join(dir, entry.Name())),
+			AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolGRPC},
+			Logger:           logger.Named(entry.Name()),
+		})
+		rpc, err := client.Client()
+		if err != nil {
+			return fmt.Errorf("plugin %s: %v", entry.Name(), err)
+		}
+		raw, err := rpc.Dispense("sink")
+		if err != nil {
+			return fmt.Errorf("plugin %s: %v", entry.Name(), err)
+		}
+		events.add(route{name: "plugin " + entry.Name(), sink: pluginSink{sink: raw.(plugin.Sink)}, selector: labels.Everything()})
+		log.Printf("Loaded plugin %s\n", entry.Name())
+	}
+	return nil
+}
+
+// isExecutable returns whether a file can be run as a plugin.
+func isExecutable(info os.FileInfo) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(info.Name()), ".exe")
+	}
+	return info.Mode()&0111 != 0
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresMigrations are applied in order to bring the database schema up to date.
+// Applied migrations are recorded in the schema_migrations table; never change a migration once released, add a new one instead.
+var postgresMigrations = []string{
+	`CREATE TABLE events (
+		id        BIGSERIAL PRIMARY KEY,
+		type      TEXT NOT NULL,
+		time      TIMESTAMPTZ NOT NULL,
+		namespace TEXT NOT NULL,
+		name      TEXT NOT NULL,
+		pod       JSONB,
+		diff      JSONB,
+		message   TEXT NOT NULL
+	);
+	CREATE INDEX events_time ON events (time);
+	CREATE INDEX events_pod ON events (namespace, name);`,
+	`ALTER TABLE events ADD COLUMN cluster TEXT NOT NULL DEFAULT '';
+	CREATE INDEX events_cluster ON events (cluster);`,
+}
+
+const (
+	// postgresBatchSize is the number of events that triggers an immediate write.
+	postgresBatchSize = 500
+	// postgresFlushInterval is the longest time an event waits before being written.
+	postgresFlushInterval = time.Second
+	// postgresMaxPending is the number of events that can wait to be written, e.g. while the database is unavailable, after which new events are refused and written to the dead-letter file by the bus.
+	postgresMaxPending = 100 * postgresBatchSize
+)
+
+// postgresStore records events in a PostgreSQL database.
+// Events are written in batches with COPY, so that a long-lived watcher of a busy cluster does not make one round trip per event.
+type postgresStore struct {
+	db    *sql.DB
+	flush chan struct{}
+	done  chan struct{}
+	// stopped is closed when run has returned, so that Close does not write at the same time.
+	stopped chan struct{}
+
+	mu      sync.Mutex
+	pending []event
+}
+
+// openPostgresStore connects to a PostgreSQL database and applies any outstanding migrations.
+func openPostgresStore(dsn string) (*postgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migratePostgres(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &postgresStore{
+		db:      db,
+		flush:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// migratePostgres applies the migrations that have not yet been applied, each in its own transaction.
+func migratePostgres(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(postgresMigrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(postgresMigrations[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, i+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Send queues an event for the next batch, or returns an error if postgresMaxPending events are already waiting.
+func (s *postgresStore) Send(e event) error {
+	s.mu.Lock()
+	if len(s.pending) >= postgresMaxPending {
+		s.mu.Unlock()
+		return fmt.Errorf("PostgreSQL store backlog full, dropping event %q", e.summary())
+	}
+	s.pending = append(s.pending, e)
+	full := len(s.pending) >= postgresBatchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// backlog returns the number of events waiting to be written.
+func (s *postgresStore) backlog() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// run writes the queued events every flush interval, or sooner if a batch fills up.
+func (s *postgresStore) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(postgresFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.flush:
+		case <-s.done:
+			return
+		}
+		if err := s.write(); err != nil {
+			log.Printf("PostgreSQL store error: %v\n", err)
+		}
+	}
+}
+
+// write writes the queued events in a single transaction.
+// If the write fails, the events are put back to be retried with the next batch, apart from the oldest beyond postgresMaxPending, which are written to the dead-letter file.
+func (s *postgresStore) write() error {
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := s.copy(batch)
+	if err != nil {
+		s.mu.Lock()
+		s.pending = append(batch, s.pending...)
+		var dropped []event
+		if over := len(s.pending) - postgresMaxPending; over > 0 {
+			dropped, s.pending = s.pending[:over], s.pending[over:]
+		}
+		s.mu.Unlock()
+		if len(dropped) > 0 {
+			log.Printf("PostgreSQL store error: dropping %d events that could not be written: %v\n", len(dropped), err)
+			if deadLetters != nil {
+				for _, e := range dropped {
+					deadLetters.write("store", e, err)
+				}
+			}
+		}
+	}
+	return err
+}
+
+// copy inserts a batch of events with COPY.
+func (s *postgresStore) copy(batch []event) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(pq.CopyIn("events", "cluster", "type", "time", "namespace", "name", "pod", "diff", "message"))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, e := range batch {
+		pod, err := storedPod(e)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		diff, err := storedDiff(e)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := stmt.Exec(e.Cluster, string(e.Type), e.Time, e.Namespace, e.podName(), nullString(pod), nullString(diff), e.Message); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Prune deletes events older than the maximum age, and then the oldest events beyond the maximum number.
+func (s *postgresStore) Prune(r retention) (int, error) {
+	var n int64
+	if cutoff := r.cutoff(); !cutoff.IsZero() {
+		result, err := s.db.Exec(`DELETE FROM events WHERE time < $1`, cutoff)
+		if err != nil {
+			return 0, err
+		}
+		deleted, _ := result.RowsAffected()
+		n += deleted
+	}
+	if r.MaxEvents > 0 {
+		result, err := s.db.Exec(`DELETE FROM events WHERE id <= (SELECT id FROM events ORDER BY id DESC LIMIT 1 OFFSET $1)`, r.MaxEvents)
+		if err != nil {
+			return int(n), err
+		}
+		deleted, _ := result.RowsAffected()
+		n += deleted
+	}
+	return int(n), nil
+}
+
+// Query returns the events matching q. Events waiting to be written are not included.
+func (s *postgresStore) Query(q eventQuery) ([]event, string, error) {
+	return queryEvents(s.db, q, func(n int) string { return "$" + strconv.Itoa(n) })
+}
+
+// Close waits for the background writer to stop, then writes any queued events and closes the database.
+func (s *postgresStore) Close() error {
+	close(s.done)
+	<-s.stopped
+	if err := s.write(); err != nil {
+		log.Printf("PostgreSQL store error: %v\n", err)
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// unreachablePostgresStore returns a PostgreSQL store whose database refuses connections, without applying the migrations or starting the background writer.
+func unreachablePostgresStore(t *testing.T) *postgresStore {
+	t.Helper()
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &postgresStore{db: db, flush: make(chan struct{}, 1), done: make(chan struct{}), stopped: make(chan struct{})}
+}
+
+func TestPostgresStoreBacklogLimit(t *testing.T) {
+	s := unreachablePostgresStore(t)
+	for i := 0; i < postgresMaxPending; i++ {
+		s.mu.Lock()
+		s.pending = append(s.pending, event{Type: eventCreated})
+		s.mu.Unlock()
+	}
+	if err := s.Send(event{Type: eventCreated}); err == nil {
+		t.Error("got no error sending to a full store")
+	}
+
+	// A failed write puts the batch back without going over the limit.
+	s.mu.Lock()
+	s.pending = append(s.pending[:0], make([]event, postgresBatchSize)...)
+	s.mu.Unlock()
+	if err := s.write(); err == nil {
+		t.Fatal("got no error writing to an unreachable database")
+	}
+	if n := s.backlog(); n != postgresBatchSize {
+		t.Errorf("got %d events waiting after a failed write, want the %d put back", n, postgresBatchSize)
+	}
+	s.mu.Lock()
+	s.pending = append(s.pending, make([]event, postgresMaxPending)...)
+	s.mu.Unlock()
+	s.write()
+	if n := s.backlog(); n != postgresMaxPending {
+		t.Errorf("got %d events waiting after a failed write, want at most %d", n, postgresMaxPending)
+	}
+}
+
+func TestPostgresStoreCloseWaitsForRun(t *testing.T) {
+	s := unreachablePostgresStore(t)
+	go s.run()
+	done := make(chan error)
+	go func() { done <- s.Close() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	select {
+	case <-s.stopped:
+	default:
+		t.Error("closed before the background writer stopped")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// probeReportInterval is the minimum time between probe-failed events for the same probe of a container, which fails every period until it is fixed.
+const probeReportInterval = 5 * time.Minute
+
+// probeKey identifies a probe of a container in a pod, e.g. the readiness probe of spec.containers{app}.
+type probeKey struct {
+	cluster string
+	uid     types.UID
+	field   string
+	probe   string
+}
+
+// probeTracker sends an event for each probe failure recorded in the Kubernetes events, with the probe's failure message.
+type probeTracker struct {
+	started time.Time
+	pods    cache.Store
+
+	mu       sync.Mutex
+	reported map[probeKey]time.Time
+}
+
+// probes tracks probe failures if enabled with the -watch-probe-events flag, and is otherwise nil.
+// Without it, only readiness probe failures are reported, from the container statuses and without the failure message.
+var probes *probeTracker
+
+// newProbeTracker creates a probe tracker. The events are not watched until watch is called.
+func newProbeTracker() *probeTracker {
+	return &probeTracker{started: time.Now(), reported: make(map[probeKey]time.Time)}
+}
+
+// watch handles the Unhealthy Kubernetes events from an informer of the events about the pods of a cluster, which the kubelet records when a liveness, readiness or startup probe fails.
+// The pods are looked up in a cache, so that the probe-failed events pass the sinks' filters.
+func (p *probeTracker) watch(c *cluster, informer cache.SharedIndexInformer, pods cache.Store) {
+	p.pods = pods
+	informer.AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			e, ok := obj.(*v1.Event)
+			return ok && e.Reason == "Unhealthy"
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { p.observe(c, obj.(*v1.Event)) },
+			UpdateFunc: func(oldObj, newObj interface{}) { p.observe(c, newObj.(*v1.Event)) },
+		},
+	})
+}
+
+// observe publishes a probe-failed event for an Unhealthy event, unless the same probe was reported recently, the event is from before the watcher started, or the pod is watched by another replica.
+func (p *probeTracker) observe(c *cluster, ke *v1.Event) {
+	if ke.InvolvedObject.Kind != "Pod" || kubeEventTime(ke).Before(p.started) || !inPartition(ke.InvolvedObject.Namespace, ke.InvolvedObject.Name) {
+		return
+	}
+	// The message starts with the type of probe, e.g. "Readiness probe failed: HTTP probe failed with statuscode: 500".
+	probe := strings.SplitN(ke.Message, " ", 2)[0]
+	key := probeKey{c.name, ke.InvolvedObject.UID, ke.InvolvedObject.FieldPath, probe}
+	now := time.Now()
+	p.mu.Lock()
+	last, ok := p.reported[key]
+	if ok && now.Sub(last) < probeReportInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.reported[key] = now
+	p.mu.Unlock()
+
+	e := event{
+		Type:      eventProbeFailed,
+		Time:      now,
+		Namespace: ke.InvolvedObject.Namespace,
+		Message:   ke.Message,
+		ctx:       withCluster(context.Background(), c),
+	}
+	if obj, exists, err := p.pods.GetByKey(ke.InvolvedObject.Namespace + "/" + ke.InvolvedObject.Name); err == nil && exists {
+		e.Pod = obj.(*v1.Pod)
+	}
+	if container := fieldPathContainer(ke.InvolvedObject.FieldPath); container != "" {
+		e.Message = "container " + container + ": " + e.Message
+	}
+	if ke.Count > 1 {
+		e.Message += fmt.Sprintf(" (%d times)", ke.Count)
+	}
+	publish(e)
+}
+
+// forget removes a deleted pod.
+func (p *probeTracker) forget(pod *v1.Pod) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key := range p.reported {
+		if key.uid == pod.UID {
+			delete(p.reported, key)
+		}
+	}
+}
+
+// forgetCluster removes the probes of the pods of a cluster that is no longer watched.
+func (p *probeTracker) forgetCluster(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key := range p.reported {
+		if key.cluster == name {
+			delete(p.reported, key)
+		}
+	}
+}
+
+// kubeEventTime returns the time a Kubernetes event last happened.
+func kubeEventTime(ke *v1.Event) time.Time {
+	if !ke.LastTimestamp.IsZero() {
+		return ke.LastTimestamp.Time
+	}
+	if !ke.EventTime.IsZero() {
+		return ke.EventTime.Time
+	}
+	return ke.CreationTimestamp.Time
+}
+
+// fieldPathContainer returns the name of the container in a field path such as "spec.containers{app}", or an empty string if there is none.
+func fieldPathContainer(path string) string {
+	start, end := strings.Index(path, "{"), strings.LastIndex(path, "}")
+	if start < 0 || end < start {
+		return ""
+	}
+	return path[start+1 : end]
+}
+
+// readinessFailures returns an event for each running container with a readiness probe that has stopped being ready in a pod update.
+// It is used when the Unhealthy Kubernetes events are not watched, so the probe's failure message is not known.
+func readinessFailures(e event, oldPod *v1.Pod) []event {
+	if e.Type != eventUpdated || probes != nil {
+		return nil
+	}
+	wasReady := make(map[string]bool)
+	for _, s := range oldPod.Status.ContainerStatuses {
+		wasReady[s.Name] = s.Ready
+	}
+	hasProbe := make(map[string]bool)
+	for _, c := range e.Pod.Spec.Containers {
+		hasProbe[c.Name] = c.ReadinessProbe != nil
+	}
+	var failures []event
+	for _, s := range e.Pod.Status.ContainerStatuses {
+		if !wasReady[s.Name] || s.Ready || s.State.Running == nil || !hasProbe[s.Name] {
+			continue
+		}
+		failures = append(failures, event{
+			Type:      eventProbeFailed,
+			Time:      e.Time,
+			Namespace: e.Namespace,
+			Pod:       e.Pod,
+			Message:   fmt.Sprintf("container %s: Readiness probe failed: the container is running but no longer ready", s.Name),
+			ctx:       e.ctx,
+		})
+	}
+	return failures
+}
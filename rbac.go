@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The -rbac-preflight modes, for when the watcher's user cannot list or watch something it would watch.
+const (
+	// preflightFail stops the watcher with the permissions that are missing.
+	preflightFail = "fail"
+	// preflightDegrade watches only the namespaces and resources that are permitted, logging what is left out.
+	preflightDegrade = "degrade"
+	// preflightOff watches everything without checking, so that what is forbidden is only logged by the informers as it fails.
+	preflightOff = "off"
+)
+
+// preflightTimeout is how long each SelfSubjectAccessReview of the preflight may take.
+const preflightTimeout = 10 * time.Second
+
+// access is a permission that the watcher needs in a cluster.
+type access struct {
+	verb        string
+	group       string
+	resource    string
+	subresource string
+	// namespaced is set for namespaced resources, which are in all namespaces if namespace is empty.
+	namespaced bool
+	namespace  string
+}
+
+// String describes the permission, e.g. "list pods in production".
+func (a access) String() string {
+	s := a.verb + " " + a.resource
+	if a.group != "" {
+		s += "." + a.group
+	}
+	if a.subresource != "" {
+		s += "/" + a.subresource
+	}
+	switch {
+	case a.namespace != "":
+		s += " in " + a.namespace
+	case a.namespaced:
+		s += " in all namespaces"
+	}
+	return s
+}
+
+// requiredAccess returns the permissions needed to watch a cluster with the given options, and to take part in the leader election with a Lease in leaseNamespace if it is not empty.
+func requiredAccess(opts watchOptions, leaseNamespace string) []access {
+	namespaces := splitList(opts.namespace)
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	var required []access
+	for _, namespace := range namespaces {
+		for _, verb := range []string{"list", "watch"} {
+			required = append(required, access{verb: verb, resource: "pods", namespaced: true, namespace: namespace})
+		}
+		if opts.probeEvents || opts.disruptions {
+			for _, verb := range []string{"list", "watch"} {
+				required = append(required, access{verb: verb, resource: "events", namespaced: true, namespace: namespace})
+			}
+		}
+		if opts.describe && !opts.probeEvents && !opts.disruptions {
+			required = append(required, access{verb: "list", resource: "events", namespaced: true, namespace: namespace})
+		}
+		if opts.budgets {
+			for _, verb := range []string{"list", "watch"} {
+				required = append(required, access{verb: verb, group: "policy", resource: "poddisruptionbudgets", namespaced: true, namespace: namespace})
+			}
+		}
+		if opts.networkPolicies {
+			for _, verb := range []string{"list", "watch"} {
+				required = append(required, access{verb: verb, group: "networking.k8s.io", resource: "networkpolicies", namespaced: true, namespace: namespace})
+			}
+		}
+		if opts.crashLogs {
+			required = append(required, access{verb: "get", resource: "pods", subresource: "log", namespaced: true, namespace: namespace})
+		}
+		if opts.usage {
+			required = append(required, access{verb: "list", group: "metrics.k8s.io", resource: "pods", namespaced: true, namespace: namespace})
+		}
+		if opts.debugContainers {
+			required = append(required, access{verb: "patch", resource: "pods", subresource: "ephemeralcontainers", namespaced: true, namespace: namespace})
+		}
+		if opts.annotatePods {
+			required = append(required, access{verb: "patch", resource: "pods", namespaced: true, namespace: namespace})
+		}
+		if opts.recordEvents {
+			for _, verb := range []string{"create", "patch"} {
+				required = append(required, access{verb: verb, resource: "events", namespaced: true, namespace: namespace})
+			}
+		}
+	}
+	if opts.nodes {
+		for _, verb := range []string{"list", "watch"} {
+			required = append(required, access{verb: verb, resource: "nodes"})
+		}
+	}
+	if leaseNamespace != "" {
+		for _, verb := range []string{"get", "create", "update"} {
+			required = append(required, access{verb: verb, group: "coordination.k8s.io", resource: "leases", namespaced: true, namespace: leaseNamespace})
+		}
+	}
+	return required
+}
+
+// reviewAccess asks a cluster's API server with a SelfSubjectAccessReview whether the watcher's user has a permission, and if not, why not.
+func (c *cluster) reviewAccess(ctx context.Context, a access) (bool, string, error) {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   a.namespace,
+				Verb:        a.verb,
+				Group:       a.group,
+				Resource:    a.resource,
+				Subresource: a.subresource,
+			},
+		},
+	}
+	review, err := c.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", err
+	}
+	return review.Status.Allowed, review.Status.Reason, nil
+}
+
+// preflight checks that the watcher's user can list and watch everything that the informers of a cluster would, before they are started, as a watch that is forbidden returns nothing but errors in the log.
+// With preflightFail, an error lists the missing permissions. With preflightDegrade, the options are returned without the namespaces whose pods are forbidden or the watches of other resources that are forbidden, and there is only an error if no namespace is left.
+// If the reviews cannot be made, e.g. because the API server does not support them, the error is logged and the cluster is watched as it is.
+func (c *cluster) preflight(ctx context.Context, opts watchOptions, mode string) (watchOptions, error) {
+	// Only the resources that have informers are checked; the other permissions are checked by the check subcommand.
+	watched := make(map[access]bool)
+	required := requiredAccess(opts, "")
+	for _, a := range required {
+		if a.verb == "watch" {
+			a.verb = "list"
+			watched[a] = true
+		}
+	}
+	var denied []access
+	var reasons []string
+	for _, a := range required {
+		list := a
+		list.verb = "list"
+		if (a.verb != "list" && a.verb != "watch") || !watched[list] {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+		allowed, reason, err := c.reviewAccess(ctx, a)
+		cancel()
+		if err != nil {
+			log.Printf("%sRBAC preflight error: %v\n", clusterPrefix(c.name), err)
+			return opts, nil
+		}
+		if !allowed {
+			denied = append(denied, a)
+			if reason != "" {
+				reason = " (" + reason + ")"
+			}
+			reasons = append(reasons, a.String()+reason)
+		}
+	}
+	if len(denied) == 0 {
+		return opts, nil
+	}
+	if mode != preflightDegrade {
+		return opts, fmt.Errorf("%s: forbidden to %s; grant the permissions, watch less (e.g. with -namespace), or start with -rbac-preflight=degrade to watch only what is permitted", c.name, strings.Join(reasons, ", "))
+	}
+
+	// The other resources are not watched in the namespaces whose pods are forbidden, so they only need to be left out if they are forbidden elsewhere.
+	forbidden := make(map[string]bool)
+	for _, a := range denied {
+		if a.resource == "pods" {
+			if a.namespace == metav1.NamespaceAll {
+				return opts, fmt.Errorf("%s: forbidden to %s; watch the namespaces that are permitted with -namespace", c.name, a)
+			}
+			forbidden[a.namespace] = true
+		}
+	}
+	for _, a := range denied {
+		if a.resource != "pods" && a.namespaced && forbidden[a.namespace] {
+			continue
+		}
+		switch a.resource {
+		case "events":
+			opts.probeEvents, opts.disruptions = false, false
+		case "poddisruptionbudgets":
+			opts.budgets = false
+		case "networkpolicies":
+			opts.networkPolicies = false
+		case "nodes":
+			opts.nodes = false
+		}
+		log.Printf("%sRBAC preflight: forbidden to %s, so it is not watched\n", clusterPrefix(c.name), a)
+	}
+	var permitted []string
+	for _, namespace := range splitList(opts.namespace) {
+		if !forbidden[namespace] {
+			permitted = append(permitted, namespace)
+		}
+	}
+	if len(permitted) == 0 {
+		return opts, fmt.Errorf("%s: forbidden to watch the pods in any of the namespaces %s", c.name, opts.namespace)
+	}
+	opts.namespace = strings.Join(permitted, ",")
+	return opts, nil
+}
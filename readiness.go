@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// readinessLatencyHistogram records the time from a pod being created to it first becoming ready.
+var readinessLatencyHistogram, _ = meter.Float64Histogram("pod_event_watcher.pod.readiness.latency",
+	metric.WithDescription("Time from pod creation to the pod first becoming ready."),
+	metric.WithUnit("s"),
+	metric.WithExplicitBucketBoundaries(1, 2, 5, 10, 20, 30, 60, 120, 300, 600, 1800))
+
+// readinessTracker records the readiness latency of each pod once, the first time it becomes ready.
+// Pods that become ready again after failing a readiness probe are not recorded again.
+type readinessTracker struct {
+	mu    sync.Mutex
+	ready map[types.UID]string // UID -> cluster.
+}
+
+// readiness tracks the pods whose readiness latency has been recorded.
+var readiness = &readinessTracker{ready: make(map[types.UID]string)}
+
+// podCondition returns the condition of the given type from a pod's status, or nil if it has none.
+func podCondition(pod *v1.Pod, t v1.PodConditionType) *v1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == t {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// podReady reports whether a pod's Ready condition is true.
+func podReady(pod *v1.Pod) bool {
+	c := podCondition(pod, v1.PodReady)
+	return c != nil && c.Status == v1.ConditionTrue
+}
+
+// observe records the readiness latency if a pod has become ready for the first time.
+func (r *readinessTracker) observe(e event, oldPod *v1.Pod) {
+	if e.Type != eventUpdated || podReady(oldPod) || !podReady(e.Pod) {
+		return
+	}
+
+	r.mu.Lock()
+	_, seen := r.ready[e.Pod.UID]
+	r.ready[e.Pod.UID] = e.cluster()
+	r.mu.Unlock()
+	if seen {
+		return
+	}
+
+	latency := podCondition(e.Pod, v1.PodReady).LastTransitionTime.Sub(e.Pod.CreationTimestamp.Time)
+	readinessLatencyHistogram.Record(e.context(), latency.Seconds(), metric.WithAttributes(
+		attribute.String("cluster", e.cluster()),
+		attribute.String("namespace", e.Namespace),
+		attribute.String("workload", metricWorkload(e.Pod)),
+	))
+}
+
+// forget removes a deleted pod.
+func (r *readinessTracker) forget(pod *v1.Pod) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.ready, pod.UID)
+}
+
+// forgetCluster removes the pods of a cluster that is no longer watched.
+func (r *readinessTracker) forgetCluster(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for uid, cluster := range r.ready {
+		if cluster == name {
+			delete(r.ready, uid)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// recorderReasons are the reasons of the Kubernetes Events for the event types that are not their names in camel case.
+var recorderReasons = map[eventType]string{
+	eventOOMKilled: "OOMKilled",
+}
+
+// recorderSink records events as Kubernetes Events on their pods, so that kubectl describe shows what the watcher found.
+// Each cluster has its own recorder, created the first time that an event from the cluster is recorded, which aggregates repeated events as kubelets do.
+type recorderSink struct {
+	mu           sync.Mutex
+	broadcasters map[*cluster]record.EventBroadcaster
+	recorders    map[*cluster]record.EventRecorder
+}
+
+// newRecorderSink creates a recorderSink.
+func newRecorderSink() *recorderSink {
+	return &recorderSink{broadcasters: make(map[*cluster]record.EventBroadcaster), recorders: make(map[*cluster]record.EventRecorder)}
+}
+
+// Send records an event on its pod. Events without a pod, or from a cluster that is no longer watched, are dropped.
+// The Events are written in the background by the recorder, which logs the ones that it fails to write.
+func (s *recorderSink) Send(e event) error {
+	if e.Pod == nil {
+		return nil
+	}
+	c := watchedClusters.named(e.cluster())
+	if c == nil {
+		return nil
+	}
+	message := e.Message
+	if message == "" {
+		message = e.title()
+	}
+	s.recorder(c).Event(e.Pod, recorderType(e.Type), recorderReason(e.Type), message)
+	return nil
+}
+
+// recorder returns the recorder for a cluster, creating it if needed.
+func (s *recorderSink) recorder(c *cluster) record.EventRecorder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.recorders[c]; ok {
+		return r
+	}
+	b := record.NewBroadcaster()
+	b.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.clientset.CoreV1().Events("")})
+	r := b.NewRecorder(scheme.Scheme, v1.EventSource{Component: "pod-event-watcher"})
+	s.broadcasters[c], s.recorders[c] = b, r
+	return r
+}
+
+// Close stops the recorders.
+func (s *recorderSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.broadcasters {
+		b.Shutdown()
+	}
+	return nil
+}
+
+// recorderReason returns the reason of the Kubernetes Events for an event type, e.g. "CrashLoop" for crash-loop.
+func recorderReason(t eventType) string {
+	if reason, ok := recorderReasons[t]; ok {
+		return reason
+	}
+	var b strings.Builder
+	for _, word := range strings.Split(string(t), "-") {
+		if word != "" {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+// recorderType returns the type of the Kubernetes Events for an event type: Normal for the pod lifecycle and recoveries, and Warning for everything else.
+func recorderType(t eventType) string {
+	switch t {
+	case eventCreated, eventUpdated, eventDeleted, eventCrashLoopRecovered, eventImageChanged, eventClusterRecovered, eventCredentialsRenewed:
+		return v1.EventTypeNormal
+	}
+	return v1.EventTypeWarning
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+)
+
+// redacted replaces the values that are masked.
+const redacted = "REDACTED"
+
+// redactor masks the data that could reveal credentials before it is output in any way.
+// The references to Secrets in the pods (the Secrets and keys that environment variables come from, and the Secrets that volumes project) are always masked, as are the matches of the -redact patterns in the environment variables, commands, arguments and annotations of the pods.
+// The pods are masked as they are cached, so that the details, differences, history store, spill file, API and snapshots never see the original values, the pods recorded in fixtures, the logs captured to files and the messages of the Kubernetes Events listed to describe a pod are masked as they are written, and the text of each event (its message, differences and logs) is masked again before it is delivered, as it can include things such as the logs of a container.
+type redactor struct {
+	patterns patternsFlag
+}
+
+// redaction masks the pods and events. It is always enabled, with the patterns given by the -redact flag.
+var redaction = &redactor{}
+
+// patternsFlag is a list of regular expressions, given by repeating the flag, as a pattern may contain commas.
+type patternsFlag []*regexp.Regexp
+
+// String returns the patterns.
+func (f *patternsFlag) String() string {
+	var patterns []string
+	for _, p := range *f {
+		patterns = append(patterns, p.String())
+	}
+	return strings.Join(patterns, " ")
+}
+
+// Set adds a pattern.
+func (f *patternsFlag) Set(value string) error {
+	p, err := regexp.Compile(value)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", value, err)
+	}
+	*f = append(*f, p)
+	return nil
+}
+
+// transform returns the watcher's Options.Transform: it masks each pod, then transforms it with next, or trims it if next is nil.
+// The pod is masked first so that next, such as the memory budget's spilling, never sees the original values.
+func (r *redactor) transform(next func(*v1.Pod)) func(*v1.Pod) {
+	if next == nil {
+		next = watcher.TrimPod
+	}
+	return func(pod *v1.Pod) {
+		r.redactPod(pod)
+		next(pod)
+	}
+}
+
+// redactObject returns a masked copy of a pod or list of pods from a list or watch, which is shared with the informer, and any other object as it is.
+func (r *redactor) redactObject(obj runtime.Object) runtime.Object {
+	switch o := obj.(type) {
+	case *v1.Pod:
+		pod := o.DeepCopy()
+		r.redactPod(pod)
+		return pod
+	case *v1.PodList:
+		list := o.DeepCopy()
+		for i := range list.Items {
+			r.redactPod(&list.Items[i])
+		}
+		return list
+	}
+	return obj
+}
+
+// redactPod masks the references to Secrets in a pod, and the matches of the patterns.
+func (r *redactor) redactPod(pod *v1.Pod) {
+	for k, v := range pod.Annotations {
+		pod.Annotations[k] = r.redactString(v)
+	}
+	for i := range pod.Spec.InitContainers {
+		r.redactContainer(&pod.Spec.InitContainers[i])
+	}
+	for i := range pod.Spec.Containers {
+		r.redactContainer(&pod.Spec.Containers[i])
+	}
+	for i := range pod.Spec.EphemeralContainers {
+		c := v1.Container(pod.Spec.EphemeralContainers[i].EphemeralContainerCommon)
+		r.redactContainer(&c)
+		pod.Spec.EphemeralContainers[i].EphemeralContainerCommon = v1.EphemeralContainerCommon(c)
+	}
+	for i := range pod.Spec.Volumes {
+		v := &pod.Spec.Volumes[i]
+		if v.Secret != nil {
+			v.Secret.SecretName = redacted
+		}
+		if v.Projected != nil {
+			for j := range v.Projected.Sources {
+				if s := v.Projected.Sources[j].Secret; s != nil {
+					s.Name = redacted
+				}
+			}
+		}
+	}
+}
+
+// redactContainer masks the Secrets that a container's environment comes from, and the matches of the patterns in its environment, command and arguments.
+func (r *redactor) redactContainer(c *v1.Container) {
+	for i := range c.Env {
+		env := &c.Env[i]
+		env.Value = r.redactString(env.Value)
+		if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+			env.ValueFrom.SecretKeyRef.Name, env.ValueFrom.SecretKeyRef.Key = redacted, redacted
+		}
+	}
+	for i := range c.EnvFrom {
+		if ref := c.EnvFrom[i].SecretRef; ref != nil {
+			ref.Name = redacted
+		}
+	}
+	for i := range c.Command {
+		c.Command[i] = r.redactString(c.Command[i])
+	}
+	for i := range c.Args {
+		c.Args[i] = r.redactString(c.Args[i])
+	}
+}
+
+// redactString replaces the matches of the patterns in s.
+func (r *redactor) redactString(s string) string {
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// copy copies text such as a container's logs from src to w a line at a time, replacing the matches of the patterns in each line.
+func (r *redactor) copy(w io.Writer, src io.Reader) error {
+	if len(r.patterns) == 0 {
+		_, err := io.Copy(w, src)
+		return err
+	}
+	br := bufio.NewReader(src)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			if _, werr := io.WriteString(w, r.redactString(line)); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// redactStrings replaces the matches of the patterns in each of a list of strings, returning a new list if any of them changed, as the list may be shared with other events.
+func (r *redactor) redactStrings(list []string) []string {
+	var masked []string
+	for i, s := range list {
+		if m := r.redactString(s); m != s {
+			if masked == nil {
+				masked = append([]string(nil), list...)
+			}
+			masked[i] = m
+		}
+	}
+	if masked == nil {
+		return list
+	}
+	return masked
+}
+
+// apply masks the matches of the patterns in an event's text, for the bus. The event's pod was masked when it was cached.
+func (r *redactor) apply(e event) (event, bool, error) {
+	if len(r.patterns) == 0 {
+		return e, true, nil
+	}
+	e.Message = r.redactString(e.Message)
+	e.Logs = r.redactString(e.Logs)
+	e.Diff = r.redactStrings(e.Diff)
+	e.Cumulative = r.redactStrings(e.Cumulative)
+	if len(e.Containers) > 0 {
+		containers := make([]containerDiff, len(e.Containers))
+		for i, c := range e.Containers {
+			containers[i] = containerDiff{Container: c.Container}
+			for _, change := range c.Changes {
+				change.Old, change.New = r.redactString(change.Old), r.redactString(change.New)
+				containers[i].Changes = append(containers[i].Changes, change)
+			}
+		}
+		e.Containers = containers
+	}
+	return e, true, nil
+}
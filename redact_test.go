@@ -0,0 +1,172 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testRedactor returns a redactor that masks passwords given as password=VALUE.
+func testRedactor() *redactor {
+	return &redactor{patterns: patternsFlag{regexp.MustCompile(`password=\S+`)}}
+}
+
+// secretKey returns an environment variable source from a key of a Secret.
+func secretKey(name, key string) *v1.EnvVarSource {
+	return &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: name}, Key: key}}
+}
+
+func TestRedactPod(t *testing.T) {
+	tests := []struct {
+		name      string
+		pod, want v1.PodSpec
+	}{
+		{
+			"env value",
+			v1.PodSpec{Containers: []v1.Container{{Name: "app", Env: []v1.EnvVar{{Name: "DSN", Value: "user password=hunter2"}}}}},
+			v1.PodSpec{Containers: []v1.Container{{Name: "app", Env: []v1.EnvVar{{Name: "DSN", Value: "user REDACTED"}}}}},
+		},
+		{
+			"env from a Secret key",
+			v1.PodSpec{Containers: []v1.Container{{Name: "app", Env: []v1.EnvVar{{Name: "TOKEN", ValueFrom: secretKey("api", "token")}}}}},
+			v1.PodSpec{Containers: []v1.Container{{Name: "app", Env: []v1.EnvVar{{Name: "TOKEN", ValueFrom: secretKey(redacted, redacted)}}}}},
+		},
+		{
+			"envFrom a Secret",
+			v1.PodSpec{InitContainers: []v1.Container{{Name: "init", EnvFrom: []v1.EnvFromSource{{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "api"}}}}}}},
+			v1.PodSpec{InitContainers: []v1.Container{{Name: "init", EnvFrom: []v1.EnvFromSource{{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: redacted}}}}}}},
+		},
+		{
+			"command and args",
+			v1.PodSpec{Containers: []v1.Container{{Name: "app", Command: []string{"app", "password=hunter2"}, Args: []string{"-v", "password=hunter2"}}}},
+			v1.PodSpec{Containers: []v1.Container{{Name: "app", Command: []string{"app", redacted}, Args: []string{"-v", redacted}}}},
+		},
+		{
+			"ephemeral container",
+			v1.PodSpec{EphemeralContainers: []v1.EphemeralContainer{{EphemeralContainerCommon: v1.EphemeralContainerCommon{Name: "debug", Args: []string{"password=hunter2"}}}}},
+			v1.PodSpec{EphemeralContainers: []v1.EphemeralContainer{{EphemeralContainerCommon: v1.EphemeralContainerCommon{Name: "debug", Args: []string{redacted}}}}},
+		},
+		{
+			"Secret volume",
+			v1.PodSpec{Volumes: []v1.Volume{{Name: "certs", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "tls"}}}}},
+			v1.PodSpec{Volumes: []v1.Volume{{Name: "certs", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: redacted}}}}},
+		},
+		{
+			"projected sources",
+			v1.PodSpec{Volumes: []v1.Volume{{Name: "all", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{Sources: []v1.VolumeProjection{
+				{Secret: &v1.SecretProjection{LocalObjectReference: v1.LocalObjectReference{Name: "tls"}}},
+				{ConfigMap: &v1.ConfigMapProjection{LocalObjectReference: v1.LocalObjectReference{Name: "settings"}}},
+			}}}}}},
+			v1.PodSpec{Volumes: []v1.Volume{{Name: "all", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{Sources: []v1.VolumeProjection{
+				{Secret: &v1.SecretProjection{LocalObjectReference: v1.LocalObjectReference{Name: redacted}}},
+				{ConfigMap: &v1.ConfigMapProjection{LocalObjectReference: v1.LocalObjectReference{Name: "settings"}}},
+			}}}}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &v1.Pod{Spec: test.pod}
+			testRedactor().redactPod(pod)
+			if !reflect.DeepEqual(pod.Spec, test.want) {
+				t.Errorf("got %+v, want %+v", pod.Spec, test.want)
+			}
+		})
+	}
+}
+
+func TestRedactPodAnnotations(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"config": "password=hunter2 mode=fast"}}}
+	testRedactor().redactPod(pod)
+	if got := pod.Annotations["config"]; got != "REDACTED mode=fast" {
+		t.Errorf("got annotation %q, want the password masked", got)
+	}
+}
+
+func TestRedactObjectCopies(t *testing.T) {
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Args: []string{"password=hunter2"}, Env: []v1.EnvVar{{Name: "TOKEN", ValueFrom: secretKey("api", "token")}}}}}}
+	original := pod.DeepCopy()
+	for _, obj := range []interface{}{testRedactor().redactObject(pod), testRedactor().redactObject(&v1.PodList{Items: []v1.Pod{*pod}})} {
+		var masked v1.Pod
+		switch o := obj.(type) {
+		case *v1.Pod:
+			masked = *o
+		case *v1.PodList:
+			masked = o.Items[0]
+		}
+		if masked.Spec.Containers[0].Args[0] != redacted || masked.Spec.Containers[0].Env[0].ValueFrom.SecretKeyRef.Name != redacted {
+			t.Errorf("got %+v, want the arguments and Secret masked", masked.Spec.Containers[0])
+		}
+	}
+	if !reflect.DeepEqual(pod, original) {
+		t.Errorf("got the original pod changed to %+v", pod.Spec)
+	}
+}
+
+func TestRedactEvent(t *testing.T) {
+	diff := []string{"spec.containers[0].args[0]: password=old != password=new"}
+	e := event{
+		Type:       eventUpdated,
+		Message:    "login with password=hunter2 failed",
+		Logs:       "starting\npassword=hunter2\n",
+		Diff:       diff,
+		Cumulative: []string{"password=first"},
+		Containers: []containerDiff{{Container: "app", Changes: []fieldChange{{Field: "args", Old: "password=old", New: "password=new"}}}},
+	}
+	got, keep, err := testRedactor().apply(e)
+	if err != nil || !keep {
+		t.Fatalf("got %v, %v, want the event kept", keep, err)
+	}
+	tests := []struct {
+		name, got, want string
+	}{
+		{"message", got.Message, "login with REDACTED failed"},
+		{"logs", got.Logs, "starting\nREDACTED\n"},
+		{"diff", got.Diff[0], "spec.containers[0].args[0]: REDACTED != REDACTED"},
+		{"cumulative diff", got.Cumulative[0], redacted},
+		{"container change", got.Containers[0].Changes[0].Old + " " + got.Containers[0].Changes[0].New, "REDACTED REDACTED"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("got %s %q, want %q", test.name, test.got, test.want)
+		}
+	}
+	// The differences may be shared with other events, so they are copied rather than masked in place.
+	if diff[0] != "spec.containers[0].args[0]: password=old != password=new" || e.Containers[0].Changes[0].Old != "password=old" {
+		t.Errorf("got the original event changed to %q %+v", diff, e.Containers)
+	}
+}
+
+func TestRedactCopy(t *testing.T) {
+	var b strings.Builder
+	if err := testRedactor().copy(&b, strings.NewReader("one\npassword=hunter2 two\nthree")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "one\nREDACTED two\nthree"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDescribeEventsRedacted(t *testing.T) {
+	patterns := redaction.patterns
+	redaction.patterns = testRedactor().patterns
+	t.Cleanup(func() { redaction.patterns = patterns })
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	ke := &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "web.1", Namespace: "default"},
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web", Namespace: "default"},
+		Type:           "Warning",
+		Reason:         "Unhealthy",
+		Message:        "Readiness probe failed: login with password=hunter2 refused",
+	}
+	c := newClusterForClientset("test", fake.NewSimpleClientset(ke))
+	var b strings.Builder
+	describeEvents(&b, c, pod)
+	if out := b.String(); strings.Contains(out, "hunter2") || !strings.Contains(out, "login with REDACTED refused") {
+		t.Errorf("got %q, want the Kubernetes Event's message masked", out)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// configReloadInterval is the time between checks for changes to the configuration file.
+const configReloadInterval = 5 * time.Second
+
+// reloadConfig replaces the sinks with those returned by load whenever SIGHUP is received or the configuration file at path changes.
+// The informers are not restarted, so the pods are not listed and reported again.
+// The previous sinks are kept if the new configuration cannot be loaded.
+func reloadConfig(path string, load func() ([]sinkConfig, error)) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	var modTime time.Time
+	if path != "" {
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+	}
+	tick := time.Tick(configReloadInterval)
+	for {
+		select {
+		case <-hangups:
+		case <-tick:
+			if path == "" {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				log.Printf("Config error: %v\n", err)
+				continue
+			}
+			if info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+		}
+		configs, err := load()
+		if err == nil {
+			err = reloadSinks(configs)
+		}
+		if err != nil {
+			log.Printf("Config error: %v\n", err)
+			continue
+		}
+		log.Printf("Reloaded the configuration\n")
+	}
+}
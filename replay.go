@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replayMain runs the replay subcommand, which re-publishes the events from a journal file to the sinks.
+// This allows filters and sinks to be developed without a cluster.
+// Only the sink pipeline is replayed: metrics that need the previous state of a pod, such as readiness latency, are not recorded.
+func replayMain(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	from := flags.String("from", "", "path of the journal file to replay (may be gzip compressed)")
+	speed := flags.String("speed", "1x", "replay speed relative to the original timing (e.g. \"10x\"), or \"max\" for no delays")
+	configPath := flags.String("config", "", "path to a YAML or JSON configuration file listing sinks and their filters")
+	var details detailsMode
+	flags.Var(&details, "details", "print pod object details: -details for a dump of the pod object, or -details=describe for a description as by kubectl describe with the pod's recent Kubernetes Events (ignored if -config is given)")
+	flags.Var(&redaction.patterns, "redact", "regular expression whose matches are replaced by "+redacted+" in the events before they are sent, as well as the references to Secrets in their pods; repeat the flag for more patterns")
+	timestampFlags := addTimestampFlags(flags)
+	flags.Parse(args)
+
+	if *from == "" {
+		fmt.Fprintln(os.Stderr, "replay: -from is required")
+		flags.Usage()
+		os.Exit(2)
+	}
+	factor, err := parseSpeed(*speed)
+	if err != nil {
+		panic(err.Error())
+	}
+	if err := timestampFlags.setup(); err != nil {
+		panic(err.Error())
+	}
+
+	sinkConfigs, err := loadSinkConfigs(*configPath, details)
+	if err != nil {
+		panic(err.Error())
+	}
+	if err := addSinks(sinkConfigs); err != nil {
+		panic(err.Error())
+	}
+	events.addTransform(redaction)
+	go events.run()
+
+	n, err := replay(*from, factor)
+	events.drain()
+	if err != nil {
+		panic(err.Error())
+	}
+	log.Printf("Replayed %d events\n", n)
+}
+
+// parseSpeed parses a replay speed such as "10x" or "0.5", returning 0 for "max".
+func parseSpeed(s string) (float64, error) {
+	if s == "max" {
+		return 0, nil
+	}
+	factor, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || factor <= 0 {
+		return 0, fmt.Errorf("invalid replay speed %q", s)
+	}
+	return factor, nil
+}
+
+// openJournalFile opens a journal file for reading, decompressing it if it is gzip compressed.
+func openJournalFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, file}, nil
+}
+
+// replay publishes the events in a journal file, waiting between events for the original time between them divided by factor.
+// A factor of 0 publishes the events without waiting.
+func replay(path string, factor float64) (int, error) {
+	file, err := openJournalFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	n := 0
+	var previous time.Time
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var e event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return n, fmt.Errorf("%s: line %d: %v", path, n+1, err)
+		}
+		if factor > 0 && !previous.IsZero() && e.Time.After(previous) {
+			time.Sleep(time.Duration(float64(e.Time.Sub(previous)) / factor))
+		}
+		previous = e.Time
+		// The journal may have been written before the pods were masked, or with other patterns.
+		if e.Pod != nil {
+			redaction.redactPod(e.Pod)
+		}
+		publish(e)
+		n++
+	}
+	return n, scanner.Err()
+}
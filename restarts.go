@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	v1 "k8s.io/api/core/v1"
+)
+
+// restartCounter counts container restarts by namespace, workload and pod.
+var restartCounter, _ = meter.Int64Counter("pod_event_watcher.container.restarts",
+	metric.WithDescription("Number of container restarts seen in pod updates."))
+
+// restartCount returns the total number of restarts of a pod's containers.
+func restartCount(pod *v1.Pod) int32 {
+	var n int32
+	for _, s := range pod.Status.InitContainerStatuses {
+		n += s.RestartCount
+	}
+	for _, s := range pod.Status.ContainerStatuses {
+		n += s.RestartCount
+	}
+	return n
+}
+
+// signalNames names the signals that commonly end containers.
+var signalNames = map[int32]string{
+	1:  "SIGHUP",
+	2:  "SIGINT",
+	6:  "SIGABRT",
+	7:  "SIGBUS",
+	8:  "SIGFPE",
+	9:  "SIGKILL",
+	11: "SIGSEGV",
+	15: "SIGTERM",
+}
+
+// containerRestarts returns an event for each container in an updated pod that has restarted since the old pod, describing how the container last ended.
+func containerRestarts(e event, oldPod *v1.Pod) []event {
+	if e.Type != eventUpdated {
+		return nil
+	}
+	oldCounts := make(map[string]int32)
+	for _, s := range containerStatuses(oldPod) {
+		oldCounts[s.Name] = s.RestartCount
+	}
+	var restarted []event
+	for _, s := range containerStatuses(e.Pod) {
+		old, ok := oldCounts[s.Name]
+		if !ok || s.RestartCount <= old {
+			continue
+		}
+		msg := fmt.Sprintf("container %s restarted (%d restarts)", s.Name, s.RestartCount)
+		if t := s.LastTerminationState.Terminated; t != nil {
+			msg += ": " + terminationDetails(t)
+		}
+		restarted = append(restarted, event{
+			Type:      eventContainerRestarted,
+			Time:      e.Time,
+			Namespace: e.Namespace,
+			Pod:       e.Pod,
+			Message:   msg,
+			Container: s.Name,
+			ctx:       e.ctx,
+		})
+	}
+	return restarted
+}
+
+// terminationDetails describes how a container ended, e.g. "exit code 137 (SIGKILL), reason OOMKilled".
+func terminationDetails(t *v1.ContainerStateTerminated) string {
+	s := fmt.Sprintf("exit code %d", t.ExitCode)
+	// The signal is rarely reported, but exit codes over 128 are conventionally 128 plus the signal number.
+	signal := t.Signal
+	if signal == 0 && t.ExitCode > 128 {
+		signal = t.ExitCode - 128
+	}
+	if signal != 0 {
+		name, ok := signalNames[signal]
+		if !ok {
+			name = fmt.Sprintf("signal %d", signal)
+		}
+		s += " (" + name + ")"
+	}
+	if t.Reason != "" {
+		s += ", reason " + t.Reason
+	}
+	if msg := strings.TrimSpace(t.Message); msg != "" {
+		s += ": " + msg
+	}
+	return s
+}
+
+// restartTracker counts container restarts per pod, for the metrics and the periodic top restarters report.
+type restartTracker struct {
+	mu     sync.Mutex
+	counts map[string]int // "[cluster] namespace/name" -> restarts since the last report
+}
+
+// restarts tracks the container restarts since the last report.
+var restarts = &restartTracker{counts: make(map[string]int)}
+
+// observe counts any new restarts in a pod update.
+func (r *restartTracker) observe(e event, oldPod *v1.Pod) {
+	if e.Type != eventUpdated {
+		return
+	}
+	delta := restartCount(e.Pod) - restartCount(oldPod)
+	if delta <= 0 {
+		return
+	}
+
+	restartCounter.Add(e.context(), int64(delta), metric.WithAttributes(
+		attribute.String("cluster", e.cluster()),
+		attribute.String("namespace", e.Namespace),
+		attribute.String("workload", metricWorkload(e.Pod)),
+		attribute.String("pod", e.Pod.Name),
+	))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[clusterPrefix(e.cluster())+e.Namespace+"/"+e.Pod.Name] += int(delta)
+}
+
+// forgetCluster removes the pods of a cluster that is no longer watched, so that they are not in the next report.
+func (r *restartTracker) forgetCluster(name string) {
+	prefix := clusterPrefix(name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.counts {
+		if strings.HasPrefix(key, prefix) {
+			delete(r.counts, key)
+		}
+	}
+}
+
+// report returns a summary of the top pods by restarts since the last report, and starts counting again.
+// It returns false if there have been no restarts.
+func (r *restartTracker) report(top int, interval time.Duration) (event, bool) {
+	r.mu.Lock()
+	counts := r.counts
+	r.counts = make(map[string]int)
+	r.mu.Unlock()
+
+	if len(counts) == 0 {
+		return event{}, false
+	}
+	pods := make([]string, 0, len(counts))
+	for pod := range counts {
+		pods = append(pods, pod)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if counts[pods[i]] != counts[pods[j]] {
+			return counts[pods[i]] > counts[pods[j]]
+		}
+		return pods[i] < pods[j]
+	})
+	if len(pods) > top {
+		pods = pods[:top]
+	}
+
+	items := make([]string, len(pods))
+	for i, pod := range pods {
+		items[i] = fmt.Sprintf("%s (%d)", pod, counts[pod])
+	}
+	return event{
+		Type:    eventRestartReport,
+		Time:    time.Now(),
+		Message: fmt.Sprintf("in the last %s: %s", interval, strings.Join(items, ", ")),
+	}, true
+}
+
+// reportRestarts publishes a top restarters report every interval.
+func reportRestarts(top int, interval time.Duration) {
+	for range time.Tick(interval) {
+		if e, ok := restarts.report(top, interval); ok {
+			publish(e)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// resumeState is saved to the state file so that the watch can be resumed after a restart.
+type resumeState struct {
+	Namespace       string   `json:"namespace"`
+	Selector        string   `json:"selector"`
+	ResourceVersion string   `json:"resourceVersion"`
+	Pods            []v1.Pod `json:"pods"`
+}
+
+// resumer saves the cache and the last resource version received from the API server, and uses them to resume the watch after a restart.
+//
+// When resuming, the first list returns the saved pods instead of asking the API server, so the informer watches from the saved resource version and receives the changes made while the watcher was stopped as normal events.
+// The informer still calls the AddFunc handler for each saved pod, but these are suppressed as they were already reported before the restart.
+// If the API server no longer has the saved resource version (410 Gone), the informer lists the pods again and reports the differences from the saved pods as updates, additions and deletions.
+type resumer struct {
+	mu         sync.Mutex
+	lastRV     string
+	state      *resumeState
+	suppressed map[string]string // Pod key -> resource version of saved pods whose Add should be suppressed.
+	listed     bool
+}
+
+// resumption resumes the watch from the state file given by the -state-file flag.
+var resumption = &resumer{}
+
+// load reads the state file, if it exists and was saved for the same namespace and selector.
+func (r *resumer) load(path string, namespace string, selector string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state resumeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if state.Namespace != namespace || state.Selector != selector {
+		log.Printf("Not resuming: state file %s was saved for a different namespace or selector\n", path)
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state = &state
+	r.lastRV = state.ResourceVersion
+	r.suppressed = make(map[string]string, len(state.Pods))
+	for i := range state.Pods {
+		pod := &state.Pods[i]
+		r.suppressed[pod.Namespace+"/"+pod.Name] = pod.ResourceVersion
+	}
+	return nil
+}
+
+// wrap returns a ListerWatcher that records the resource versions of the lists and watch events, and whose first list returns the saved pods if there is saved state.
+func (r *resumer) wrap(lw cache.ListerWatcher) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			r.mu.Lock()
+			first := r.state != nil && !r.listed
+			r.listed = true
+			r.mu.Unlock()
+			if first {
+				log.Printf("Resuming watch from resource version %s with %d saved pods\n", r.state.ResourceVersion, len(r.state.Pods))
+				return &v1.PodList{
+					ListMeta: metav1.ListMeta{ResourceVersion: r.state.ResourceVersion},
+					Items:    r.state.Pods,
+				}, nil
+			}
+			obj, err := lw.List(options)
+			if err == nil {
+				if list, err := meta.ListAccessor(obj); err == nil {
+					r.advance(list.GetResourceVersion())
+				}
+			}
+			return obj, err
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			w, err := lw.Watch(options)
+			if err != nil {
+				return nil, err
+			}
+			return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+				if e.Type != watch.Error {
+					if obj, err := meta.Accessor(e.Object); err == nil {
+						r.advance(obj.GetResourceVersion())
+					}
+				}
+				return e, true
+			}), nil
+		},
+	}
+}
+
+// advance records the resource version of a list or watch event, unless it is older than the last one recorded, so that the saved resource version never goes backwards.
+// Resource versions are compared as numbers, as the API server's are. Those that are not numbers are recorded as they are received.
+func (r *resumer) advance(rv string) {
+	if rv == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if last, err := strconv.ParseUint(r.lastRV, 10, 64); err == nil {
+		if next, err := strconv.ParseUint(rv, 10, 64); err == nil && next <= last {
+			return
+		}
+	}
+	r.lastRV = rv
+}
+
+// suppress reports whether the Add for a pod is for a saved pod that has not changed.
+// Each saved pod is only suppressed once.
+func (r *resumer) suppress(pod *v1.Pod) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := pod.Namespace + "/" + pod.Name
+	rv, ok := r.suppressed[key]
+	if !ok {
+		return false
+	}
+	delete(r.suppressed, key)
+	return rv == pod.ResourceVersion
+}
+
+// save writes the cache and the last resource version received to the state file.
+// The resource version is read before the cache, so the cache may include changes after the resource version. These will be seen again when resuming, as updates with no differences.
+// As the resource version is recorded when it is received, a change still queued for the cache when it is saved is not seen when resuming, so the state file is saved last when shutting down, after the watch has stopped.
+func (r *resumer) save(path string, namespace string, selector string, store cache.Store) error {
+	r.mu.Lock()
+	state := resumeState{Namespace: namespace, Selector: selector, ResourceVersion: r.lastRV}
+	r.mu.Unlock()
+	if state.ResourceVersion == "" {
+		return nil
+	}
+	for _, obj := range store.List() {
+		state.Pods = append(state.Pods, *obj.(*v1.Pod))
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it, so that a crash while saving does not leave a truncated state file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// savePeriodically saves the state file every interval. The state file is also saved once the watch has stopped when shutting down.
+func (r *resumer) savePeriodically(path string, namespace string, selector string, store cache.Store, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := r.save(path, namespace, selector, store); err != nil {
+			log.Printf("State file error: %v\n", err)
+		}
+	}
+}
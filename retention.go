@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// retention limits how much history is kept. Zero values are unlimited.
+type retention struct {
+	// MaxAge is the age after which events are removed.
+	MaxAge time.Duration
+	// MaxEvents is the number of events kept by a store, removing the oldest first.
+	// For the bolt store, which only keeps the latest state of each pod, it is the number of pods.
+	MaxEvents int
+	// MaxJournalBytes is the total size of rotated journal files kept, removing the oldest first.
+	MaxJournalBytes int64
+}
+
+// cutoff returns the time before which events should be removed, or the zero time if there is no maximum age.
+func (r retention) cutoff() time.Time {
+	if r.MaxAge == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-r.MaxAge)
+}
+
+// pruner is implemented by stores of history that can remove old events.
+type pruner interface {
+	// Prune removes the events that are outside the retention limits, returning the number of events (or files) removed.
+	Prune(r retention) (int, error)
+}
+
+// prune prunes each of the history stores, logging the results.
+func prune(pruners map[string]pruner, r retention) {
+	for name, p := range pruners {
+		n, err := p.Prune(r)
+		if err != nil {
+			log.Printf("Prune error (%s): %v\n", name, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("Pruned %d from %s\n", n, name)
+		}
+	}
+}
+
+// prunePeriodically prunes the history stores every interval.
+func prunePeriodically(pruners map[string]pruner, r retention, interval time.Duration) {
+	prune(pruners, r)
+	for range time.Tick(interval) {
+		prune(pruners, r)
+	}
+}
+
+// Prune removes rotated journal files that were rotated before the maximum age, and then the oldest rotated files until their total size is within the limit.
+// The current journal file is never removed, and the last line of the newest file removed is kept as the checkpoint that verify checks the first line left against.
+// Pruning stops at a file that is still being compressed, as the newer files after it must be kept for the checkpoint to be the line before the oldest file left.
+func (j *journal) Prune(r retention) (int, error) {
+	paths, err := j.files()
+	if err != nil {
+		return 0, err
+	}
+	paths = paths[:len(paths)-1]
+
+	type rotatedFile struct {
+		path string
+		info os.FileInfo
+	}
+	var files []rotatedFile
+	var total int64
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, err
+		}
+		files = append(files, rotatedFile{path, info})
+		total += info.Size()
+	}
+
+	n := 0
+	cutoff := r.cutoff()
+	for _, f := range files {
+		tooOld := !cutoff.IsZero() && f.info.ModTime().Before(cutoff)
+		tooBig := r.MaxJournalBytes > 0 && total > r.MaxJournalBytes
+		if !tooOld && !tooBig {
+			break
+		}
+		removed, err := j.pruneFile(f.path)
+		if err != nil || !removed {
+			return n, err
+		}
+		total -= f.info.Size()
+		n++
+	}
+	return n, nil
+}
+
+// compressingWindow is how recently a rotated file's .gz.tmp file must have been written to for it to be taken as being compressed by another process, rather than left by one that stopped while compressing.
+const compressingWindow = time.Minute
+
+// pruneFile removes a rotated journal file and writes its last line as the checkpoint, unless it is being compressed.
+// It holds the journal's lock, so that the file cannot start being compressed while it is removed.
+func (j *journal) pruneFile(path string) (bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.compressing[path] {
+		return false, nil
+	}
+	// The journal may be rotated by a watcher while the prune subcommand runs.
+	if info, err := os.Stat(path + compressingSuffix); err == nil && time.Since(info.ModTime()) < compressingWindow {
+		return false, nil
+	}
+	// The last line of a hash-chained file is kept as the checkpoint, which the first line left follows.
+	last, err := lastJournalLine(path)
+	if err != nil {
+		return false, err
+	}
+	if err := os.Remove(path); err != nil {
+		return false, err
+	}
+	if err := j.writeCheckpoint(last); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// retentionFlags adds the retention flags to a flag set.
+func retentionFlags(flags *flag.FlagSet) *retention {
+	r := &retention{}
+	flags.DurationVar(&r.MaxAge, "retention", 0, "age after which stored events and rotated journal files are pruned (0 for no limit)")
+	flags.IntVar(&r.MaxEvents, "retention-events", 0, "number of events kept in the store, pruning the oldest first (0 for no limit)")
+	flags.Var((*megabytes)(&r.MaxJournalBytes), "retention-journal-size", "total size in megabytes of rotated journal files kept, pruning the oldest first (0 for no limit)")
+	return r
+}
+
+// megabytes is a flag value that is given in megabytes and stored in bytes.
+type megabytes int64
+
+// String returns the value in megabytes.
+func (m *megabytes) String() string {
+	return strconv.FormatInt(int64(*m)/(1024*1024), 10)
+}
+
+// Set parses a value in megabytes.
+func (m *megabytes) Set(s string) error {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*m = megabytes(n * 1024 * 1024)
+	return nil
+}
+
+// pruneMain runs the prune subcommand, which prunes the history stores once and exits.
+func pruneMain(args []string) {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	storeURL := flags.String("store", "", "URL of the store to prune")
+	journalPath := flags.String("journal", "", "path of the journal file whose rotated files should be pruned")
+	r := retentionFlags(flags)
+	flags.Parse(args)
+
+	pruners := make(map[string]pruner)
+	if *storeURL != "" {
+		store, err := openStore(*storeURL)
+		if err != nil {
+			panic(err.Error())
+		}
+		defer store.Close()
+		pruners["store"] = store
+	}
+	if *journalPath != "" {
+		pruners["journal"] = &journal{path: *journalPath}
+	}
+	if len(pruners) == 0 {
+		fmt.Fprintln(os.Stderr, "prune: -store or -journal is required")
+		flags.Usage()
+		os.Exit(2)
+	}
+	prune(pruners, *r)
+}
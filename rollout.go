@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// workloadImages is the images of the newest pod seen for a workload.
+type workloadImages struct {
+	created time.Time
+	images  map[string]string // Container name -> image.
+}
+
+// rolloutTracker sends an event when a workload creates a pod with different images from its previous pods, which narrates rollouts.
+// Only the newest pod of each workload is compared with, so that old pods that are still running during a rollout do not cause events.
+type rolloutTracker struct {
+	started time.Time
+
+	mu        sync.Mutex
+	workloads map[workloadKey]workloadImages
+}
+
+// rollouts tracks the images of each workload.
+var rollouts = &rolloutTracker{started: time.Now(), workloads: make(map[workloadKey]workloadImages)}
+
+// podImages returns the image of each of a pod's containers.
+func podImages(pod *v1.Pod) map[string]string {
+	images := make(map[string]string)
+	for _, c := range containers(pod) {
+		images[c.Name] = c.Image
+	}
+	return images
+}
+
+// observe records the images of a created pod, returning an event if they differ from the previous pods of its workload.
+// Pods that existed before the watcher started only record their images, as the order they are listed in is not the order they were created in.
+func (r *rolloutTracker) observe(e event) (event, bool) {
+	if e.Type != eventCreated || metav1.GetControllerOf(e.Pod) == nil {
+		return event{}, false
+	}
+	key := workloadKey{cluster: e.cluster(), namespace: e.Namespace, workload: workload(e.Pod)}
+	created := e.Pod.CreationTimestamp.Time
+	images := podImages(e.Pod)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous, ok := r.workloads[key]
+	if ok && created.Before(previous.created) {
+		return event{}, false
+	}
+	r.workloads[key] = workloadImages{created: created, images: images}
+	if !ok || created.Before(r.started) {
+		return event{}, false
+	}
+	changes := imageChanges(previous.images, images)
+	if len(changes) == 0 {
+		return event{}, false
+	}
+	return event{
+		Cluster:   key.cluster,
+		Type:      eventImageChanged,
+		Time:      e.Time,
+		Namespace: e.Namespace,
+		Pod:       e.Pod,
+		Message:   fmt.Sprintf("%s: %s", workload(e.Pod), strings.Join(changes, ", ")),
+		ctx:       e.ctx,
+	}, true
+}
+
+// forgetCluster removes the workloads of a cluster that is no longer watched.
+func (r *rolloutTracker) forgetCluster(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.workloads {
+		if key.cluster == name {
+			delete(r.workloads, key)
+		}
+	}
+}
+
+// imageChanges describes the differences between two sets of container images, e.g. "app nginx:1.24 -> nginx:1.25".
+func imageChanges(old, new map[string]string) []string {
+	var changes []string
+	for _, c := range sortedKeys(new) {
+		switch image, ok := old[c]; {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("%s added with %s", c, new[c]))
+		case image != new[c]:
+			changes = append(changes, fmt.Sprintf("%s %s -> %s", c, image, new[c]))
+		}
+	}
+	for _, c := range sortedKeys(old) {
+		if _, ok := new[c]; !ok {
+			changes = append(changes, c+" removed")
+		}
+	}
+	return changes
+}
+
+// sortedKeys returns the keys of a map in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
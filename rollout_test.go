@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRolloutPerCluster(t *testing.T) {
+	r := &rolloutTracker{started: time.Now().Add(-time.Hour), workloads: make(map[workloadKey]workloadImages)}
+	controller := true
+	pod := func(image string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "web-" + image,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Now(),
+				OwnerReferences:   []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-1", Controller: &controller}},
+			},
+			Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: image}}},
+		}
+	}
+	if e, ok := r.observe(clusterEvent("prod", eventCreated, pod("web:1"))); ok {
+		t.Fatalf("got %s, want the first pod only recorded", e.summary())
+	}
+	if e, ok := r.observe(clusterEvent("staging", eventCreated, pod("web:2"))); ok {
+		t.Fatalf("got %s, want a different image in another cluster not to be a rollout", e.summary())
+	}
+	e, ok := r.observe(clusterEvent("prod", eventCreated, pod("web:3")))
+	if !ok || e.Cluster != "prod" || e.Message == "" {
+		t.Fatalf("got %v in %q, want an image change in prod", ok, e.Cluster)
+	}
+}
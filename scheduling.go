@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	v1 "k8s.io/api/core/v1"
+)
+
+// schedulingLatencyHistogram records the time from a pod being created to it being scheduled to a node.
+var schedulingLatencyHistogram, _ = meter.Float64Histogram("pod_event_watcher.pod.scheduling.latency",
+	metric.WithDescription("Time from pod creation to the pod being scheduled."),
+	metric.WithUnit("s"),
+	metric.WithExplicitBucketBoundaries(0.1, 0.5, 1, 2, 5, 10, 30, 60, 300, 600))
+
+// logScheduling enables a log line for each pod that is scheduled.
+var logScheduling bool
+
+// podScheduled reports whether a pod's PodScheduled condition is true.
+func podScheduled(pod *v1.Pod) bool {
+	c := podCondition(pod, v1.PodScheduled)
+	return c != nil && c.Status == v1.ConditionTrue
+}
+
+// observeScheduling records the scheduling latency if a pod has just been scheduled.
+func observeScheduling(e event, oldPod *v1.Pod) {
+	if e.Type != eventUpdated || podScheduled(oldPod) || !podScheduled(e.Pod) {
+		return
+	}
+	latency := podCondition(e.Pod, v1.PodScheduled).LastTransitionTime.Sub(e.Pod.CreationTimestamp.Time)
+	schedulingLatencyHistogram.Record(e.context(), latency.Seconds(), metric.WithAttributes(
+		attribute.String("cluster", e.cluster()),
+		attribute.String("namespace", e.Namespace),
+	))
+	if logScheduling {
+		log.Printf("%sPod scheduled: %s on %s after %s\n", clusterPrefix(e.cluster()), e.Pod.Name, e.Pod.Spec.NodeName, latency.Round(time.Second))
+	}
+}
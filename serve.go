@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// serveMain serves the API and dashboard for the events recorded by a watcher in a store or journal, without watching a cluster.
+// There are no pods in the cache, so only the history can be queried.
+func serveMain(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("admin-addr", "localhost:9090", "address to serve the API and dashboard on, either host:port or unix:/path/to/socket")
+	storeURL := flags.String("store", "", "URL of the store of events to serve")
+	journalPath := flags.String("journal", "", "path of the journal file of events to serve to Server-Sent Events clients that resume from an event ID")
+	serverFlags := addServerAuthFlags(flags)
+	flags.Parse(args)
+
+	if *storeURL == "" && *journalPath == "" {
+		fmt.Fprintln(os.Stderr, "serve: -store or -journal is required")
+		flags.Usage()
+		os.Exit(2)
+	}
+	var history historyStore
+	if *storeURL != "" {
+		var err error
+		if history, err = openStore(*storeURL); err != nil {
+			panic(err.Error())
+		}
+		defer history.Close()
+	}
+	var j *journal
+	if *journalPath != "" {
+		j = &journal{path: *journalPath}
+	}
+	go events.run()
+
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	mux := http.NewServeMux()
+	registerAdmin(mux, store)
+	registerAPI(mux, store, history)
+	registerWebSocket(mux)
+	registerSSE(mux, j)
+	registerGraphQL(mux, store, history)
+	registerDashboard(mux)
+	auth, err := serverFlags.newServerAuth()
+	if err != nil {
+		panic(err.Error())
+	}
+	listener, err := auth.listen(*addr)
+	if err != nil {
+		panic(err.Error())
+	}
+	log.Printf("Serving on %s\n", *addr)
+	log.Fatal(http.Serve(listener, auth.handler(mux)))
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// serverAuthFlags are the flags for securing the admin server (the API, WebSocket, Server-Sent Events, GraphQL and dashboard), the gRPC event stream and the audit webhook, which are shared with the serve subcommand.
+type serverAuthFlags struct {
+	certFile     *string
+	keyFile      *string
+	clientCAFile *string
+	tokenFile    *string
+}
+
+// addServerAuthFlags adds the flags for securing the servers to a flag set.
+func addServerAuthFlags(flags *flag.FlagSet) *serverAuthFlags {
+	f := &serverAuthFlags{}
+
+	// Optional TLS, with client certificates, for the admin, gRPC and audit webhook servers.
+	f.certFile = flags.String("tls-cert-file", "", "path to a PEM certificate to serve the admin, gRPC and audit webhook servers over TLS with, which is loaded again when the file changes")
+	f.keyFile = flags.String("tls-key-file", "", "path to the PEM private key of -tls-cert-file")
+	f.clientCAFile = flags.String("tls-client-ca-file", "", "path to a PEM file of the certificate authorities that the admin, gRPC and audit webhook servers' clients must have a certificate from (mutual TLS)")
+
+	// Optional bearer tokens for the admin, gRPC and audit webhook servers.
+	f.tokenFile = flags.String("auth-token-file", "", "path to a file of bearer tokens, one per line, one of which the admin, gRPC and audit webhook servers' clients must send in their Authorization header")
+	return f
+}
+
+// serverAuth secures the servers that serve pod data with TLS, client certificates and bearer tokens, as configured.
+type serverAuth struct {
+	tls    *tls.Config
+	tokens [][]byte
+}
+
+// newServerAuth creates the security for the servers from the flags. It is nil if none of them are given, so that the servers are served as before.
+func (f *serverAuthFlags) newServerAuth() (*serverAuth, error) {
+	if *f.certFile == "" && *f.keyFile == "" && *f.clientCAFile == "" && *f.tokenFile == "" {
+		return nil, nil
+	}
+	a := &serverAuth{}
+	if *f.certFile != "" || *f.keyFile != "" {
+		if *f.certFile == "" || *f.keyFile == "" {
+			return nil, fmt.Errorf("-tls-cert-file and -tls-key-file must be given together")
+		}
+		certs := &certificateLoader{certFile: *f.certFile, keyFile: *f.keyFile}
+		if _, err := certs.load(); err != nil {
+			return nil, err
+		}
+		a.tls = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return certs.load()
+			},
+		}
+	}
+	if *f.clientCAFile != "" {
+		if a.tls == nil {
+			return nil, fmt.Errorf("-tls-client-ca-file needs -tls-cert-file and -tls-key-file")
+		}
+		data, err := os.ReadFile(*f.clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s: no PEM certificates", *f.clientCAFile)
+		}
+		a.tls.ClientCAs, a.tls.ClientAuth = pool, tls.RequireAndVerifyClientCert
+	}
+	if *f.tokenFile != "" {
+		var err error
+		if a.tokens, err = readTokens(*f.tokenFile); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// readTokens reads a file of bearer tokens, one per line, ignoring blank lines and lines starting with #.
+func readTokens(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var tokens [][]byte
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, []byte(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s: no tokens", path)
+	}
+	return tokens, nil
+}
+
+// listen listens on an address as the top-level listen does, with TLS if it is configured.
+// A nil serverAuth listens without TLS.
+func (a *serverAuth) listen(addr string) (net.Listener, error) {
+	listener, err := listen(addr)
+	if err != nil || a == nil || a.tls == nil {
+		return listener, err
+	}
+	return tls.NewListener(listener, a.tls), nil
+}
+
+// handler returns a handler that only passes on the requests with one of the bearer tokens, if there are any.
+func (a *serverAuth) handler(h http.Handler) http.Handler {
+	if a == nil || len(a.tokens) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.validToken(r.Header.Get("Authorization")) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pod-event-watcher"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// authenticatesClients reports whether the clients are authenticated, with client certificates or bearer tokens.
+func (a *serverAuth) authenticatesClients() bool {
+	return a != nil && (len(a.tokens) > 0 || a.tls != nil && a.tls.ClientCAs != nil)
+}
+
+// authorized reports whether a request has a verified client certificate or one of the bearer tokens.
+// It is used on the admission webhook's server, which cannot require client certificates, as the API server does not send them to admission webhooks unless configured to.
+func (a *serverAuth) authorized(r *http.Request) bool {
+	if a == nil {
+		return false
+	}
+	if a.tls != nil && a.tls.ClientCAs != nil && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	return len(a.tokens) > 0 && a.validToken(r.Header.Get("Authorization"))
+}
+
+// validToken reports whether an Authorization header has one of the bearer tokens, comparing it with each in constant time.
+func (a *serverAuth) validToken(header string) bool {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return false
+	}
+	valid := 0
+	for _, t := range a.tokens {
+		valid |= subtle.ConstantTimeCompare([]byte(token), t)
+	}
+	return valid == 1
+}
+
+// grpcOptions returns the options for a gRPC server: TLS, and interceptors that check the bearer token in each call's authorization metadata.
+// The server is given the TLS configuration rather than a TLS listener, so that gRPC knows the connection is secure.
+func (a *serverAuth) grpcOptions() []grpc.ServerOption {
+	if a == nil {
+		return nil
+	}
+	var opts []grpc.ServerOption
+	if a.tls != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(a.tls)))
+	}
+	if len(a.tokens) > 0 {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if err := a.authorizeCall(ctx); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := a.authorizeCall(ss.Context()); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}),
+		)
+	}
+	return opts
+}
+
+// authorizeCall checks the bearer token of a gRPC call.
+func (a *serverAuth) authorizeCall(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, header := range md.Get("authorization") {
+		if a.validToken(header) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "a valid bearer token is required")
+}
+
+// certificateLoader loads a certificate and key, loading them again when the certificate file changes, so that certificates renewed by e.g. cert-manager are served without a restart.
+type certificateLoader struct {
+	certFile, keyFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// load returns the certificate, loading it if the file has changed since it was last loaded.
+// If a changed certificate cannot be loaded, e.g. because only one of the files has been written so far, the previous one is returned.
+func (l *certificateLoader) load() (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	info, err := os.Stat(l.certFile)
+	if err != nil {
+		if l.cert != nil {
+			return l.cert, nil
+		}
+		return nil, err
+	}
+	if l.cert != nil && info.ModTime().Equal(l.modified) {
+		return l.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		if l.cert != nil {
+			return l.cert, nil
+		}
+		return nil, err
+	}
+	l.cert, l.modified = &cert, info.ModTime()
+	return l.cert, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// severity is how urgent an event is, so that routine churn can go to the logs while only critical conditions page anyone.
+type severity string
+
+const (
+	severityInfo     severity = "info"
+	severityWarning  severity = "warning"
+	severityCritical severity = "critical"
+)
+
+// severities are the severities from the least to the most urgent.
+var severities = []severity{severityInfo, severityWarning, severityCritical}
+
+// typeSeverities are the severities of the event types that are not info, before any rules are applied.
+var typeSeverities = map[eventType]severity{
+	eventContainerRestarted: severityWarning,
+	eventPendingTooLong:     severityWarning,
+	eventReadinessFlapping:  severityWarning,
+	eventProbeFailed:        severityWarning,
+	eventSchedulingFailed:   severityWarning,
+	eventUnrestricted:       severityWarning,
+	eventRateExceeded:       severityWarning,
+	eventAnomaly:            severityWarning,
+
+	eventOOMKilled:          severityCritical,
+	eventCrashLoop:          severityCritical,
+	eventOrphaned:           severityCritical,
+	eventClusterUnreachable: severityCritical,
+	eventCredentialsExpired: severityCritical,
+}
+
+// rank returns the position of a severity from the least urgent, or -1 if it is not known.
+func (s severity) rank() int {
+	for i, known := range severities {
+		if s == known {
+			return i
+		}
+	}
+	return -1
+}
+
+// atLeast reports whether a severity is as urgent as another.
+func (s severity) atLeast(min severity) bool {
+	return s.rank() >= min.rank()
+}
+
+// validSeverity reports whether s is a known severity.
+func validSeverity(s severity) bool {
+	return s.rank() >= 0
+}
+
+// defaultSeverity returns the severity of an event from its type and what was detected about its pod: a pod that failed or was evicted is a warning, and an SLO report that names any workloads is a warning.
+func defaultSeverity(e event) severity {
+	if s, ok := typeSeverities[e.Type]; ok {
+		return s
+	}
+	switch {
+	case e.Type == eventSLOReport && len(e.SLOs) > 0:
+		return severityWarning
+	case (e.Type == eventUpdated || e.Type == eventDeleted) && e.Pod != nil && e.Pod.Status.Phase == v1.PodFailed:
+		return severityWarning
+	}
+	return severityInfo
+}
+
+// severity returns the severity of an event, which is set by the classifier on the bus, or is the default for events that did not go through the bus, such as those read from an old journal.
+func (e event) severity() severity {
+	if e.Severity != "" {
+		return e.Severity
+	}
+	return defaultSeverity(e)
+}
+
+// severityRules is the contents of the -severity-rules file.
+//
+// Example:
+//
+//	rules:
+//	# Crash loops in the batch namespace only need looking at in working hours.
+//	- match:
+//	    events: [crash-loop, oom-killed]
+//	    namespaces: [batch]
+//	  severity: warning
+//	# Anything wrong with the payments pods pages someone.
+//	- match:
+//	    selector: app=payments
+//	    severity: warning
+//	  severity: critical
+//	- match:
+//	    events: [probe-failed]
+//	  message: "Liveness probe"
+//	  severity: critical
+type severityRules struct {
+	Rules []severityRule `json:"rules"`
+}
+
+// severityRule sets the severity of the events that it matches. The first rule that matches an event decides its severity, and events that no rule matches keep their default severity.
+type severityRule struct {
+	// Match selects the events by type, namespace, pod labels and default severity, as a sink's filter does.
+	Match filter `json:"match,omitempty"`
+	// Message is a regular expression that the event's message must match.
+	Message string `json:"message,omitempty"`
+	// Severity is the severity given to the events that the rule matches.
+	Severity severity `json:"severity"`
+
+	route   route
+	message *regexp.Regexp
+}
+
+// severityClassifier sets the severity of each event on the bus from its default severity and the rules.
+type severityClassifier struct {
+	rules []severityRule
+}
+
+// newSeverityClassifier creates a severity classifier with the rules in a YAML or JSON file, or with no rules if the path is empty.
+func newSeverityClassifier(path string) (*severityClassifier, error) {
+	c := &severityClassifier{}
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules severityRules
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i, rule := range rules.Rules {
+		if !validSeverity(rule.Severity) {
+			return nil, fmt.Errorf("%s: rule %d: severity must be info, warning or critical", path, i+1)
+		}
+		if rule.Match.Severity != "" && !validSeverity(rule.Match.Severity) {
+			return nil, fmt.Errorf("%s: rule %d: match severity must be info, warning or critical", path, i+1)
+		}
+		for _, t := range rule.Match.Events {
+			if !validEventType(t) {
+				return nil, fmt.Errorf("%s: rule %d: unknown event type %q", path, i+1, t)
+			}
+		}
+		selector, err := labels.Parse(rule.Match.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %v", path, i+1, err)
+		}
+		rule.route = route{filter: rule.Match, selector: selector}
+		if rule.Message != "" {
+			if rule.message, err = regexp.Compile(rule.Message); err != nil {
+				return nil, fmt.Errorf("%s: rule %d: %v", path, i+1, err)
+			}
+		}
+		c.rules = append(c.rules, rule)
+	}
+	return c, nil
+}
+
+// classify returns the severity of an event.
+func (c *severityClassifier) classify(e event) severity {
+	for _, rule := range c.rules {
+		if rule.route.matches(e) && (rule.message == nil || rule.message.MatchString(e.Message)) {
+			return rule.Severity
+		}
+	}
+	return defaultSeverity(e)
+}
+
+// apply sets the severity of an event for the bus.
+func (c *severityClassifier) apply(e event) (event, bool, error) {
+	e.Severity = c.classify(e)
+	return e, true, nil
+}
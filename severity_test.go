@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// writeSeverityRules writes a -severity-rules file, returning its path.
+func writeSeverityRules(t *testing.T, rules string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "severity.yaml")
+	if err := os.WriteFile(path, []byte(rules), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// labelledPod returns a pod with labels and a phase.
+func labelledPod(phase v1.PodPhase, labels map[string]string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: labels}, Status: v1.PodStatus{Phase: phase}}
+}
+
+func TestSeverityClassifier(t *testing.T) {
+	c, err := newSeverityClassifier(writeSeverityRules(t, `
+rules:
+- match:
+    events: [crash-loop, oom-killed]
+    namespaces: [batch]
+  severity: warning
+- match:
+    selector: app=payments
+    severity: warning
+  severity: critical
+- match:
+    events: [probe-failed]
+  message: "Liveness probe"
+  severity: critical
+- match:
+    events: [created]
+    namespaces: [batch]
+  severity: critical
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payments := labelledPod(v1.PodRunning, map[string]string{"app": "payments"})
+	tests := []struct {
+		name string
+		e    event
+		want severity
+	}{
+		{"created", event{Type: eventCreated, Namespace: "default"}, severityInfo},
+		{"restarted", event{Type: eventContainerRestarted, Namespace: "default"}, severityWarning},
+		{"crash loop", event{Type: eventCrashLoop, Namespace: "default"}, severityCritical},
+		{"failed pod", event{Type: eventUpdated, Namespace: "default", Pod: labelledPod(v1.PodFailed, nil)}, severityWarning},
+		{"SLO report without workloads", event{Type: eventSLOReport}, severityInfo},
+		{"crash loop lowered by namespace", event{Type: eventCrashLoop, Namespace: "batch"}, severityWarning},
+		{"created raised by namespace", event{Type: eventCreated, Namespace: "batch"}, severityCritical},
+		{"warning raised by selector", event{Type: eventContainerRestarted, Namespace: "default", Pod: payments}, severityCritical},
+		{"info not raised by selector", event{Type: eventCreated, Namespace: "default", Pod: payments}, severityInfo},
+		{"first rule that matches", event{Type: eventCrashLoop, Namespace: "batch", Pod: payments}, severityWarning},
+		{"message matching", event{Type: eventProbeFailed, Namespace: "default", Message: "Liveness probe failed: timeout"}, severityCritical},
+		{"message not matching", event{Type: eventProbeFailed, Namespace: "default", Message: "Readiness probe failed: timeout"}, severityWarning},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := c.classify(test.e); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+			e, keep, err := c.apply(test.e)
+			if err != nil || !keep || e.Severity != test.want || e.severity() != test.want {
+				t.Errorf("got %q, %v, %v from apply, want the event kept as %s", e.Severity, keep, err, test.want)
+			}
+		})
+	}
+}
+
+func TestSeverityClassifierErrors(t *testing.T) {
+	tests := []struct {
+		name, rules, want string
+	}{
+		{"unknown severity", "rules:\n- severity: urgent\n", "rule 1: severity must be"},
+		{"unknown match severity", "rules:\n- match:\n    severity: urgent\n  severity: info\n", "rule 1: match severity must be"},
+		{"unknown event type", "rules:\n- severity: info\n- match:\n    events: [exploded]\n  severity: info\n", `rule 2: unknown event type "exploded"`},
+		{"invalid selector", "rules:\n- match:\n    selector: 'app in ('\n  severity: info\n", "rule 1:"},
+		{"invalid message", "rules:\n- message: '('\n  severity: info\n", "rule 1:"},
+		{"unknown field", "rules:\n- severity: info\n  priority: 1\n", "priority"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := newSeverityClassifier(writeSeverityRules(t, test.rules)); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error with %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestSeverityAtLeast(t *testing.T) {
+	tests := []struct {
+		s, min severity
+		want   bool
+	}{
+		{severityInfo, severityInfo, true},
+		{severityInfo, severityWarning, false},
+		{severityWarning, severityInfo, true},
+		{severityCritical, severityWarning, true},
+		{severityWarning, severityCritical, false},
+	}
+	for _, test := range tests {
+		if got := test.s.atLeast(test.min); got != test.want {
+			t.Errorf("got %s at least %s %v, want %v", test.s, test.min, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// shard watches the pods in one of the namespaces given by the -namespace flag in one cluster, with its own informers.
+// Each shard lists and watches independently, so a namespace that cannot be watched, e.g. because the watcher does not have permission, does not stop the others.
+type shard struct {
+	cluster   string
+	namespace string
+	factory   informers.SharedInformerFactory
+	watcher   *watcher.Watcher
+	lw        *activityListWatch
+	// networkPolicies is the cache of the NetworkPolicies in the shard's namespace with -network-policies, and is otherwise nil.
+	networkPolicies cache.Indexer
+	// disruptionBudgets is the cache of the PodDisruptionBudgets in the shard's namespace with -watch-disruption-budgets, and is otherwise nil.
+	disruptionBudgets cache.Indexer
+
+	mu          sync.Mutex
+	lastErr     error
+	lastErrTime time.Time
+}
+
+// shardStatus is the sync status of a shard, as reported by the /stats admin endpoint.
+type shardStatus struct {
+	Cluster       string     `json:"cluster,omitempty"`
+	Namespace     string     `json:"namespace"`
+	Synced        bool       `json:"synced"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// newShards creates a shard in a cluster for each namespace in a comma-separated list, or one for all namespaces if it is empty.
+// With a single namespace the shard uses factory, so that its informers are shared with the nodes; otherwise each shard has a factory of its own for its events.
+func newShards(cluster string, factory informers.SharedInformerFactory, namespaces string, newFactory func(namespace string) informers.SharedInformerFactory) []*shard {
+	list := splitList(namespaces)
+	switch len(list) {
+	case 0:
+		return []*shard{{cluster: cluster, namespace: metav1.NamespaceAll, factory: factory}}
+	case 1:
+		return []*shard{{cluster: cluster, namespace: list[0], factory: factory}}
+	}
+	shards := make([]*shard, len(list))
+	for i, namespace := range list {
+		shards[i] = &shard{cluster: cluster, namespace: namespace, factory: newFactory(namespace)}
+	}
+	return shards
+}
+
+// namespaced returns the objects in a namespace from the cache of the shard that watches it, given by indexer, which is nil for the shards without one.
+func (c *cluster) namespaced(namespace string, indexer func(*shard) cache.Indexer) []interface{} {
+	var objs []interface{}
+	for _, s := range c.shards {
+		i := indexer(s)
+		if i == nil || (s.namespace != metav1.NamespaceAll && s.namespace != namespace) {
+			continue
+		}
+		if found, err := i.ByIndex(cache.NamespaceIndex, namespace); err == nil {
+			objs = append(objs, found...)
+		}
+	}
+	return objs
+}
+
+// name describes the shard's namespace and cluster for messages.
+func (s *shard) name() string {
+	return shardName(s.cluster, s.namespace)
+}
+
+// shardName describes the pods in a namespace of a cluster, e.g. "production in prod-eu".
+func shardName(cluster, namespace string) string {
+	name := namespace
+	if namespace == metav1.NamespaceAll {
+		name = "all namespaces"
+	}
+	if cluster != "" {
+		name += " in " + cluster
+	}
+	return name
+}
+
+// watchError records a failure to list or watch the pods in the shard's namespace.
+func (s *shard) watchError(err error) {
+	debugf(1, debugInformer, "error listing or watching the pods in %s: %v\n", s.name(), err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr, s.lastErrTime = err, time.Now()
+}
+
+// logSync logs a debug message once the initial list of the shard's pods has been added to the cache.
+func (s *shard) logSync(ctx context.Context) {
+	if verbosity < 1 {
+		return
+	}
+	start := time.Now()
+	if cache.WaitForCacheSync(ctx.Done(), s.watcher.HasSynced) {
+		debugf(1, debugInformer, "synced %d pods in %s after %s\n", len(s.watcher.Store().ListKeys()), s.name(), time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// status returns the shard's sync status and the last error listing or watching its pods.
+func (s *shard) status() shardStatus {
+	status := shardStatus{Cluster: s.cluster, Namespace: s.namespace, Synced: s.watcher.HasSynced()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastErr != nil {
+		t := s.lastErrTime
+		status.LastError, status.LastErrorTime = s.lastErr.Error(), &t
+	}
+	return status
+}
+
+// startShardInformers starts the informers of each shard's factory concurrently, and waits until their caches have been filled or timed out.
+// The informers run until stop is closed.
+func startShardInformers(shards []*shard, stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, s := range shards {
+		wg.Add(1)
+		go func(s *shard) {
+			defer wg.Done()
+			startInformers(s.factory, stop)
+		}(s)
+	}
+	wg.Wait()
+}
+
+// podStore returns the cache of pods for all of the shards returned by a function, which can change as clusters are added and removed.
+func podStore(shards func() []*shard) cache.Store {
+	return shardedStore(shards)
+}
+
+// errReadOnlyStore is returned by the methods of a shardedStore that would change it.
+var errReadOnlyStore = errors.New("the cache of pods is read only")
+
+// shardedStore is a read-only view of the caches of several shards as one cache.
+// When several clusters have a pod with the same namespace and name, only the first is found by Get and GetByKey.
+type shardedStore func() []*shard
+
+// List returns the pods in every shard.
+func (s shardedStore) List() []interface{} {
+	var objs []interface{}
+	for _, shard := range s() {
+		objs = append(objs, shard.watcher.Store().List()...)
+	}
+	return objs
+}
+
+// ListKeys returns the keys of the pods in every shard.
+func (s shardedStore) ListKeys() []string {
+	var keys []string
+	for _, shard := range s() {
+		keys = append(keys, shard.watcher.Store().ListKeys()...)
+	}
+	return keys
+}
+
+// Get returns the cached version of a pod.
+func (s shardedStore) Get(obj interface{}) (interface{}, bool, error) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return nil, false, err
+	}
+	return s.GetByKey(key)
+}
+
+// GetByKey returns the pod with a namespace/name key from the first shard watching its namespace that has it.
+func (s shardedStore) GetByKey(key string) (interface{}, bool, error) {
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, shard := range s() {
+		if shard.namespace != namespace && shard.namespace != metav1.NamespaceAll {
+			continue
+		}
+		if obj, ok, err := shard.watcher.Store().GetByKey(key); err != nil || ok {
+			return obj, ok, err
+		}
+	}
+	return nil, false, nil
+}
+
+// Add returns errReadOnlyStore.
+func (s shardedStore) Add(obj interface{}) error { return errReadOnlyStore }
+
+// Update returns errReadOnlyStore.
+func (s shardedStore) Update(obj interface{}) error { return errReadOnlyStore }
+
+// Delete returns errReadOnlyStore.
+func (s shardedStore) Delete(obj interface{}) error { return errReadOnlyStore }
+
+// Replace returns errReadOnlyStore.
+func (s shardedStore) Replace(objs []interface{}, resourceVersion string) error {
+	return errReadOnlyStore
+}
+
+// Resync returns errReadOnlyStore.
+func (s shardedStore) Resync() error { return errReadOnlyStore }
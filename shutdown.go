@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shutdownGrace is the time allowed for closing a sink whose queued events are still being delivered, set by -shutdown-timeout.
+var shutdownGrace = 30 * time.Second
+
+// watchersRunning counts the pod watchers that are running, which shutdown waits for, so that the events they handle after the watch has stopped are delivered.
+var watchersRunning sync.WaitGroup
+
+// shutdownAt is the time in nanoseconds by which shutdown must finish, or 0 if the watcher is not shutting down.
+var shutdownAt int64
+
+// closeDeadline returns the time by which a sink that is being closed must have delivered its queued events: the end of the grace period when shutting down, or shutdownGrace from now when the sink is replaced by a configuration reload.
+func closeDeadline() time.Time {
+	if at := atomic.LoadInt64(&shutdownAt); at != 0 {
+		return time.Unix(0, at)
+	}
+	return time.Now().Add(shutdownGrace)
+}
+
+// shutdown sends the events that have been published but not yet delivered, and closes the sinks, e.g. to flush the journal and upload the current archive batch.
+// It returns false if this takes longer than the grace period, in which case the remaining events are lost.
+func shutdown(grace time.Duration) bool {
+	atomic.StoreInt64(&shutdownAt, time.Now().Add(grace).UnixNano())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchersRunning.Wait()
+		if debounce != nil {
+			debounce.flushAll()
+		}
+		events.drain()
+		if deadLetters != nil {
+			if err := deadLetters.Close(); err != nil {
+				log.Printf("Dead-letter error: %v\n", err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(grace):
+		log.Printf("Shutdown error: events were still being delivered after %s\n", grace)
+		return false
+	}
+}
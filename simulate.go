@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	// simulatedCluster is the name of the cluster watched with -simulate.
+	simulatedCluster = "simulated"
+	// simulatedGracePeriod is the grace period of the simulated pods' deletions.
+	simulatedGracePeriod = 30
+)
+
+// simulatedWorkload is a workload whose pods are simulated.
+type simulatedWorkload struct {
+	namespace string
+	name      string
+	image     string
+}
+
+// simulatedWorkloads are the workloads that the simulated pods are created for.
+var simulatedWorkloads = []simulatedWorkload{
+	{"default", "web", "nginx:1.25"},
+	{"default", "api", "ghcr.io/example/api:2.4.1"},
+	{"production", "checkout", "ghcr.io/example/checkout:1.9.0"},
+	{"production", "worker", "ghcr.io/example/worker:3.0.2"},
+	{"staging", "batch", "ghcr.io/example/batch:0.7.3"},
+}
+
+// simulator creates pods in a fake clientset and takes each one through a realistic lifecycle (created, scheduled, running, sometimes crashing or OOM killed, terminating and deleted), so that the watcher and its sinks can be tried out and load tested without a cluster.
+// The pods are watched through the fake clientset like any other cluster's, so each change goes through the same handlers, trackers and sinks.
+type simulator struct {
+	clientset kubernetes.Interface
+	// resourceVersion numbers the changes to the pods, as the fake clientset does not, so that they are not mistaken for resyncs.
+	resourceVersion int64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// newSimulatedCluster creates the cluster watched with -simulate, and the simulator that creates its pods.
+func newSimulatedCluster() (*cluster, *simulator) {
+	clientset := fake.NewSimpleClientset()
+	return newClusterForClientset(simulatedCluster, clientset), newSimulator(clientset, time.Now().UnixNano())
+}
+
+// newSimulator creates a simulator for the pods in a clientset, whose random choices are made from a seed.
+func newSimulator(clientset kubernetes.Interface, seed int64) *simulator {
+	return &simulator{clientset: clientset, rand: rand.New(rand.NewSource(seed))}
+}
+
+// run creates pods at a rate of pods per second until the context is done.
+func (s *simulator) run(ctx context.Context, rate float64) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			go s.lifecycle(ctx)
+		}
+	}
+}
+
+// lifecycle creates a pod and changes it through each stage of its life, pausing between the stages, until it is deleted.
+func (s *simulator) lifecycle(ctx context.Context) {
+	pod, steps := s.plan()
+	pods := s.clientset.CoreV1().Pods(pod.Namespace)
+	created, err := pods.Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		log.Printf("%sSimulation error: %v\n", clusterPrefix(simulatedCluster), err)
+		return
+	}
+	pod = created
+	for _, step := range steps {
+		if !s.pause(ctx) {
+			return
+		}
+		pod = pod.DeepCopy()
+		step(pod)
+		pod.ResourceVersion = s.nextResourceVersion()
+		if pod, err = pods.Update(ctx, pod, metav1.UpdateOptions{}); err != nil {
+			log.Printf("%sSimulation error: %v\n", clusterPrefix(simulatedCluster), err)
+			return
+		}
+	}
+	if !s.pause(ctx) {
+		return
+	}
+	if err := pods.Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil {
+		log.Printf("%sSimulation error: %v\n", clusterPrefix(simulatedCluster), err)
+	}
+}
+
+// plan returns a new pending pod of a random workload, and the changes to make to it before it is deleted.
+func (s *simulator) plan() (*v1.Pod, []func(*v1.Pod)) {
+	pod := s.newPod(simulatedWorkloads[s.intn(len(simulatedWorkloads))])
+	steps := []func(*v1.Pod){s.schedule, s.start}
+	switch n := s.intn(100); {
+	case n < 10:
+		steps = []func(*v1.Pod){s.unschedulable}
+	case n < 25:
+		for i, crashes := 0, 1+s.intn(3); i < crashes; i++ {
+			steps = append(steps, s.crash("Error", 1), s.restart)
+		}
+		steps = append(steps, s.crash("Error", 1), s.backOff)
+	case n < 35:
+		steps = append(steps, s.crash("OOMKilled", 137), s.restart)
+	}
+	return pod, append(steps, s.terminate)
+}
+
+// newPod returns a pending pod of a workload, named like the pods of a Deployment's ReplicaSet.
+func (s *simulator) newPod(w simulatedWorkload) *v1.Pod {
+	hash := s.suffix(10)
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              w.name + "-" + hash + "-" + s.suffix(5),
+			Namespace:         w.namespace,
+			UID:               uuid.NewUUID(),
+			ResourceVersion:   s.nextResourceVersion(),
+			CreationTimestamp: metav1.Now(),
+			Labels:            map[string]string{"app": w.name, "pod-template-hash": hash},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1",
+				Kind:       "ReplicaSet",
+				Name:       w.name + "-" + hash,
+				UID:        types.UID(w.namespace + "-" + w.name),
+			}},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:  "app",
+				Image: w.image,
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m"), v1.ResourceMemory: resource.MustParse("128Mi")},
+					Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+				},
+			}},
+		},
+		Status: v1.PodStatus{Phase: v1.PodPending, QOSClass: v1.PodQOSBurstable},
+	}
+}
+
+// schedule assigns a pod to a node.
+func (s *simulator) schedule(pod *v1.Pod) {
+	pod.Spec.NodeName = fmt.Sprintf("node-%d", 1+s.intn(5))
+	setSimulatedCondition(pod, v1.PodScheduled, v1.ConditionTrue, "")
+}
+
+// unschedulable marks a pod as unable to be scheduled, as if no node has room for it.
+func (s *simulator) unschedulable(pod *v1.Pod) {
+	setSimulatedCondition(pod, v1.PodScheduled, v1.ConditionFalse, v1.PodReasonUnschedulable)
+}
+
+// start runs a scheduled pod's container, which becomes ready.
+func (s *simulator) start(pod *v1.Pod) {
+	now := metav1.Now()
+	pod.Status.Phase = v1.PodRunning
+	pod.Status.HostIP = "10.0.0." + strconv.Itoa(10+s.intn(5))
+	pod.Status.PodIP = fmt.Sprintf("10.244.%d.%d", s.intn(5), 2+s.intn(250))
+	pod.Status.StartTime = &now
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+		Name:    "app",
+		Image:   pod.Spec.Containers[0].Image,
+		ImageID: pod.Spec.Containers[0].Image,
+		State:   v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: now}},
+		Ready:   true,
+		Started: boolPtr(true),
+	}}
+	setSimulatedCondition(pod, v1.PodInitialized, v1.ConditionTrue, "")
+	setSimulatedCondition(pod, v1.ContainersReady, v1.ConditionTrue, "")
+	setSimulatedCondition(pod, v1.PodReady, v1.ConditionTrue, "")
+}
+
+// crash returns a step that stops a pod's container with a reason and exit code, making the pod not ready.
+func (s *simulator) crash(reason string, exitCode int32) func(*v1.Pod) {
+	return func(pod *v1.Pod) {
+		status := &pod.Status.ContainerStatuses[0]
+		var started metav1.Time
+		if status.State.Running != nil {
+			started = status.State.Running.StartedAt
+		}
+		status.State = v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+			ExitCode:   exitCode,
+			Reason:     reason,
+			StartedAt:  started,
+			FinishedAt: metav1.Now(),
+		}}
+		status.Ready = false
+		status.Started = boolPtr(false)
+		setSimulatedCondition(pod, v1.ContainersReady, v1.ConditionFalse, "ContainersNotReady")
+		setSimulatedCondition(pod, v1.PodReady, v1.ConditionFalse, "ContainersNotReady")
+	}
+}
+
+// restart runs a pod's stopped container again, which becomes ready.
+func (s *simulator) restart(pod *v1.Pod) {
+	status := &pod.Status.ContainerStatuses[0]
+	status.LastTerminationState = status.State
+	status.State = v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: metav1.Now()}}
+	status.RestartCount++
+	status.Ready = true
+	status.Started = boolPtr(true)
+	setSimulatedCondition(pod, v1.ContainersReady, v1.ConditionTrue, "")
+	setSimulatedCondition(pod, v1.PodReady, v1.ConditionTrue, "")
+}
+
+// backOff leaves a pod's stopped container waiting to be restarted, as the kubelet does once it has crashed repeatedly.
+func (s *simulator) backOff(pod *v1.Pod) {
+	status := &pod.Status.ContainerStatuses[0]
+	status.LastTerminationState = status.State
+	status.State = v1.ContainerState{Waiting: &v1.ContainerStateWaiting{
+		Reason:  "CrashLoopBackOff",
+		Message: fmt.Sprintf("back-off 40s restarting failed container=app pod=%s_%s(%s)", pod.Name, pod.Namespace, pod.UID),
+	}}
+	status.RestartCount++
+}
+
+// terminate requests the deletion of a pod, which is deleted after its next pause.
+func (s *simulator) terminate(pod *v1.Pod) {
+	grace := int64(simulatedGracePeriod)
+	deadline := metav1.NewTime(time.Now().Add(simulatedGracePeriod * time.Second))
+	pod.DeletionTimestamp = &deadline
+	pod.DeletionGracePeriodSeconds = &grace
+}
+
+// pause waits for a random time of up to 5 seconds between two stages of a pod's life, and returns false if the context is done first.
+func (s *simulator) pause(ctx context.Context) bool {
+	timer := time.NewTimer(time.Duration(500+s.intn(4500)) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// intn returns a random number from 0 to n-1.
+func (s *simulator) intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Intn(n)
+}
+
+// suffix returns n random characters of the kind used in generated names.
+func (s *simulator) suffix(n int) string {
+	const alphabet = "bcdfghjklmnpqrstvwxz2456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[s.intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+// nextResourceVersion returns the resource version for the next change to a pod.
+func (s *simulator) nextResourceVersion() string {
+	return strconv.FormatInt(atomic.AddInt64(&s.resourceVersion, 1), 10)
+}
+
+// setSimulatedCondition sets the status of one of a pod's conditions, adding it if the pod does not have it.
+func setSimulatedCondition(pod *v1.Pod, t v1.PodConditionType, status v1.ConditionStatus, reason string) {
+	now := metav1.Now()
+	for i := range pod.Status.Conditions {
+		if c := &pod.Status.Conditions[i]; c.Type == t {
+			if c.Status != status {
+				c.LastTransitionTime = now
+			}
+			c.Status, c.Reason = status, reason
+			return
+		}
+	}
+	pod.Status.Conditions = append(pod.Status.Conditions, v1.PodCondition{Type: t, Status: status, Reason: reason, LastTransitionTime: now})
+}
+
+// boolPtr returns a pointer to b.
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// sink delivers events to a destination such as the log or a webhook.
+// Send is called from the bus dispatcher, so implementations should not block for long.
+type sink interface {
+	Send(e event) error
+}
+
+// splitList converts a comma-separated list into a slice, ignoring empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// workload returns a "Kind/name" description of the controller that owns a pod, or the pod itself if it has no controller.
+// Pods owned by a ReplicaSet are described by the Deployment that owns the ReplicaSet, as the ReplicaSet changes with each rollout.
+func workload(pod *v1.Pod) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "Pod/" + pod.Name
+	}
+	if hash, ok := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok && owner.Kind == "ReplicaSet" {
+		if name := strings.TrimSuffix(owner.Name, "-"+hash); name != owner.Name {
+			return "Deployment/" + name
+		}
+	}
+	return owner.Kind + "/" + owner.Name
+}
+
+// metricWorkload returns the workload of a pod for use as a metric attribute.
+// Pods without a controller are all reported as "none" to avoid one time series per pod.
+func metricWorkload(pod *v1.Pod) string {
+	if metav1.GetControllerOf(pod) == nil {
+		return "none"
+	}
+	return workload(pod)
+}
+
+// podReason returns a short explanation of a pod's current state, taken from the pod status or the first container that is not running.
+func podReason(pod *v1.Pod) string {
+	if pod.Status.Reason != "" {
+		return pod.Status.Reason
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			return status.State.Waiting.Reason
+		}
+		if status.State.Terminated != nil && status.State.Terminated.Reason != "" {
+			return status.State.Terminated.Reason
+		}
+	}
+	return ""
+}
+
+// httpClient is used by all sinks that deliver over HTTP.
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON sends a payload to a URL as a JSON document.
+func postJSON(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return postBody(url, body, nil)
+}
+
+// postBody sends a JSON document to a URL with the given headers as well.
+func postBody(url string, body []byte, header http.Header) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("POST %s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// rateLimitedDrainTimeout is how long a rate limited sink that has run out of time to deliver its queued events waits for the event being sent, before closing the wrapped sink.
+const rateLimitedDrainTimeout = 5 * time.Second
+
+// rateLimitedSink wraps a sink so that events are delivered no faster than a given rate.
+// Events are buffered and delivered in the background; when the buffer is full, new events are dropped.
+type rateLimitedSink struct {
+	sink    sink
+	policy  retryPolicy
+	limiter *rate.Limiter
+	queue   chan event
+	done    chan struct{}
+	// ctx is cancelled when the sink is closed and the queued events were not delivered in time.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// newRateLimitedSink wraps a sink with a limit of perMinute deliveries per minute and starts the background sender, which retries and dead-letters the deliveries that fail with the policy of the sink's route.
+func newRateLimitedSink(s sink, perMinute int, policy retryPolicy) *rateLimitedSink {
+	r := &rateLimitedSink{
+		sink:    s,
+		policy:  policy,
+		limiter: rate.NewLimiter(rate.Limit(float64(perMinute)/60), 1),
+		queue:   make(chan event, 100),
+		done:    make(chan struct{}),
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	go r.run()
+	return r
+}
+
+// Send queues an event for delivery.
+func (r *rateLimitedSink) Send(e event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return fmt.Errorf("rate limited sink closed, dropping event %q", e.summary())
+	}
+	select {
+	case r.queue <- e:
+		return nil
+	default:
+		return fmt.Errorf("rate limited sink buffer full, dropping event %q", e.summary())
+	}
+}
+
+// backlog returns the number of queued events.
+func (r *rateLimitedSink) backlog() int {
+	return len(r.queue)
+}
+
+// Close waits until the queued events have been delivered as the rate limit allows, then closes the wrapped sink if it implements io.Closer.
+// The events that are still queued at the close deadline are written to the dead-letter file, and the wrapped sink is closed once the event being sent (if any) has been, for up to rateLimitedDrainTimeout.
+func (r *rateLimitedSink) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.queue)
+	r.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(closeDeadline()))
+	defer timer.Stop()
+	var err error
+	select {
+	case <-r.done:
+	case <-timer.C:
+		err = fmt.Errorf("rate limited sink closed with %d events not delivered", len(r.queue))
+		r.cancel()
+		select {
+		case <-r.done:
+		case <-time.After(rateLimitedDrainTimeout):
+		}
+	}
+	r.cancel()
+	if c, ok := r.sink.(io.Closer); ok {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// run delivers queued events as the rate limit allows.
+func (r *rateLimitedSink) run() {
+	defer close(r.done)
+	for e := range r.queue {
+		if err := r.limiter.Wait(r.ctx); err != nil {
+			r.policy.fail(e, fmt.Errorf("rate limited sink closed before event %q was delivered", e.summary()))
+			continue
+		}
+		r.policy.deliver(e, r.sink.Send)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitedSinkClose(t *testing.T) {
+	s := newMemorySink("rate", 0, 0, "")
+	r := newRateLimitedSink(s, 600, retryPolicy{sink: "rate"})
+	for i := 0; i < 3; i++ {
+		if err := r.Send(event{Type: eventCreated, Message: "queued"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Events()); n != 3 {
+		t.Errorf("got %d events delivered, want the 3 queued", n)
+	}
+	if err := r.Send(event{Type: eventCreated}); err == nil {
+		t.Error("got no error sending to a closed sink")
+	}
+}
+
+func TestExecSinkClose(t *testing.T) {
+	s := newExecSink("sleep 0.2", 2, time.Minute, retryPolicy{sink: "exec"})
+	start := time.Now()
+	if err := s.Send(event{Type: eventCreated}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("closed after %s, want after the command finished", d)
+	}
+	if n := s.backlog(); n != 0 {
+		t.Errorf("got %d commands running after closing, want 0", n)
+	}
+}
+
+func TestTeamsSinkClose(t *testing.T) {
+	s := newTeamsSink("http://127.0.0.1:0", time.Hour)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimitedSinkRetry(t *testing.T) {
+	s := newMemorySink("rate", 0, 2, "")
+	r := newRateLimitedSink(s, 6000, retryPolicy{sink: "rate", retries: 2})
+	if err := r.Send(event{Type: eventCreated, Message: "retried"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Events()); n != 1 {
+		t.Errorf("got %d events delivered, want the event delivered after 2 retries", n)
+	}
+}
+
+// closeRecorder is a sink that records whether it has been closed.
+type closeRecorder struct {
+	*memorySink
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRateLimitedSinkCloseTimeout(t *testing.T) {
+	grace := shutdownGrace
+	shutdownGrace = 50 * time.Millisecond
+	t.Cleanup(func() { shutdownGrace = grace })
+	s := &closeRecorder{memorySink: newMemorySink("rate", 0, 0, "")}
+	// The first event is delivered at once, and the others would wait a minute each.
+	r := newRateLimitedSink(s, 1, retryPolicy{sink: "rate"})
+	for i := 0; i < 3; i++ {
+		if err := r.Send(event{Type: eventCreated, Message: "queued"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err == nil {
+		t.Error("got no error closing with events not delivered")
+	}
+	select {
+	case <-r.done:
+	default:
+		t.Error("closed before the events left were dead-lettered")
+	}
+	if !s.closed {
+		t.Error("the wrapped sink was not closed")
+	}
+	if n := len(s.Events()); n != 1 {
+		t.Errorf("got %d events delivered, want the first", n)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import "sync/atomic"
+
+// The overflow policies decide what happens to an event for a sink whose queue is full.
+const (
+	// overflowBlock waits for room in the queue, holding up the bus and so every other sink.
+	overflowBlock = "block"
+	// overflowDropOldest drops the oldest queued event to make room for the new one.
+	overflowDropOldest = "drop-oldest"
+	// overflowDropNewest drops the new event.
+	overflowDropNewest = "drop-newest"
+)
+
+// validOverflow reports whether an overflow policy exists.
+func validOverflow(policy string) bool {
+	return policy == overflowBlock || policy == overflowDropOldest || policy == overflowDropNewest
+}
+
+// sinkQueue is a bounded queue of events for one sink, so that a slow or broken sink neither holds up the others nor uses unbounded memory.
+type sinkQueue struct {
+	policy  string
+	events  chan event
+	done    chan struct{}
+	dropped int64 // Accessed atomically.
+}
+
+// newSinkQueue creates a queue with room for size events.
+func newSinkQueue(size int, policy string) *sinkQueue {
+	return &sinkQueue{policy: policy, events: make(chan event, size), done: make(chan struct{})}
+}
+
+// push queues an event according to the overflow policy, returning the event that was dropped to make room, if any.
+func (q *sinkQueue) push(e event) (dropped event, ok bool) {
+	switch q.policy {
+	case overflowBlock:
+		q.events <- e
+	case overflowDropOldest:
+		for !q.tryPush(e) {
+			select {
+			case dropped = <-q.events:
+				atomic.AddInt64(&q.dropped, 1)
+				ok = true
+			default:
+			}
+		}
+	default:
+		if !q.tryPush(e) {
+			atomic.AddInt64(&q.dropped, 1)
+			return e, true
+		}
+	}
+	return dropped, ok
+}
+
+// tryPush queues an event if there is room.
+func (q *sinkQueue) tryPush(e event) bool {
+	select {
+	case q.events <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+// run passes the queued events to send until the queue is closed.
+func (q *sinkQueue) run(send func(event)) {
+	defer close(q.done)
+	for e := range q.events {
+		send(e)
+	}
+}
+
+// close stops the queue and waits until the queued events have been sent.
+func (q *sinkQueue) close() {
+	close(q.events)
+	<-q.done
+}
+
+// backlog returns the number of queued events.
+func (q *sinkQueue) backlog() int {
+	return len(q.events)
+}
+
+// droppedCount returns the number of events dropped because the queue was full.
+func (q *sinkQueue) droppedCount() int64 {
+	return atomic.LoadInt64(&q.dropped)
+}
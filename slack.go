@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+)
+
+// slackSink posts a one-line message per event to a Slack incoming webhook.
+type slackSink struct {
+	url string
+}
+
+// Send posts an event as a message.
+// See https://api.slack.com/messaging/webhooks
+func (s *slackSink) Send(e event) error {
+	if e.Pod == nil {
+		return postJSON(s.url, map[string]string{"text": e.summary()})
+	}
+
+	text := fmt.Sprintf("%s%s: *%s/%s*", clusterPrefix(e.Cluster), e.title(), e.Namespace, e.Pod.Name)
+	if e.Pod.Status.Phase != "" {
+		text += fmt.Sprintf(" (%s", e.Pod.Status.Phase)
+		if reason := podReason(e.Pod); reason != "" {
+			text += ", " + reason
+		}
+		text += ")"
+	}
+	return postJSON(s.url, map[string]string{"text": text})
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// sloMinReadyAnnotation sets the number of ready pods that a workload needs to be available, in place of -slo-min-ready. It is read from the workload's pods, so it goes in the pod template.
+const sloMinReadyAnnotation = "pod-event-watcher/slo-min-ready"
+
+// sloBurnWindow is the short window that the burn rate is calculated over, which shows whether the error budget is being used up now.
+const sloBurnWindow = time.Hour
+
+// sloReportMax is the number of workloads named in each SLO report.
+const sloReportMax = 10
+
+// sloBucket is the time a workload was watched within a bucket of time, and the part of it that the workload was available.
+type sloBucket struct {
+	good, total time.Duration
+}
+
+// sloWorkload is the availability of a workload: its ready pods, and its available time in hourly buckets over the window and in minutely buckets over sloBurnWindow.
+type sloWorkload struct {
+	minReady int
+	pods     map[types.UID]bool // UID -> ready.
+	// since is the time up to which the workload's time has been added to the buckets.
+	since   time.Time
+	hours   map[int64]*sloBucket
+	minutes map[int64]*sloBucket
+}
+
+// sloStatus is the availability of a workload, for SLO reports and metrics.
+type sloStatus struct {
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace"`
+	Workload  string `json:"workload"`
+	// Availability is the fraction of the watched time within the window that the workload had at least its minimum number of ready pods.
+	Availability float64 `json:"availability"`
+	// BurnRate is the rate that the error budget was used over the last hour, where 1 uses it up in exactly the window.
+	BurnRate float64 `json:"burnRate"`
+}
+
+// sloTracker tracks the fraction of time that each workload had at least a minimum number of ready pods, from the Ready transitions of its pods as they are published, and how fast it is using up the error budget of an objective.
+// Time without any pods is not counted, as a workload that has been deleted or scaled to zero cannot be told apart from one whose pods have all gone.
+type sloTracker struct {
+	objective float64
+	minReady  int
+	window    time.Duration
+
+	mu        sync.Mutex
+	workloads map[workloadKey]*sloWorkload
+}
+
+// slos tracks the availability of the workloads if enabled with the -slo-objective flag, and is otherwise nil.
+var slos *sloTracker
+
+// The SLO metric instruments, which report nothing until slos is set.
+var (
+	_, _ = meter.Float64ObservableGauge("pod_event_watcher.slo.availability",
+		metric.WithDescription("Fraction of the time within -slo-window that each workload had at least its minimum number of ready pods."),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			if slos == nil {
+				return nil
+			}
+			for _, s := range slos.statuses(time.Now()) {
+				o.Observe(s.Availability, metric.WithAttributes(attribute.String("cluster", s.Cluster), attribute.String("namespace", s.Namespace), attribute.String("workload", s.Workload)))
+			}
+			return nil
+		}))
+	_, _ = meter.Float64ObservableGauge("pod_event_watcher.slo.burn_rate",
+		metric.WithDescription("Rate at which each workload used up its error budget over the last hour, where 1 uses it up in exactly -slo-window."),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			if slos == nil {
+				return nil
+			}
+			for _, s := range slos.statuses(time.Now()) {
+				o.Observe(s.BurnRate, metric.WithAttributes(attribute.String("cluster", s.Cluster), attribute.String("namespace", s.Namespace), attribute.String("workload", s.Workload)))
+			}
+			return nil
+		}))
+)
+
+// newSLOTracker creates an sloTracker for an objective such as 0.999, where each workload needs minReady ready pods unless its pods say otherwise, over a window such as 30 days.
+func newSLOTracker(objective float64, minReady int, window time.Duration) (*sloTracker, error) {
+	if objective <= 0 || objective >= 1 {
+		return nil, fmt.Errorf("-slo-objective must be more than 0 and less than 1")
+	}
+	if minReady < 1 {
+		return nil, fmt.Errorf("-slo-min-ready must be at least 1")
+	}
+	if window < sloBurnWindow {
+		return nil, fmt.Errorf("-slo-window must be at least %s", sloBurnWindow)
+	}
+	return &sloTracker{objective: objective, minReady: minReady, window: window, workloads: make(map[workloadKey]*sloWorkload)}, nil
+}
+
+// observe records the readiness of the pod of an event. Pods without a controller are not part of a workload, so they are not tracked.
+func (s *sloTracker) observe(e event) {
+	if e.Pod == nil || metav1.GetControllerOf(e.Pod) == nil {
+		return
+	}
+	key := workloadKey{cluster: e.cluster(), namespace: e.Namespace, workload: workload(e.Pod)}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workloads[key]
+	if !ok {
+		w = &sloWorkload{pods: make(map[types.UID]bool), since: now, hours: make(map[int64]*sloBucket), minutes: make(map[int64]*sloBucket)}
+		s.workloads[key] = w
+	}
+	s.advance(w, now)
+	if e.Type == eventDeleted {
+		delete(w.pods, e.Pod.UID)
+	} else {
+		w.pods[e.Pod.UID] = podReady(e.Pod)
+	}
+	w.minReady = s.minReady
+	if n, err := strconv.Atoi(e.Pod.Annotations[sloMinReadyAnnotation]); err == nil && n > 0 {
+		w.minReady = n
+	}
+}
+
+// forgetCluster forgets the workloads of a cluster that is no longer watched.
+func (s *sloTracker) forgetCluster(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.workloads {
+		if key.cluster == name {
+			delete(s.workloads, key)
+		}
+	}
+}
+
+// available reports whether a workload has at least its minimum number of ready pods.
+func (w *sloWorkload) available() bool {
+	ready := 0
+	for _, r := range w.pods {
+		if r {
+			ready++
+		}
+	}
+	return ready >= w.minReady
+}
+
+// advance adds a workload's time since it was last advanced to its buckets, as available or not as it has been since then, and forgets the buckets that have left the window.
+func (s *sloTracker) advance(w *sloWorkload, now time.Time) {
+	if len(w.pods) > 0 {
+		good := w.available()
+		addSLOTime(w.hours, w.since, now, time.Hour, good)
+		addSLOTime(w.minutes, w.since, now, time.Minute, good)
+	}
+	w.since = now
+	for i := range w.hours {
+		if now.Sub(time.Unix(0, (i+1)*int64(time.Hour))) >= s.window {
+			delete(w.hours, i)
+		}
+	}
+	for i := range w.minutes {
+		if now.Sub(time.Unix(0, (i+1)*int64(time.Minute))) >= sloBurnWindow {
+			delete(w.minutes, i)
+		}
+	}
+}
+
+// addSLOTime adds the time from one time to another to the buckets of a width that it falls in.
+func addSLOTime(buckets map[int64]*sloBucket, from, to time.Time, width time.Duration, good bool) {
+	for from.Before(to) {
+		i := from.UnixNano() / int64(width)
+		end := time.Unix(0, (i+1)*int64(width))
+		if end.After(to) {
+			end = to
+		}
+		b, ok := buckets[i]
+		if !ok {
+			b = &sloBucket{}
+			buckets[i] = b
+		}
+		b.total += end.Sub(from)
+		if good {
+			b.good += end.Sub(from)
+		}
+		from = end
+	}
+}
+
+// sumSLOTime returns the time in buckets, and the part of it that was available.
+func sumSLOTime(buckets map[int64]*sloBucket) (good, total time.Duration) {
+	for _, b := range buckets {
+		good, total = good+b.good, total+b.total
+	}
+	return good, total
+}
+
+// statuses returns the availability and burn rate of each workload that has been watched, sorted by cluster, namespace and workload, and forgets the workloads that have had no pods for the whole window.
+func (s *sloTracker) statuses(now time.Time) []sloStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var statuses []sloStatus
+	for key, w := range s.workloads {
+		s.advance(w, now)
+		good, total := sumSLOTime(w.hours)
+		if total == 0 {
+			if len(w.pods) == 0 {
+				delete(s.workloads, key)
+			}
+			continue
+		}
+		status := sloStatus{Cluster: key.cluster, Namespace: key.namespace, Workload: key.workload, Availability: float64(good) / float64(total)}
+		if good, total := sumSLOTime(w.minutes); total > 0 {
+			status.BurnRate = (1 - float64(good)/float64(total)) / (1 - s.objective)
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Workload < b.Workload
+	})
+	return statuses
+}
+
+// report returns an slo-report event naming the workloads that are below the objective over the window or using up their error budget faster than it lasts, with the fastest first.
+func (s *sloTracker) report(now time.Time) event {
+	statuses := s.statuses(now)
+	var failing []sloStatus
+	for _, st := range statuses {
+		if st.Availability < s.objective || st.BurnRate > 1 {
+			failing = append(failing, st)
+		}
+	}
+	sort.SliceStable(failing, func(i, j int) bool { return failing[i].BurnRate > failing[j].BurnRate })
+	objective := strconv.FormatFloat(s.objective*100, 'f', -1, 64) + "%"
+	message := fmt.Sprintf("all %d workloads met %s over the last %s", len(statuses), objective, s.window)
+	if len(failing) > 0 {
+		message = fmt.Sprintf("%d of %d workloads below %s or burning their error budget", len(failing), len(statuses), objective)
+		if len(failing) > sloReportMax {
+			failing = failing[:sloReportMax]
+		}
+		items := make([]string, len(failing))
+		for i, st := range failing {
+			items[i] = fmt.Sprintf("%s%s/%s %.3f%% (burn rate %.1f)", clusterPrefix(st.Cluster), st.Namespace, st.Workload, st.Availability*100, st.BurnRate)
+		}
+		message += ": " + strings.Join(items, ", ")
+	}
+	return event{Type: eventSLOReport, Time: now, Message: message, SLOs: failing}
+}
+
+// reportSLOs publishes an SLO report every interval.
+func reportSLOs(interval time.Duration) {
+	for range time.Tick(interval) {
+		publish(slos.report(time.Now()))
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// sloPod returns a pod of the StatefulSet web, ready or not.
+func sloPod(uid types.UID, ready bool, annotations map[string]string) *v1.Pod {
+	controller := true
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "web-" + string(uid), Namespace: "default", UID: uid, Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "web", Controller: &controller}},
+		},
+		Status: v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}}},
+	}
+}
+
+// onlySLOWorkload returns the one workload tracked.
+func onlySLOWorkload(t *testing.T, s *sloTracker) *sloWorkload {
+	t.Helper()
+	if len(s.workloads) != 1 {
+		t.Fatalf("got %d workloads, want 1", len(s.workloads))
+	}
+	for _, w := range s.workloads {
+		return w
+	}
+	return nil
+}
+
+func TestNewSLOTracker(t *testing.T) {
+	tests := []struct {
+		objective float64
+		minReady  int
+		window    time.Duration
+		err       string // Part of the error, or empty if the flags are valid.
+	}{
+		{0.999, 1, 30 * 24 * time.Hour, ""},
+		{0, 1, time.Hour, "-slo-objective"},
+		{1, 1, time.Hour, "-slo-objective"},
+		{0.99, 0, time.Hour, "-slo-min-ready"},
+		{0.99, 1, time.Minute, "-slo-window"},
+	}
+	for _, test := range tests {
+		_, err := newSLOTracker(test.objective, test.minReady, test.window)
+		if (test.err == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("got %v for %v, %d, %s, want an error with %q", err, test.objective, test.minReady, test.window, test.err)
+		}
+	}
+}
+
+func TestAddSLOTime(t *testing.T) {
+	from := time.Date(2024, 1, 31, 10, 50, 0, 0, time.UTC)
+	buckets := make(map[int64]*sloBucket)
+	addSLOTime(buckets, from, from.Add(80*time.Minute), time.Hour, false)
+	addSLOTime(buckets, from.Add(80*time.Minute), from.Add(90*time.Minute), time.Hour, true)
+	hour := from.Truncate(time.Hour).UnixNano() / int64(time.Hour)
+	want := map[int64]sloBucket{
+		hour:     {0, 10 * time.Minute},
+		hour + 1: {0, time.Hour},
+		hour + 2: {10 * time.Minute, 20 * time.Minute},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("got %d buckets, want %d", len(buckets), len(want))
+	}
+	for i, b := range want {
+		if got := buckets[i]; got == nil || *got != b {
+			t.Errorf("got bucket %d %+v, want %+v", i-hour, got, b)
+		}
+	}
+	if good, total := sumSLOTime(buckets); good != 10*time.Minute || total != 90*time.Minute {
+		t.Errorf("got %s of %s available, want 10m0s of 1h30m0s", good, total)
+	}
+}
+
+func TestSLOTracker(t *testing.T) {
+	s, err := newSLOTracker(0.99, 1, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.observe(event{Type: eventCreated, Namespace: "default", Pod: &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "standalone", Namespace: "default"}}})
+	if len(s.workloads) != 0 {
+		t.Fatalf("got %d workloads for a pod without a controller, want none", len(s.workloads))
+	}
+	s.observe(event{Type: eventCreated, Namespace: "default", Pod: sloPod("1", true, nil)})
+	w := onlySLOWorkload(t, s)
+	// Starting on the hour lines the buckets up with the windows.
+	start := w.since.Truncate(time.Hour)
+	w.since = start
+
+	tests := []struct {
+		name                   string
+		change                 func()
+		at                     time.Duration // The time since the workload was first seen.
+		availability, burnRate float64
+		failing                bool
+	}{
+		{"ready", func() {}, 23 * time.Hour, 1, 0, false},
+		{"not ready for the last hour", func() { w.pods["1"] = false }, 24 * time.Hour, 23.0 / 24, 100, true},
+		{"ready again for half an hour", func() { w.pods["1"] = true }, 24*time.Hour + 30*time.Minute, 47.0 / 49, 50, true},
+		{"an hour after recovering", func() {}, 25*time.Hour + 30*time.Minute, 47.0 / 49, 0, true},
+		{"the unavailable hour left the window", func() {}, 48*time.Hour + 30*time.Minute, 1, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.change()
+			statuses := s.statuses(start.Add(test.at))
+			if len(statuses) != 1 {
+				t.Fatalf("got %d statuses, want 1", len(statuses))
+			}
+			got := statuses[0]
+			if got.Workload != "StatefulSet/web" || !costsAbout(got.Availability, test.availability) || !costsAbout(got.BurnRate, test.burnRate) {
+				t.Errorf("got %+v, want availability %v and burn rate %v", got, test.availability, test.burnRate)
+			}
+			report := s.report(start.Add(test.at))
+			if failing := len(report.SLOs) > 0; failing != test.failing {
+				t.Errorf("got report %q, want failing %v", report.Message, test.failing)
+			}
+		})
+	}
+
+	// Once the workload has had no pods for the whole window, it is forgotten.
+	delete(w.pods, "1")
+	if statuses := s.statuses(start.Add(80 * time.Hour)); len(statuses) != 0 || len(s.workloads) != 0 {
+		t.Errorf("got %+v, want the workload without pods forgotten", statuses)
+	}
+}
+
+func TestSLOMinReady(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		available   bool
+	}{
+		{"-slo-min-ready", nil, true},
+		{"annotation", map[string]string{sloMinReadyAnnotation: "2"}, false},
+		{"invalid annotation", map[string]string{sloMinReadyAnnotation: "two"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := newSLOTracker(0.99, 1, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.observe(event{Type: eventCreated, Namespace: "default", Pod: sloPod("1", true, test.annotations)})
+			s.observe(event{Type: eventCreated, Namespace: "default", Pod: sloPod("2", false, test.annotations)})
+			if got := onlySLOWorkload(t, s).available(); got != test.available {
+				t.Errorf("got available %v, want %v", got, test.available)
+			}
+			s.observe(event{Type: eventDeleted, Namespace: "default", Pod: sloPod("2", false, test.annotations)})
+			if w := onlySLOWorkload(t, s); len(w.pods) != 1 {
+				t.Errorf("got pods %v after one was deleted, want 1", w.pods)
+			}
+		})
+	}
+}
+
+func TestSLOReportMessage(t *testing.T) {
+	s, err := newSLOTracker(0.999, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.observe(event{Type: eventCreated, Namespace: "default", Pod: sloPod("1", false, nil)})
+	start := onlySLOWorkload(t, s).since
+	report := s.report(start.Add(30 * time.Minute))
+	if want := "1 of 1 workloads below 99.9% or burning their error budget: default/StatefulSet/web 0.000% (burn rate 1000.0)"; report.Type != eventSLOReport || report.Message != want {
+		t.Errorf("got %s %q, want %q", report.Type, report.Message, want)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mhale/pod-event-watcher/watcher"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+)
+
+// snapshot returns the pods in the cache as a list sorted by namespace and name, in the same form as `kubectl get pods -o yaml`.
+func snapshot(store cache.Store) *v1.PodList {
+	list := &v1.PodList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"}}
+	for _, obj := range store.List() {
+		pod := obj.(*v1.Pod).DeepCopy()
+		pod.APIVersion = "v1"
+		pod.Kind = "Pod"
+		list.Items = append(list.Items, *pod)
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		a, b := list.Items[i], list.Items[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return list
+}
+
+// writeSnapshot writes the pods in the cache as JSON if format is "json", otherwise as YAML.
+// If the usage of the pods is being tracked, each pod has the usage of its containers in an annotation.
+func writeSnapshot(w io.Writer, store cache.Store, format string) error {
+	list := snapshot(store)
+	if podUsage != nil {
+		for i := range list.Items {
+			podUsage.annotate(&list.Items[i])
+		}
+	}
+	var data []byte
+	var err error
+	if format == "json" {
+		data, err = json.MarshalIndent(list, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(list)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// snapshotFile writes the pods in the cache to a file in a directory, named with the current time.
+// The format is given by the extension, which is either "json" or "yaml".
+func snapshotFile(store cache.Store, dir string, format string) (string, error) {
+	path := filepath.Join(dir, "pods-"+time.Now().UTC().Format("20060102T150405")+"."+format)
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := writeSnapshot(file, store, format); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// snapshotFormat returns the snapshot format for a format name, defaulting to YAML.
+func snapshotFormat(name string) string {
+	if strings.EqualFold(name, "json") {
+		return "json"
+	}
+	return "yaml"
+}
+
+// snapshotMain writes the pods in a cluster in the same form as a snapshot of the watcher's cache, but without watching them.
+func snapshotMain(args []string) {
+	flags := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	conn := addConnectionFlags(flags)
+	namespace := flags.String("namespace", metav1.NamespaceAll, "namespace to list the pods of, or a comma-separated list of namespaces")
+	selector := flags.String("selector", "", "selector (label query) to filter on")
+	format := flags.String("format", "yaml", "format of the snapshot (yaml or json)")
+	output := flags.String("output", "", "path of the file to write the snapshot to (default stdout)")
+	withUsage := flags.Bool("usage", false, "add the CPU and memory used by each pod's containers from the metrics API to the pods as the "+usageAnnotation+" annotation")
+	flags.Parse(args)
+
+	clusters, err := conn.newClusters()
+	if err != nil {
+		panic(err.Error())
+	}
+	if len(clusters) > 1 {
+		fmt.Fprintln(os.Stderr, "snapshot: only one cluster can be listed at a time")
+		os.Exit(2)
+	}
+	store, err := listClusterPods(context.Background(), clusters[0].clientset, splitList(*namespace), *selector)
+	if err != nil {
+		panic(err.Error())
+	}
+	if *withUsage {
+		podUsage = newUsageTracker()
+		podUsage.refresh(clusters)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			panic(err.Error())
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := writeSnapshot(w, store, snapshotFormat(*format)); err != nil {
+		panic(err.Error())
+	}
+}
+
+// listClusterPods lists the pods in the given namespaces (or all namespaces if there are none) into a store, a page at a time.
+func listClusterPods(ctx context.Context, clientset kubernetes.Interface, namespaces []string, selector string) (cache.Store, error) {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, namespace := range namespaces {
+		opts := metav1.ListOptions{LabelSelector: selector, Limit: watcher.DefaultPageSize}
+		for {
+			list, err := clientset.CoreV1().Pods(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			for i := range list.Items {
+				store.Add(&list.Items[i])
+			}
+			if list.Continue == "" {
+				break
+			}
+			opts.Continue = list.Continue
+		}
+	}
+	return store, nil
+}
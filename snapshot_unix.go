@@ -0,0 +1,26 @@
+//go:build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// snapshotOnSignal writes a snapshot file each time SIGUSR1 is received.
+func snapshotOnSignal(store cache.Store, dir string, format string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	for range signals {
+		path, err := snapshotFile(store, dir, format)
+		if err != nil {
+			log.Printf("Snapshot error: %v\n", err)
+			continue
+		}
+		log.Printf("Snapshot written to %s\n", path)
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+import (
+	"k8s.io/client-go/tools/cache"
+)
+
+// snapshotOnSignal does nothing, as Windows has no SIGUSR1. Use the /snapshot admin endpoint instead.
+func snapshotOnSignal(store cache.Store, dir string, format string) {}
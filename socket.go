@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// socketBuffer is the number of events queued for each socket client. A client that falls further behind is disconnected.
+	socketBuffer = 1000
+	// socketWriteTimeout is how long a write to a client may take.
+	socketWriteTimeout = 10 * time.Second
+)
+
+// serveSocket listens on a Unix domain socket and streams every event to each client that connects.
+// Each event is sent as JSON preceded by its length as a 4-byte big-endian integer, so that clients do not need to parse the JSON to find where it ends.
+func serveSocket(path string) error {
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Printf("Socket error: %v\n", err)
+				return
+			}
+			go streamSocket(conn)
+		}
+	}()
+	return nil
+}
+
+// streamSocket writes every event to a connection until the client closes it.
+func streamSocket(conn net.Conn) {
+	defer conn.Close()
+	sub, err := events.subscribe("socket", filter{}, socketBuffer)
+	if err != nil {
+		log.Printf("Socket error: %v\n", err)
+		return
+	}
+	defer events.unsubscribe(sub)
+
+	// Anything sent by the client is discarded, but must be read to notice when it closes the connection.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		io.Copy(io.Discard, conn)
+	}()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case e, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("Socket error: %v\n", err)
+				continue
+			}
+			frame := make([]byte, 4+len(data))
+			binary.BigEndian.PutUint32(frame, uint32(len(data)))
+			copy(frame[4:], data)
+			conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+			if _, err := conn.Write(frame); err != nil {
+				return
+			}
+		}
+	}
+}
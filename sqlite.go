@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema creates the events table. The pod and diff columns hold JSON, which can be queried with SQLite's JSON functions.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS events (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	type      TEXT NOT NULL,
+	time      TIMESTAMP NOT NULL,
+	namespace TEXT NOT NULL,
+	name      TEXT NOT NULL,
+	pod       TEXT,
+	diff      TEXT,
+	message   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_time ON events (time);
+CREATE INDEX IF NOT EXISTS events_pod ON events (namespace, name);
+`
+
+// sqliteClusterColumn adds the cluster column to an events table created before it was added. The events recorded before then have an empty cluster.
+const sqliteClusterColumn = `
+ALTER TABLE events ADD COLUMN cluster TEXT NOT NULL DEFAULT '';
+`
+
+// sqliteStore records events in an SQLite database.
+type sqliteStore struct {
+	db     *sql.DB
+	insert *sql.Stmt
+}
+
+// openSQLiteStore opens (or creates) an SQLite database at path.
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	var columns int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('events') WHERE name = 'cluster'`).Scan(&columns); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if columns == 0 {
+		if _, err := db.Exec(sqliteClusterColumn); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS events_cluster ON events (cluster)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+	insert, err := db.Prepare(`INSERT INTO events (cluster, type, time, namespace, name, pod, diff, message) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db, insert: insert}, nil
+}
+
+// Send records an event.
+func (s *sqliteStore) Send(e event) error {
+	pod, err := storedPod(e)
+	if err != nil {
+		return err
+	}
+	diff, err := storedDiff(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.insert.Exec(e.Cluster, string(e.Type), e.Time.UTC(), e.Namespace, e.podName(), nullString(pod), nullString(diff), e.Message)
+	return err
+}
+
+// Prune deletes events older than the maximum age, and then the oldest events beyond the maximum number.
+func (s *sqliteStore) Prune(r retention) (int, error) {
+	var n int64
+	if cutoff := r.cutoff(); !cutoff.IsZero() {
+		result, err := s.db.Exec(`DELETE FROM events WHERE time < ?`, cutoff.UTC())
+		if err != nil {
+			return 0, err
+		}
+		deleted, _ := result.RowsAffected()
+		n += deleted
+	}
+	if r.MaxEvents > 0 {
+		result, err := s.db.Exec(`DELETE FROM events WHERE id <= (SELECT id FROM events ORDER BY id DESC LIMIT 1 OFFSET ?)`, r.MaxEvents)
+		if err != nil {
+			return int(n), err
+		}
+		deleted, _ := result.RowsAffected()
+		n += deleted
+	}
+	return int(n), nil
+}
+
+// Query returns the events matching q.
+func (s *sqliteStore) Query(q eventQuery) ([]event, string, error) {
+	return queryEvents(s.db, q, func(int) string { return "?" })
+}
+
+// Close closes the database.
+func (s *sqliteStore) Close() error {
+	s.insert.Close()
+	return s.db.Close()
+}
+
+// nullString converts JSON to a string column value, storing a missing value as NULL.
+func nullString(b []byte) sql.NullString {
+	return sql.NullString{String: string(b), Valid: b != nil}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// sseBuffer is the number of events queued for each Server-Sent Events client. A client that falls further behind is disconnected.
+	sseBuffer = 1000
+	// sseKeepAlive is the time between comments sent to idle clients, so that proxies do not close the connection.
+	sseKeepAlive = 30 * time.Second
+)
+
+// errSSEClosed is returned when a client disconnects while missed events are being sent.
+var errSSEClosed = errors.New("client disconnected")
+
+// registerSSE adds the /events endpoint to a mux, which streams each event matching the filter parameters as a Server-Sent Event.
+// The filter is given by the events, namespaces and selector parameters, e.g. /events?events=deleted&namespaces=production.
+// Each event's ID is sent as the SSE id field. If there is a journal, a client that reconnects with a Last-Event-ID header (or last-event-id parameter) is first sent the events it missed.
+func registerSSE(mux *http.ServeMux, j *journal) {
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		f, err := filterParams(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("last-event-id")
+		}
+		var after int64
+		if lastID != "" {
+			if after, err = strconv.ParseInt(lastID, 10, 64); err != nil {
+				http.Error(w, fmt.Sprintf("invalid last event ID %q", lastID), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if after > atomic.LoadInt64(&events.lastID) {
+			// The watcher has restarted without a journal, so the IDs have started again.
+			after = 0
+		}
+
+		// Subscribe before reading the journal so that no events are missed in between; any events seen in both are skipped by ID.
+		sub, err := events.subscribe("sse "+r.RemoteAddr, f, sseBuffer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer events.unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		if after > 0 && j != nil {
+			err := j.since(after, func(e event) error {
+				if !sub.matches(e) {
+					return nil
+				}
+				if r.Context().Err() != nil {
+					return errSSEClosed
+				}
+				after = e.ID
+				return writeSSE(w, e)
+			})
+			if err != nil {
+				if err != errSSEClosed {
+					fmt.Fprintf(w, ": journal error: %v\n\n", err)
+				}
+				return
+			}
+			flusher.Flush()
+		}
+
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			case e, ok := <-sub.events:
+				if !ok {
+					if sub.overflowed {
+						fmt.Fprint(w, ": client is not keeping up\n\n")
+					}
+					return
+				}
+				if e.ID <= after {
+					continue
+				}
+				if err := writeSSE(w, e); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// writeSSE writes an event as a Server-Sent Event with its ID. The JSON is on a single line, so it needs no escaping.
+func writeSSE(w http.ResponseWriter, e event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.ID, data)
+	return err
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// publishAndWait publishes an event in the sse namespace with a message, and returns it as delivered to the test sink, with its ID.
+func publishAndWait(t *testing.T, message string) event {
+	t.Helper()
+	publish(event{Type: eventCreated, Namespace: "sse", Message: message, Time: time.Now()})
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, e := range testSink.Events() {
+			if e.Namespace == "sse" && e.Message == message {
+				return e
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no event %q in %v", message, summaries(testSink.Events()))
+	return event{}
+}
+
+// sseStream is a connection to the /events endpoint.
+type sseStream struct {
+	scanner *bufio.Scanner
+}
+
+// connectSSE connects to the /events endpoint of a server with a Last-Event-ID header, if it is not empty.
+func connectSSE(t *testing.T, url, lastID string) (*sseStream, int) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/events?namespaces=sse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != "" {
+		r.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return &sseStream{scanner: bufio.NewScanner(resp.Body)}, resp.StatusCode
+}
+
+// next returns the ID and message of the next event in the stream, skipping comments.
+func (s *sseStream) next(t *testing.T) (int64, string) {
+	t.Helper()
+	var id int64
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id, _ = strconv.ParseInt(strings.TrimPrefix(line, "id: "), 10, 64)
+		case strings.HasPrefix(line, "data: "):
+			var e event
+			if err := e.UnmarshalJSON([]byte(strings.TrimPrefix(line, "data: "))); err != nil {
+				t.Fatal(err)
+			}
+			return id, e.Message
+		}
+	}
+	t.Fatalf("stream ended: %v", s.scanner.Err())
+	return 0, ""
+}
+
+func TestSSEResume(t *testing.T) {
+	testSink.Reset()
+	j, err := openJournal(filepath.Join(t.TempDir(), "events.jsonl"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	// The events are journaled as the bus numbers them, with an event from another namespace in between.
+	var journaled []event
+	for _, message := range []string{"first", "second", "third"} {
+		e := publishAndWait(t, message)
+		journaled = append(journaled, e)
+		if err := j.Send(e); err != nil {
+			t.Fatal(err)
+		}
+		if err := j.Send(event{ID: e.ID, Type: eventCreated, Namespace: "other", Message: "filtered"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	registerSSE(mux, j)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		lastID string
+		want   []string // The messages of the events missed, from the journal.
+	}{
+		{"after the first", strconv.FormatInt(journaled[0].ID, 10), []string{"second", "third"}},
+		{"after the last", strconv.FormatInt(journaled[2].ID, 10), nil},
+		{"without a last event ID", "", nil},
+		{"after a restart", strconv.FormatInt(atomic.LoadInt64(&events.lastID)+1000, 10), nil},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stream, status := connectSSE(t, server.URL, test.lastID)
+			if status != http.StatusOK {
+				t.Fatalf("got status %d, want 200", status)
+			}
+			for _, want := range test.want {
+				if _, got := stream.next(t); got != want {
+					t.Fatalf("got %q, want %q", got, want)
+				}
+			}
+			// The stream continues with the events published after connecting, without repeating any. The client is subscribed before the response starts.
+			live := fmt.Sprintf("live %d", i)
+			published := publishAndWait(t, live)
+			if id, got := stream.next(t); got != live || id != published.ID {
+				t.Errorf("got %d %q, want %d %q", id, got, published.ID, live)
+			}
+		})
+	}
+}
+
+func TestSSEInvalidLastEventID(t *testing.T) {
+	mux := http.NewServeMux()
+	registerSSE(mux, nil)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	if _, status := connectSSE(t, server.URL, "latest"); status != http.StatusBadRequest {
+		t.Errorf("got status %d, want 400", status)
+	}
+}
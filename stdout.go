@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/k0kubun/pp"
+	"sigs.k8s.io/yaml"
+)
+
+// stdoutSink logs each event, optionally with the pod details or differences.
+// The details are a dump of the pod object, or a description of the pod as by kubectl describe, which is given with every event about a pod but updates.
+// This is the default sink when no configuration file is given.
+type stdoutSink struct {
+	details detailsMode
+}
+
+// Send logs an event.
+func (s *stdoutSink) Send(e event) error {
+	log.Println(e.summary())
+	if e.Logs != "" {
+		log.Printf("Logs of container %s:\n%s", e.Container, e.Logs)
+	}
+	if s.details == detailsNone || e.Pod == nil {
+		return nil
+	}
+	if s.details == detailsDescribe && e.Type != eventUpdated {
+		var b strings.Builder
+		describePod(&b, e.cluster(), e.Pod)
+		log.Print(b.String())
+		return nil
+	}
+	switch e.Type {
+	case eventCreated, eventDeleted:
+		if deterministic {
+			data, err := yaml.Marshal(e.Pod)
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(data))
+		} else if e.Type == eventCreated {
+			pp.Println(e.Pod)
+		} else {
+			pp.Print(e.Pod)
+		}
+	case eventUpdated:
+		if e.Diff != nil {
+			log.Printf("Difference: %s\n", pp.Sprint(e.Diff))
+		} else {
+			log.Println("No difference, just a cache update")
+		}
+		if e.Cumulative != nil {
+			log.Printf("Difference since first seen: %s\n", pp.Sprint(e.Cumulative))
+		}
+	}
+	return nil
+}
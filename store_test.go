@@ -0,0 +1,99 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSQLiteStoreClusters(t *testing.T) {
+	s, err := openSQLiteStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	for _, cluster := range []string{"prod", "staging"} {
+		if err := s.Send(event{Cluster: cluster, Type: eventCreated, Time: time.Now(), Namespace: "default", Pod: pod}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range []struct {
+		cluster string
+		want    []string
+	}{
+		{"", []string{"prod", "staging"}},
+		{"prod", []string{"prod"}},
+		{"staging", []string{"staging"}},
+		{"dev", nil},
+	} {
+		results, _, err := s.Query(eventQuery{Cluster: test.cluster})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range results {
+			got = append(got, e.Cluster)
+		}
+		if len(got) != len(test.want) || (len(got) > 0 && got[0] != test.want[0]) || (len(got) > 1 && got[1] != test.want[1]) {
+			t.Errorf("cluster %q: got events from %v, want %v", test.cluster, got, test.want)
+		}
+	}
+}
+
+func TestSQLiteStoreAddsClusterColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	s, err := openSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Recreate the table as it was before the cluster column was added.
+	if _, err := s.db.Exec(`DROP TABLE events`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec(`CREATE TABLE events (id INTEGER PRIMARY KEY AUTOINCREMENT, type TEXT NOT NULL, time TIMESTAMP NOT NULL, namespace TEXT NOT NULL, name TEXT NOT NULL, pod TEXT, diff TEXT, message TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec(`INSERT INTO events (type, time, namespace, name, message) VALUES ('created', ?, 'default', 'old', '')`, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if s, err = openSQLiteStore(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Send(event{Cluster: "prod", Type: eventCreated, Time: time.Now(), Namespace: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	results, _, err := s.Query(eventQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Cluster != "" || results[1].Cluster != "prod" {
+		t.Errorf("got %v, want the old event without a cluster and the new one in prod", summaries(results))
+	}
+}
+
+func TestEventQueryMatchesCluster(t *testing.T) {
+	e := event{Cluster: "prod", Type: eventCreated, Namespace: "default"}
+	if !(eventQuery{Cluster: "prod"}).matches(e) {
+		t.Error("got no match for the event's cluster")
+	}
+	if (eventQuery{Cluster: "staging"}).matches(e) {
+		t.Error("got a match for another cluster")
+	}
+}
+
+func TestParseEventQueryCluster(t *testing.T) {
+	q, err := parseEventQuery(map[string][]string{"cluster": {"prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Cluster != "prod" {
+		t.Errorf("got cluster %q, want prod", q.Cluster)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// teamsSink posts adaptive card messages to a Microsoft Teams incoming webhook.
+// Events are collected and sent at most once per interval, grouped by the workload that owns each pod, so that a rollout produces one message rather than one per pod.
+type teamsSink struct {
+	url      string
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]map[eventType][]string // workload -> event type -> pod names (or messages for events without a pod)
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newTeamsSink creates a Teams sink and starts its background sender.
+func newTeamsSink(url string, interval time.Duration) *teamsSink {
+	s := &teamsSink{
+		url:      url,
+		interval: interval,
+		pending:  make(map[string]map[eventType][]string),
+		stop:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Send queues an event for the next message.
+func (s *teamsSink) Send(e event) error {
+	group, item := e.Namespace, e.Message
+	if group == "" {
+		group = "All namespaces"
+	}
+	if e.Pod != nil {
+		group += "/" + workload(e.Pod)
+		item = e.Pod.Name
+	}
+	group = clusterPrefix(e.Cluster) + group
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending[group] == nil {
+		s.pending[group] = make(map[eventType][]string)
+	}
+	s.pending[group][e.Type] = append(s.pending[group][e.Type], item)
+	return nil
+}
+
+// backlog returns the number of workloads waiting to be sent.
+func (s *teamsSink) backlog() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// run sends the queued events every interval until the sink is closed.
+func (s *teamsSink) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.send()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Close stops the background sender and sends the queued events straight away, e.g. when the watcher is shutting down or the sink is replaced by a configuration reload.
+func (s *teamsSink) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.send()
+	return nil
+}
+
+// send sends the queued events in one message, if there are any.
+func (s *teamsSink) send() {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[string]map[eventType][]string)
+	s.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	if err := postJSON(s.url, teamsMessage(pending)); err != nil {
+		log.Printf("Teams error: %v\n", err)
+	}
+}
+
+// teamsMessage builds an adaptive card message with one fact set per workload.
+// See https://learn.microsoft.com/en-us/microsoftteams/platform/task-modules-and-cards/cards/cards-reference#adaptive-card
+func teamsMessage(pending map[string]map[eventType][]string) map[string]interface{} {
+	groups := make([]string, 0, len(pending))
+	for group := range pending {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	body := []interface{}{
+		map[string]interface{}{"type": "TextBlock", "size": "Medium", "weight": "Bolder", "text": "Pod events"},
+	}
+	for _, group := range groups {
+		facts := []interface{}{}
+		for _, t := range eventTypes {
+			if items := pending[group][t]; len(items) > 0 {
+				facts = append(facts, map[string]interface{}{
+					"title": fmt.Sprintf("%s (%d)", t, len(items)),
+					"value": strings.Join(items, ", "),
+				})
+			}
+		}
+		body = append(body,
+			map[string]interface{}{"type": "TextBlock", "weight": "Bolder", "text": group, "wrap": true},
+			map[string]interface{}{"type": "FactSet", "facts": facts},
+		)
+	}
+
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.2",
+					"body":    body,
+				},
+			},
+		},
+	}
+}
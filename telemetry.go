@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// tracer creates the spans for event processing.
+// Until setupTracing is called it is a no-op tracer, so the spans cost almost nothing when tracing is disabled.
+var tracer = otel.Tracer("github.com/mhale/pod-event-watcher")
+
+// telemetryResource describes this program to the telemetry backend.
+var telemetryResource = resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("pod-event-watcher"))
+
+// setupTracing exports spans to an OTLP/HTTP collector at endpoint (host:port).
+// The standard OTEL_EXPORTER_OTLP_* environment variables are also honoured, e.g. for headers.
+func setupTracing(endpoint string, insecure bool) error {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(telemetryResource),
+	)
+	otel.SetTracerProvider(provider)
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+// The formats of the -timestamp-format flag.
+const (
+	// timestampRFC3339 writes times as e.g. 2024-01-31T12:00:00.000Z.
+	timestampRFC3339 = "rfc3339"
+	// timestampUnix writes times as the seconds since the Unix epoch, with milliseconds.
+	timestampUnix = "unix"
+	// timestampRelative writes times as the time since the watcher started, e.g. +1h2m3.456s.
+	timestampRelative = "relative"
+)
+
+// timestampLogLayout is the layout of the rfc3339 timestamps of log lines and the terminal UI, which have milliseconds so that they can be lined up with the API server's and kubelet's logs.
+const timestampLogLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// timestamper writes the times of log lines and events in the format and time zone given by the -timestamp-format and -timezone flags.
+type timestamper struct {
+	format   string
+	location *time.Location
+	start    time.Time
+}
+
+// timestamps writes the times of log lines and events if enabled with the -timestamp-format or -timezone flags, and is otherwise nil, which leaves the log lines with the log package's local date and time, and the events with their local times.
+var timestamps *timestamper
+
+// timestampFlags are the flags for the format and time zone of times, which are shared with the replay subcommand.
+type timestampFlags struct {
+	format   *string
+	timezone *string
+}
+
+// addTimestampFlags adds the flags for the format and time zone of times to a flag set.
+func addTimestampFlags(flags *flag.FlagSet) *timestampFlags {
+	f := &timestampFlags{}
+
+	// Optional format and time zone of the times in log lines and events.
+	f.format = flags.String("timestamp-format", "", "format of the times in log lines, the terminal UI and the events' JSON: rfc3339, unix (seconds since the epoch) or relative (time since the watcher started, for log lines and the terminal UI only) (default the log package's date and time)")
+	f.timezone = flags.String("timezone", "", "time zone of the times in log lines and events, e.g. UTC or Europe/Berlin (default the local time zone)")
+	return f
+}
+
+// setup enables timestamps if either flag is given, and writes the log lines with them.
+func (f *timestampFlags) setup() error {
+	if *f.format == "" && *f.timezone == "" {
+		return nil
+	}
+	t := &timestamper{format: *f.format, location: time.Local, start: time.Now()}
+	switch t.format {
+	case "":
+		t.format = timestampRFC3339
+	case timestampRFC3339, timestampUnix, timestampRelative:
+	default:
+		return fmt.Errorf("-timestamp-format must be rfc3339, unix or relative")
+	}
+	if *f.timezone != "" {
+		var err error
+		if t.location, err = time.LoadLocation(*f.timezone); err != nil {
+			return fmt.Errorf("-timezone: %v", err)
+		}
+	}
+	timestamps = t
+	setLogOutput(log.Writer())
+	return nil
+}
+
+// formatTime returns a time in the format and time zone.
+func (t *timestamper) formatTime(at time.Time) string {
+	switch t.format {
+	case timestampUnix:
+		return strconv.FormatFloat(float64(at.UnixMilli())/1000, 'f', 3, 64)
+	case timestampRelative:
+		return "+" + at.Sub(t.start).Round(time.Millisecond).String()
+	}
+	return at.In(t.location).Format(timestampLogLayout)
+}
+
+// setLogOutput sends the log lines to w, starting each with its time if timestamps are enabled. With -deterministic, the log lines keep having no times.
+func setLogOutput(w io.Writer) {
+	if timestamps == nil || deterministic {
+		log.SetOutput(w)
+		return
+	}
+	log.SetFlags(0)
+	log.SetOutput(&timestampWriter{w: w})
+}
+
+// timestampWriter starts each log line with its time. The log package writes each line with a single Write.
+type timestampWriter struct {
+	w io.Writer
+}
+
+// Write writes a log line after its time.
+func (w *timestampWriter) Write(p []byte) (int, error) {
+	line := append([]byte(timestamps.formatTime(time.Now())+" "), p...)
+	if _, err := w.w.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// MarshalJSON writes an event, with its time as the seconds since the Unix epoch with -timestamp-format=unix.
+// The time is otherwise written as RFC 3339 in the event's time zone, which is the -timezone once it has been published, as relative times cannot be read back from the journal.
+func (e event) MarshalJSON() ([]byte, error) {
+	type plain event
+	if timestamps == nil || timestamps.format != timestampUnix {
+		return json.Marshal(plain(e))
+	}
+	return json.Marshal(struct {
+		plain
+		Time json.Number `json:"time"`
+	}{plain(e), json.Number(timestamps.formatTime(e.Time))})
+}
+
+// UnmarshalJSON reads an event, with its time as either RFC 3339 or the seconds since the Unix epoch, so that journals written with any -timestamp-format can be replayed.
+func (e *event) UnmarshalJSON(data []byte) error {
+	type plain event
+	aux := struct {
+		*plain
+		Time json.RawMessage `json:"time"`
+	}{plain: (*plain)(e)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if len(aux.Time) == 0 || aux.Time[0] == '"' || string(aux.Time) == "null" {
+		return json.Unmarshal(orNull(aux.Time), &e.Time)
+	}
+	seconds, err := strconv.ParseFloat(string(aux.Time), 64)
+	if err != nil {
+		return fmt.Errorf("invalid time %s", aux.Time)
+	}
+	e.Time = time.UnixMilli(int64(math.Round(seconds * 1000)))
+	return nil
+}
+
+// orNull returns JSON null for a missing value.
+func orNull(data json.RawMessage) json.RawMessage {
+	if len(data) == 0 {
+		return json.RawMessage("null")
+	}
+	return data
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventJSONTimestamps(t *testing.T) {
+	at := time.UnixMilli(1700000000123).UTC()
+	tests := []struct {
+		name       string
+		timestamps *timestamper
+		want       string
+	}{
+		{"default", nil, `"time":"2023-11-14T22:13:20.123Z"`},
+		{"rfc3339", &timestamper{format: timestampRFC3339, location: time.UTC}, `"time":"2023-11-14T22:13:20.123Z"`},
+		{"unix", &timestamper{format: timestampUnix, location: time.UTC}, `"time":1700000000.123`},
+		{"relative", &timestamper{format: timestampRelative, location: time.UTC, start: at.Add(-time.Hour)}, `"time":"2023-11-14T22:13:20.123Z"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			saved := timestamps
+			timestamps = test.timestamps
+			t.Cleanup(func() { timestamps = saved })
+
+			data, err := json.Marshal(event{ID: 7, Type: eventCreated, Message: "created", Time: at})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), test.want) || strings.Count(string(data), `"time"`) != 1 {
+				t.Errorf("got %s, want one %s", data, test.want)
+			}
+			var e event
+			if err := json.Unmarshal(data, &e); err != nil {
+				t.Fatal(err)
+			}
+			if !e.Time.Equal(at) || e.ID != 7 || e.Type != eventCreated || e.Message != "created" {
+				t.Errorf("got %+v back, want the event at %v", e, at)
+			}
+		})
+	}
+}
+
+func TestEventUnmarshalJSONTime(t *testing.T) {
+	tests := []struct {
+		data string
+		want time.Time
+		err  bool
+	}{
+		{`{"time":1700000000.123}`, time.UnixMilli(1700000000123), false},
+		{`{"time":1700000000}`, time.Unix(1700000000, 0), false},
+		{`{"time":"2023-11-14T23:13:20.123+01:00"}`, time.UnixMilli(1700000000123), false},
+		{`{}`, time.Time{}, false},
+		{`{"time":null}`, time.Time{}, false},
+		{`{"time":true}`, time.Time{}, true},
+		{`{"time":"yesterday"}`, time.Time{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.data, func(t *testing.T) {
+			var e event
+			err := json.Unmarshal([]byte(test.data), &e)
+			if test.err {
+				if err == nil {
+					t.Errorf("got %v, want an error", e.Time)
+				}
+				return
+			}
+			if err != nil || !e.Time.Equal(test.want) {
+				t.Errorf("got %v, %v, want %v", e.Time, err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// tuiEventLines is the height of the event pane.
+	tuiEventLines = 10
+	// tuiRefresh is the time between refreshes of the pod table from the cache.
+	tuiRefresh = time.Second
+)
+
+// tuiSortColumns are the columns that the pod table can be sorted by, in the order that the s key cycles through them.
+var tuiSortColumns = []string{"Name", "Status", "Restarts", "Age"}
+
+var (
+	tuiTitleStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	tuiHelpStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	tuiTypeStyles = map[eventType]lipgloss.Style{
+		eventCreated: lipgloss.NewStyle().Foreground(lipgloss.Color("2")),
+		eventUpdated: lipgloss.NewStyle().Foreground(lipgloss.Color("4")),
+		eventDeleted: lipgloss.NewStyle().Foreground(lipgloss.Color("1")),
+
+		eventContainerRestarted: lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
+		eventOOMKilled:          lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("9")),
+		eventCrashLoop:          lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("9")),
+		eventCrashLoopRecovered: lipgloss.NewStyle().Foreground(lipgloss.Color("2")),
+		eventPendingTooLong:     lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("3")),
+		eventReadinessFlapping:  lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("3")),
+		eventImageChanged:       lipgloss.NewStyle().Foreground(lipgloss.Color("5")),
+		eventProbeFailed:        lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
+		eventSchedulingFailed:   lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
+		eventOrphaned:           lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("9")),
+		eventTerminating:        lipgloss.NewStyle().Foreground(lipgloss.Color("8")),
+		eventFinalizerRemoved:   lipgloss.NewStyle().Foreground(lipgloss.Color("8")),
+		eventDebugContainer:     lipgloss.NewStyle().Foreground(lipgloss.Color("5")),
+		eventUnrestricted:       lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
+		eventClusterUnreachable: lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("9")),
+		eventClusterRecovered:   lipgloss.NewStyle().Foreground(lipgloss.Color("2")),
+		eventCredentialsExpired: lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("9")),
+		eventCredentialsRenewed: lipgloss.NewStyle().Foreground(lipgloss.Color("2")),
+	}
+	// tuiSeverityStyles are used in place of the type's style for events whose severity was changed by the severity rules, and for types without a style.
+	tuiSeverityStyles = map[severity]lipgloss.Style{
+		severityInfo:     lipgloss.NewStyle(),
+		severityWarning:  lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
+		severityCritical: lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("9")),
+	}
+)
+
+// tuiEventMsg is an event delivered to the terminal UI.
+type tuiEventMsg event
+
+// tuiLogMsg is a log message written to the terminal UI.
+type tuiLogMsg string
+
+// tuiTickMsg triggers a refresh of the pod table.
+type tuiTickMsg time.Time
+
+// tuiModel is the state of the terminal UI: a table of the pods in the cache and a pane of the latest events.
+type tuiModel struct {
+	store   cache.Store
+	msgs    <-chan tea.Msg
+	table   table.Model
+	events  []string
+	sortBy  int
+	reverse bool
+	// grouped shows the workloads in each namespace of each cluster instead of the pods.
+	grouped bool
+	width   int
+	height  int
+}
+
+// tui is the terminal UI shown instead of the log output with -tui.
+// It is a sink, so that it can be connected to the bus before the cache exists, and a log writer, so that log messages do not corrupt the screen.
+type tui struct {
+	msgs chan tea.Msg
+}
+
+// newTUI creates the terminal UI. Nothing is shown until run is called.
+func newTUI() *tui {
+	return &tui{msgs: make(chan tea.Msg, 100)}
+}
+
+// run shows the terminal UI for the pods in a cache until the user quits or the context is cancelled.
+func (t *tui) run(ctx context.Context, store cache.Store) error {
+	m := tuiModel{
+		store: store,
+		msgs:  t.msgs,
+		table: table.New(table.WithColumns(tuiColumns(80)), table.WithFocused(true)),
+	}
+	_, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx)).Run()
+	if err == tea.ErrProgramKilled && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// Send delivers an event to the terminal UI, waiting until there is room for it.
+func (t *tui) Send(e event) error {
+	t.msgs <- tuiEventMsg(e)
+	return nil
+}
+
+// Write shows a log message in the event pane. Messages are dropped rather than holding up the caller if the UI is not keeping up.
+func (t *tui) Write(p []byte) (int, error) {
+	select {
+	case t.msgs <- tuiLogMsg(p):
+	default:
+	}
+	return len(p), nil
+}
+
+// tuiColumns returns the columns of the pod table for a terminal width, giving the spare width to the pod name.
+func tuiColumns(width int) []table.Column {
+	columns := []table.Column{
+		{Title: "Namespace", Width: 16},
+		{Title: "Name", Width: 0},
+		{Title: "Ready", Width: 6},
+		{Title: "Status", Width: 18},
+		{Title: "Restarts", Width: 8},
+		{Title: "Age", Width: 6},
+		{Title: "Node", Width: 20},
+	}
+	used := 0
+	for _, c := range columns {
+		// Each column is padded by one character on each side.
+		used += c.Width + 2
+	}
+	columns[1].Width = width - used - 2
+	if columns[1].Width < 20 {
+		columns[1].Width = 20
+	}
+	return columns
+}
+
+// tuiTick schedules the next refresh of the pod table.
+func tuiTick() tea.Cmd {
+	return tea.Tick(tuiRefresh, func(t time.Time) tea.Msg { return tuiTickMsg(t) })
+}
+
+// wait waits for the next event or log message.
+func (m tuiModel) wait() tea.Cmd {
+	return func() tea.Msg { return <-m.msgs }
+}
+
+// Init starts refreshing the pod table and waiting for events.
+func (m tuiModel) Init() tea.Cmd {
+	return tea.Batch(func() tea.Msg { return tuiTickMsg(time.Now()) }, tuiTick(), m.wait())
+}
+
+// Update handles key presses, resizes, refreshes and events.
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "s":
+			m.sortBy = (m.sortBy + 1) % len(tuiSortColumns)
+			m.refresh()
+			return m, nil
+		case "r":
+			m.reverse = !m.reverse
+			m.refresh()
+			return m, nil
+		case "c":
+			m.grouped = !m.grouped
+			// The rows are cleared first, as the table cannot render rows with fewer cells than it has columns.
+			m.table.SetRows(nil)
+			m.setColumns()
+			m.refresh()
+			return m, nil
+		}
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.setColumns()
+		m.table.SetHeight(max(msg.Height-tuiEventLines-5, 3))
+		return m, nil
+	case tuiTickMsg:
+		m.refresh()
+		return m, tuiTick()
+	case tuiEventMsg:
+		m.addLine(tuiEventLine(event(msg)))
+		return m, m.wait()
+	case tuiLogMsg:
+		m.addLine(tuiHelpStyle.Render(time.Now().Format("15:04:05") + " " + strings.TrimSpace(string(msg))))
+		return m, m.wait()
+	}
+	var cmd tea.Cmd
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+// View renders the pod table, the event pane and a line of help.
+func (m tuiModel) View() string {
+	var b strings.Builder
+	title := "Pods"
+	if m.grouped {
+		title = "Workloads"
+	}
+	b.WriteString(tuiTitleStyle.Render(fmt.Sprintf("%s (%d)", title, len(m.table.Rows()))) + "\n")
+	b.WriteString(m.table.View() + "\n")
+	b.WriteString(tuiTitleStyle.Render("Events") + "\n")
+	for i := 0; i < tuiEventLines; i++ {
+		if i < len(m.events) {
+			b.WriteString(m.events[i])
+		}
+		b.WriteString("\n")
+	}
+	order := "ascending"
+	if m.reverse {
+		order = "descending"
+	}
+	if m.grouped {
+		b.WriteString(tuiHelpStyle.Render("↑/↓: scroll  c: show pods  q: quit"))
+	} else {
+		b.WriteString(tuiHelpStyle.Render(fmt.Sprintf("↑/↓: scroll  s: sort (by %s)  r: reverse (%s)  c: group by cluster  q: quit", tuiSortColumns[m.sortBy], order)))
+	}
+	return b.String()
+}
+
+// addLine adds a line to the top of the event pane.
+func (m *tuiModel) addLine(line string) {
+	if m.width > 0 {
+		line = lipgloss.NewStyle().MaxWidth(m.width).Render(line)
+	}
+	m.events = append([]string{line}, m.events...)
+	if len(m.events) > tuiEventLines {
+		m.events = m.events[:tuiEventLines]
+	}
+}
+
+// setColumns sets the columns of the table for the current view and terminal width.
+func (m *tuiModel) setColumns() {
+	width := m.width
+	if width == 0 {
+		width = 80
+	}
+	if m.grouped {
+		m.table.SetColumns(tuiSummaryColumns(width))
+	} else {
+		m.table.SetColumns(tuiColumns(width))
+	}
+}
+
+// refresh rebuilds the pod table from the cache.
+func (m *tuiModel) refresh() {
+	if m.grouped {
+		m.refreshSummary()
+		return
+	}
+	var pods []*v1.Pod
+	for _, obj := range m.store.List() {
+		pods = append(pods, obj.(*v1.Pod))
+	}
+	name := func(p *v1.Pod) string { return p.Namespace + "/" + p.Name }
+	sort.Slice(pods, func(i, j int) bool {
+		a, b := pods[i], pods[j]
+		if m.reverse {
+			a, b = b, a
+		}
+		switch tuiSortColumns[m.sortBy] {
+		case "Status":
+			if sa, sb := podStatus(a), podStatus(b); sa != sb {
+				return sa < sb
+			}
+		case "Restarts":
+			if ra, rb := restartCount(a), restartCount(b); ra != rb {
+				return ra < rb
+			}
+		case "Age":
+			if ta, tb := a.CreationTimestamp.Time, b.CreationTimestamp.Time; !ta.Equal(tb) {
+				return ta.After(tb)
+			}
+		}
+		return name(a) < name(b)
+	})
+
+	rows := make([]table.Row, 0, len(pods))
+	for _, pod := range pods {
+		rows = append(rows, table.Row{
+			pod.Namespace,
+			pod.Name,
+			readyContainers(pod),
+			podStatus(pod),
+			fmt.Sprint(restartCount(pod)),
+			shortDuration(time.Since(pod.CreationTimestamp.Time)),
+			pod.Spec.NodeName,
+		})
+	}
+	m.table.SetRows(rows)
+}
+
+// tuiSummaryColumns returns the columns of the workload table for a terminal width, giving the spare width to the workload.
+func tuiSummaryColumns(width int) []table.Column {
+	columns := []table.Column{
+		{Title: "Cluster", Width: 16},
+		{Title: "Namespace", Width: 16},
+		{Title: "Workload", Width: 0},
+		{Title: "Pods", Width: 6},
+		{Title: "Events", Width: 8},
+		{Title: "Warnings", Width: 8},
+	}
+	used := 0
+	for _, c := range columns {
+		used += c.Width + 2
+	}
+	columns[2].Width = width - used - 2
+	if columns[2].Width < 20 {
+		columns[2].Width = 20
+	}
+	return columns
+}
+
+// refreshSummary rebuilds the workload table, grouped by cluster and namespace, with the events since the watcher started.
+// The cluster and namespace are only shown on the first row of each group.
+func (m *tuiModel) refreshSummary() {
+	var rows []table.Row
+	var cluster, namespace string
+	for i, w := range fleet.summarize(watchedClusters.list(), false) {
+		warnings := w.eventCount() - w.Events[eventCreated] - w.Events[eventUpdated] - w.Events[eventDeleted]
+		row := table.Row{"", "", w.Workload, fmt.Sprint(w.Pods), fmt.Sprint(w.eventCount()), fmt.Sprint(warnings)}
+		if i == 0 || w.Cluster != cluster {
+			row[0], row[1] = orDash(w.Cluster), w.Namespace
+		} else if w.Namespace != namespace {
+			row[1] = w.Namespace
+		}
+		cluster, namespace = w.Cluster, w.Namespace
+		rows = append(rows, row)
+	}
+	m.table.SetRows(rows)
+}
+
+// tuiEventLine formats an event for the event pane.
+func tuiEventLine(e event) string {
+	style, ok := tuiTypeStyles[e.Type]
+	if !ok || e.severity() != defaultSeverity(e) {
+		style = tuiSeverityStyles[e.severity()]
+	}
+	at := e.Time.Format("15:04:05")
+	if timestamps != nil {
+		at = timestamps.formatTime(e.Time)
+	}
+	line := at + " " + style.Render(fmt.Sprintf("%-8s", e.Type)) + " " + clusterPrefix(e.Cluster)
+	if e.Namespace != "" {
+		line += e.Namespace + "/"
+	}
+	if e.Pod != nil {
+		line += e.Pod.Name
+	}
+	if e.Message != "" {
+		line += " " + e.Message
+	}
+	if len(e.Diff) > 0 {
+		line += " " + tuiHelpStyle.Render(strings.Join(e.Diff, "; "))
+	}
+	return line
+}
+
+// podStatus returns the status of a pod as shown by kubectl get pods, e.g. "Running" or "CrashLoopBackOff".
+func podStatus(pod *v1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+	if reason := podReason(pod); reason != "" {
+		return reason
+	}
+	return string(pod.Status.Phase)
+}
+
+// readyContainers returns the number of ready containers out of the total, e.g. "1/2".
+func readyContainers(pod *v1.Pod) string {
+	ready := 0
+	for _, s := range pod.Status.ContainerStatuses {
+		if s.Ready {
+			ready++
+		}
+	}
+	return fmt.Sprintf("%d/%d", ready, len(pod.Spec.Containers))
+}
+
+// shortDuration formats a duration in the style of kubectl's age column, e.g. "45s", "12m", "5h" or "3d".
+func shortDuration(d time.Duration) string {
+	switch {
+	case d < 2*time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < 2*time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// schedulingSummary matches the start of the scheduler's message for a pod that cannot be scheduled, e.g. "0/5 nodes are available: ".
+var schedulingSummary = regexp.MustCompile(`^(\d+)/(\d+) nodes are available: `)
+
+// schedulingFailure is the reason a pod cannot be scheduled, parsed from the message of its PodScheduled condition so that dashboards can count the reasons.
+type schedulingFailure struct {
+	Available int                `json:"available"`
+	Total     int                `json:"total"`
+	Reasons   []schedulingReason `json:"reasons"`
+}
+
+// schedulingReason is a reason that some of the nodes cannot run a pod.
+type schedulingReason struct {
+	// Category is one of "insufficient", "taint", "affinity", "unschedulable", "volume", "ports" or "other".
+	Category string `json:"category"`
+	// Resource is the resource that the nodes do not have enough of, for the "insufficient" category.
+	Resource string `json:"resource,omitempty"`
+	Nodes    int    `json:"nodes"`
+	Message  string `json:"message"`
+}
+
+// parseSchedulingFailure parses the message of the PodScheduled condition of a pod that cannot be scheduled, e.g.
+// "0/5 nodes are available: 2 Insufficient cpu, 3 node(s) had untolerated taint {dedicated: gpu}. preemption: ...".
+// It returns nil if the pod has been scheduled or the message is not in that form.
+func parseSchedulingFailure(pod *v1.Pod) *schedulingFailure {
+	c := podCondition(pod, v1.PodScheduled)
+	if c == nil || c.Status != v1.ConditionFalse || c.Reason != v1.PodReasonUnschedulable {
+		return nil
+	}
+	m := schedulingSummary.FindStringSubmatch(c.Message)
+	if m == nil {
+		return nil
+	}
+	f := &schedulingFailure{}
+	f.Available, _ = strconv.Atoi(m[1])
+	f.Total, _ = strconv.Atoi(m[2])
+
+	details := strings.TrimPrefix(c.Message, m[0])
+	// The scheduler's reasons for not preempting other pods follow the reasons for not scheduling the pod.
+	if i := strings.Index(details, " preemption: "); i >= 0 {
+		details = details[:i]
+	}
+	details = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(details), "."))
+
+	// Reasons are separated by commas, but some reasons also contain commas (e.g. "had taint {a: b}, that the pod didn't tolerate"), so parts that do not start with a node count belong to the previous reason.
+	for _, part := range strings.Split(details, ", ") {
+		count, rest, ok := strings.Cut(part, " ")
+		nodes, err := strconv.Atoi(count)
+		if !ok || err != nil {
+			if len(f.Reasons) > 0 {
+				r := &f.Reasons[len(f.Reasons)-1]
+				r.Message += ", " + part
+			}
+			continue
+		}
+		f.Reasons = append(f.Reasons, schedulingReason{Nodes: nodes, Message: rest})
+	}
+	for i := range f.Reasons {
+		f.Reasons[i].Category, f.Reasons[i].Resource = schedulingCategory(f.Reasons[i].Message)
+	}
+	return f
+}
+
+// schedulingCategory returns the category of a scheduling failure reason, and the resource for the "insufficient" category.
+func schedulingCategory(reason string) (string, string) {
+	lower := strings.ToLower(reason)
+	switch {
+	case strings.HasPrefix(reason, "Insufficient "):
+		return "insufficient", strings.TrimPrefix(reason, "Insufficient ")
+	case strings.HasPrefix(reason, "Too many pods"):
+		return "insufficient", "pods"
+	case strings.Contains(lower, "taint"):
+		return "taint", ""
+	case strings.Contains(lower, "affinity"), strings.Contains(lower, "selector"), strings.Contains(lower, "topology spread"):
+		return "affinity", ""
+	case strings.Contains(lower, "unschedulable"):
+		return "unschedulable", ""
+	case strings.Contains(lower, "volume"):
+		return "volume", ""
+	case strings.Contains(lower, "port"):
+		return "ports", ""
+	}
+	return "other", ""
+}
+
+// sameSchedulingReasons reports whether two scheduling failures have the same reasons for the same numbers of nodes.
+func sameSchedulingReasons(a, b *schedulingFailure) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if len(a.Reasons) != len(b.Reasons) {
+		return false
+	}
+	for i := range a.Reasons {
+		if a.Reasons[i] != b.Reasons[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// schedulingFailed returns an event if a pod update shows that the pod cannot be scheduled, or that the reasons have changed.
+// The scheduler retries unschedulable pods and updates the condition each time, so other updates are ignored.
+func schedulingFailed(e event, oldPod *v1.Pod) (event, bool) {
+	if e.Type != eventUpdated {
+		return event{}, false
+	}
+	f := parseSchedulingFailure(e.Pod)
+	if f == nil || sameSchedulingReasons(f, parseSchedulingFailure(oldPod)) {
+		return event{}, false
+	}
+	return event{
+		Type:       eventSchedulingFailed,
+		Time:       e.Time,
+		Namespace:  e.Namespace,
+		Pod:        e.Pod,
+		Message:    podCondition(e.Pod, v1.PodScheduled).Message,
+		Scheduling: f,
+		ctx:        e.ctx,
+	}, true
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// usageAnnotation holds the usage of each container in the pods written by snapshots.
+	usageAnnotation = "pod-event-watcher/usage"
+	// usageTimeout is how long listing the usage of the pods in a cluster may take.
+	usageTimeout = 30 * time.Second
+)
+
+// containerUsage is the CPU and memory that a container is using, as reported by the metrics API, with its requests and limits.
+type containerUsage struct {
+	Container     string `json:"container"`
+	CPU           string `json:"cpu"`
+	Memory        string `json:"memory"`
+	CPURequest    string `json:"cpuRequest,omitempty"`
+	CPULimit      string `json:"cpuLimit,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	MemoryLimit   string `json:"memoryLimit,omitempty"`
+}
+
+// String describes the usage, e.g. "app: cpu 120m (request 100m, limit 500m), memory 200Mi (request 128Mi, limit 256Mi)".
+func (u containerUsage) String() string {
+	return fmt.Sprintf("%s: cpu %s%s, memory %s%s", u.Container, u.CPU, requestLimit(u.CPURequest, u.CPULimit), u.Memory, requestLimit(u.MemoryRequest, u.MemoryLimit))
+}
+
+// requestLimit describes a request and limit in parentheses, or returns an empty string if neither is set.
+func requestLimit(request, limit string) string {
+	var s []string
+	if request != "" {
+		s = append(s, "request "+request)
+	}
+	if limit != "" {
+		s = append(s, "limit "+limit)
+	}
+	if len(s) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(s, ", ") + ")"
+}
+
+// podMetricsList is the part of a metrics.k8s.io PodMetricsList that is used, decoded without depending on the metrics client.
+type podMetricsList struct {
+	Items []struct {
+		Metadata struct {
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		} `json:"metadata"`
+		Containers []struct {
+			Name  string          `json:"name"`
+			Usage v1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// usageTracker keeps the latest usage of the pods' containers in each cluster from the metrics API, which is served by metrics-server.
+type usageTracker struct {
+	mu sync.RWMutex
+	// usage maps each cluster's name to the usage of its containers by "namespace/name" of the pod and then container name.
+	usage map[string]map[string]map[string]v1.ResourceList
+	// failing records the clusters whose usage could not be listed, so that each failure is only logged once.
+	failing map[string]bool
+}
+
+// podUsage keeps the usage of the pods' containers if enabled with the -usage-interval flag, and is otherwise nil.
+var podUsage *usageTracker
+
+// newUsageTracker creates an empty usageTracker.
+func newUsageTracker() *usageTracker {
+	return &usageTracker{usage: make(map[string]map[string]map[string]v1.ResourceList), failing: make(map[string]bool)}
+}
+
+// refreshPeriodically lists the usage of the pods in the watched clusters now and then every interval.
+func (u *usageTracker) refreshPeriodically(interval time.Duration) {
+	u.refresh(watchedClusters.list())
+	for range time.Tick(interval) {
+		u.refresh(watchedClusters.list())
+	}
+}
+
+// refresh lists the usage of the pods in the clusters, replacing the previous usage.
+// A cluster whose usage cannot be listed, e.g. because it has no metrics-server, has no usage until it can be.
+func (u *usageTracker) refresh(clusters []*cluster) {
+	refreshed := make(map[string]map[string]map[string]v1.ResourceList)
+	for _, c := range clusters {
+		pods, err := c.listUsage()
+		u.mu.Lock()
+		if err != nil && !u.failing[c.name] {
+			log.Printf("%sUsage error: %v\n", clusterPrefix(c.name), err)
+		}
+		u.failing[c.name] = err != nil
+		u.mu.Unlock()
+		if err == nil {
+			refreshed[c.name] = pods
+		}
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.usage = refreshed
+}
+
+// listUsage lists the usage of each container of the pods in a cluster from the metrics API.
+func (c *cluster) listUsage() (map[string]map[string]v1.ResourceList, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), usageTimeout)
+	defer cancel()
+	data, err := c.clientset.Discovery().RESTClient().Get().AbsPath("/apis/metrics.k8s.io/v1beta1/pods").DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list podMetricsList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	pods := make(map[string]map[string]v1.ResourceList, len(list.Items))
+	for _, item := range list.Items {
+		containers := make(map[string]v1.ResourceList, len(item.Containers))
+		for _, container := range item.Containers {
+			containers[container.Name] = container.Usage
+		}
+		pods[item.Metadata.Namespace+"/"+item.Metadata.Name] = containers
+	}
+	return pods, nil
+}
+
+// of returns the usage of a pod's containers in a cluster, with their requests and limits, or nil if it is not known.
+// If the cluster's name is empty, the pod is looked for in every cluster, as the pods in a snapshot do not say which cluster they are from.
+func (u *usageTracker) of(clusterName string, pod *v1.Pod) []containerUsage {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	key := pod.Namespace + "/" + pod.Name
+	containerUsages, ok := u.usage[clusterName][key]
+	if !ok && clusterName == "" {
+		for _, pods := range u.usage {
+			if containerUsages, ok = pods[key]; ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil
+	}
+	var usages []containerUsage
+	for _, c := range containers(pod) {
+		used, ok := containerUsages[c.Name]
+		if !ok {
+			continue
+		}
+		usages = append(usages, containerUsage{
+			Container:     c.Name,
+			CPU:           fmt.Sprintf("%dm", used.Cpu().MilliValue()),
+			Memory:        formatBytes(uint64(used.Memory().Value())),
+			CPURequest:    cpuString(c.Resources.Requests[v1.ResourceCPU]),
+			CPULimit:      cpuString(c.Resources.Limits[v1.ResourceCPU]),
+			MemoryRequest: memoryString(c.Resources.Requests[v1.ResourceMemory]),
+			MemoryLimit:   memoryString(c.Resources.Limits[v1.ResourceMemory]),
+		})
+	}
+	return usages
+}
+
+// annotate adds the usage of a pod's containers to the pod as an annotation, for snapshots.
+func (u *usageTracker) annotate(pod *v1.Pod) {
+	usages := u.of("", pod)
+	if len(usages) == 0 {
+		return
+	}
+	descriptions := make([]string, len(usages))
+	for i, usage := range usages {
+		descriptions[i] = usage.String()
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
+	}
+	pod.Annotations[usageAnnotation] = strings.Join(descriptions, "; ")
+}
+
+// cpuString formats an amount of CPU in millicores, e.g. "120m", or returns an empty string if it is zero.
+func cpuString(q resource.Quantity) string {
+	if q.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%dm", q.MilliValue())
+}
+
+// memoryString formats an amount of memory, e.g. "64Mi", or returns an empty string if it is zero.
+func memoryString(q resource.Quantity) string {
+	if q.IsZero() {
+		return ""
+	}
+	return formatBytes(uint64(q.Value()))
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// chainHashField ends each line of a hash-chained journal, before the closing brace, followed by the line's hash in hex and the closing quote.
+const chainHashField = `,"hash":"`
+
+// verifyMaxProblems is the number of problems with a journal that the verify subcommand lists.
+const verifyMaxProblems = 20
+
+// chainedRecord is a line of a hash-chained journal: an event with the hash of the previous line. The line's own hash is appended by the journal, as it is a hash of the rest of the line.
+type chainedRecord struct {
+	event
+	// Prev is the hash of the previous line, which is empty for the first line of a chain.
+	Prev string `json:"prev,omitempty"`
+}
+
+// MarshalJSON writes the event with the hash of the previous line, as the event's own MarshalJSON would otherwise leave it out.
+func (r chainedRecord) MarshalJSON() ([]byte, error) {
+	data, err := r.event.MarshalJSON()
+	if err != nil || r.Prev == "" {
+		return data, err
+	}
+	prev, err := json.Marshal(r.Prev)
+	if err != nil {
+		return nil, err
+	}
+	data = append(data[:len(data)-1], `,"prev":`...)
+	return append(append(data, prev...), '}'), nil
+}
+
+// UnmarshalJSON reads the event and the hash of the previous line.
+func (r *chainedRecord) UnmarshalJSON(data []byte) error {
+	if err := r.event.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	var prev struct {
+		Prev string `json:"prev"`
+	}
+	if err := json.Unmarshal(data, &prev); err != nil {
+		return err
+	}
+	r.Prev = prev.Prev
+	return nil
+}
+
+// chainHash returns the hash of a chained line without its own hash: SHA-256, or HMAC-SHA256 if there is a key.
+func chainHash(data []byte, key []byte) string {
+	if len(key) > 0 {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// encodeChained returns an event as a line of a hash-chained journal following a line with the hash prev, and the line's hash.
+// The hash is of the JSON of the event and prev, and is added to the end of that JSON, so that it can be checked against the exact bytes that were written.
+func encodeChained(e event, prev string, key []byte) ([]byte, string, error) {
+	data, err := json.Marshal(chainedRecord{event: e, Prev: prev})
+	if err != nil {
+		return nil, "", err
+	}
+	hash := chainHash(data, key)
+	line := append(data[:len(data)-1:len(data)-1], chainHashField+hash+`"}`+"\n"...)
+	return line, hash, nil
+}
+
+// splitChained returns a chained line without its hash, and the hash, or false if the line is not chained.
+func splitChained(line []byte) ([]byte, string, bool) {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	i := bytes.LastIndex(line, []byte(chainHashField))
+	if i < 0 || !bytes.HasSuffix(line, []byte(`"}`)) {
+		return nil, "", false
+	}
+	hash := string(line[i+len(chainHashField) : len(line)-2])
+	if len(hash) != sha256.Size*2 {
+		return nil, "", false
+	}
+	return append(line[:i:i], '}'), hash, true
+}
+
+// lastChainHash returns the hash of the last line of a journal, or an empty string if it is empty or its last line is not chained.
+// If every line has been pruned, the chain carries on from the checkpoint.
+func (j *journal) lastChainHash() (string, error) {
+	paths, err := j.files()
+	if err != nil {
+		return "", err
+	}
+	// The newest file may be empty just after rotating, so look back until a line is found.
+	for i := len(paths) - 1; i >= 0; i-- {
+		last, err := lastJournalLine(paths[i])
+		if err != nil {
+			return "", err
+		}
+		if last != nil {
+			_, hash, _ := splitChained(last)
+			return hash, nil
+		}
+	}
+	checkpoint, err := readCheckpoint(j.checkpointPath())
+	if err != nil {
+		return "", err
+	}
+	_, hash, _ := splitChained(checkpoint)
+	return hash, nil
+}
+
+// lastJournalLine returns the last line of a journal file, or nil if it is empty.
+func lastJournalLine(path string) ([]byte, error) {
+	var last []byte
+	err := scanJournalLines(path, func(line []byte) error {
+		last = append(last[:0], line...)
+		return nil
+	})
+	return last, err
+}
+
+// checkpointSuffix is the suffix of a journal's checkpoint file, which keeps the last line of the newest rotated file that has been pruned, so that the first line left can be checked against it.
+const checkpointSuffix = ".checkpoint"
+
+// checkpointPath returns the path of the journal's checkpoint file.
+func (j *journal) checkpointPath() string {
+	return j.path + checkpointSuffix
+}
+
+// readCheckpoint returns the line kept in a checkpoint file, or nil if there is none because nothing has been pruned.
+func readCheckpoint(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return bytes.TrimSpace(data), err
+}
+
+// writeCheckpoint keeps the last line of a pruned file if it is hash-chained, writing a temporary file first so that a crash leaves the previous checkpoint.
+// The line keeps its own hash, so a changed checkpoint is found by verify like a changed line.
+func (j *journal) writeCheckpoint(line []byte) error {
+	if _, _, ok := splitChained(line); !ok {
+		return nil
+	}
+	tmp := j.checkpointPath() + ".tmp"
+	if err := os.WriteFile(tmp, append(line, '\n'), 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.checkpointPath())
+}
+
+// scanJournalLines calls fn for each line of a journal file, which may be compressed. A file that has disappeared is skipped.
+func scanJournalLines(path string, fn func(line []byte) error) error {
+	file, err := openJournalFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// chainVerification is the result of checking the chain of a journal.
+type chainVerification struct {
+	lines, records int
+	first, last    int64
+	// anchor is the hash of the checkpoint, which the first line must follow, or an empty string if nothing has been pruned.
+	anchor           string
+	earliest, latest string
+}
+
+// errChainBroken is returned by verifyChain for a journal that has been changed.
+var errChainBroken = errors.New("the journal has been changed")
+
+// verifyChain checks that every line of a journal's files, oldest first, is chained to the one before it and has the right hash, logging each line that is not to report.
+// The first line must follow the start of the chain, or the line kept in the checkpoint file if files have been pruned, so that removing the oldest lines breaks the chain too.
+func verifyChain(paths []string, checkpoint string, key []byte, report func(path string, line int, problem string)) (chainVerification, error) {
+	var v chainVerification
+	broken := false
+	anchor, err := readCheckpoint(checkpoint)
+	if err != nil {
+		return v, err
+	}
+	if anchor != nil {
+		data, hash, ok := splitChained(anchor)
+		switch {
+		case !ok:
+			report(checkpoint, 1, "the checkpoint is not hash-chained")
+			broken = true
+		case !hmac.Equal([]byte(hash), []byte(chainHash(data, key))):
+			report(checkpoint, 1, fmt.Sprintf("the checkpoint has the hash %s, not %s: it was changed, or the key is wrong", short(hash), short(chainHash(data, key))))
+			broken = true
+		}
+		v.anchor = hash
+	}
+	for _, path := range paths {
+		n := 0
+		err := scanJournalLines(path, func(line []byte) error {
+			n++
+			v.lines++
+			data, hash, ok := splitChained(line)
+			if !ok {
+				report(path, n, "the line is not hash-chained")
+				broken = true
+				return nil
+			}
+			var r chainedRecord
+			if err := json.Unmarshal(data, &r); err != nil {
+				report(path, n, err.Error())
+				broken = true
+				return nil
+			}
+			switch {
+			case v.records > 0 && r.Prev != v.latest:
+				report(path, n, fmt.Sprintf("event %d follows a line with the hash %s, not %s: a line before it was removed, added or changed", r.ID, short(r.Prev), short(v.latest)))
+				broken = true
+			case v.records == 0 && v.anchor == "" && r.Prev != "":
+				report(path, n, fmt.Sprintf("event %d follows a line with the hash %s, but nothing has been pruned: the lines before it were removed", r.ID, short(r.Prev)))
+				broken = true
+			case v.records == 0 && r.Prev != v.anchor:
+				report(path, n, fmt.Sprintf("event %d follows a line with the hash %s, not the checkpoint's %s: the lines before it were removed, or it was changed", r.ID, short(r.Prev), short(v.anchor)))
+				broken = true
+			}
+			if want := chainHash(data, key); !hmac.Equal([]byte(hash), []byte(want)) {
+				report(path, n, fmt.Sprintf("event %d has the hash %s, not %s: it was changed, or the key is wrong", r.ID, short(hash), short(want)))
+				broken = true
+			}
+			if v.records == 0 {
+				v.first, v.earliest = r.ID, hash
+			}
+			v.records++
+			v.last, v.latest = r.ID, hash
+			return nil
+		})
+		if err != nil {
+			return v, err
+		}
+	}
+	if broken {
+		return v, errChainBroken
+	}
+	return v, nil
+}
+
+// short returns the start of a hash for messages, or "none" for the start of a chain.
+func short(hash string) string {
+	if hash == "" {
+		return "none"
+	}
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// readChainKey reads the HMAC key of a chained journal from a file, without the trailing newline. An empty path means no key.
+func readChainKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimRight(data, "\r\n")
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	return key, nil
+}
+
+// verifyMain runs the verify subcommand, which checks that a hash-chained journal and its rotated files have not been changed since they were written.
+func verifyMain(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	journalPath := flags.String("journal", "", "path of the journal file to verify, along with its rotated files")
+	keyFile := flags.String("journal-hmac-key-file", "", "path of the file with the key that the journal's hashes were made with, if any")
+	flags.Parse(args)
+
+	if *journalPath == "" {
+		fmt.Fprintln(os.Stderr, "verify: -journal is required")
+		flags.Usage()
+		os.Exit(2)
+	}
+	key, err := readChainKey(*keyFile)
+	if err != nil {
+		panic(err.Error())
+	}
+	j := &journal{path: *journalPath}
+	paths, err := j.files()
+	if err != nil {
+		panic(err.Error())
+	}
+	// A wrong key makes every line fail, so only the first problems are listed.
+	problems := 0
+	v, err := verifyChain(paths, j.checkpointPath(), key, func(path string, line int, problem string) {
+		if problems++; problems <= verifyMaxProblems {
+			fmt.Printf("FAIL    %s:%d: %s\n", path, line, problem)
+		}
+	})
+	if err != nil && err != errChainBroken {
+		panic(err.Error())
+	}
+	if problems > verifyMaxProblems {
+		fmt.Printf("FAIL    %d more problems\n", problems-verifyMaxProblems)
+	}
+	if v.records == 0 {
+		fmt.Printf("FAIL    %s has no events\n", *journalPath)
+		os.Exit(1)
+	}
+	if err == errChainBroken {
+		os.Exit(1)
+	}
+	start := "the start of the chain"
+	if v.anchor != "" {
+		start = "the checkpoint " + j.checkpointPath() + ", with the hash " + v.anchor
+	}
+	fmt.Printf("ok      %d events in %d lines, %d to %d, in %s\n", v.records, v.lines, v.first, v.last, strings.Join(paths, ", "))
+	fmt.Printf("ok      the first event follows %s\n", start)
+	fmt.Printf("ok      the first event has the hash %s\n", v.earliest)
+	fmt.Printf("ok      the last event has the hash %s\n", v.latest)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chainedLines returns the lines of a hash-chained journal of n events.
+func chainedLines(t *testing.T, n int, key []byte) [][]byte {
+	t.Helper()
+	var lines [][]byte
+	prev := ""
+	for i := 1; i <= n; i++ {
+		line, hash, err := encodeChained(event{ID: int64(i), Type: eventCreated, Namespace: "default", Message: fmt.Sprintf("event %d", i)}, prev, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines, prev = append(lines, line), hash
+	}
+	return lines
+}
+
+// writeJournalFile writes lines to a journal file.
+func writeJournalFile(t *testing.T, path string, lines [][]byte) {
+	t.Helper()
+	if err := os.WriteFile(path, bytes.Join(lines, nil), 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	key := []byte("secret")
+	tests := []struct {
+		name   string
+		change func(lines [][]byte) [][]byte
+		key    []byte
+		want   string // A problem that should be reported, or empty if the chain is unchanged.
+	}{
+		{"unchanged", func(lines [][]byte) [][]byte { return lines }, key, ""},
+		{"edited line", func(lines [][]byte) [][]byte {
+			lines[2] = bytes.Replace(lines[2], []byte("event 3"), []byte("event X"), 1)
+			return lines
+		}, key, "event 3 has the hash"},
+		{"deleted line", func(lines [][]byte) [][]byte {
+			return append(lines[:2:2], lines[3:]...)
+		}, key, "event 4 follows a line with the hash"},
+		{"reordered lines", func(lines [][]byte) [][]byte {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, key, "event 3 follows a line with the hash"},
+		{"deleted first line", func(lines [][]byte) [][]byte {
+			return lines[1:]
+		}, key, "nothing has been pruned"},
+		{"wrong key", func(lines [][]byte) [][]byte { return lines }, []byte("wrong"), "the key is wrong"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "events.jsonl")
+			writeJournalFile(t, path, test.change(chainedLines(t, 5, key)))
+			j := &journal{path: path}
+			var problems []string
+			v, err := verifyChain([]string{path}, j.checkpointPath(), test.key, func(_ string, line int, problem string) {
+				problems = append(problems, fmt.Sprintf("%d: %s", line, problem))
+			})
+			if test.want == "" {
+				if err != nil || len(problems) > 0 {
+					t.Fatalf("got %v %q, want no problems", err, problems)
+				}
+				if v.records != 5 || v.lines != 5 || v.first != 1 || v.last != 5 || v.earliest == "" || v.latest == "" {
+					t.Errorf("got %+v, want 5 events from 1 to 5 with the first and last hashes", v)
+				}
+				return
+			}
+			if err != errChainBroken || !strings.Contains(strings.Join(problems, "\n"), test.want) {
+				t.Errorf("got %v %q, want a problem with %q", err, problems, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyChainAfterPrune(t *testing.T) {
+	key := []byte("secret")
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	lines := chainedLines(t, 6, key)
+	writeJournalFile(t, path+".1", lines[:2])
+	writeJournalFile(t, path+".2", lines[2:4])
+	writeJournalFile(t, path, lines[4:])
+	j := &journal{path: path}
+	verify := func() (chainVerification, []string, error) {
+		paths, err := j.files()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var problems []string
+		v, err := verifyChain(paths, j.checkpointPath(), key, func(_ string, _ int, problem string) {
+			problems = append(problems, problem)
+		})
+		return v, problems, err
+	}
+
+	if n, err := j.Prune(retention{MaxJournalBytes: int64(len(lines[2]) + len(lines[3]))}); err != nil || n != 1 {
+		t.Fatalf("got %d files pruned, %v, want 1", n, err)
+	}
+	v, problems, err := verify()
+	if err != nil || v.first != 3 || v.anchor == "" {
+		t.Fatalf("got %+v %v %q, want the events from 3 following the checkpoint", v, err, problems)
+	}
+
+	// Removing a rotated file without pruning it breaks the chain.
+	if err := os.Remove(path + ".2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, problems, err := verify(); err != errChainBroken || len(problems) != 1 || !strings.Contains(problems[0], "not the checkpoint's") {
+		t.Errorf("got %v %q, want the first event to not follow the checkpoint", err, problems)
+	}
+
+	// So does changing the checkpoint.
+	writeJournalFile(t, path+".2", lines[2:4])
+	checkpoint := bytes.Replace(lines[1], []byte("event 2"), []byte("event X"), 1)
+	writeJournalFile(t, j.checkpointPath(), [][]byte{checkpoint})
+	if _, problems, err := verify(); err != errChainBroken || len(problems) != 1 || !strings.Contains(problems[0], "the checkpoint has the hash") {
+		t.Errorf("got %v %q, want the checkpoint to have the wrong hash", err, problems)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+const (
+	// wasmTimeout is how long a WebAssembly module may take to transform an event before it is stopped.
+	wasmTimeout = time.Second
+	// wasmReloadInterval is the time between checks for changes to the WebAssembly modules.
+	wasmReloadInterval = 5 * time.Second
+)
+
+// wasmTransform runs each event through a WebAssembly module before it is delivered, which can change the event or drop it.
+//
+// The module exports its memory, an alloc function that returns a buffer of the given size for the watcher to write the event into, and a transform function.
+// transform is called with the address and length of the event as JSON, and returns 0 to drop the event, or the address of the new JSON in the upper 32 bits and its length in the lower 32 bits.
+// If the module also exports a free function, it is called with the address and length of the buffer returned by alloc once transform has returned.
+//
+// The module is loaded again when its file changes, so that it can be replaced without restarting the watcher.
+type wasmTransform struct {
+	path string
+
+	mu       sync.Mutex
+	modTime  time.Time
+	runtime  wazero.Runtime
+	module   api.Module
+	alloc    api.Function
+	free     api.Function
+	function api.Function
+}
+
+// newWASMTransform loads a WebAssembly module from a file.
+func newWASMTransform(path string) (*wasmTransform, error) {
+	t := &wasmTransform{path: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.load(info.ModTime()); err != nil {
+		return nil, err
+	}
+	go t.reloadPeriodically()
+	return t, nil
+}
+
+// load compiles and instantiates the module, replacing the previous instance.
+func (t *wasmTransform) load(modTime time.Time) error {
+	code, err := os.ReadFile(t.path)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+	// Modules built as WASI reactors (e.g. with TinyGo or Rust) are initialised by _initialize rather than _start.
+	config := wazero.NewModuleConfig().WithStartFunctions("_initialize").WithStdout(log.Writer()).WithStderr(log.Writer())
+	module, err := runtime.InstantiateWithConfig(ctx, code, config)
+	if err != nil {
+		runtime.Close(ctx)
+		return fmt.Errorf("%s: %v", t.path, err)
+	}
+	alloc, function := module.ExportedFunction("alloc"), module.ExportedFunction("transform")
+	if alloc == nil || function == nil || module.Memory() == nil {
+		runtime.Close(ctx)
+		return fmt.Errorf("%s: module must export memory, alloc and transform", t.path)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.runtime != nil {
+		t.runtime.Close(ctx)
+	}
+	t.modTime, t.runtime, t.module = modTime, runtime, module
+	t.alloc, t.free, t.function = alloc, module.ExportedFunction("free"), function
+	return nil
+}
+
+// reloadPeriodically loads the module again whenever its file is modified. The previous module is kept if the new one cannot be loaded.
+func (t *wasmTransform) reloadPeriodically() {
+	for range time.Tick(wasmReloadInterval) {
+		info, err := os.Stat(t.path)
+		if err != nil {
+			log.Printf("WASM error (%s): %v\n", t.path, err)
+			continue
+		}
+		t.mu.Lock()
+		changed := !info.ModTime().Equal(t.modTime)
+		t.mu.Unlock()
+		if !changed {
+			continue
+		}
+		if err := t.load(info.ModTime()); err != nil {
+			log.Printf("WASM error (%s): %v\n", t.path, err)
+			continue
+		}
+		log.Printf("Reloaded WebAssembly module %s\n", t.path)
+	}
+}
+
+// apply transforms an event, returning false if the module dropped it.
+func (t *wasmTransform) apply(e event) (event, bool, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return e, true, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), wasmTimeout)
+	defer cancel()
+	results, err := t.alloc.Call(ctx, uint64(len(data)))
+	if err != nil {
+		return e, true, err
+	}
+	ptr := uint32(results[0])
+	if !t.module.Memory().Write(ptr, data) {
+		return e, true, fmt.Errorf("alloc returned an invalid buffer")
+	}
+	results, err = t.function.Call(ctx, uint64(ptr), uint64(len(data)))
+	if err != nil {
+		return e, true, err
+	}
+	if results[0] == 0 {
+		return e, false, nil
+	}
+	out, ok := t.module.Memory().Read(uint32(results[0]>>32), uint32(results[0]))
+	if !ok {
+		return e, true, fmt.Errorf("transform returned an invalid buffer")
+	}
+	var transformed event
+	err = json.Unmarshal(out, &transformed)
+	if t.free != nil {
+		if _, err := t.free.Call(ctx, uint64(ptr), uint64(len(data))); err != nil {
+			return e, true, err
+		}
+	}
+	if err != nil {
+		return e, true, err
+	}
+	transformed.ctx = e.ctx
+	return transformed, true, nil
+}
@@ -0,0 +1,32 @@
+package watcher
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ClientsetListWatch lists and watches the pods matching a label selector with a clientset's typed pods client, for Options.ListWatch.
+// Unlike a clientset's RESTClient, this also works with the fake clientset from k8s.io/client-go/kubernetes/fake, so that a Watcher and its Handler can be run against pods created by a test:
+//
+//	clientset := fake.NewSimpleClientset()
+//	w := watcher.New(nil, watcher.Options{ListWatch: watcher.ClientsetListWatch(clientset, "", ""), Handler: handler})
+//	go w.Run(ctx)
+//	clientset.CoreV1().Pods("default").Create(ctx, pod, metav1.CreateOptions{})
+func ClientsetListWatch(clientset kubernetes.Interface, namespace string, selector string) cache.ListerWatcher {
+	pods := clientset.CoreV1().Pods(namespace)
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selector
+			return pods.List(context.Background(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector
+			return pods.Watch(context.Background(), options)
+		},
+	}
+}
@@ -0,0 +1,231 @@
+package watcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-test/deep"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Differ finds the differences between two versions of a pod, which are passed to Handler.PodUpdated.
+type Differ interface {
+	Diff(oldPod, newPod *v1.Pod) []string
+}
+
+// DifferFunc is a function that is a Differ.
+type DifferFunc func(oldPod, newPod *v1.Pod) []string
+
+// Diff calls f.
+func (f DifferFunc) Diff(oldPod, newPod *v1.Pod) []string {
+	return f(oldPod, newPod)
+}
+
+// The Differs provided by the package.
+var (
+	// SemanticDiffer finds the differences with Diff. It is the default Options.Differ.
+	SemanticDiffer Differ = DifferFunc(Diff)
+	// DeepEqualDiffer finds the differences with FullDiff.
+	DeepEqualDiffer Differ = DifferFunc(FullDiff)
+	// JSONPatchDiffer finds the differences with JSONPatch.
+	JSONPatchDiffer Differ = DifferFunc(JSONPatch)
+	// NoDiffer finds no differences, which saves comparing the pods for handlers that do not use them.
+	NoDiffer Differ = DifferFunc(func(oldPod, newPod *v1.Pod) []string { return nil })
+)
+
+// Diff returns the differences between two versions of a pod, leaving out the fields that change without the pod itself changing: the resource version and generation, which change with every update, and the managed fields and kubectl's last applied configuration, which only record how the pod was written.
+func Diff(oldPod, newPod *v1.Pod) []string {
+	return deep.Equal(withoutNoise(oldPod), withoutNoise(newPod))
+}
+
+// FullDiff returns all of the differences between two versions of a pod, including the fields left out by Diff.
+func FullDiff(oldPod, newPod *v1.Pod) []string {
+	return deep.Equal(oldPod, newPod)
+}
+
+// IgnorePaths returns a Differ like d that leaves out the fields matching any of the paths.
+func IgnorePaths(d Differ, paths []Path) Differ {
+	if len(paths) == 0 {
+		return d
+	}
+	return DifferFunc(func(oldPod, newPod *v1.Pod) []string {
+		return d.Diff(withoutPaths(oldPod, paths), withoutPaths(newPod, paths))
+	})
+}
+
+// withoutNoise returns a shallow copy of a pod without the fields left out by Diff, so that the pod in the cache is not changed.
+func withoutNoise(pod *v1.Pod) *v1.Pod {
+	p := *pod
+	p.ResourceVersion, p.Generation, p.ManagedFields = "", 0, nil
+	if _, ok := p.Annotations[lastAppliedAnnotation]; ok {
+		p.Annotations = make(map[string]string, len(pod.Annotations))
+		for k, v := range pod.Annotations {
+			if k != lastAppliedAnnotation {
+				p.Annotations[k] = v
+			}
+		}
+	}
+	return &p
+}
+
+// withoutPaths returns a copy of a pod without the fields matching the paths.
+// The pod is converted to its JSON form, where the paths are removed, and back again; the pod is returned as it is if that fails.
+func withoutPaths(pod *v1.Pod, paths []Path) *v1.Pod {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+	if err != nil {
+		return pod
+	}
+	for _, p := range paths {
+		p.remove(obj)
+	}
+	var p v1.Pod
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &p); err != nil {
+		return pod
+	}
+	return &p
+}
+
+// Path matches fields of a pod by their JSON names, e.g. status.podIP.
+// Map keys that are not names can be given in brackets, e.g. metadata.annotations["example.com/owner"], list elements by their index, e.g. spec.containers[0].image, and [*] matches every key or element, e.g. status.conditions[*].lastTransitionTime.
+type Path []pathStep
+
+// pathStep is one step of a Path: a map key, a list index, or any key or index.
+type pathStep struct {
+	key   string
+	index int
+	any   bool
+}
+
+// ParsePath parses a path such as status.conditions[*].lastTransitionTime.
+func ParsePath(s string) (Path, error) {
+	var path Path
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "[\"") || strings.HasPrefix(s[i:], "['"):
+			// A quoted key may contain dots and brackets, so it ends at the closing quote.
+			end := strings.IndexByte(s[i+2:], s[i+1])
+			if end < 0 || !strings.HasPrefix(s[i+2+end+1:], "]") {
+				return nil, fmt.Errorf("path %q has an unclosed quote", s)
+			}
+			path = append(path, pathStep{key: s[i+2 : i+2+end], index: -1})
+			i += end + 4
+		case s[i] == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q has an unclosed [", s)
+			}
+			inner := s[i+1 : i+end]
+			if inner == "*" {
+				path = append(path, pathStep{index: -1, any: true})
+			} else if n, err := strconv.Atoi(inner); err == nil && n >= 0 {
+				path = append(path, pathStep{index: n})
+			} else {
+				return nil, fmt.Errorf("path %q has %q in brackets, which is not *, an index or a quoted key", s, inner)
+			}
+			i += end + 1
+		case s[i] == '.' && i > 0:
+			i++
+			fallthrough
+		default:
+			end := strings.IndexAny(s[i:], ".[")
+			if end < 0 {
+				end = len(s) - i
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("path %q has an empty name", s)
+			}
+			name := s[i : i+end]
+			if name == "*" {
+				path = append(path, pathStep{index: -1, any: true})
+			} else {
+				path = append(path, pathStep{key: name, index: -1})
+			}
+			i += end
+		}
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("path is empty")
+	}
+	return path, nil
+}
+
+// ParsePaths parses a comma-separated list of paths. Commas in quoted keys do not separate the paths.
+func ParsePaths(s string) ([]Path, error) {
+	var paths []Path
+	start, quote := 0, byte(0)
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && quote != 0 {
+			if s[i] == quote {
+				quote = 0
+			}
+			continue
+		}
+		if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+			quote = s[i]
+			continue
+		}
+		if i < len(s) && s[i] != ',' {
+			continue
+		}
+		if field := strings.TrimSpace(s[start:i]); field != "" {
+			p, err := ParsePath(field)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, p)
+		}
+		start = i + 1
+	}
+	return paths, nil
+}
+
+// String returns the path in the form parsed by ParsePath.
+func (p Path) String() string {
+	var b strings.Builder
+	for i, s := range p {
+		switch {
+		case s.any:
+			b.WriteString("[*]")
+		case s.index >= 0:
+			fmt.Fprintf(&b, "[%d]", s.index)
+		case strings.ContainsAny(s.key, ".,[]*\"' ") || s.key == "":
+			fmt.Fprintf(&b, "[%q]", s.key)
+		default:
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(s.key)
+		}
+	}
+	return b.String()
+}
+
+// remove deletes the fields matching the path from a pod in its JSON form.
+// A matching list element is set to null rather than removed, so that the indexes of the other elements do not change.
+func (p Path) remove(obj interface{}) {
+	step, last := p[0], len(p) == 1
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if step.any || (step.index < 0 && k == step.key) {
+				if last {
+					delete(v, k)
+				} else {
+					p[1:].remove(child)
+				}
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if step.any || i == step.index {
+				if last {
+					v[i] = nil
+				} else {
+					p[1:].remove(child)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package watcher
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParsePaths(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string // The paths in the form returned by String.
+		err  string   // Part of the error, or empty if the paths are valid.
+	}{
+		{"status.podIP", []string{"status.podIP"}, ""},
+		{"status.podIP, metadata.labels", []string{"status.podIP", "metadata.labels"}, ""},
+		{"spec.containers[0].image", []string{"spec.containers[0].image"}, ""},
+		{"status.conditions[*].lastTransitionTime", []string{"status.conditions[*].lastTransitionTime"}, ""},
+		{"metadata.annotations.*", []string{"metadata.annotations[*]"}, ""},
+		{`metadata.annotations["example.com/owner"]`, []string{`metadata.annotations["example.com/owner"]`}, ""},
+		{`metadata.annotations['a,b'],status.podIP`, []string{`metadata.annotations["a,b"]`, "status.podIP"}, ""},
+		{"status.podIP,,", []string{"status.podIP"}, ""},
+		{"", nil, ""},
+		{`metadata.annotations["example.com/owner`, nil, "unclosed quote"},
+		{"spec.containers[0", nil, "unclosed ["},
+		{"spec.containers[first]", nil, "not *, an index or a quoted key"},
+		{"spec.containers[-1]", nil, "not *, an index or a quoted key"},
+		{"status..podIP", nil, "empty name"},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			paths, err := ParsePaths(test.in)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %v, want an error with %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range paths {
+				got = append(got, p.String())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// diffPods returns two versions of a pod that differ in their IP, an annotation, the image of the first container and the time of each condition.
+func diffPods() (oldPod, newPod *v1.Pod) {
+	oldPod = &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: map[string]string{"example.com/owner": "alice"}},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "app:1"}, {Name: "proxy", Image: "proxy:1"}}},
+		Status: v1.PodStatus{
+			PodIP: "10.0.0.1",
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodReady, Status: v1.ConditionTrue, LastTransitionTime: metav1.Unix(1, 0)},
+				{Type: v1.ContainersReady, Status: v1.ConditionTrue, LastTransitionTime: metav1.Unix(1, 0)},
+			},
+		},
+	}
+	newPod = oldPod.DeepCopy()
+	newPod.Annotations["example.com/owner"] = "bob"
+	newPod.Spec.Containers[0].Image = "app:2"
+	newPod.Status.PodIP = "10.0.0.2"
+	for i := range newPod.Status.Conditions {
+		newPod.Status.Conditions[i].LastTransitionTime = metav1.Unix(2, 0)
+	}
+	return oldPod, newPod
+}
+
+func TestIgnorePaths(t *testing.T) {
+	tests := []struct {
+		paths string
+		want  int // The number of differences left.
+	}{
+		{"", 5},
+		{"status.podIP", 4},
+		{`metadata.annotations["example.com/owner"]`, 4},
+		{"metadata.annotations", 4},
+		{"spec.containers[0].image", 4},
+		{"spec.containers[1].image", 5},
+		{"spec.containers[*].image", 4},
+		{"status.conditions[0].lastTransitionTime", 4},
+		{"status.conditions[*].lastTransitionTime", 3},
+		{"status", 2},
+		{"status.podIP,metadata.annotations,spec.containers[*].image,status.conditions[*].lastTransitionTime", 0},
+		{"status.hostIP", 5},
+	}
+	for _, test := range tests {
+		t.Run(test.paths, func(t *testing.T) {
+			paths, err := ParsePaths(test.paths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldPod, newPod := diffPods()
+			original := newPod.DeepCopy()
+			diff := IgnorePaths(SemanticDiffer, paths).Diff(oldPod, newPod)
+			if len(diff) != test.want {
+				t.Errorf("got %d differences %q, want %d", len(diff), diff, test.want)
+			}
+			if !reflect.DeepEqual(newPod, original) {
+				t.Errorf("got the pod changed to %+v", newPod)
+			}
+		})
+	}
+}
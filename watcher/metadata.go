@@ -0,0 +1,44 @@
+package watcher
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/tools/cache"
+)
+
+// metadataListWatch lists and watches only the metadata of the pods, as PartialObjectMetadata, converting each to a pod with only its ObjectMeta set.
+func metadataListWatch(client metadata.Interface, namespace string, selector string) cache.ListerWatcher {
+	pods := client.Resource(v1.SchemeGroupVersion.WithResource(v1.ResourcePods.String())).Namespace(namespace)
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selector
+			list, err := pods.List(context.Background(), options)
+			if err != nil {
+				return nil, err
+			}
+			podList := &v1.PodList{ListMeta: list.ListMeta, Items: make([]v1.Pod, len(list.Items))}
+			for i, item := range list.Items {
+				podList.Items[i] = v1.Pod{ObjectMeta: item.ObjectMeta}
+			}
+			return podList, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector
+			w, err := pods.Watch(context.Background(), options)
+			if err != nil {
+				return nil, err
+			}
+			return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+				if partial, ok := e.Object.(*metav1.PartialObjectMetadata); ok {
+					e.Object = &v1.Pod{ObjectMeta: partial.ObjectMeta}
+				}
+				return e, true
+			}), nil
+		},
+	}
+}
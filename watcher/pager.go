@@ -0,0 +1,51 @@
+package watcher
+
+import (
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultPageSize is the number of pods in each page of a list when Options.PageSize is zero.
+const DefaultPageSize = 500
+
+// pagedListWatch lists the pods a page at a time, using the limit and continue parameters, so that the API server never has to send every pod in one response.
+// The pages are put together into one list for the informer.
+type pagedListWatch struct {
+	cache.ListerWatcher
+	pageSize int64
+}
+
+// List lists the pods in pages.
+// A list from any resource version ("0") is served from the API server's cache, which does not support pages, so the latest pods are listed instead.
+// If the continue token expires before the last page, the pods are listed again in one response.
+func (p *pagedListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	if options.ResourceVersion == "0" {
+		options.ResourceVersion = ""
+	}
+	options.Limit = p.pageSize
+	list := &v1.PodList{}
+	for {
+		obj, err := p.ListerWatcher.List(options)
+		if apierrors.IsResourceExpired(err) && options.Continue != "" {
+			options.Limit, options.Continue = 0, ""
+			return p.ListerWatcher.List(options)
+		}
+		if err != nil {
+			return nil, err
+		}
+		page, ok := obj.(*v1.PodList)
+		if !ok {
+			return obj, nil
+		}
+		list.Items = append(list.Items, page.Items...)
+		list.ListMeta = page.ListMeta
+		if page.Continue == "" {
+			return list, nil
+		}
+		// The later pages are from the same resource version as the first, which is given by the continue token.
+		options.Continue, options.ResourceVersion, options.ResourceVersionMatch = page.Continue, "", ""
+	}
+}
@@ -0,0 +1,91 @@
+package watcher
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// JSONPatch returns the JSON Patch (RFC 6902) operations that turn the old pod into the new pod, one operation as JSON per difference, e.g. {"op":"replace","path":"/status/phase","value":"Running"}.
+// Lists are compared element by element, so an element inserted into a list is reported as changes to the elements after it.
+func JSONPatch(oldPod, newPod *v1.Pod) []string {
+	oldObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(oldPod)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	newObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(newPod)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var ops []string
+	patch(&ops, "", oldObj, newObj)
+	return ops
+}
+
+// patch appends the operations that turn the JSON value a, at a JSON Pointer path, into b.
+func patch(ops *[]string, path string, a, b interface{}) {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(a)+len(b))
+			for k := range a {
+				keys = append(keys, k)
+			}
+			for k := range b {
+				if _, ok := a[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				p := path + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(k)
+				oldValue, inOld := a[k]
+				newValue, inNew := b[k]
+				switch {
+				case !inNew:
+					addOp(ops, "remove", p, nil)
+				case !inOld:
+					addOp(ops, "add", p, newValue)
+				default:
+					patch(ops, p, oldValue, newValue)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok {
+			for i := 0; i < len(a) && i < len(b); i++ {
+				patch(ops, path+"/"+strconv.Itoa(i), a[i], b[i])
+			}
+			for i := len(a); i < len(b); i++ {
+				addOp(ops, "add", path+"/"+strconv.Itoa(i), b[i])
+			}
+			// The extra elements are removed from the end, so that each index is still valid when it is applied.
+			for i := len(a) - 1; i >= len(b); i-- {
+				addOp(ops, "remove", path+"/"+strconv.Itoa(i), nil)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		addOp(ops, "replace", path, b)
+	}
+}
+
+// addOp appends an operation as JSON. A remove operation has no value.
+func addOp(ops *[]string, op, path string, value interface{}) {
+	o := map[string]interface{}{"op": op, "path": path}
+	if op != "remove" {
+		o["value"] = value
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		data = []byte(err.Error())
+	}
+	*ops = append(*ops, string(data))
+}
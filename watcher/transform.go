@@ -0,0 +1,87 @@
+package watcher
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// lastAppliedAnnotation holds the whole manifest of a pod created with kubectl apply.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// TrimPod removes the parts of a pod that are bulky but rarely of interest, the managed fields and the last applied configuration, to reduce the memory used by the cache.
+// It is the default Options.Transform.
+func TrimPod(pod *v1.Pod) {
+	pod.ManagedFields = nil
+	delete(pod.Annotations, lastAppliedAnnotation)
+}
+
+// transformListWatch applies a transform to every pod listed or watched, before the informer caches it.
+// It does the job of the informer's SetTransform, which this version of client-go does not have.
+type transformListWatch struct {
+	cache.ListerWatcher
+	transform func(*v1.Pod)
+}
+
+// List lists the pods and transforms them.
+func (t *transformListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	obj, err := t.ListerWatcher.List(options)
+	if list, ok := obj.(*v1.PodList); ok {
+		for i := range list.Items {
+			t.transform(&list.Items[i])
+		}
+	}
+	return obj, err
+}
+
+// Watch starts a watch that transforms the pods in its events.
+func (t *transformListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := t.ListerWatcher.Watch(options)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		if pod, ok := e.Object.(*v1.Pod); ok {
+			t.transform(pod)
+		}
+		return e, true
+	}), nil
+}
+
+// filterListWatch leaves out the pods that a filter rejects, so that they are neither cached nor passed to the Handler.
+type filterListWatch struct {
+	cache.ListerWatcher
+	filter func(*v1.Pod) bool
+}
+
+// List lists the pods that pass the filter.
+func (f *filterListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	obj, err := f.ListerWatcher.List(options)
+	if list, ok := obj.(*v1.PodList); ok {
+		kept := list.Items[:0]
+		for i := range list.Items {
+			if f.filter(&list.Items[i]) {
+				kept = append(kept, list.Items[i])
+			}
+		}
+		list.Items = kept
+	}
+	return obj, err
+}
+
+// Watch starts a watch that leaves out the events for pods that do not pass the filter.
+// Bookmarks are always passed on, as they only carry the resource version.
+func (f *filterListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := f.ListerWatcher.Watch(options)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		if pod, ok := e.Object.(*v1.Pod); ok && e.Type != watch.Bookmark {
+			return e, f.filter(pod)
+		}
+		return e, true
+	}), nil
+}
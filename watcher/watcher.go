@@ -0,0 +1,436 @@
+// Package watcher watches the pods in a Kubernetes cluster and calls a Handler when they are created, updated or deleted.
+// It is the library behind pod-event-watcher, for programs such as controllers that want to react to pod events themselves:
+//
+//	w := watcher.New(clientset.CoreV1().RESTClient(), watcher.Options{
+//		Namespace: "production",
+//		Handler: watcher.HandlerFuncs{
+//			DeleteFunc: func(ctx context.Context, pod *v1.Pod) {
+//				log.Printf("Pod deleted: %s\n", pod.Name)
+//			},
+//		},
+//	})
+//	w.Run(ctx)
+//
+// The watcher maintains a cache (Store) of pod information. On startup the Handler's PodCreated method is called once for each pod that is currently running, because the running pods are being added to the cache.
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// DefaultResyncPeriod is the resync period used when Options.ResyncPeriod is zero.
+	DefaultResyncPeriod = 5 * time.Minute
+	// DefaultMaxRetries is the number of retries used when Options.MaxRetries is zero.
+	DefaultMaxRetries = 5
+)
+
+// tracer creates a span for each pod event, which is passed to the Handler in its context.
+// It uses the global tracer provider, so the spans are only recorded if the program sets one up.
+var tracer = otel.Tracer("github.com/mhale/pod-event-watcher/watcher")
+
+// Handler is called by a Watcher when pods are created, updated or deleted.
+// Without Workers, the methods are called in sequence, and slow or blocking handlers delay the handling of later events.
+// With Workers, the methods are called concurrently for different pods, but in sequence for each pod.
+type Handler interface {
+	// PodCreated is called when a pod is created.
+	// Pods do not have all of their fields populated at creation time; the information is added with multiple updates after pod creation.
+	PodCreated(ctx context.Context, pod *v1.Pod)
+	// PodUpdated is called when a pod is updated, with the differences between the old and new pod.
+	// Pods are updated multiple times immediately after being created, so expect multiple calls for the same pod.
+	// It is also called every resync period even if nothing has changed, in which case the pods have the same resource version.
+	PodUpdated(ctx context.Context, oldPod, newPod *v1.Pod, diff []string)
+	// PodDeleted is called when a pod is deleted.
+	// Before a pod is deleted, it will be updated with a termination time.
+	// If the watch was interrupted and the deletion was only noticed when listing the pods again, the pod is the last known state.
+	PodDeleted(ctx context.Context, pod *v1.Pod)
+}
+
+// HandlerFuncs is a Handler made of optional functions, in the style of cache.ResourceEventHandlerFuncs.
+type HandlerFuncs struct {
+	CreateFunc func(ctx context.Context, pod *v1.Pod)
+	UpdateFunc func(ctx context.Context, oldPod, newPod *v1.Pod, diff []string)
+	DeleteFunc func(ctx context.Context, pod *v1.Pod)
+}
+
+// PodCreated calls CreateFunc if it is not nil.
+func (h HandlerFuncs) PodCreated(ctx context.Context, pod *v1.Pod) {
+	if h.CreateFunc != nil {
+		h.CreateFunc(ctx, pod)
+	}
+}
+
+// PodUpdated calls UpdateFunc if it is not nil.
+func (h HandlerFuncs) PodUpdated(ctx context.Context, oldPod, newPod *v1.Pod, diff []string) {
+	if h.UpdateFunc != nil {
+		h.UpdateFunc(ctx, oldPod, newPod, diff)
+	}
+}
+
+// PodDeleted calls DeleteFunc if it is not nil.
+func (h HandlerFuncs) PodDeleted(ctx context.Context, pod *v1.Pod) {
+	if h.DeleteFunc != nil {
+		h.DeleteFunc(ctx, pod)
+	}
+}
+
+// Options configures a Watcher.
+type Options struct {
+	// Namespace limits the watch to one namespace. All namespaces are watched if it is empty.
+	Namespace string
+	// Selector limits the watch to pods matching a label selector, e.g. "app=web".
+	Selector string
+	// ResyncPeriod is the time between resyncs, when PodUpdated is called for every pod. DefaultResyncPeriod is used if it is zero.
+	ResyncPeriod time.Duration
+	// Handler is called for each pod event.
+	Handler Handler
+	// PageSize is the number of pods in each page when listing the pods, so that very large clusters are not listed in one response. DefaultPageSize is used if it is zero, and the pods are listed in one response if it is negative.
+	PageSize int64
+	// Filter, if not nil, decides which of the pods are watched. The pods that it returns false for are neither cached nor passed to the Handler.
+	// It must give the same answer for every version of a pod, e.g. by only looking at its namespace and name.
+	Filter func(*v1.Pod) bool
+	// Differ finds the differences between the old and new pod that are passed to PodUpdated. SemanticDiffer is used if it is nil.
+	Differ Differ
+	// Transform is applied to each pod before it is cached and passed to the Handler, e.g. to remove fields that are not needed. TrimPod is used if it is nil.
+	Transform func(*v1.Pod)
+	// ListWatch, if not nil, lists and watches the pods in place of the client given to New, which can then be nil, e.g. ClientsetListWatch for a fake clientset in tests.
+	// Selector is not applied to it, and it is not used with Metadata.
+	ListWatch cache.ListerWatcher
+	// WrapListWatch, if not nil, wraps the ListerWatcher used to list and watch the pods, e.g. to record metrics.
+	WrapListWatch func(cache.ListerWatcher) cache.ListerWatcher
+	// Factory, if not nil, is the informer factory that the pod informer is added to, so that it is shared with the program's other uses of the factory's pod informer and started with the factory's other informers.
+	// The factory's namespace and list options are not used for the pods; Namespace and Selector are used instead.
+	Factory informers.SharedInformerFactory
+	// Metadata, if not nil, is used to watch only the metadata of the pods instead of using the client given to New, which uses much less memory and bandwidth in large clusters.
+	// The pods passed to the Handler then only have their ObjectMeta set, e.g. their names, labels, owners and timestamps.
+	// The pod informer is then not added to the Factory, so that it is not shared with other uses of the factory's pod informer that need whole pods, and Run does not start the factory.
+	Metadata metadata.Interface
+	// WatchErrorHandler, if not nil, is called when listing or watching the pods fails, e.g. because the watcher does not have permission. The informer keeps trying with a backoff.
+	WatchErrorHandler func(err error)
+	// Workers is the number of goroutines that call the Handler. If it is zero, the Handler is called by the informer, so a slow Handler holds up the watch.
+	// Otherwise the informer only adds each event to a queue, which the workers take the events from.
+	Workers int
+	// MaxRetries is the number of times an event that the Handler fails to handle (see Retry) is retried, with exponential backoff, before it is dropped. DefaultMaxRetries is used if it is zero.
+	MaxRetries int
+	// DrainTimeout is how long Run waits, once the context is cancelled, for the workers to handle the events that are already queued, so that they are not lost when the program exits.
+	// If it is zero, Run returns without waiting, and the events that have not been handled are dropped.
+	DrainTimeout time.Duration
+}
+
+// Watcher watches pods and calls a Handler in response to pod events.
+type Watcher struct {
+	handler      Handler
+	differ       Differ
+	factory      informers.SharedInformerFactory
+	informer     cache.SharedIndexInformer
+	workers      int
+	maxRetries   int
+	drainTimeout time.Duration
+	// ctx is the context given to Run, which the Handler is called with. It is guarded by mu.
+	ctx context.Context
+
+	// queue holds the keys of the pods with events waiting in pending, so that each pod is only handled by one worker at a time.
+	queue   workqueue.RateLimitingInterface
+	mu      sync.Mutex
+	pending map[string][]notification
+}
+
+// notification is a pod event waiting to be handled.
+type notification struct {
+	oldPod, pod *v1.Pod
+	deleted     bool
+}
+
+// attemptKey is the context key for the attempt at handling an event.
+type attemptKey struct{}
+
+// attempt records whether the Handler asked for an event to be retried.
+type attempt struct {
+	err error
+}
+
+// Retry is called by a Handler that failed to handle an event because of a transient problem, e.g. a sink being unavailable, with the context it was given.
+// Once the Handler returns, the event is handled again after a backoff, up to Options.MaxRetries times.
+// The later events for the same pod wait until it has been handled, so that they are still handled in order.
+// Retry does nothing unless the Watcher has Workers.
+func Retry(ctx context.Context, err error) {
+	if a, ok := ctx.Value(attemptKey{}).(*attempt); ok {
+		a.err = err
+	}
+}
+
+// New creates a Watcher for the pods available from client, which is usually a clientset's CoreV1().RESTClient(), or from Options.ListWatch.
+// The Watcher does nothing until Run is called.
+func New(client cache.Getter, opts Options) *Watcher {
+	w := &Watcher{handler: opts.Handler, differ: opts.Differ, workers: opts.Workers, maxRetries: opts.MaxRetries, drainTimeout: opts.DrainTimeout}
+	if w.handler == nil {
+		w.handler = HandlerFuncs{}
+	}
+	if w.differ == nil {
+		w.differ = SemanticDiffer
+	}
+	if w.maxRetries == 0 {
+		w.maxRetries = DefaultMaxRetries
+	}
+	if w.workers > 0 {
+		w.queue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "pods")
+		w.pending = make(map[string][]notification)
+	}
+	resyncPeriod := opts.ResyncPeriod
+	if resyncPeriod == 0 {
+		resyncPeriod = DefaultResyncPeriod
+	}
+
+	// Apply the specified selector as a filter.
+	optionsModifier := func(options *metav1.ListOptions) {
+		options.LabelSelector = opts.Selector
+	}
+	var lw cache.ListerWatcher
+	switch {
+	case opts.Metadata != nil:
+		lw = metadataListWatch(opts.Metadata, opts.Namespace, opts.Selector)
+	case opts.ListWatch != nil:
+		lw = opts.ListWatch
+	default:
+		lw = cache.NewFilteredListWatchFromClient(client, v1.ResourcePods.String(), opts.Namespace, optionsModifier)
+	}
+	pageSize := opts.PageSize
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > 0 {
+		lw = &pagedListWatch{ListerWatcher: lw, pageSize: pageSize}
+	}
+	if opts.Filter != nil {
+		lw = &filterListWatch{ListerWatcher: lw, filter: opts.Filter}
+	}
+	transform := opts.Transform
+	if transform == nil {
+		transform = TrimPod
+	}
+	lw = &transformListWatch{ListerWatcher: lw, transform: transform}
+	if opts.WrapListWatch != nil {
+		lw = opts.WrapListWatch(lw)
+	}
+
+	newInformer := func(kubernetes.Interface, time.Duration) cache.SharedIndexInformer {
+		return cache.NewSharedIndexInformer(lw, &v1.Pod{}, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	}
+	if opts.Factory != nil && opts.Metadata == nil {
+		w.factory = opts.Factory
+		w.informer = opts.Factory.InformerFor(&v1.Pod{}, newInformer)
+	} else {
+		w.informer = newInformer(nil, resyncPeriod)
+	}
+
+	if opts.WatchErrorHandler != nil {
+		// This only fails if the informer has already been started, e.g. by the Factory.
+		w.informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+			opts.WatchErrorHandler(err)
+			cache.DefaultWatchErrorHandler(r, err)
+		})
+	}
+
+	// Note: The AddFunc handler will be called for each existing pod when first starting the informer.
+	// Note: The UpdateFunc handler will be called every resync period, even if nothing has changed.
+	w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    w.podCreated,
+		DeleteFunc: w.podDeleted,
+		UpdateFunc: w.podUpdated,
+	})
+	return w
+}
+
+// Run watches the pods until the context is cancelled. The Handler is called with a context derived from it.
+// If the Watcher was created with a Factory, the factory's informers that have not been started are started too.
+// With workers, Run then waits up to the DrainTimeout for the events already queued to be handled.
+func (w *Watcher) Run(ctx context.Context) {
+	w.mu.Lock()
+	w.ctx = ctx
+	w.mu.Unlock()
+	if w.queue != nil {
+		var workers sync.WaitGroup
+		for i := 0; i < w.workers; i++ {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				wait.UntilWithContext(ctx, w.work, time.Second)
+			}()
+		}
+		defer w.drain(&workers)
+	}
+	if w.factory == nil {
+		w.informer.Run(ctx.Done())
+		return
+	}
+	w.factory.Start(ctx.Done())
+	<-ctx.Done()
+}
+
+// drain shuts down the queue, waiting up to the DrainTimeout for the workers to handle the events that are still queued, which they do until it is empty.
+// The retries of the events that fail are dropped, as the queue no longer accepts them.
+func (w *Watcher) drain(workers *sync.WaitGroup) {
+	if w.drainTimeout <= 0 {
+		w.queue.ShutDown()
+		return
+	}
+	drained := make(chan struct{})
+	go func() {
+		w.queue.ShutDownWithDrain()
+		workers.Wait()
+		close(drained)
+	}()
+	timer := time.NewTimer(w.drainTimeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+	case <-timer.C:
+		utilruntime.HandleError(fmt.Errorf("pod events still queued %s after the watch stopped", w.drainTimeout))
+		// This stops ShutDownWithDrain waiting for the events being handled.
+		w.queue.ShutDown()
+	}
+}
+
+// Store returns the cache of pods.
+func (w *Watcher) Store() cache.Store {
+	return w.informer.GetStore()
+}
+
+// HasSynced reports whether the initial list of pods has been added to the cache.
+func (w *Watcher) HasSynced() bool {
+	return w.informer.HasSynced()
+}
+
+// podCreated is the informer's AddFunc.
+func (w *Watcher) podCreated(obj interface{}) {
+	w.notify(notification{pod: obj.(*v1.Pod)})
+}
+
+// podDeleted is the informer's DeleteFunc.
+// If the watch was interrupted and the deletion was only noticed when listing the pods again, obj is a DeletedFinalStateUnknown holding the last known state of the pod.
+func (w *Watcher) podDeleted(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	w.notify(notification{pod: pod, deleted: true})
+}
+
+// podUpdated is the informer's UpdateFunc.
+func (w *Watcher) podUpdated(oldObj, newObj interface{}) {
+	w.notify(notification{oldPod: oldObj.(*v1.Pod), pod: newObj.(*v1.Pod)})
+}
+
+// notify handles an event straight away if the Watcher has no workers, or queues it for the workers.
+func (w *Watcher) notify(n notification) {
+	if w.queue == nil {
+		w.mu.Lock()
+		ctx := w.ctx
+		w.mu.Unlock()
+		if ctx == nil {
+			// The Factory was started before Run was called.
+			ctx = context.Background()
+		}
+		w.handle(ctx, n)
+		return
+	}
+	key := n.pod.Namespace + "/" + n.pod.Name
+	w.mu.Lock()
+	w.pending[key] = append(w.pending[key], n)
+	w.mu.Unlock()
+	w.queue.Add(key)
+}
+
+// work handles the queued events until the queue is shut down.
+func (w *Watcher) work(ctx context.Context) {
+	for w.handleNext(ctx) {
+	}
+}
+
+// handleNext handles the events waiting for the next pod in the queue, returning false once the queue has been shut down.
+// If an event is to be retried, it and the later events for the pod are put back to be handled after a backoff.
+func (w *Watcher) handleNext(ctx context.Context) bool {
+	item, shutdown := w.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer w.queue.Done(item)
+	key := item.(string)
+	w.mu.Lock()
+	notifications := w.pending[key]
+	delete(w.pending, key)
+	w.mu.Unlock()
+
+	for i, n := range notifications {
+		err := w.handle(ctx, n)
+		if err == nil {
+			continue
+		}
+		if w.queue.NumRequeues(key) < w.maxRetries {
+			w.mu.Lock()
+			w.pending[key] = append(notifications[i:len(notifications):len(notifications)], w.pending[key]...)
+			w.mu.Unlock()
+			w.queue.AddRateLimited(key)
+			return true
+		}
+		utilruntime.HandleError(fmt.Errorf("dropping event for pod %s after %d retries: %v", key, w.maxRetries, err))
+		w.queue.Forget(key)
+	}
+	w.queue.Forget(key)
+	return true
+}
+
+// handle calls the Handler for an event with a context derived from ctx, returning the error passed to Retry if the Handler called it.
+func (w *Watcher) handle(ctx context.Context, n notification) error {
+	a := &attempt{}
+	ctx = context.WithValue(ctx, attemptKey{}, a)
+	switch {
+	case n.deleted:
+		ctx, span := tracer.Start(ctx, "pod deleted", trace.WithAttributes(podAttributes(n.pod)...))
+		defer span.End()
+		w.handler.PodDeleted(ctx, n.pod)
+	case n.oldPod == nil:
+		ctx, span := tracer.Start(ctx, "pod created", trace.WithAttributes(podAttributes(n.pod)...))
+		defer span.End()
+		w.handler.PodCreated(ctx, n.pod)
+	default:
+		ctx, span := tracer.Start(ctx, "pod updated", trace.WithAttributes(podAttributes(n.pod)...))
+		defer span.End()
+
+		_, diffSpan := tracer.Start(ctx, "diff")
+		diff := w.differ.Diff(n.oldPod, n.pod)
+		diffSpan.SetAttributes(attribute.Int("diff.count", len(diff)))
+		diffSpan.End()
+
+		w.handler.PodUpdated(ctx, n.oldPod, n.pod, diff)
+	}
+	return a.err
+}
+
+// podAttributes returns the span attributes that identify a pod.
+func podAttributes(pod *v1.Pod) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("k8s.namespace.name", pod.Namespace),
+		attribute.String("k8s.pod.name", pod.Name),
+		attribute.String("k8s.pod.uid", string(pod.UID)),
+	}
+}
@@ -0,0 +1,273 @@
+package watcher
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// call is one call of a test Handler.
+type call struct {
+	method string
+	pod    *v1.Pod
+	diff   []string
+}
+
+// recorder is a Handler that sends each call to a channel.
+func recorder(calls chan<- call) Handler {
+	return HandlerFuncs{
+		CreateFunc: func(ctx context.Context, pod *v1.Pod) {
+			calls <- call{method: "created", pod: pod}
+		},
+		UpdateFunc: func(ctx context.Context, oldPod, newPod *v1.Pod, diff []string) {
+			calls <- call{method: "updated", pod: newPod, diff: diff}
+		},
+		DeleteFunc: func(ctx context.Context, pod *v1.Pod) {
+			calls <- call{method: "deleted", pod: pod}
+		},
+	}
+}
+
+// watchStarted wraps a ListerWatcher so that started is closed once the first watch has started, after which the fake clientset sends it every change.
+type watchStarted struct {
+	cache.ListerWatcher
+	started chan struct{}
+}
+
+// Watch starts a watch and closes started.
+func (w *watchStarted) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	i, err := w.ListerWatcher.Watch(options)
+	if err == nil {
+		select {
+		case <-w.started:
+		default:
+			close(w.started)
+		}
+	}
+	return i, err
+}
+
+// run starts a Watcher of a fake clientset with opts, and waits until it is watching.
+func run(t *testing.T, clientset *fake.Clientset, opts Options) {
+	t.Helper()
+	runContext(context.Background(), t, clientset, opts)
+}
+
+// runContext starts a Watcher of a fake clientset with opts and a context derived from parent, and waits until it is watching.
+func runContext(parent context.Context, t *testing.T, clientset *fake.Clientset, opts Options) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(parent)
+	t.Cleanup(cancel)
+	lw := &watchStarted{ListerWatcher: ClientsetListWatch(clientset, "", opts.Selector), started: make(chan struct{})}
+	opts.ListWatch = lw
+	opts.ResyncPeriod = time.Hour
+	w := New(nil, opts)
+	go w.Run(ctx)
+	select {
+	case <-lw.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch not started")
+	}
+}
+
+// next returns the next call of the Handler.
+func next(t *testing.T, calls <-chan call) call {
+	t.Helper()
+	select {
+	case c := <-calls:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("Handler not called")
+	}
+	return call{}
+}
+
+// testPod returns a pod in the default namespace.
+func testPod(name string, labels map[string]string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels}}
+}
+
+func TestWatcherCreateUpdateDelete(t *testing.T) {
+	for _, workers := range []int{0, 2} {
+		clientset := fake.NewSimpleClientset(testPod("existing", nil))
+		calls := make(chan call, 10)
+		run(t, clientset, Options{Handler: recorder(calls), Workers: workers})
+		ctx := context.Background()
+
+		if c := next(t, calls); c.method != "created" || c.pod.Name != "existing" {
+			t.Fatalf("workers %d: got %s %s, want the existing pod created", workers, c.method, c.pod.Name)
+		}
+
+		pods := clientset.CoreV1().Pods("default")
+		pod, err := pods.Create(ctx, testPod("web", map[string]string{"app": "web"}), metav1.CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := next(t, calls); c.method != "created" || c.pod.Name != "web" {
+			t.Fatalf("workers %d: got %s %s, want web created", workers, c.method, c.pod.Name)
+		}
+
+		pod.Labels["app"] = "api"
+		if _, err := pods.Update(ctx, pod, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		c := next(t, calls)
+		if c.method != "updated" || c.pod.Name != "web" {
+			t.Fatalf("workers %d: got %s %s, want web updated", workers, c.method, c.pod.Name)
+		}
+		if len(c.diff) != 1 || !strings.Contains(c.diff[0], "web != api") {
+			t.Errorf("workers %d: got diff %q, want the label change", workers, c.diff)
+		}
+
+		if err := pods.Delete(ctx, "web", metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if c := next(t, calls); c.method != "deleted" || c.pod.Name != "web" || c.pod.Labels["app"] != "api" {
+			t.Fatalf("workers %d: got %s %s, want web deleted with its last labels", workers, c.method, c.pod.Name)
+		}
+	}
+}
+
+func TestWatcherOptions(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	calls := make(chan call, 10)
+	run(t, clientset, Options{
+		Handler: recorder(calls),
+		Filter: func(pod *v1.Pod) bool {
+			return !strings.HasPrefix(pod.Name, "ignored")
+		},
+		Differ: NoDiffer,
+	})
+	ctx := context.Background()
+	pods := clientset.CoreV1().Pods("default")
+	for _, pod := range []*v1.Pod{testPod("ignored", map[string]string{"app": "web"}), testPod("web", map[string]string{"app": "web"})} {
+		if _, err := pods.Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c := next(t, calls); c.method != "created" || c.pod.Name != "web" {
+		t.Fatalf("got %s %s, want only the pod not filtered out created", c.method, c.pod.Name)
+	}
+
+	pod := testPod("web", map[string]string{"app": "web", "version": "2"})
+	if _, err := pods.Update(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if c := next(t, calls); c.method != "updated" || c.diff != nil {
+		t.Fatalf("got %s with diff %q, want an update without differences", c.method, c.diff)
+	}
+	select {
+	case c := <-calls:
+		t.Fatalf("unexpected %s %s", c.method, c.pod.Name)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatcherRetry(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	calls := make(chan int, 10)
+	attempts := 0
+	run(t, clientset, Options{
+		Workers:    1,
+		MaxRetries: 2,
+		Handler: HandlerFuncs{
+			CreateFunc: func(ctx context.Context, pod *v1.Pod) {
+				attempts++
+				if attempts < 3 {
+					Retry(ctx, context.DeadlineExceeded)
+				}
+				calls <- attempts
+			},
+		},
+	})
+	if _, err := clientset.CoreV1().Pods("default").Create(context.Background(), testPod("web", nil), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for want := 1; want <= 3; want++ {
+		select {
+		case got := <-calls:
+			if got != want {
+				t.Fatalf("got attempt %d, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("attempt %d not made", want)
+		}
+	}
+}
+
+// contextKey is the key of a value in the context given to Run.
+type contextKey struct{}
+
+func TestWatcherContext(t *testing.T) {
+	for _, workers := range []int{0, 1} {
+		values := make(chan interface{}, 10)
+		ctx := context.WithValue(context.Background(), contextKey{}, "run")
+		runContext(ctx, t, fake.NewSimpleClientset(testPod("existing", nil)), Options{
+			Workers: workers,
+			Handler: HandlerFuncs{
+				CreateFunc: func(ctx context.Context, pod *v1.Pod) {
+					values <- ctx.Value(contextKey{})
+				},
+			},
+		})
+		select {
+		case v := <-values:
+			if v != "run" {
+				t.Errorf("workers %d: got context value %v, want the value from the context given to Run", workers, v)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("workers %d: Handler not called", workers)
+		}
+	}
+}
+
+func TestWatcherDrain(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testPod("a", nil), testPod("b", nil), testPod("c", nil))
+	started, release := make(chan struct{}, 3), make(chan struct{})
+	var handled []string
+	w := New(nil, Options{
+		ListWatch:    ClientsetListWatch(clientset, "", ""),
+		ResyncPeriod: time.Hour,
+		Workers:      1,
+		DrainTimeout: 5 * time.Second,
+		Handler: HandlerFuncs{
+			CreateFunc: func(ctx context.Context, pod *v1.Pod) {
+				started <- struct{}{}
+				<-release
+				handled = append(handled, pod.Name)
+			},
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Handler not called")
+	}
+	// The other pods are still queued when the watch stops.
+	for deadline := time.Now().Add(5 * time.Second); w.queue.Len() < 2 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+	if len(handled) != 3 {
+		t.Errorf("got %v handled, want all 3 queued pods", handled)
+	}
+}
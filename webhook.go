@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// webhookSink posts each event as JSON to a URL.
+// With a secret, each request is signed so that the receiver can check that it came from the watcher and is not a replay of an old one.
+type webhookSink struct {
+	url    string
+	secret []byte
+}
+
+// newWebhookSink creates a webhook sink, which signs its requests with the secret in secretFile if it is given.
+func newWebhookSink(url, secretFile string) (*webhookSink, error) {
+	s := &webhookSink{url: url}
+	if secretFile != "" {
+		data, err := os.ReadFile(secretFile)
+		if err != nil {
+			return nil, fmt.Errorf("webhook sink: %v", err)
+		}
+		if s.secret = bytes.TrimRight(data, "\r\n"); len(s.secret) == 0 {
+			return nil, fmt.Errorf("webhook sink: %s is empty", secretFile)
+		}
+	}
+	return s, nil
+}
+
+// Send posts an event.
+func (s *webhookSink) Send(e event) error {
+	if s.secret == nil {
+		return postJSON(s.url, e)
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return postBody(s.url, body, webhookSignature(s.secret, time.Now(), body))
+}
+
+// webhookSignature returns the headers that sign a request's body at a time: X-Signature-Timestamp is the time in Unix seconds, and X-Signature is "sha256=" and the hex HMAC-SHA256 of the timestamp, a full stop and the body, as in GitHub's X-Hub-Signature-256.
+// The timestamp is signed along with the body, so that the receiver can reject requests that are too old to be anything but a replay. Each retry is signed again with the time it is made.
+func webhookSignature(secret []byte, t time.Time, body []byte) http.Header {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	header := make(http.Header)
+	header.Set("X-Signature-Timestamp", timestamp)
+	header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	header := webhookSignature([]byte("secret"), time.Unix(1700000000, 0), []byte(`{"type":"created"}`))
+	if got := header.Get("X-Signature-Timestamp"); got != "1700000000" {
+		t.Errorf("got timestamp %q, want 1700000000", got)
+	}
+	// HMAC-SHA256 with the key "secret" of `1700000000.{"type":"created"}`.
+	if got, want := header.Get("X-Signature"), "sha256=abd297bcf8cef16a25963bef3c9a06616b8b542144b46aa6342a2ceec6998e25"; got != want {
+		t.Errorf("got signature %q, want %q", got, want)
+	}
+}
+
+func TestWebhookSinkSigning(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret []byte
+		signed bool
+	}{
+		{"with a secret", []byte("secret"), true},
+		{"without a secret", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got *http.Request
+			var body []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				body, _ = io.ReadAll(r.Body)
+			}))
+			defer server.Close()
+			s := &webhookSink{url: server.URL, secret: test.secret}
+			if err := s.Send(event{Type: eventCreated, Message: "signed"}); err != nil {
+				t.Fatal(err)
+			}
+			timestamp, signature := got.Header.Get("X-Signature-Timestamp"), got.Header.Get("X-Signature")
+			if !test.signed {
+				if timestamp != "" || signature != "" {
+					t.Errorf("got X-Signature-Timestamp %q and X-Signature %q, want neither", timestamp, signature)
+				}
+				return
+			}
+			if !strings.Contains(string(body), `"signed"`) {
+				t.Errorf("got body %s, want the event", body)
+			}
+			unix, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil || time.Since(time.Unix(unix, 0)) > time.Minute {
+				t.Fatalf("got timestamp %q, want the time of the request", timestamp)
+			}
+			if want := webhookSignature(test.secret, time.Unix(unix, 0), body).Get("X-Signature"); signature != want {
+				t.Errorf("got signature %q, want %q for the timestamp and body", signature, want)
+			}
+		})
+	}
+}
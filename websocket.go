@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsBuffer is the number of events queued for each WebSocket connection. A client that falls further behind is disconnected.
+	wsBuffer = 1000
+	// wsPingInterval is the time between pings sent to each client.
+	wsPingInterval = 30 * time.Second
+	// wsPongTimeout is how long to wait for any message, including a pong, before assuming that the client has gone.
+	wsPongTimeout = 2 * wsPingInterval
+	// wsWriteTimeout is how long a write to a client may take.
+	wsWriteTimeout = 10 * time.Second
+)
+
+// wsUpgrader accepts connections from any origin, since the admin endpoints are not meant to be exposed to untrusted networks.
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// registerWebSocket adds the /ws endpoint to a mux, which pushes each event matching the filter parameters to the client as a JSON text message.
+// The filter is given by the events, namespaces and selector parameters, e.g. /ws?events=deleted&namespaces=production.
+func registerWebSocket(mux *http.ServeMux) {
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		f, err := filterParams(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sub, err := events.subscribe("ws "+r.RemoteAddr, f, wsBuffer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer events.unsubscribe(sub)
+		conn, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has already responded with an error.
+			return
+		}
+		defer conn.Close()
+		streamWebSocket(conn, sub)
+	})
+}
+
+// streamWebSocket writes the subscription's events to a connection until either side closes it or the client stops responding to pings.
+func streamWebSocket(conn *websocket.Conn, sub *subscription) {
+	// Messages from the client are discarded, but must be read to handle pongs and closes.
+	gone := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-gone:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case e, ok := <-sub.events:
+			if !ok {
+				reason := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+				if sub.overflowed {
+					reason = websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client is not keeping up")
+				}
+				conn.WriteControl(websocket.CloseMessage, reason, time.Now().Add(wsWriteTimeout))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+		}
+	}
+}